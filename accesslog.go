@@ -0,0 +1,298 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// AccessLogMethodKey holds the context key of the request method in access logs.
+	AccessLogMethodKey = "http.method"
+	// AccessLogPathKey holds the context key of the request path in access logs.
+	AccessLogPathKey = "http.path"
+	// AccessLogStatusKey holds the context key of the response status code in access logs.
+	AccessLogStatusKey = "http.status"
+	// AccessLogLatencyKey holds the context key of the request latency in access logs, in milliseconds.
+	AccessLogLatencyKey = "http.latencyMs"
+	// AccessLogRequestBytesKey holds the context key of the request body size in access logs.
+	AccessLogRequestBytesKey = "http.requestBytes"
+	// AccessLogResponseBytesKey holds the context key of the response body size in access logs.
+	AccessLogResponseBytesKey = "http.responseBytes"
+	// AccessLogUserAgentKey holds the context key of the request user agent in access logs.
+	AccessLogUserAgentKey = "http.userAgent"
+	// AccessLogRemoteIPKey holds the context key of the client IP in access logs, anonymized per the config.
+	AccessLogRemoteIPKey = "http.remoteIP"
+	// AccessLogProtocolKey holds the context key of the request protocol in access logs, e.g. "HTTP/1.1".
+	AccessLogProtocolKey = "http.protocol"
+)
+
+const (
+	// IPAnonymizationTruncate represents client IPs with their host part zeroed: /24 for IPv4, /48 for IPv6.
+	IPAnonymizationTruncate = "truncate"
+	// IPAnonymizationHash represents client IPs replaced by their HMAC-SHA256 with the config IP hash
+	// key, still grouping requests per client.
+	IPAnonymizationHash = "hash"
+	// IPAnonymizationDrop represents client IPs left out of the access logs.
+	IPAnonymizationDrop = "drop"
+)
+
+const (
+	// RequestIDHeader holds the header carrying the request ID used as access log correlation ID.
+	RequestIDHeader = "X-Request-ID"
+	// TraceParentHeader holds the W3C trace context header, whose trace ID is used as correlation ID
+	// when the request has no RequestIDHeader.
+	TraceParentHeader = "traceparent"
+	// AccessLogCorrelationName holds the correlation name of access logs.
+	AccessLogCorrelationName = "http"
+)
+
+// ErrInvalidIPHashKey is returned when the IP hash key of the access log config can't be loaded or is empty.
+var ErrInvalidIPHashKey = errors.New("invalid IP hash key")
+
+// AccessLogConfig holds the configuration of the HTTP access logs.
+// IPAnonymization: How client IPs are anonymized. One of "IPAnonymization*". Empty keeps them as is.
+// IPHashKeySource: Where the secret key of the "IPAnonymizationHash" HMAC is read from, so hashed IPs
+// can't be reversed by hashing the whole address space. One of "KeySource*". Required with it.
+// IPHashKeyReference: Environment variable name or file path holding the IP hash key.
+// TrustForwardedFor: true if the client IP is read from the X-Forwarded-For header, e.g. behind a
+// trusted load balancer; false to use the connection remote address. The rightmost address is used,
+// the one appended by the load balancer, as the leftmost ones are set by the client.
+// TrustedProxyHops: Number of trusted proxies in front of the load balancer, each appending an
+// X-Forwarded-For address. That many rightmost addresses are skipped.
+type AccessLogConfig struct {
+	IPAnonymization    string `json:"ipAnonymization"`
+	IPHashKeySource    string `json:"ipHashKeySource"`
+	IPHashKeyReference string `json:"ipHashKeyReference"`
+	TrustForwardedFor  bool   `json:"trustForwardedFor"`
+	TrustedProxyHops   int    `json:"trustedProxyHops"`
+}
+
+// Validate checks the access log config, returning every invalid field.
+func (c *AccessLogConfig) Validate() []*ValidationError {
+	v := &validator{}
+	if c.IPAnonymization != "" {
+		v.oneOf("ipAnonymization", c.IPAnonymization, IPAnonymizationTruncate, IPAnonymizationHash, IPAnonymizationDrop)
+	}
+	if c.IPAnonymization == IPAnonymizationHash {
+		v.oneOf("ipHashKeySource", c.IPHashKeySource, KeySourceEnv, KeySourceFile)
+		if c.IPHashKeyReference == "" {
+			v.add("ipHashKeyReference", c.IPHashKeyReference, ConstraintRequired)
+		}
+	}
+	v.nonNegative("trustedProxyHops", int64(c.TrustedProxyHops))
+	return v.errs
+}
+
+// AccessLogData holds the metadata of a served HTTP request.
+// StartedAt: Time the request was received.
+// Method: Request method.
+// Path: Request URL path, without the query string, which may hold secrets.
+// Protocol: Request protocol, e.g. "HTTP/1.1".
+// Status: Response status code.
+// Latency: Time taken to serve the request.
+// RequestBytes: Request body size. -1 if unknown.
+// ResponseBytes: Response body size.
+// UserAgent: Request user agent.
+// RemoteIP: Client IP, anonymized per the config.
+// RequestID: Request ID, from "RequestIDHeader" or "TraceParentHeader". Empty if the request has none.
+type AccessLogData struct {
+	StartedAt     time.Time
+	Method        string
+	Path          string
+	Protocol      string
+	Status        int
+	Latency       time.Duration
+	RequestBytes  int64
+	ResponseBytes int64
+	UserAgent     string
+	RemoteIP      string
+	RequestID     string
+}
+
+// LoadIPHashKey reads the IP hash key. Returns ErrInvalidIPHashKey if it can't be read or is empty.
+func (c *AccessLogConfig) LoadIPHashKey() ([]byte, error) {
+	secret, err := readSecret(c.IPHashKeySource, c.IPHashKeyReference)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIPHashKey, err)
+	}
+	if secret = strings.TrimSpace(secret); secret == "" {
+		return nil, fmt.Errorf("%w: empty %s %q", ErrInvalidIPHashKey, c.IPHashKeySource, c.IPHashKeyReference)
+	}
+	return []byte(secret), nil
+}
+
+// ClientIPResolver returns the anonymized client IPs of requests, per an access log config.
+type ClientIPResolver struct {
+	config  AccessLogConfig
+	hashKey []byte
+}
+
+// NewClientIPResolver returns the client IP resolver of the config, loading its IP hash key in
+// "IPAnonymizationHash" mode.
+func NewClientIPResolver(cfg *AccessLogConfig) (*ClientIPResolver, error) {
+	c := &ClientIPResolver{config: *cfg}
+	if cfg.IPAnonymization == IPAnonymizationHash {
+		key, err := cfg.LoadIPHashKey()
+		if err != nil {
+			return nil, err
+		}
+		c.hashKey = key
+	}
+	return c, nil
+}
+
+// NewAccessLogData returns the access log data of a request answered at now, latency after it was
+// received, with the given status and response body size. A nil resolver keeps the remote address IP as is.
+func NewAccessLogData(ips *ClientIPResolver, r *http.Request, status int, responseBytes int64, latency time.Duration, now time.Time) *AccessLogData {
+	if ips == nil {
+		ips = &ClientIPResolver{}
+	}
+	a := &AccessLogData{
+		StartedAt:     now.Add(-latency),
+		Method:        r.Method,
+		Protocol:      r.Proto,
+		Status:        status,
+		Latency:       latency,
+		RequestBytes:  r.ContentLength,
+		ResponseBytes: responseBytes,
+		UserAgent:     r.UserAgent(),
+		RemoteIP:      ips.AnonymizeIP(ips.requestIP(r)),
+		RequestID:     requestID(r),
+	}
+	if r.URL != nil {
+		a.Path = r.URL.Path
+	}
+	return a
+}
+
+// requestIP returns the client IP of the request, without port. A forwarded address that isn't an
+// IP is ignored.
+func (c *ClientIPResolver) requestIP(r *http.Request) string {
+	if c.config.TrustForwardedFor {
+		var addrs []string
+		for _, h := range r.Header.Values("X-Forwarded-For") {
+			addrs = append(addrs, strings.Split(h, ",")...)
+		}
+		if len(addrs) > 0 {
+			addr := strings.TrimSpace(addrs[max(len(addrs)-1-c.config.TrustedProxyHops, 0)])
+			if host, _, err := net.SplitHostPort(addr); err == nil {
+				addr = host
+			}
+			if ip := net.ParseIP(addr); ip != nil {
+				return ip.String()
+			}
+		}
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// requestID returns the request ID header, or the trace ID of a valid traceparent header.
+func requestID(r *http.Request) string {
+	if id := r.Header.Get(RequestIDHeader); id != "" {
+		return id
+	}
+	// traceparent: version "-" trace-id "-" parent-id "-" flags, e.g. "00-4bf9...4736-00f0...02b7-01".
+	parts := strings.Split(r.Header.Get(TraceParentHeader), "-")
+	if len(parts) == 4 && len(parts[1]) == 32 && strings.Trim(parts[1], "0") != "" {
+		return parts[1]
+	}
+	return ""
+}
+
+// AnonymizeIP returns the IP anonymized per the config IPAnonymization. Empty mode returns ip as is;
+// values that aren't IPs are truncated to empty.
+func (c *ClientIPResolver) AnonymizeIP(ip string) string {
+	switch c.config.IPAnonymization {
+	case "":
+		return ip
+	case IPAnonymizationHash:
+		if ip == "" || len(c.hashKey) == 0 {
+			return ""
+		}
+		mac := hmac.New(sha256.New, c.hashKey)
+		mac.Write([]byte(ip))
+		return hex.EncodeToString(mac.Sum(nil)[:8])
+	case IPAnonymizationTruncate:
+		parsed := net.ParseIP(ip)
+		if parsed == nil {
+			return ""
+		}
+		if v4 := parsed.To4(); v4 != nil {
+			return v4.Mask(net.CIDRMask(24, 32)).String()
+		}
+		return parsed.Mask(net.CIDRMask(48, 128)).String()
+	default:
+		return ""
+	}
+}
+
+// Level returns the access log level: "LevelError" for server errors, "LevelWarn" for client errors
+// and "LevelInfo" otherwise.
+func (a *AccessLogData) Level() byte {
+	switch {
+	case a.Status >= 500:
+		return LevelError
+	case a.Status >= 400:
+		return LevelWarn
+	default:
+		return LevelInfo
+	}
+}
+
+// LogData returns the access log, timestamped at the request start and correlated by its request ID.
+func (a *AccessLogData) LogData() *LogData {
+	ld := &LogData{
+		Timestamp: a.StartedAt,
+		Level:     a.Level(),
+		Type:      LogTypeLog,
+		Message:   fmt.Sprintf("%s %s %d %s", a.Method, a.Path, a.Status, a.Latency),
+		ContextMap: []interface{}{
+			AccessLogMethodKey, a.Method,
+			AccessLogPathKey, a.Path,
+			AccessLogStatusKey, a.Status,
+			AccessLogLatencyKey, float64(a.Latency) / float64(time.Millisecond),
+			AccessLogResponseBytesKey, a.ResponseBytes,
+		},
+	}
+	if a.RequestBytes >= 0 {
+		ld.ContextMap = append(ld.ContextMap, AccessLogRequestBytesKey, a.RequestBytes)
+	}
+	if a.Protocol != "" {
+		ld.ContextMap = append(ld.ContextMap, AccessLogProtocolKey, a.Protocol)
+	}
+	if a.UserAgent != "" {
+		ld.ContextMap = append(ld.ContextMap, AccessLogUserAgentKey, a.UserAgent)
+	}
+	if a.RemoteIP != "" {
+		ld.ContextMap = append(ld.ContextMap, AccessLogRemoteIPKey, a.RemoteIP)
+	}
+	if a.RequestID != "" {
+		ld.CorrelationData = &CorrelationData{CorrelationID: a.RequestID, Name: AccessLogCorrelationName}
+		ld.ContextMap = append(ld.ContextMap, CorrelationIDField, a.RequestID)
+	}
+	return ld
+}
@@ -0,0 +1,244 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// GroupByLevel is a group-by key grouping logs by level.
+	GroupByLevel = "@level"
+	// GroupByType is a group-by key grouping logs by type.
+	GroupByType = "@type"
+)
+
+// LogMatch holds the conditions a log must meet to be matched. Empty conditions match every log.
+// Levels: Matching levels. One of "Level*".
+// Types: Matching log types. One of "LogType*" or a registered type, by name or value.
+// MessagePrefix: Prefix the log message must start with.
+// Labels: Context key-values the log must have.
+type LogMatch struct {
+	Levels        []byte            `json:"levels,omitempty"`
+	Types         []LogType         `json:"types,omitempty"`
+	MessagePrefix string            `json:"messagePrefix,omitempty"`
+	Labels        map[string]string `json:"labels,omitempty"`
+}
+
+// Matches returns true if the log meets every condition; false otherwise.
+func (m *LogMatch) Matches(ld *LogData, context map[string]interface{}) bool {
+	if m == nil {
+		return true
+	}
+	if len(m.Levels) > 0 && !containsByte(m.Levels, ld.Level) {
+		return false
+	}
+	if len(m.Types) > 0 && !containsLogType(m.Types, ld.Type) {
+		return false
+	}
+	if !strings.HasPrefix(ld.Message, m.MessagePrefix) {
+		return false
+	}
+	for k, v := range m.Labels {
+		cv, ok := context[k]
+		if !ok || fmt.Sprint(cv) != v {
+			return false
+		}
+	}
+	return true
+}
+
+func containsByte(values []byte, b byte) bool {
+	for _, v := range values {
+		if v == b {
+			return true
+		}
+	}
+	return false
+}
+
+func containsLogType(values []LogType, t LogType) bool {
+	for _, v := range values {
+		if v == t {
+			return true
+		}
+	}
+	return false
+}
+
+// AggregationRule holds a rule deriving a metric from the log stream.
+// Match: Logs counted by the rule.
+// GroupBy: Context keys (or "GroupBy*" keys) the counts are grouped by. Each group is emitted as a separate metric.
+// Window: Aggregation window size.
+// Metric: Output metric name.
+type AggregationRule struct {
+	Match   *LogMatch     `json:"match"`
+	GroupBy []string      `json:"groupBy"`
+	Window  time.Duration `json:"window"`
+	Metric  string        `json:"metric"`
+}
+
+// MetricData holds a metric value derived from the log stream.
+// Name: Metric name.
+// Labels: Group-by key-values the value was computed for.
+// WindowStart: Start of the aggregation window.
+// WindowEnd: End of the aggregation window.
+// Count: Number of logs matched in the window.
+// Rate: Number of logs matched per second in the window.
+type MetricData struct {
+	Name        string
+	Labels      map[string]string
+	WindowStart time.Time
+	WindowEnd   time.Time
+	Count       int64
+	Rate        float64
+}
+
+// aggregationKey identifies a rule group within a window.
+type aggregationKey struct {
+	rule   int
+	start  int64
+	labels string
+}
+
+type aggregationBucket struct {
+	labels map[string]string
+	count  int64
+}
+
+// WindowedAggregator counts logs matching a set of aggregation rules over fixed time windows.
+type WindowedAggregator struct {
+	rules   []*AggregationRule
+	mu      sync.Mutex
+	buckets map[aggregationKey]*aggregationBucket
+}
+
+// NewWindowedAggregator returns an aggregator for the given rules. Rules without a window use one minute windows.
+func NewWindowedAggregator(rules []*AggregationRule) *WindowedAggregator {
+	for _, r := range rules {
+		if r.Window <= 0 {
+			r.Window = time.Minute
+		}
+	}
+	return &WindowedAggregator{rules: rules, buckets: make(map[aggregationKey]*aggregationBucket)}
+}
+
+// Observe counts the log in the window of each matching rule.
+func (a *WindowedAggregator) Observe(ld *LogData) {
+	context := ld.Context()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for i, r := range a.rules {
+		if !r.Match.Matches(ld, context) {
+			continue
+		}
+		labels := groupLabels(r.GroupBy, ld, context)
+		key := aggregationKey{
+			rule:   i,
+			start:  ld.Timestamp.Truncate(r.Window).UnixNano(),
+			labels: labelsKey(labels),
+		}
+		b, ok := a.buckets[key]
+		if !ok {
+			b = &aggregationBucket{labels: labels}
+			a.buckets[key] = b
+		}
+		b.count++
+	}
+}
+
+// Flush emits and forgets the windows that ended at or before now.
+func (a *WindowedAggregator) Flush(now time.Time) []*MetricData {
+	return a.flush(func(end time.Time) bool { return !end.After(now) })
+}
+
+// FlushAll emits and forgets every window, including the ones still open.
+func (a *WindowedAggregator) FlushAll() []*MetricData {
+	return a.flush(func(time.Time) bool { return true })
+}
+
+func (a *WindowedAggregator) flush(ready func(end time.Time) bool) []*MetricData {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var metrics []*MetricData
+	for key, b := range a.buckets {
+		r := a.rules[key.rule]
+		start := time.Unix(0, key.start)
+		end := start.Add(r.Window)
+		if !ready(end) {
+			continue
+		}
+		metrics = append(metrics, &MetricData{
+			Name:        r.Metric,
+			Labels:      b.labels,
+			WindowStart: start,
+			WindowEnd:   end,
+			Count:       b.count,
+			Rate:        float64(b.count) / r.Window.Seconds(),
+		})
+		delete(a.buckets, key)
+	}
+	sort.Slice(metrics, func(i, j int) bool {
+		if !metrics[i].WindowStart.Equal(metrics[j].WindowStart) {
+			return metrics[i].WindowStart.Before(metrics[j].WindowStart)
+		}
+		if metrics[i].Name != metrics[j].Name {
+			return metrics[i].Name < metrics[j].Name
+		}
+		return labelsKey(metrics[i].Labels) < labelsKey(metrics[j].Labels)
+	})
+	return metrics
+}
+
+func groupLabels(groupBy []string, ld *LogData, context map[string]interface{}) map[string]string {
+	labels := make(map[string]string, len(groupBy))
+	for _, k := range groupBy {
+		switch k {
+		case GroupByLevel:
+			labels[k] = strconv.Itoa(int(ld.Level))
+		case GroupByType:
+			labels[k] = ld.Type.String()
+		default:
+			if v, ok := context[k]; ok {
+				labels[k] = fmt.Sprint(v)
+			} else {
+				labels[k] = ""
+			}
+		}
+	}
+	return labels
+}
+
+// labelsKey returns a canonical string representation of the labels.
+func labelsKey(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var sb strings.Builder
+	for _, k := range keys {
+		sb.WriteString(strconv.Quote(k))
+		sb.WriteByte('=')
+		sb.WriteString(strconv.Quote(labels[k]))
+		sb.WriteByte(',')
+	}
+	return sb.String()
+}
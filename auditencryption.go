@@ -0,0 +1,334 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// AuditEncryptionX25519AESGCM represents the envelope encryption of audit logs with a random AES-256-GCM
+// data key, wrapped with a key derived by HKDF-SHA256 from an X25519 exchange with the recipient key.
+const AuditEncryptionX25519AESGCM = "X25519-HKDF-SHA256-AES-GCM"
+
+// AuditEnvelopeKey holds the context key of the envelope replacing the content of encrypted audit logs.
+const AuditEnvelopeKey = "$auditEnvelope"
+
+// auditKeyInfo holds the HKDF info binding the derived keys to the audit envelope encryption.
+const auditKeyInfo = "logging audit envelope v1"
+
+var (
+	// ErrInvalidAuditKey is returned when an audit encryption key is not a valid X25519 key.
+	ErrInvalidAuditKey = errors.New("invalid audit encryption key")
+	// ErrUnknownAuditKey is returned when opening an audit envelope whose key ID isn't held by the opener.
+	ErrUnknownAuditKey = errors.New("unknown audit encryption key")
+)
+
+// AuditEncryptionConfig holds the application layer encryption of the audit logs written to a
+// backend, independent of TLS, so the aggregation tiers in between can't read the audit content.
+// Only the holder of the recipient private key, usually the backend writer, can decrypt them.
+// Enabled: true if audit logs are encrypted; false otherwise.
+// Algorithm: Encryption algorithm. Only "AuditEncryptionX25519AESGCM" is supported.
+// RecipientPublicKey: Base64 encoded X25519 public key of the recipient.
+// RecipientKeyID: ID of the recipient key, sent in each envelope so the recipient can rotate keys.
+// Levels: Levels of the audit logs to encrypt. Empty encrypts audit logs of every level.
+type AuditEncryptionConfig struct {
+	Enabled            bool
+	Algorithm          string
+	RecipientPublicKey string
+	RecipientKeyID     string
+	Levels             []byte
+}
+
+// Validate checks the audit encryption config, returning every invalid field.
+func (c *AuditEncryptionConfig) Validate() []*ValidationError {
+	if !c.Enabled {
+		return nil
+	}
+	v := &validator{}
+	v.oneOf("Algorithm", c.Algorithm, AuditEncryptionX25519AESGCM)
+	if c.RecipientPublicKey == "" {
+		v.add("RecipientPublicKey", c.RecipientPublicKey, ConstraintRequired)
+	} else if _, err := parseAuditPublicKey(c.RecipientPublicKey); err != nil {
+		v.add("RecipientPublicKey", c.RecipientPublicKey, err.Error())
+	}
+	for i, level := range c.Levels {
+		v.level(fmt.Sprintf("Levels[%d]", i), level)
+	}
+	return v.errs
+}
+
+func parseAuditPublicKey(encoded string) (*ecdh.PublicKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAuditKey, err)
+	}
+	key, err := ecdh.X25519().NewPublicKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAuditKey, err)
+	}
+	return key, nil
+}
+
+// AuditEnvelope holds an encrypted audit log and the metadata its recipient needs to decrypt it.
+// Algorithm: Encryption algorithm. One of "AuditEncryption*".
+// KeyID: ID of the recipient key. Empty if the config doesn't set one.
+// EphemeralKey: X25519 public key generated for this envelope.
+// KeyNonce: Nonce of the data key wrapping.
+// WrappedKey: Data key encrypted with the key derived from the X25519 exchange.
+// Nonce: Nonce of the payload encryption.
+// Data: Encrypted JSON of the log content, authenticated with its log type.
+type AuditEnvelope struct {
+	Algorithm    string
+	KeyID        string `json:",omitempty"`
+	EphemeralKey []byte
+	KeyNonce     []byte
+	WrappedKey   []byte
+	Nonce        []byte
+	Data         []byte
+}
+
+// auditContent holds the part of a logged data hidden by the envelope. Error is kept as its message.
+type auditContent struct {
+	Message         string                 `json:",omitempty"`
+	Error           string                 `json:",omitempty"`
+	Context         map[string]interface{} `json:",omitempty"`
+	MessageTemplate string                 `json:",omitempty"`
+	Params          []interface{}          `json:",omitempty"`
+	RetentionHint   *RetentionHint         `json:",omitempty"`
+}
+
+// AuditSealer encrypts the audit logs per an AuditEncryptionConfig. Safe for concurrent use.
+type AuditSealer struct {
+	enabled   bool
+	keyID     string
+	recipient *ecdh.PublicKey
+	levels    map[byte]bool
+}
+
+// NewAuditSealer returns the sealer of the config recipient key. The sealer of a disabled config
+// applies to no log.
+func NewAuditSealer(cfg *AuditEncryptionConfig) (*AuditSealer, error) {
+	if !cfg.Enabled {
+		return &AuditSealer{}, nil
+	}
+	recipient, err := parseAuditPublicKey(cfg.RecipientPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	s := &AuditSealer{enabled: true, keyID: cfg.RecipientKeyID, recipient: recipient}
+	if len(cfg.Levels) > 0 {
+		s.levels = make(map[byte]bool, len(cfg.Levels))
+		for _, level := range cfg.Levels {
+			s.levels[level] = true
+		}
+	}
+	return s, nil
+}
+
+// Applies returns true if the logged data of the given level must be encrypted; false otherwise.
+func (s *AuditSealer) Applies(ld *LoggedData, level byte) bool {
+	return s.enabled && ld.Type == LogTypeAudit && (s.levels == nil || s.levels[level])
+}
+
+// Seal returns a copy of the logged data with its content replaced by an AuditEnvelope under
+// "AuditEnvelopeKey", keeping only its Type and Weight readable. Returns ld itself if it doesn't apply.
+func (s *AuditSealer) Seal(ld *LoggedData, level byte) (*LoggedData, error) {
+	if !s.Applies(ld, level) {
+		return ld, nil
+	}
+	content := auditContent{
+		Message:         ld.Message,
+		Context:         ld.Context,
+		MessageTemplate: ld.MessageTemplate,
+		Params:          ld.Params,
+		RetentionHint:   ld.RetentionHint,
+	}
+	if ld.Error != nil {
+		content.Error = ld.Error.Error()
+	}
+	plaintext, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	kek, err := deriveAuditKey(ephemeral, s.recipient, ephemeral.PublicKey())
+	if err != nil {
+		return nil, err
+	}
+	dek := make([]byte, 32)
+	if _, err := rand.Read(dek); err != nil {
+		return nil, err
+	}
+	env := &AuditEnvelope{Algorithm: AuditEncryptionX25519AESGCM, KeyID: s.keyID, EphemeralKey: ephemeral.PublicKey().Bytes()}
+	if env.KeyNonce, env.WrappedKey, err = sealAES(kek, dek, []byte(env.KeyID)); err != nil {
+		return nil, err
+	}
+	if env.Nonce, env.Data, err = sealAES(dek, plaintext, []byte(ld.Type.String())); err != nil {
+		return nil, err
+	}
+	return &LoggedData{Type: ld.Type, Weight: ld.Weight, Context: map[string]interface{}{AuditEnvelopeKey: env}}, nil
+}
+
+// AuditOpener decrypts the audit envelopes with the recipient private keys, by key ID. Safe for concurrent use.
+type AuditOpener struct {
+	mu         sync.RWMutex
+	keys       map[string]*ecdh.PrivateKey
+	defaultKey string
+}
+
+// NewAuditOpener returns an opener without keys.
+func NewAuditOpener() *AuditOpener {
+	return &AuditOpener{keys: make(map[string]*ecdh.PrivateKey)}
+}
+
+// AddKey adds a raw X25519 private key. The first key added is used for envelopes without key ID.
+func (o *AuditOpener) AddKey(keyID string, key []byte) error {
+	priv, err := ecdh.X25519().NewPrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidAuditKey, err)
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if len(o.keys) == 0 {
+		o.defaultKey = keyID
+	}
+	o.keys[keyID] = priv
+	return nil
+}
+
+// Open returns a copy of the logged data with the content of its envelope restored. Returns ld itself
+// if it doesn't hold an envelope.
+func (o *AuditOpener) Open(ld *LoggedData) (*LoggedData, error) {
+	env, ok, err := ParseAuditEnvelope(ld)
+	if err != nil || !ok {
+		return ld, err
+	}
+	if env.Algorithm != AuditEncryptionX25519AESGCM {
+		return nil, fmt.Errorf("unsupported audit encryption algorithm %q", env.Algorithm)
+	}
+	keyID := env.KeyID
+	o.mu.RLock()
+	if keyID == "" {
+		keyID = o.defaultKey
+	}
+	priv, ok := o.keys[keyID]
+	o.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownAuditKey, keyID)
+	}
+
+	ephemeral, err := ecdh.X25519().NewPublicKey(env.EphemeralKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAuditKey, err)
+	}
+	kek, err := deriveAuditKey(priv, ephemeral, ephemeral)
+	if err != nil {
+		return nil, err
+	}
+	dek, err := openAES(kek, env.KeyNonce, env.WrappedKey, []byte(env.KeyID))
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := openAES(dek, env.Nonce, env.Data, []byte(ld.Type.String()))
+	if err != nil {
+		return nil, err
+	}
+	var content auditContent
+	if err := json.Unmarshal(plaintext, &content); err != nil {
+		return nil, err
+	}
+	opened := &LoggedData{
+		Type:            ld.Type,
+		Weight:          ld.Weight,
+		Message:         content.Message,
+		Context:         content.Context,
+		MessageTemplate: content.MessageTemplate,
+		Params:          content.Params,
+		RetentionHint:   content.RetentionHint,
+	}
+	if content.Error != "" {
+		opened.Error = errors.New(content.Error)
+	}
+	return opened, nil
+}
+
+// ParseAuditEnvelope returns the envelope held by the logged data, either as set by an AuditSealer
+// or as decoded from JSON.
+func ParseAuditEnvelope(ld *LoggedData) (*AuditEnvelope, bool, error) {
+	switch v := ld.Context[AuditEnvelopeKey].(type) {
+	case nil:
+		return nil, false, nil
+	case *AuditEnvelope:
+		return v, true, nil
+	default:
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return nil, false, err
+		}
+		env := &AuditEnvelope{}
+		if err := json.Unmarshal(raw, env); err != nil {
+			return nil, false, fmt.Errorf("audit envelope: %w", err)
+		}
+		return env, true, nil
+	}
+}
+
+// deriveAuditKey derives the data key wrapping key from the X25519 exchange between priv and peer,
+// salted with the envelope ephemeral public key.
+func deriveAuditKey(priv *ecdh.PrivateKey, peer, ephemeral *ecdh.PublicKey) ([]byte, error) {
+	shared, err := priv.ECDH(peer)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAuditKey, err)
+	}
+	// HKDF-SHA256 (RFC 5869) of a single output block: the key is the first block of the expansion.
+	extract := hmac.New(sha256.New, ephemeral.Bytes())
+	extract.Write(shared)
+	expand := hmac.New(sha256.New, extract.Sum(nil))
+	expand.Write([]byte(auditKeyInfo))
+	expand.Write([]byte{1})
+	return expand.Sum(nil), nil
+}
+
+func sealAES(key, plaintext, aad []byte) (nonce, ciphertext []byte, err error) {
+	aead, err := newAESGCM(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+	return nonce, aead.Seal(nil, nonce, plaintext, aad), nil
+}
+
+func openAES(key, nonce, ciphertext, aad []byte) ([]byte, error) {
+	aead, err := newAESGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Open(nil, nonce, ciphertext, aad)
+}
@@ -0,0 +1,46 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+const (
+	// AuthModeCredentialsFile authenticates with the service account key file in CredentialsFilePath.
+	AuthModeCredentialsFile = "credentialsFile"
+	// AuthModeApplicationDefault authenticates with application default credentials, which
+	// include GKE workload identity and the compute metadata server. No key file is needed.
+	AuthModeApplicationDefault = "applicationDefault"
+)
+
+// DefaultLoggingScopes holds the OAuth scopes requested when a server logging config doesn't define any.
+var DefaultLoggingScopes = []string{"https://www.googleapis.com/auth/logging.write"}
+
+// EffectiveAuthMode returns the config auth mode. Configs without an explicit mode use
+// "AuthModeCredentialsFile" if CredentialsFilePath is set, "AuthModeApplicationDefault" otherwise.
+func (c *ServerLoggingConfig) EffectiveAuthMode() string {
+	if c.AuthMode != "" {
+		return c.AuthMode
+	}
+	if c.CredentialsFilePath != "" {
+		return AuthModeCredentialsFile
+	}
+	return AuthModeApplicationDefault
+}
+
+// EffectiveScopes returns the config OAuth scopes, or "DefaultLoggingScopes" if none are set.
+func (c *ServerLoggingConfig) EffectiveScopes() []string {
+	if len(c.Scopes) > 0 {
+		return c.Scopes
+	}
+	return DefaultLoggingScopes
+}
@@ -0,0 +1,331 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+)
+
+const (
+	// AvroContentType holds the content type of Avro Object Container Files.
+	AvroContentType = "application/avro"
+	// AvroFingerprintMetadataKey holds the OCF metadata key of the CRC-64-AVRO schema fingerprint, little endian.
+	AvroFingerprintMetadataKey = "cloudlogger.schema.fingerprint"
+	// DefaultAvroBlockRecords is the number of records per OCF block used when the writer doesn't set one.
+	DefaultAvroBlockRecords = 1000
+)
+
+// avroMagic holds the header written at the start of every Object Container File.
+var avroMagic = []byte("Obj\x01")
+
+// avroValueUnion holds the union of the types dynamic values (context values and params) are written as.
+// Other types are written as their JSON encoding.
+const avroValueUnion = `["null","boolean","long","double","string"]`
+
+// AvroSchema holds an Avro schema of the archived data.
+// Name: Full name of the schema record.
+// Schema: Schema JSON, written in the OCF header.
+// Canonical: Schema in Parsing Canonical Form, used to compute its fingerprint.
+type AvroSchema struct {
+	Name      string
+	Schema    string
+	Canonical string
+	encode    func(b []byte, v interface{}) ([]byte, error)
+}
+
+// LoggedDataAvroSchema is the Avro schema of LoggedData records.
+var LoggedDataAvroSchema = &AvroSchema{
+	Name: "cloudlogger.LoggedData",
+	Schema: `{"type":"record","name":"LoggedData","namespace":"cloudlogger","fields":[` +
+		`{"name":"Type","type":"string"},` +
+		`{"name":"Weight","type":"long"},` +
+		`{"name":"Message","type":"string"},` +
+		`{"name":"Error","type":["null","string"]},` +
+		`{"name":"Context","type":{"type":"map","values":` + avroValueUnion + `}},` +
+		`{"name":"MessageTemplate","type":"string"},` +
+		`{"name":"Params","type":{"type":"array","items":` + avroValueUnion + `}}]}`,
+	Canonical: `{"name":"cloudlogger.LoggedData","type":"record","fields":[` +
+		`{"name":"Type","type":"string"},` +
+		`{"name":"Weight","type":"long"},` +
+		`{"name":"Message","type":"string"},` +
+		`{"name":"Error","type":["null","string"]},` +
+		`{"name":"Context","type":{"type":"map","values":` + avroValueUnion + `}},` +
+		`{"name":"MessageTemplate","type":"string"},` +
+		`{"name":"Params","type":{"type":"array","items":` + avroValueUnion + `}}]}`,
+	encode: encodeLoggedDataAvro,
+}
+
+// LogGroupAvroSchema is the Avro schema of LogGroup records. Correlation custom data is not archived.
+var LogGroupAvroSchema = &AvroSchema{
+	Name: "cloudlogger.LogGroup",
+	Schema: `{"type":"record","name":"LogGroup","namespace":"cloudlogger","fields":[` +
+		`{"name":"CorrelationID","type":["null","string"]},` +
+		`{"name":"CorrelationName","type":["null","string"]},` +
+		`{"name":"Logs","type":{"type":"array","items":{"type":"record","name":"LogEntry","fields":[` +
+		`{"name":"Timestamp","type":{"type":"long","logicalType":"timestamp-micros"}},` +
+		`{"name":"Level","type":"string"},` +
+		`{"name":"Type","type":"string"},` +
+		`{"name":"Weight","type":"long"},` +
+		`{"name":"Message","type":"string"},` +
+		`{"name":"Error","type":["null","string"]},` +
+		`{"name":"Context","type":{"type":"map","values":` + avroValueUnion + `}},` +
+		`{"name":"MessageTemplate","type":"string"},` +
+		`{"name":"Params","type":{"type":"array","items":` + avroValueUnion + `}}]}}}]}`,
+	Canonical: `{"name":"cloudlogger.LogGroup","type":"record","fields":[` +
+		`{"name":"CorrelationID","type":["null","string"]},` +
+		`{"name":"CorrelationName","type":["null","string"]},` +
+		`{"name":"Logs","type":{"type":"array","items":{"name":"cloudlogger.LogEntry","type":"record","fields":[` +
+		`{"name":"Timestamp","type":"long"},` +
+		`{"name":"Level","type":"string"},` +
+		`{"name":"Type","type":"string"},` +
+		`{"name":"Weight","type":"long"},` +
+		`{"name":"Message","type":"string"},` +
+		`{"name":"Error","type":["null","string"]},` +
+		`{"name":"Context","type":{"type":"map","values":` + avroValueUnion + `}},` +
+		`{"name":"MessageTemplate","type":"string"},` +
+		`{"name":"Params","type":{"type":"array","items":` + avroValueUnion + `}}]}}}]}`,
+	encode: encodeLogGroupAvro,
+}
+
+// Fingerprint returns the CRC-64-AVRO (Rabin) fingerprint of the schema canonical form.
+func (s *AvroSchema) Fingerprint() uint64 {
+	return AvroFingerprint([]byte(s.Canonical))
+}
+
+// Encode appends the Avro binary encoding of v to b.
+func (s *AvroSchema) Encode(b []byte, v interface{}) ([]byte, error) {
+	return s.encode(b, v)
+}
+
+const avroFingerprintEmpty = 0xc15d213aa4d7a795
+
+var avroFingerprintTable = func() (t [256]uint64) {
+	for i := range t {
+		fp := uint64(i)
+		for j := 0; j < 8; j++ {
+			fp = (fp >> 1) ^ (avroFingerprintEmpty & -(fp & 1))
+		}
+		t[i] = fp
+	}
+	return t
+}()
+
+// AvroFingerprint returns the CRC-64-AVRO fingerprint of a schema in Parsing Canonical Form.
+func AvroFingerprint(canonical []byte) uint64 {
+	fp := uint64(avroFingerprintEmpty)
+	for _, c := range canonical {
+		fp = (fp >> 8) ^ avroFingerprintTable[byte(fp)^c]
+	}
+	return fp
+}
+
+// AvroOCFWriter writes records to an Avro Object Container File, uncompressed.
+type AvroOCFWriter struct {
+	w            io.Writer
+	schema       *AvroSchema
+	sync         [16]byte
+	blockRecords int
+	block        []byte
+	count        int
+}
+
+// NewAvroOCFWriter writes the file header and returns a writer of records of the given schema.
+// blockRecords is the number of records per block, "DefaultAvroBlockRecords" if zero.
+func NewAvroOCFWriter(w io.Writer, schema *AvroSchema, blockRecords int) (*AvroOCFWriter, error) {
+	if blockRecords <= 0 {
+		blockRecords = DefaultAvroBlockRecords
+	}
+	ow := &AvroOCFWriter{w: w, schema: schema, blockRecords: blockRecords}
+	if _, err := rand.Read(ow.sync[:]); err != nil {
+		return nil, err
+	}
+
+	var fp [8]byte
+	binary.LittleEndian.PutUint64(fp[:], schema.Fingerprint())
+	h := append([]byte(nil), avroMagic...)
+	h = binary.AppendVarint(h, 3)
+	h = appendAvroString(h, "avro.schema")
+	h = appendAvroString(h, schema.Schema)
+	h = appendAvroString(h, "avro.codec")
+	h = appendAvroString(h, "null")
+	h = appendAvroString(h, AvroFingerprintMetadataKey)
+	h = appendAvroString(h, string(fp[:]))
+	h = binary.AppendVarint(h, 0)
+	h = append(h, ow.sync[:]...)
+	if _, err := w.Write(h); err != nil {
+		return nil, err
+	}
+	return ow, nil
+}
+
+// Append adds a record to the current block, writing the block once it is full.
+func (ow *AvroOCFWriter) Append(v interface{}) error {
+	b, err := ow.schema.encode(ow.block, v)
+	if err != nil {
+		return err
+	}
+	ow.block = b
+	ow.count++
+	if ow.count >= ow.blockRecords {
+		return ow.Flush()
+	}
+	return nil
+}
+
+// Flush writes the current block, if it holds any record.
+func (ow *AvroOCFWriter) Flush() error {
+	if ow.count == 0 {
+		return nil
+	}
+	h := binary.AppendVarint(nil, int64(ow.count))
+	h = binary.AppendVarint(h, int64(len(ow.block)))
+	if _, err := ow.w.Write(h); err != nil {
+		return err
+	}
+	if _, err := ow.w.Write(ow.block); err != nil {
+		return err
+	}
+	if _, err := ow.w.Write(ow.sync[:]); err != nil {
+		return err
+	}
+	ow.block, ow.count = ow.block[:0], 0
+	return nil
+}
+
+// Close flushes the current block. It doesn't close the underlying writer.
+func (ow *AvroOCFWriter) Close() error {
+	return ow.Flush()
+}
+
+func encodeLoggedDataAvro(b []byte, v interface{}) ([]byte, error) {
+	d, ok := v.(*LoggedData)
+	if !ok {
+		return nil, fmt.Errorf("avro: expected *LoggedData, got %T", v)
+	}
+	b = appendAvroString(b, d.Type.String())
+	b = binary.AppendVarint(b, int64(d.Weight))
+	b = appendAvroString(b, d.Message)
+	b = appendAvroError(b, d.Error)
+	b = appendAvroValueMap(b, d.Context)
+	b = appendAvroString(b, d.MessageTemplate)
+	return appendAvroValueArray(b, d.Params), nil
+}
+
+func encodeLogGroupAvro(b []byte, v interface{}) ([]byte, error) {
+	g, ok := v.(*LogGroup)
+	if !ok {
+		return nil, fmt.Errorf("avro: expected *LogGroup, got %T", v)
+	}
+	if g.CorrelationData != nil {
+		b = appendAvroOptionalString(b, g.CorrelationData.CorrelationID, true)
+		b = appendAvroOptionalString(b, g.CorrelationData.Name, true)
+	} else {
+		b = appendAvroOptionalString(b, "", false)
+		b = appendAvroOptionalString(b, "", false)
+	}
+	if len(g.Logs) > 0 {
+		b = binary.AppendVarint(b, int64(len(g.Logs)))
+		for _, ld := range g.Logs {
+			b = binary.AppendVarint(b, ld.Timestamp.UnixMicro())
+			b = appendAvroString(b, LevelName(ld.Level))
+			b = appendAvroString(b, ld.Type.String())
+			b = binary.AppendVarint(b, int64(ld.Weight))
+			b = appendAvroString(b, ld.RenderMessage())
+			b = appendAvroError(b, ld.Error)
+			b = appendAvroValueMap(b, ld.Context())
+			b = appendAvroString(b, ld.MessageTemplate)
+			b = appendAvroValueArray(b, ld.Params)
+		}
+	}
+	return binary.AppendVarint(b, 0), nil
+}
+
+func appendAvroString(b []byte, s string) []byte {
+	b = binary.AppendVarint(b, int64(len(s)))
+	return append(b, s...)
+}
+
+func appendAvroOptionalString(b []byte, s string, set bool) []byte {
+	if !set {
+		return binary.AppendVarint(b, 0)
+	}
+	return appendAvroString(binary.AppendVarint(b, 1), s)
+}
+
+func appendAvroError(b []byte, err error) []byte {
+	if err == nil {
+		return appendAvroOptionalString(b, "", false)
+	}
+	return appendAvroOptionalString(b, err.Error(), true)
+}
+
+func appendAvroValueMap(b []byte, m map[string]interface{}) []byte {
+	if len(m) > 0 {
+		b = binary.AppendVarint(b, int64(len(m)))
+		for k, v := range m {
+			b = appendAvroString(b, k)
+			b = appendAvroValue(b, v)
+		}
+	}
+	return binary.AppendVarint(b, 0)
+}
+
+func appendAvroValueArray(b []byte, values []interface{}) []byte {
+	if len(values) > 0 {
+		b = binary.AppendVarint(b, int64(len(values)))
+		for _, v := range values {
+			b = appendAvroValue(b, v)
+		}
+	}
+	return binary.AppendVarint(b, 0)
+}
+
+// appendAvroValue appends v as a value of the avroValueUnion union.
+func appendAvroValue(b []byte, v interface{}) []byte {
+	if v == nil {
+		return binary.AppendVarint(b, 0)
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Bool:
+		b = binary.AppendVarint(b, 1)
+		if rv.Bool() {
+			return append(b, 1)
+		}
+		return append(b, 0)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return binary.AppendVarint(binary.AppendVarint(b, 2), rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if rv.Uint() <= math.MaxInt64 {
+			return binary.AppendVarint(binary.AppendVarint(b, 2), int64(rv.Uint()))
+		}
+	case reflect.Float32, reflect.Float64:
+		b = binary.AppendVarint(b, 3)
+		return binary.LittleEndian.AppendUint64(b, math.Float64bits(rv.Float()))
+	case reflect.String:
+		return appendAvroString(binary.AppendVarint(b, 4), rv.String())
+	}
+	s, err := json.Marshal(v)
+	if err != nil {
+		return appendAvroString(binary.AppendVarint(b, 4), fmt.Sprint(v))
+	}
+	return appendAvroString(binary.AppendVarint(b, 4), string(s))
+}
@@ -0,0 +1,212 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// OutputCloudLogging writes the logs to the Cloud Logging project ProjectID.
+	OutputCloudLogging = "cloudLogging"
+	// OutputKafka publishes the logs to Kafka topics, per the Kafka and KafkaMapping configs.
+	OutputKafka = "kafka"
+)
+
+// MaxBackendBackoff holds the longest delay between two retries of a backend write.
+const MaxBackendBackoff = time.Minute
+
+// ErrBackendCircuitOpen is returned when writing to a backend whose circuit is open.
+var ErrBackendCircuitOpen = errors.New("backend circuit open")
+
+// Backend writes logs to the output of a server logging config. Delivery, retries and circuit
+// breaking are built on top of this interface, see ResilientBackend, so every output shares them.
+type Backend interface {
+	// Write writes the logs, returning once every log is persisted or the write failed.
+	Write(ctx context.Context, logs []*LogEntrySource) error
+	// Close flushes and releases the backend.
+	Close() error
+}
+
+// BackendFactory returns a new backend writing to the output of the config.
+type BackendFactory func(cfg *ServerLoggingConfig) (Backend, error)
+
+var backends = struct {
+	sync.RWMutex
+	factories map[string]BackendFactory
+}{factories: make(map[string]BackendFactory)}
+
+func init() {
+	RegisterBackend(OutputCloudLogging, func(cfg *ServerLoggingConfig) (Backend, error) {
+		return NewCloudLoggingBackend(cfg, os.Stdout), nil
+	})
+}
+
+// RegisterBackend makes a backend available for the given output, one of "Output*" or a custom one,
+// replacing any previous registration.
+func RegisterBackend(output string, factory BackendFactory) {
+	backends.Lock()
+	defer backends.Unlock()
+	backends.factories[output] = factory
+}
+
+// RegisteredBackends returns the outputs of the registered backends, sorted.
+func RegisteredBackends() []string {
+	backends.RLock()
+	defer backends.RUnlock()
+	outputs := make([]string, 0, len(backends.factories))
+	for output := range backends.factories {
+		outputs = append(outputs, output)
+	}
+	sort.Strings(outputs)
+	return outputs
+}
+
+// knownOutputs returns the outputs a server logging config may set: "OutputKafka", whose backend
+// is registered by the embedding server, and every registered backend.
+func knownOutputs() []string {
+	outputs := RegisteredBackends()
+	for _, output := range outputs {
+		if output == OutputKafka {
+			return outputs
+		}
+	}
+	outputs = append(outputs, OutputKafka)
+	sort.Strings(outputs)
+	return outputs
+}
+
+// EffectiveOutput returns the config output, or "OutputCloudLogging" if none is set.
+func (c *ServerLoggingConfig) EffectiveOutput() string {
+	if c.Output != "" {
+		return c.Output
+	}
+	return OutputCloudLogging
+}
+
+// BackendDeliveryConfig holds the configuration of the delivery of the logs to a backend.
+// Retries: Number of times a failed write is retried.
+// Backoff: Delay before the first retry, doubled on each following retry up to "MaxBackendBackoff".
+// CircuitBreaker: Circuit breaker of the backend, failing writes fast while it's down. Nil disables it.
+type BackendDeliveryConfig struct {
+	Retries        int
+	Backoff        time.Duration
+	CircuitBreaker *CircuitBreakerConfig
+}
+
+// Validate checks the delivery config, returning every invalid field.
+func (c *BackendDeliveryConfig) Validate() []*ValidationError {
+	v := &validator{}
+	v.nonNegative("Retries", int64(c.Retries))
+	v.nonNegative("Backoff", int64(c.Backoff))
+	if c.CircuitBreaker != nil {
+		v.nest("CircuitBreaker", c.CircuitBreaker.Validate())
+	}
+	return v.errs
+}
+
+// ResilientBackend retries the failed writes of a backend and breaks its circuit while it's down.
+// Name: Circuit name, the "group/name" of the server logging config.
+// Retries: Number of times a failed write is retried.
+// Backoff: Delay before the first retry, doubled on each following retry up to "MaxBackendBackoff".
+// Breaker: Circuit breaker of the backend. Nil disables it.
+// Clock: Times the retries and the circuit cool-down. Nil uses SystemClock.
+type ResilientBackend struct {
+	Backend Backend
+	Name    string
+	Retries int
+	Backoff time.Duration
+	Breaker *ClientCircuitBreaker
+	Clock   Clock
+}
+
+// NewBackend returns the backend of the config output, wrapped per its Delivery config.
+func NewBackend(cfg *ServerLoggingConfig) (Backend, error) {
+	output := cfg.EffectiveOutput()
+	backends.RLock()
+	factory, ok := backends.factories[output]
+	backends.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown output %q", output)
+	}
+	b, err := factory(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Delivery == nil {
+		return b, nil
+	}
+	rb := &ResilientBackend{
+		Backend: b,
+		Name:    cfg.Group + "/" + cfg.Name,
+		Retries: cfg.Delivery.Retries,
+		Backoff: cfg.Delivery.Backoff,
+	}
+	if cfg.Delivery.CircuitBreaker != nil {
+		rb.Breaker = NewClientCircuitBreaker(cfg.Delivery.CircuitBreaker)
+	}
+	return rb, nil
+}
+
+// Write writes the logs, retrying failed writes. Returns ErrBackendCircuitOpen without writing
+// while the circuit is open, or the context error if it's done while backing off. Writes failing
+// once the context is done aren't retried nor counted against the circuit.
+func (b *ResilientBackend) Write(ctx context.Context, logs []*LogEntrySource) error {
+	clock := clockOrSystem(b.Clock)
+	backoff := min(b.Backoff, MaxBackendBackoff)
+	for attempt := 0; ; attempt++ {
+		if b.Breaker != nil && !b.Breaker.Allow(b.Name, TransportPackageTypeLog, clock.Now()) {
+			return ErrBackendCircuitOpen
+		}
+		err := b.Backend.Write(ctx, logs)
+		if err == nil {
+			if b.Breaker != nil {
+				b.Breaker.RecordSuccess(b.Name)
+			}
+			return nil
+		}
+		if ctx.Err() != nil {
+			if b.Breaker != nil {
+				b.Breaker.ReleaseProbe(b.Name)
+			}
+			return err
+		}
+		if b.Breaker != nil {
+			b.Breaker.RecordFailure(b.Name, clock.Now())
+		}
+		if attempt >= b.Retries {
+			return err
+		}
+		wait := clock.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			wait.Stop()
+			return ctx.Err()
+		case <-wait.C():
+		}
+		backoff = min(backoff*2, MaxBackendBackoff)
+	}
+}
+
+// Close closes the wrapped backend.
+func (b *ResilientBackend) Close() error {
+	return b.Backend.Close()
+}
@@ -0,0 +1,174 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// BackupWarm represents backup connections kept open but carrying no traffic.
+	BackupWarm = byte(0)
+	// BackupActive represents backup connections carrying their weighted share of the traffic.
+	BackupActive = byte(1)
+)
+
+const (
+	// BackupTriggerPrimaryUnhealthy represents backups activated because a primary connection stayed unhealthy.
+	BackupTriggerPrimaryUnhealthy = "primaryUnhealthy"
+	// BackupTriggerQueueDepth represents backups activated because the queue depth went over the threshold.
+	BackupTriggerQueueDepth = "queueDepth"
+	// BackupTriggerServerHint represents backups activated by the server through a config update.
+	BackupTriggerServerHint = "serverHint"
+)
+
+// DefaultBackupWeight is the share of traffic carried by active backups when the policy doesn't set one.
+const DefaultBackupWeight = 0.5
+
+// BackupActivationPolicy holds when the NumberOfBackupConnections carry traffic instead of staying
+// warm-idle. Backups activate as soon as any enabled trigger fires and go back to warm once every
+// trigger stayed clear for CoolDown.
+// UnhealthyIntervals: Number of consecutive health check intervals a primary connection must be unhealthy for. Zero disables the trigger.
+// QueueDepthThreshold: Number of queued logs over which backups activate. Zero disables the trigger.
+// ServerHint: true if the server can activate backups through "ClientConfigUpdate" BackupHint; false otherwise.
+// Weight: Share of the traffic, in (0, 1], carried by active backups. Defaults to "DefaultBackupWeight".
+// CoolDown: Time every trigger must stay clear before backups go back to warm.
+type BackupActivationPolicy struct {
+	UnhealthyIntervals  int           `json:"unhealthyIntervals"`
+	QueueDepthThreshold int           `json:"queueDepthThreshold"`
+	ServerHint          bool          `json:"serverHint"`
+	Weight              float64       `json:"weight"`
+	CoolDown            time.Duration `json:"coolDown"`
+}
+
+// Validate checks the backup activation policy, returning every invalid field.
+func (c *BackupActivationPolicy) Validate() []*ValidationError {
+	v := &validator{}
+	v.nonNegative("unhealthyIntervals", int64(c.UnhealthyIntervals))
+	v.nonNegative("queueDepthThreshold", int64(c.QueueDepthThreshold))
+	if c.Weight < 0 || c.Weight > 1 {
+		v.add("weight", c.Weight, "must be in [0, 1]")
+	}
+	v.nonNegative("coolDown", int64(c.CoolDown))
+	if c.UnhealthyIntervals == 0 && c.QueueDepthThreshold == 0 && !c.ServerHint {
+		v.add("unhealthyIntervals", c.UnhealthyIntervals, "at least one trigger must be enabled")
+	}
+	return v.errs
+}
+
+// BackupObservation holds what the client observed during one health check interval.
+// PrimaryHealthy: true if every primary connection passed its health checks; false otherwise.
+// QueueDepth: Number of logs queued across the channels.
+type BackupObservation struct {
+	PrimaryHealthy bool
+	QueueDepth     int
+}
+
+// BackupState holds the state of the backup connections.
+// State: One of "BackupWarm" or "BackupActive".
+// Trigger: Trigger that activated the backups. One of "BackupTrigger*". Empty while warm.
+// Since: Time of the last state change.
+// UnhealthyIntervals: Number of consecutive intervals a primary connection was unhealthy for.
+type BackupState struct {
+	State              byte
+	Trigger            string
+	Since              time.Time
+	UnhealthyIntervals int
+}
+
+// BackupActivation is the state machine deciding whether backup connections carry traffic. Safe for concurrent use.
+type BackupActivation struct {
+	policy    BackupActivationPolicy
+	mu        sync.Mutex
+	state     BackupState
+	hint      bool
+	clearedAt time.Time
+}
+
+// NewBackupActivation returns a state machine with warm backups.
+func NewBackupActivation(policy *BackupActivationPolicy, now time.Time) *BackupActivation {
+	p := *policy
+	if p.Weight <= 0 {
+		p.Weight = DefaultBackupWeight
+	}
+	return &BackupActivation{policy: p, state: BackupState{State: BackupWarm, Since: now}}
+}
+
+// SetServerHint records the latest server hint. Ignored if the policy doesn't enable ServerHint.
+func (a *BackupActivation) SetServerHint(active bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.hint = active && a.policy.ServerHint
+}
+
+// Observe advances the state machine with the observation of one health check interval and returns the new state.
+func (a *BackupActivation) Observe(obs BackupObservation, now time.Time) BackupState {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if obs.PrimaryHealthy {
+		a.state.UnhealthyIntervals = 0
+	} else {
+		a.state.UnhealthyIntervals++
+	}
+	trigger := a.trigger(obs)
+	switch {
+	case trigger != "":
+		a.clearedAt = time.Time{}
+		if a.state.State == BackupWarm {
+			a.state.State, a.state.Since = BackupActive, now
+		}
+		a.state.Trigger = trigger
+	case a.state.State == BackupActive:
+		if a.clearedAt.IsZero() {
+			a.clearedAt = now
+		}
+		if now.Sub(a.clearedAt) >= a.policy.CoolDown {
+			a.state.State, a.state.Trigger, a.state.Since = BackupWarm, "", now
+			a.clearedAt = time.Time{}
+		}
+	}
+	return a.state
+}
+
+func (a *BackupActivation) trigger(obs BackupObservation) string {
+	switch {
+	case a.policy.UnhealthyIntervals > 0 && a.state.UnhealthyIntervals >= a.policy.UnhealthyIntervals:
+		return BackupTriggerPrimaryUnhealthy
+	case a.policy.QueueDepthThreshold > 0 && obs.QueueDepth > a.policy.QueueDepthThreshold:
+		return BackupTriggerQueueDepth
+	case a.hint:
+		return BackupTriggerServerHint
+	default:
+		return ""
+	}
+}
+
+// State returns a copy of the current state.
+func (a *BackupActivation) State() BackupState {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.state
+}
+
+// Weight returns the share of the traffic backups should carry: the policy weight while active, zero while warm.
+func (a *BackupActivation) Weight() float64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.state.State != BackupActive {
+		return 0
+	}
+	return a.policy.Weight
+}
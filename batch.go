@@ -0,0 +1,333 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	// LogBatchVersionCommonContext holds the batch wire format version written for peers supporting "CapabilityCommonContext".
+	LogBatchVersionCommonContext = 1
+	// LogBatchVersionTimestampDeltas holds the batch wire format version written for peers also supporting
+	// "CapabilityTimestampDeltas", with the log timestamps delta encoded in a binary header.
+	LogBatchVersionTimestampDeltas = 2
+)
+
+// LogBatchVersion holds the latest batch wire format version, the highest one DecodeLogBatch reads.
+const LogBatchVersion = LogBatchVersionTimestampDeltas
+
+// logBatchDeltasHeader starts the binary header of the batches with delta encoded timestamps. A JSON
+// batch never starts with it.
+const logBatchDeltasHeader = byte(0)
+
+// ErrInvalidTimestampDeltas is returned when decoding a batch whose timestamp deltas don't match its logs.
+var ErrInvalidTimestampDeltas = errors.New("invalid log batch timestamp deltas")
+
+// LogBatch is the wire form of a LogGroup sent to peers supporting "CapabilityCommonContext". The
+// context key-values shared by every log of the group are sent once, in CommonContext, and each log
+// carries only the rest of its context.
+// Version: Wire format version. See "LogBatchVersion".
+// CorrelationData: Group correlation data.
+// Sampling: Group sampling decision.
+// PartitionKey: Group partition key.
+// ContainsErrors: Group error flag. See "LogGroup".
+// Identity: Client identity, sent once per batch to peers that don't keep it per connection. Optional.
+// CommonContext: Context key-value pairs shared by every log, sorted by key.
+// Logs: Logs with their ContextMap holding only the pairs not in CommonContext. Their Timestamp is
+// left out when TimestampDeltas is set.
+// BaseTimestamp: Timestamp the deltas start from, the timestamp of the first log. Sent in the binary
+// header, not in the JSON batch.
+// TimestampDeltas: Zigzag varint nanosecond difference between the timestamp of each log and the
+// previous one, the first one against BaseTimestamp. Sent in the binary header, not in the JSON
+// batch. Unset before version 2 or if a log timestamp can't be delta encoded.
+type LogBatch struct {
+	Version         int
+	CorrelationData *CorrelationData  `json:",omitempty"`
+	Sampling        *SamplingDecision `json:",omitempty"`
+	PartitionKey    string            `json:",omitempty"`
+	ContainsErrors  bool              `json:",omitempty"`
+	Identity        *ClientIdentity   `json:",omitempty"`
+	CommonContext   []interface{}     `json:",omitempty"`
+	Logs            []*LogData
+	BaseTimestamp   *time.Time `json:"-"`
+	TimestampDeltas []byte     `json:"-"`
+}
+
+// NewLogBatch factors the context shared by every log of the group out into the batch common context,
+// in the version 1 wire format read by every peer supporting "CapabilityCommonContext".
+// The group and its logs are not modified.
+func NewLogBatch(g *LogGroup, identity *ClientIdentity) (*LogBatch, error) {
+	return NewLogBatchFor(g, identity, 0)
+}
+
+// NewLogBatchFor is NewLogBatch for a peer with the given negotiated capabilities. The log timestamps
+// are delta encoded, in the version 2 wire format, only if the peer supports "CapabilityTimestampDeltas".
+func NewLogBatchFor(g *LogGroup, identity *ClientIdentity, caps Capabilities) (*LogBatch, error) {
+	b := &LogBatch{
+		Version:         LogBatchVersionCommonContext,
+		CorrelationData: g.CorrelationData,
+		Sampling:        g.Sampling,
+		PartitionKey:    g.PartitionKey,
+		ContainsErrors:  g.ContainsErrors,
+		Identity:        identity,
+		Logs:            make([]*LogData, len(g.Logs)),
+	}
+	if len(g.Logs) == 0 {
+		return b, nil
+	}
+
+	// common holds the serialized value of the keys every log seen so far has with the same value.
+	var common map[string]string
+	encoded := make([]map[string]string, len(g.Logs))
+	for i, ld := range g.Logs {
+		enc := make(map[string]string)
+		for k, v := range ld.Context() {
+			raw, err := json.Marshal(v)
+			if err != nil {
+				return nil, fmt.Errorf("log %d context %q: %w", i, k, err)
+			}
+			enc[k] = string(raw)
+		}
+		encoded[i] = enc
+		if i == 0 {
+			common = make(map[string]string, len(enc))
+			for k, v := range enc {
+				common[k] = v
+			}
+			continue
+		}
+		for k, v := range common {
+			if enc[k] != v {
+				delete(common, k)
+			}
+		}
+	}
+	if len(g.Logs) == 1 {
+		common = nil
+	}
+
+	keys := make([]string, 0, len(common))
+	for k := range common {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	first := g.Logs[0].Context()
+	for _, k := range keys {
+		b.CommonContext = append(b.CommonContext, k, first[k])
+	}
+
+	for i, ld := range g.Logs {
+		delta := *ld
+		delta.ContextMap = nil
+		for j := 0; j < len(ld.ContextMap); j += 2 {
+			k := fmt.Sprint(ld.ContextMap[j])
+			if _, ok := common[k]; ok && encoded[i][k] == common[k] {
+				continue
+			}
+			var v interface{}
+			if j+1 < len(ld.ContextMap) {
+				v = ld.ContextMap[j+1]
+			}
+			delta.ContextMap = append(delta.ContextMap, ld.ContextMap[j], v)
+		}
+		b.Logs[i] = &delta
+	}
+	if caps.Has(CapabilityTimestampDeltas) {
+		b.Version = LogBatchVersionTimestampDeltas
+		b.encodeTimestamps()
+	}
+	return b, nil
+}
+
+// encodeTimestamps moves the log timestamps into BaseTimestamp and TimestampDeltas, unless a
+// timestamp is outside of the UnixNano range, zero included.
+func (b *LogBatch) encodeTimestamps() {
+	minTime, maxTime := time.Unix(0, -1<<63), time.Unix(0, 1<<63-1)
+	for _, ld := range b.Logs {
+		if ld.Timestamp.Before(minTime) || ld.Timestamp.After(maxTime) {
+			return
+		}
+	}
+	base := b.Logs[0].Timestamp
+	deltas := make([]byte, 0, len(b.Logs)*2)
+	prev := base.UnixNano()
+	for _, ld := range b.Logs {
+		ns := ld.Timestamp.UnixNano()
+		deltas = binary.AppendVarint(deltas, ns-prev)
+		prev = ns
+		ld.Timestamp = time.Time{}
+	}
+	b.BaseTimestamp, b.TimestampDeltas = &base, deltas
+}
+
+// timestamps returns the log timestamps decoded from BaseTimestamp and TimestampDeltas, in the base
+// location. Returns nil if the timestamps aren't delta encoded.
+func (b *LogBatch) timestamps() ([]time.Time, error) {
+	if b.BaseTimestamp == nil {
+		return nil, nil
+	}
+	timestamps := make([]time.Time, len(b.Logs))
+	ts := *b.BaseTimestamp
+	deltas := b.TimestampDeltas
+	for i := range b.Logs {
+		delta, n := binary.Varint(deltas)
+		if n <= 0 {
+			return nil, ErrInvalidTimestampDeltas
+		}
+		deltas = deltas[n:]
+		ts = ts.Add(time.Duration(delta))
+		timestamps[i] = ts
+	}
+	if len(deltas) > 0 {
+		return nil, ErrInvalidTimestampDeltas
+	}
+	return timestamps, nil
+}
+
+// logBatchAlias has the LogBatch fields without its JSON methods.
+type logBatchAlias LogBatch
+
+// batchLogJSON leaves the Timestamp of delta encoded logs out of the serialized log.
+type batchLogJSON struct {
+	logDataJSON
+	Timestamp *time.Time `json:",omitempty"`
+}
+
+// MarshalJSON serializes the batch, leaving the log timestamps out when they are delta encoded, as
+// they are then sent in the binary header written by EncodeLogBatchFor.
+// Log errors are encoded as their message.
+func (b *LogBatch) MarshalJSON() ([]byte, error) {
+	if b.TimestampDeltas == nil {
+		return json.Marshal(struct {
+			*logBatchAlias
+			Logs []*wireLogData
+		}{(*logBatchAlias)(b), toWireLogs(b.Logs)})
+	}
+	logs := make([]*batchLogJSON, len(b.Logs))
+	for i, ld := range b.Logs {
+		logs[i] = &batchLogJSON{logDataJSON: newLogDataJSON(ld)}
+	}
+	return json.Marshal(struct {
+		*logBatchAlias
+		Logs []*batchLogJSON
+	}{(*logBatchAlias)(b), logs})
+}
+
+// UnmarshalJSON deserializes the batch, restoring log errors from their message.
+func (b *LogBatch) UnmarshalJSON(data []byte) error {
+	in := struct {
+		*logBatchAlias
+		Logs []*wireLogData
+	}{logBatchAlias: (*logBatchAlias)(b)}
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	b.Logs = fromWireLogs(in.Logs)
+	return nil
+}
+
+// Group returns the log group of the batch, merging the common context back into every log and
+// restoring delta encoded timestamps. Logs keep a zero Timestamp if the deltas are invalid.
+func (b *LogBatch) Group() *LogGroup {
+	g := &LogGroup{
+		CorrelationData: b.CorrelationData,
+		Sampling:        b.Sampling,
+		PartitionKey:    b.PartitionKey,
+		ContainsErrors:  b.ContainsErrors,
+		Logs:            make([]*LogData, len(b.Logs)),
+	}
+	timestamps, _ := b.timestamps()
+	for i, ld := range b.Logs {
+		full := *ld
+		if timestamps != nil {
+			full.Timestamp = timestamps[i]
+		}
+		if len(b.CommonContext) > 0 {
+			full.ContextMap = make([]interface{}, 0, len(b.CommonContext)+len(ld.ContextMap))
+			full.ContextMap = append(full.ContextMap, b.CommonContext...)
+			full.ContextMap = append(full.ContextMap, ld.ContextMap...)
+		}
+		g.Logs[i] = &full
+	}
+	return g
+}
+
+// EncodeLogBatch serializes the group in the version 1 batch wire format.
+func EncodeLogBatch(g *LogGroup, identity *ClientIdentity) ([]byte, error) {
+	return EncodeLogBatchFor(g, identity, 0)
+}
+
+// EncodeLogBatchFor serializes the group in the batch wire format for a peer with the given negotiated
+// capabilities. When the timestamps are delta encoded, the JSON batch is preceded by a binary header:
+// logBatchDeltasHeader, the varint BaseTimestamp in Unix nanoseconds, the uvarint TimestampDeltas
+// length and the TimestampDeltas.
+func EncodeLogBatchFor(g *LogGroup, identity *ClientIdentity, caps Capabilities) ([]byte, error) {
+	b, err := NewLogBatchFor(g, identity, caps)
+	if err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(b)
+	if err != nil || b.TimestampDeltas == nil {
+		return body, err
+	}
+	out := make([]byte, 0, 1+2*binary.MaxVarintLen64+len(b.TimestampDeltas)+len(body))
+	out = append(out, logBatchDeltasHeader)
+	out = binary.AppendVarint(out, b.BaseTimestamp.UnixNano())
+	out = binary.AppendUvarint(out, uint64(len(b.TimestampDeltas)))
+	out = append(out, b.TimestampDeltas...)
+	return append(out, body...), nil
+}
+
+// DecodeLogBatch deserializes a group serialized by EncodeLogBatch or EncodeLogBatchFor, returning it
+// with the batch identity, if any.
+func DecodeLogBatch(data []byte) (*LogGroup, *ClientIdentity, error) {
+	var base *time.Time
+	var deltas []byte
+	if len(data) > 0 && data[0] == logBatchDeltasHeader {
+		ns, n := binary.Varint(data[1:])
+		if n <= 0 {
+			return nil, nil, ErrInvalidTimestampDeltas
+		}
+		data = data[1+n:]
+		size, n := binary.Uvarint(data)
+		if n <= 0 || size > uint64(len(data)-n) {
+			return nil, nil, ErrInvalidTimestampDeltas
+		}
+		ts := time.Unix(0, ns).UTC()
+		base, deltas = &ts, data[n:n+int(size)]
+		data = data[n+int(size):]
+	}
+	b := &LogBatch{}
+	if err := json.Unmarshal(data, b); err != nil {
+		return nil, nil, err
+	}
+	if b.Version < 1 || b.Version > LogBatchVersion {
+		return nil, nil, fmt.Errorf("unsupported log batch version %d", b.Version)
+	}
+	if base != nil && b.Version < LogBatchVersionTimestampDeltas {
+		return nil, nil, ErrInvalidTimestampDeltas
+	}
+	b.BaseTimestamp, b.TimestampDeltas = base, deltas
+	if _, err := b.timestamps(); err != nil {
+		return nil, nil, err
+	}
+	return b.Group(), b.Identity, nil
+}
@@ -0,0 +1,124 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultBatchIncreaseStep is the batch size increase used when the config doesn't set one.
+	DefaultBatchIncreaseStep = 1
+	// DefaultBatchDecreaseFactor is the batch size decrease factor used when the config doesn't set one.
+	DefaultBatchDecreaseFactor = 0.5
+)
+
+// AdaptiveBatchingConfig holds the configuration of the adaptive batch sizing, which replaces the
+// static TargetMessageBatchSize for latency sensitive services. Batch sizes grow additively while
+// the observed send latency stays under the target and shrink multiplicatively when it goes over.
+// MinBatchSize: Smallest batch size. Must be at least 1.
+// MaxBatchSize: Largest batch size.
+// TargetLatency: Average send latency the controller aims to stay under.
+// AdjustmentInterval: Interval between two batch size adjustments.
+// IncreaseStep: Messages added to the batch size when latency is under target. Defaults to "DefaultBatchIncreaseStep".
+// DecreaseFactor: Factor, in (0, 1), the batch size is multiplied by when latency is over target.
+// Defaults to "DefaultBatchDecreaseFactor".
+type AdaptiveBatchingConfig struct {
+	MinBatchSize       int           `json:"minBatchSize"`
+	MaxBatchSize       int           `json:"maxBatchSize"`
+	TargetLatency      time.Duration `json:"targetLatency"`
+	AdjustmentInterval time.Duration `json:"adjustmentInterval"`
+	IncreaseStep       int           `json:"increaseStep"`
+	DecreaseFactor     float64       `json:"decreaseFactor"`
+}
+
+// Validate checks the adaptive batching config, returning every invalid field.
+func (c *AdaptiveBatchingConfig) Validate() []*ValidationError {
+	v := &validator{}
+	if c.MinBatchSize < 1 {
+		v.add("minBatchSize", c.MinBatchSize, ConstraintPositive)
+	}
+	if c.MaxBatchSize < c.MinBatchSize {
+		v.add("maxBatchSize", c.MaxBatchSize, "must be >= minBatchSize")
+	}
+	if c.TargetLatency <= 0 {
+		v.add("targetLatency", c.TargetLatency, ConstraintPositive)
+	}
+	if c.AdjustmentInterval <= 0 {
+		v.add("adjustmentInterval", c.AdjustmentInterval, ConstraintPositive)
+	}
+	v.nonNegative("increaseStep", int64(c.IncreaseStep))
+	if c.DecreaseFactor < 0 || c.DecreaseFactor >= 1 {
+		v.add("decreaseFactor", c.DecreaseFactor, "must be in [0, 1)")
+	}
+	return v.errs
+}
+
+// BatchSizeController computes the batch size from the observed send latencies. Safe for concurrent use.
+type BatchSizeController struct {
+	cfg        AdaptiveBatchingConfig
+	mu         sync.Mutex
+	size       int
+	lastAdjust time.Time
+	total      time.Duration
+	samples    int
+}
+
+// NewBatchSizeController returns a controller starting at the minimum batch size.
+func NewBatchSizeController(cfg *AdaptiveBatchingConfig, now time.Time) *BatchSizeController {
+	c := *cfg
+	if c.IncreaseStep <= 0 {
+		c.IncreaseStep = DefaultBatchIncreaseStep
+	}
+	if c.DecreaseFactor <= 0 || c.DecreaseFactor >= 1 {
+		c.DecreaseFactor = DefaultBatchDecreaseFactor
+	}
+	return &BatchSizeController{cfg: c, size: c.MinBatchSize, lastAdjust: now}
+}
+
+// Size returns the current batch size.
+func (b *BatchSizeController) Size() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.size
+}
+
+// Observe records the latency of a batch send, adjusting the batch size once per adjustment
+// interval. It returns the batch size to use for the next batch.
+func (b *BatchSizeController) Observe(latency time.Duration, now time.Time) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.total += latency
+	b.samples++
+	if now.Sub(b.lastAdjust) < b.cfg.AdjustmentInterval {
+		return b.size
+	}
+
+	avg := b.total / time.Duration(b.samples)
+	if avg <= b.cfg.TargetLatency {
+		b.size += b.cfg.IncreaseStep
+	} else {
+		b.size = int(float64(b.size) * b.cfg.DecreaseFactor)
+	}
+	if b.size < b.cfg.MinBatchSize {
+		b.size = b.cfg.MinBatchSize
+	}
+	if b.size > b.cfg.MaxBatchSize {
+		b.size = b.cfg.MaxBatchSize
+	}
+	b.total, b.samples, b.lastAdjust = 0, 0, now
+	return b.size
+}
@@ -0,0 +1,136 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrBulkheadFull is returned when a write can't be queued because the bulkhead queue is full.
+	ErrBulkheadFull = errors.New("bulkhead queue full")
+	// ErrBulkheadTimeout is returned when a queued write didn't get a slot within the queue timeout.
+	ErrBulkheadTimeout = errors.New("bulkhead queue timeout")
+)
+
+// BulkheadConfig holds the concurrency limits of the writes to one backend, so a slow backend
+// can't take the workers other configs need.
+// MaxConcurrentWrites: Maximum number of writes in progress. Zero means no limit.
+// MaxQueued: Maximum number of writes waiting for a slot. Zero means writes are rejected when no slot is free.
+// QueueTimeout: Maximum time a write waits for a slot. Zero means no timeout.
+type BulkheadConfig struct {
+	MaxConcurrentWrites int
+	MaxQueued           int
+	QueueTimeout        time.Duration
+}
+
+// BulkheadState holds a point in time view of a bulkhead.
+// Active: Number of writes in progress.
+// Queued: Number of writes waiting for a slot.
+// Rejected: Number of writes rejected because the queue was full.
+// TimedOut: Number of writes that timed out waiting for a slot.
+type BulkheadState struct {
+	Active   int
+	Queued   int
+	Rejected uint64
+	TimedOut uint64
+}
+
+// Bulkhead limits the concurrent writes to a backend.
+// Clock: Times the queue timeout. Nil uses SystemClock.
+type Bulkhead struct {
+	Clock    Clock
+	config   BulkheadConfig
+	slots    chan struct{}
+	queued   atomic.Int64
+	rejected atomic.Uint64
+	timedOut atomic.Uint64
+}
+
+// NewBulkhead returns a bulkhead with the given config. A nil config means no limits.
+func NewBulkhead(config *BulkheadConfig) *Bulkhead {
+	b := &Bulkhead{}
+	if config != nil {
+		b.config = *config
+	}
+	if b.config.MaxConcurrentWrites > 0 {
+		b.slots = make(chan struct{}, b.config.MaxConcurrentWrites)
+	}
+	return b
+}
+
+// Acquire waits for a write slot. Every successful Acquire must be followed by a Release.
+func (b *Bulkhead) Acquire(ctx context.Context) error {
+	if b.slots == nil {
+		return nil
+	}
+	select {
+	case b.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	if b.queued.Add(1) > int64(b.config.MaxQueued) {
+		b.queued.Add(-1)
+		b.rejected.Add(1)
+		return ErrBulkheadFull
+	}
+	defer b.queued.Add(-1)
+
+	var timeout <-chan time.Time
+	if b.config.QueueTimeout > 0 {
+		t := clockOrSystem(b.Clock).NewTimer(b.config.QueueTimeout)
+		defer t.Stop()
+		timeout = t.C()
+	}
+	select {
+	case b.slots <- struct{}{}:
+		return nil
+	case <-timeout:
+		b.timedOut.Add(1)
+		return ErrBulkheadTimeout
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Release frees the slot taken by a successful Acquire.
+func (b *Bulkhead) Release() {
+	if b.slots != nil {
+		<-b.slots
+	}
+}
+
+// State returns the current bulkhead state.
+func (b *Bulkhead) State() BulkheadState {
+	return BulkheadState{
+		Active:   len(b.slots),
+		Queued:   int(b.queued.Load()),
+		Rejected: b.rejected.Load(),
+		TimedOut: b.timedOut.Load(),
+	}
+}
+
+// Validate checks the bulkhead config, returning every invalid field.
+func (c *BulkheadConfig) Validate() []*ValidationError {
+	v := &validator{}
+	v.nonNegative("MaxConcurrentWrites", int64(c.MaxConcurrentWrites))
+	v.nonNegative("MaxQueued", int64(c.MaxQueued))
+	v.nonNegative("QueueTimeout", int64(c.QueueTimeout))
+	return v.errs
+}
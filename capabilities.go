@@ -0,0 +1,102 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Capabilities holds the set of protocol features supported by a connection peer. Unknown bits
+// are preserved so older peers can forward capabilities they don't understand. Capabilities are
+// numbered by their position, so new ones are only ever added last.
+type Capabilities uint64
+
+const (
+	// CapabilityCompressionGzip represents support for gzip compressed payloads.
+	CapabilityCompressionGzip Capabilities = 1 << iota
+	// CapabilityCompressionZstd represents support for zstd compressed payloads.
+	CapabilityCompressionZstd
+	// CapabilityAcks represents support for package acknowledgements.
+	CapabilityAcks
+	// CapabilityBackpressure represents support for server initiated backpressure.
+	CapabilityBackpressure
+	// CapabilityFlush represents support for "TransportPackageTypeFlushRequest" packages.
+	CapabilityFlush
+	// CapabilityTracePackages represents support for trace packages.
+	CapabilityTracePackages
+	// CapabilityCommonContext represents support for the LogBatch wire format, with the context shared by a batch sent once.
+	CapabilityCommonContext
+	// CapabilityDeliveryReceipts represents support for "TransportPackageTypeDeliveryReceipt" packages.
+	CapabilityDeliveryReceipts
+	// CapabilityControl represents support for "TransportPackageTypeControl" packages.
+	CapabilityControl
+	// CapabilityFrameFlags represents support for the frame flags byte, carrying FlushImmediately. See WriteFrame.
+	CapabilityFrameFlags
+	// CapabilityTimestampDeltas represents support for the version 2 LogBatch wire format, with delta encoded log timestamps.
+	CapabilityTimestampDeltas
+	// CapabilityPayloadSchema represents support for the frame schema part, carrying the package ContentType and
+	// SchemaID. Only used along "CapabilityFrameFlags". See WriteFrame.
+	CapabilityPayloadSchema
+)
+
+// SupportedCapabilities holds the capabilities implemented by this version of the model.
+const SupportedCapabilities = CapabilityFlush | CapabilityCommonContext | CapabilityDeliveryReceipts | CapabilityControl | CapabilityFrameFlags | CapabilityTimestampDeltas | CapabilityPayloadSchema
+
+var capabilityNames = []struct {
+	capability Capabilities
+	name       string
+}{
+	{CapabilityCompressionGzip, "compression-gzip"},
+	{CapabilityCompressionZstd, "compression-zstd"},
+	{CapabilityAcks, "acks"},
+	{CapabilityBackpressure, "backpressure"},
+	{CapabilityFlush, "flush"},
+	{CapabilityTracePackages, "trace-packages"},
+	{CapabilityCommonContext, "common-context"},
+	{CapabilityDeliveryReceipts, "delivery-receipts"},
+	{CapabilityControl, "control"},
+	{CapabilityFrameFlags, "frame-flags"},
+	{CapabilityTimestampDeltas, "timestamp-deltas"},
+	{CapabilityPayloadSchema, "payload-schema"},
+}
+
+// Has returns true if every capability in other is supported; false otherwise.
+func (c Capabilities) Has(other Capabilities) bool {
+	return c&other == other
+}
+
+// Negotiate returns the capabilities supported by both peers.
+func (c Capabilities) Negotiate(peer Capabilities) Capabilities {
+	return c & peer
+}
+
+// String returns the capability names separated by "|".
+func (c Capabilities) String() string {
+	if c == 0 {
+		return "none"
+	}
+	var names []string
+	for _, cn := range capabilityNames {
+		if c.Has(cn.capability) {
+			names = append(names, cn.name)
+			c &^= cn.capability
+		}
+	}
+	if c != 0 {
+		names = append(names, fmt.Sprintf("0x%x", uint64(c)))
+	}
+	return strings.Join(names, "|")
+}
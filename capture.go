@@ -0,0 +1,259 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// captureMagic holds the header written at the start of every capture file. Its last byte is the
+// capture format version: 1 for frames without capabilities, 2 for frames with "captureCapabilities".
+var captureMagic = []byte("LCAP\x02")
+
+// captureCapabilities holds the capabilities the captured packages are framed with.
+const captureCapabilities = CapabilityFrameFlags | CapabilityPayloadSchema
+
+// ErrInvalidCapture is returned when reading a file that isn't a capture file.
+var ErrInvalidCapture = errors.New("invalid capture file")
+
+// CaptureConfig holds the configuration of the capture mode, which tees every serialized
+// transport package to local files for offline reproduction of production issues.
+// Enabled: true if packages are captured; false otherwise.
+// Path: Path of the current capture file. Rotated files are named Path.1 (newest) to Path.N (oldest).
+// MaxFileBytes: Size after which the current capture file is rotated. Zero means no rotation.
+// MaxFiles: Maximum number of rotated files kept, in addition to the current one.
+type CaptureConfig struct {
+	Enabled      bool   `json:"enabled"`
+	Path         string `json:"path"`
+	MaxFileBytes int64  `json:"maxFileBytes"`
+	MaxFiles     int    `json:"maxFiles"`
+}
+
+// CapturedPackage holds a package read from a capture.
+// CapturedAt: Time the package was captured.
+// Package: Captured package. Only the ID, Type, RetryCount, ContentType, SchemaID and Payload fields are restored.
+type CapturedPackage struct {
+	CapturedAt time.Time
+	Package    *TransportPackage
+}
+
+// CaptureWriter writes packages to capture files, rotating them as a ring buffer. Safe for concurrent use.
+// Clock: Timestamps the captured packages. Nil uses SystemClock.
+type CaptureWriter struct {
+	Clock  Clock
+	config CaptureConfig
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+}
+
+// NewCaptureWriter opens a new capture file, rotating the existing one if any.
+func NewCaptureWriter(config *CaptureConfig) (*CaptureWriter, error) {
+	w := &CaptureWriter{config: *config}
+	if err := w.rotate(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Write captures the package.
+func (w *CaptureWriter) Write(pkg *TransportPackage) error {
+	var buf bytes.Buffer
+	var ts [binary.MaxVarintLen64]byte
+	buf.Write(ts[:binary.PutVarint(ts[:], clockOrSystem(w.Clock).Now().UnixNano())])
+	if err := WriteFrame(&buf, pkg, captureCapabilities); err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return os.ErrClosed
+	}
+	if w.config.MaxFileBytes > 0 && w.size > int64(len(captureMagic)) && w.size+int64(buf.Len()) > w.config.MaxFileBytes {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := w.file.Write(buf.Bytes())
+	w.size += int64(n)
+	return err
+}
+
+// Close closes the current capture file.
+func (w *CaptureWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+// rotate shifts Path.i to Path.i+1, drops the files beyond MaxFiles and starts a new current file.
+func (w *CaptureWriter) rotate() error {
+	if w.file != nil {
+		if err := w.file.Close(); err != nil {
+			return err
+		}
+		w.file = nil
+	}
+	if w.config.MaxFiles <= 0 {
+		if err := os.Remove(w.config.Path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	} else {
+		if err := os.Remove(rotatedCapturePath(w.config.Path, w.config.MaxFiles)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		for i := w.config.MaxFiles - 1; i >= 0; i-- {
+			from := rotatedCapturePath(w.config.Path, i)
+			if err := os.Rename(from, rotatedCapturePath(w.config.Path, i+1)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	f, err := os.OpenFile(w.config.Path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(captureMagic); err != nil {
+		f.Close()
+		return err
+	}
+	w.file = f
+	w.size = int64(len(captureMagic))
+	return nil
+}
+
+func rotatedCapturePath(path string, i int) string {
+	if i == 0 {
+		return path
+	}
+	return fmt.Sprintf("%s.%d", path, i)
+}
+
+// ReplayReader reads the packages of a capture, oldest first, across its rotated files.
+type ReplayReader struct {
+	paths  []string
+	file   *os.File
+	reader *bufio.Reader
+	caps   Capabilities
+}
+
+// NewReplayReader returns a reader over the capture described by the config. Missing rotated files are skipped.
+func NewReplayReader(config *CaptureConfig) *ReplayReader {
+	r := &ReplayReader{}
+	for i := config.MaxFiles; i >= 0; i-- {
+		p := rotatedCapturePath(config.Path, i)
+		if _, err := os.Stat(p); err == nil {
+			r.paths = append(r.paths, p)
+		}
+	}
+	return r
+}
+
+// Next returns the next captured package. Returns io.EOF once every file was read.
+func (r *ReplayReader) Next() (*CapturedPackage, error) {
+	for {
+		if r.reader == nil {
+			if len(r.paths) == 0 {
+				return nil, io.EOF
+			}
+			if err := r.open(r.paths[0]); err != nil {
+				return nil, err
+			}
+			r.paths = r.paths[1:]
+		}
+		ts, err := binary.ReadVarint(r.reader)
+		if err == io.EOF {
+			r.closeFile()
+			continue
+		}
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		pkg, err := ReadFrame(r.reader, r.caps)
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		return &CapturedPackage{CapturedAt: time.Unix(0, ts), Package: pkg}, nil
+	}
+}
+
+// Close releases the file currently being read.
+func (r *ReplayReader) Close() error {
+	r.paths = nil
+	return r.closeFile()
+}
+
+func (r *ReplayReader) open(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	br := bufio.NewReader(f)
+	magic := make([]byte, len(captureMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || !bytes.Equal(magic[:len(magic)-1], captureMagic[:len(captureMagic)-1]) {
+		f.Close()
+		return fmt.Errorf("%w: %s", ErrInvalidCapture, path)
+	}
+	switch magic[len(magic)-1] {
+	case 1:
+		r.caps = 0
+	case captureMagic[len(captureMagic)-1]:
+		r.caps = captureCapabilities
+	default:
+		f.Close()
+		return fmt.Errorf("%w: %s: unsupported version %d", ErrInvalidCapture, path, magic[len(magic)-1])
+	}
+	r.file = f
+	r.reader = br
+	return nil
+}
+
+func (r *ReplayReader) closeFile() error {
+	r.reader = nil
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+// Validate checks the capture config, returning every invalid field.
+func (c *CaptureConfig) Validate() []*ValidationError {
+	if !c.Enabled {
+		return nil
+	}
+	v := &validator{}
+	if c.Path == "" {
+		v.add("path", c.Path, ConstraintRequired)
+	}
+	v.nonNegative("maxFileBytes", c.MaxFileBytes)
+	v.nonNegative("maxFiles", int64(c.MaxFiles))
+	return v.errs
+}
@@ -0,0 +1,130 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CEFVersion holds the ArcSight Common Event Format version the encoder targets.
+const CEFVersion = 0
+
+// ErrCEFNotAudit is returned when converting a log that isn't of type "LogTypeAudit" to CEF.
+var ErrCEFNotAudit = errors.New("cef: only audit logs can be converted")
+
+// cefReservedKeys holds the extension keys set by the encoder, which context keys can't override.
+var cefReservedKeys = map[string]bool{"rt": true, "dvchost": true, "externalId": true, "reason": true}
+
+// CEFConfig holds the device fields of the CEF header.
+// Vendor: Device vendor, e.g. the company name.
+// Product: Device product, e.g. the app name.
+// Version: Device version. Defaults to the client identity version.
+type CEFConfig struct {
+	Vendor  string `json:"vendor"`
+	Product string `json:"product"`
+	Version string `json:"version"`
+}
+
+// CEFSeverity returns the CEF severity, from 0 to 10, of the level.
+func CEFSeverity(level byte) int {
+	switch level {
+	case LevelError:
+		return 8
+	case LevelWarn:
+		return 5
+	case LevelInfo:
+		return 3
+	default:
+		return 1
+	}
+}
+
+// LogDataToCEF converts the audit log into a CEF line, so it can be routed straight into a SIEM.
+// The event class ID is the message template, or the log type name if none. The context becomes
+// the extension, sorted by key, with invalid key characters replaced by '_'. identity may be nil.
+func LogDataToCEF(ld *LogData, identity *ClientIdentity, cfg *CEFConfig) (string, error) {
+	if ld.Type != LogTypeAudit {
+		return "", ErrCEFNotAudit
+	}
+	version := cfg.Version
+	if version == "" && identity != nil {
+		version = identity.Version
+	}
+	classID := ld.MessageTemplate
+	if classID == "" {
+		classID = ld.Type.String()
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "CEF:%d|%s|%s|%s|%s|%s|%d|", CEFVersion, escapeCEFHeader(cfg.Vendor), escapeCEFHeader(cfg.Product),
+		escapeCEFHeader(version), escapeCEFHeader(classID), escapeCEFHeader(ld.RenderMessage()), CEFSeverity(ld.Level))
+
+	ext := []string{"rt=" + strconv.FormatInt(ld.Timestamp.UnixMilli(), 10)}
+	if identity != nil && identity.Hostname != "" {
+		ext = append(ext, "dvchost="+escapeCEFValue(identity.Hostname))
+	}
+	if ld.CorrelationData != nil && ld.CorrelationData.CorrelationID != "" {
+		ext = append(ext, "externalId="+escapeCEFValue(ld.CorrelationData.CorrelationID))
+	}
+	if ld.Error != nil {
+		ext = append(ext, "reason="+escapeCEFValue(ld.Error.Error()))
+	}
+	context := ld.Context()
+	keys := make([]string, 0, len(context))
+	for k := range context {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := context[k]
+		key := sanitizeCEFKey(k)
+		if v == nil || cefReservedKeys[key] {
+			continue
+		}
+		ext = append(ext, key+"="+escapeCEFValue(fmt.Sprint(v)))
+	}
+	b.WriteString(strings.Join(ext, " "))
+	return b.String(), nil
+}
+
+var (
+	cefHeaderEscaper = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\r", " ", "\n", " ")
+	cefValueEscaper  = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\r", `\r`, "\n", `\n`)
+)
+
+func escapeCEFHeader(s string) string {
+	return cefHeaderEscaper.Replace(s)
+}
+
+func escapeCEFValue(s string) string {
+	return cefValueEscaper.Replace(s)
+}
+
+// sanitizeCEFKey returns the key with every character but letters and digits replaced by '_', as
+// CEF extension keys can't be escaped.
+func sanitizeCEFKey(k string) string {
+	if k == "" {
+		return "_"
+	}
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, k)
+}
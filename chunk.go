@@ -0,0 +1,177 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrInvalidChunk is returned when a chunk index or total is out of range or inconsistent.
+	ErrInvalidChunk = errors.New("invalid chunk")
+	// ErrChunkedEntryTooLarge is returned when a chunked entry exceeds the assembler maximum size.
+	ErrChunkedEntryTooLarge = errors.New("chunked entry too large")
+	// ErrTooManyChunkedEntries is returned when the assembler already holds the maximum number of partial entries.
+	ErrTooManyChunkedEntries = errors.New("too many partial chunked entries")
+)
+
+// Chunk holds the data of a "TransportPackageTypeChunk" package, carrying a slice of a single
+// serialized log entry too large to be sent in one package.
+// EntryID: ID shared by all the chunks of the entry.
+// Index: Zero based index of the chunk.
+// Total: Total number of chunks of the entry.
+// Type: Package type the reassembled entry should be handled as. One of "TransportPackageType*".
+// Data: Chunk bytes.
+type Chunk struct {
+	EntryID uint64
+	Index   int
+	Total   int
+	Type    PackageType
+	Data    []byte
+}
+
+// SplitIntoChunks splits the serialized entry into chunks of at most maxChunkSize bytes.
+func SplitIntoChunks(entryID uint64, entryType PackageType, payload []byte, maxChunkSize int) []*Chunk {
+	if maxChunkSize <= 0 {
+		maxChunkSize = max(len(payload), 1)
+	}
+	total := (len(payload) + maxChunkSize - 1) / maxChunkSize
+	if total == 0 {
+		total = 1
+	}
+	chunks := make([]*Chunk, total)
+	for i := range chunks {
+		end := (i + 1) * maxChunkSize
+		if end > len(payload) {
+			end = len(payload)
+		}
+		chunks[i] = &Chunk{EntryID: entryID, Index: i, Total: total, Type: entryType, Data: payload[i*maxChunkSize : end]}
+	}
+	return chunks
+}
+
+// DefaultMaxChunksPerEntry holds the maximum number of chunks of an entry when the assembler config doesn't set one.
+const DefaultMaxChunksPerEntry = 1024
+
+// ChunkAssemblerConfig holds the server side chunk reassembly configuration.
+// MaxEntrySize: Maximum size of a reassembled entry. Zero means no limit.
+// MaxPendingEntries: Maximum number of partially received entries. Zero means no limit.
+// MaxChunksPerEntry: Maximum Total of a chunk. Defaults to "DefaultMaxChunksPerEntry".
+// Timeout: Time after which a partially received entry is discarded.
+type ChunkAssemblerConfig struct {
+	MaxEntrySize      int
+	MaxPendingEntries int
+	MaxChunksPerEntry int
+	Timeout           time.Duration
+}
+
+type partialEntry struct {
+	chunks   [][]byte
+	received int
+	size     int
+	typ      PackageType
+	started  time.Time
+}
+
+// ChunkAssembler reassembles chunked entries received over a connection.
+// Clock: Times the start of each entry, checked by Expire. Nil uses SystemClock.
+type ChunkAssembler struct {
+	Clock   Clock
+	config  ChunkAssemblerConfig
+	mu      sync.Mutex
+	pending map[uint64]*partialEntry
+}
+
+// NewChunkAssembler returns an assembler with the given configuration.
+func NewChunkAssembler(config ChunkAssemblerConfig) *ChunkAssembler {
+	if config.MaxChunksPerEntry <= 0 {
+		config.MaxChunksPerEntry = DefaultMaxChunksPerEntry
+	}
+	return &ChunkAssembler{config: config, pending: make(map[uint64]*partialEntry)}
+}
+
+// Add stores the chunk and, once every chunk of its entry was received, returns the reassembled
+// entry and its package type with complete set to true. Duplicate chunks are ignored. Chunks whose
+// Total exceeds MaxChunksPerEntry are rejected before anything is allocated for their entry.
+func (a *ChunkAssembler) Add(c *Chunk) (entry []byte, entryType PackageType, complete bool, err error) {
+	if c.Total <= 0 || c.Index < 0 || c.Index >= c.Total {
+		return nil, 0, false, fmt.Errorf("%w: index %d of %d", ErrInvalidChunk, c.Index, c.Total)
+	}
+	if c.Total > a.config.MaxChunksPerEntry {
+		return nil, 0, false, fmt.Errorf("%w: %d chunks, at most %d allowed", ErrInvalidChunk, c.Total, a.config.MaxChunksPerEntry)
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	p, ok := a.pending[c.EntryID]
+	if !ok {
+		if a.config.MaxPendingEntries > 0 && len(a.pending) >= a.config.MaxPendingEntries {
+			return nil, 0, false, ErrTooManyChunkedEntries
+		}
+		p = &partialEntry{chunks: make([][]byte, c.Total), typ: c.Type, started: clockOrSystem(a.Clock).Now()}
+		a.pending[c.EntryID] = p
+	}
+	if len(p.chunks) != c.Total || p.typ != c.Type {
+		delete(a.pending, c.EntryID)
+		return nil, 0, false, fmt.Errorf("%w: entry %d changed its total or type", ErrInvalidChunk, c.EntryID)
+	}
+	if p.chunks[c.Index] != nil {
+		return nil, 0, false, nil
+	}
+	p.size += len(c.Data)
+	if a.config.MaxEntrySize > 0 && p.size > a.config.MaxEntrySize {
+		delete(a.pending, c.EntryID)
+		return nil, 0, false, fmt.Errorf("%w: entry %d", ErrChunkedEntryTooLarge, c.EntryID)
+	}
+	p.chunks[c.Index] = append(make([]byte, 0, len(c.Data)), c.Data...)
+	p.received++
+	if p.received < c.Total {
+		return nil, 0, false, nil
+	}
+
+	delete(a.pending, c.EntryID)
+	entry = make([]byte, 0, p.size)
+	for _, d := range p.chunks {
+		entry = append(entry, d...)
+	}
+	return entry, p.typ, true, nil
+}
+
+// Expire discards the partial entries older than the configured timeout, returning their IDs.
+func (a *ChunkAssembler) Expire(now time.Time) []uint64 {
+	if a.config.Timeout <= 0 {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var expired []uint64
+	for id, p := range a.pending {
+		if now.Sub(p.started) >= a.config.Timeout {
+			expired = append(expired, id)
+			delete(a.pending, id)
+		}
+	}
+	return expired
+}
+
+// Pending returns the number of partially received entries.
+func (a *ChunkAssembler) Pending() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.pending)
+}
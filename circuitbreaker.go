@@ -0,0 +1,177 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// CircuitClosed represents a circuit letting every send through.
+	CircuitClosed = byte(0)
+	// CircuitOpen represents a circuit rejecting sends until its cool-down ends.
+	CircuitOpen = byte(1)
+	// CircuitHalfOpen represents a circuit letting probes through to test whether the endpoint recovered.
+	CircuitHalfOpen = byte(2)
+)
+
+const (
+	// CircuitProbeSingle lets a single send or reconnect through at a time while half-open.
+	CircuitProbeSingle = "single"
+	// CircuitProbeHealthCheck only lets health checks through while half-open, so no log is risked on probes.
+	CircuitProbeHealthCheck = "healthCheck"
+)
+
+// CircuitBreakerConfig holds the configuration of the per endpoint client circuit breaker.
+// FailureThreshold: Number of consecutive failures opening the circuit.
+// CoolDown: Time the circuit stays open before letting probes through.
+// ProbePolicy: Which sends may probe a half-open circuit. One of "CircuitProbe*". Defaults to "CircuitProbeSingle".
+// SuccessThreshold: Number of consecutive successful probes closing the circuit. Defaults to 1.
+type CircuitBreakerConfig struct {
+	FailureThreshold int           `json:"failureThreshold"`
+	CoolDown         time.Duration `json:"coolDown"`
+	ProbePolicy      string        `json:"probePolicy"`
+	SuccessThreshold int           `json:"successThreshold"`
+}
+
+// Validate checks the circuit breaker config, returning every invalid field.
+func (c *CircuitBreakerConfig) Validate() []*ValidationError {
+	v := &validator{}
+	if c.FailureThreshold < 1 {
+		v.add("failureThreshold", c.FailureThreshold, ConstraintPositive)
+	}
+	v.nonNegative("coolDown", int64(c.CoolDown))
+	if c.ProbePolicy != "" {
+		v.oneOf("probePolicy", c.ProbePolicy, CircuitProbeSingle, CircuitProbeHealthCheck)
+	}
+	v.nonNegative("successThreshold", int64(c.SuccessThreshold))
+	return v.errs
+}
+
+// CircuitState holds the state of the circuit of an endpoint.
+// State: One of "Circuit*".
+// ConsecutiveFailures: Number of failures since the last success.
+// ConsecutiveSuccesses: Number of successful probes since the circuit became half-open.
+// OpenedAt: Time the circuit last opened.
+type CircuitState struct {
+	State                byte
+	ConsecutiveFailures  int
+	ConsecutiveSuccesses int
+	OpenedAt             time.Time
+	probing              bool
+}
+
+// ClientCircuitBreaker tracks a circuit per endpoint, consulted before sends and reconnects so a
+// hard-down server doesn't consume retries and overflow capacity. Safe for concurrent use.
+type ClientCircuitBreaker struct {
+	cfg      CircuitBreakerConfig
+	mu       sync.Mutex
+	circuits map[string]*CircuitState
+}
+
+// NewClientCircuitBreaker returns a breaker with every circuit closed.
+func NewClientCircuitBreaker(cfg *CircuitBreakerConfig) *ClientCircuitBreaker {
+	c := *cfg
+	if c.ProbePolicy == "" {
+		c.ProbePolicy = CircuitProbeSingle
+	}
+	if c.SuccessThreshold <= 0 {
+		c.SuccessThreshold = 1
+	}
+	return &ClientCircuitBreaker{cfg: c, circuits: make(map[string]*CircuitState)}
+}
+
+// Allow returns true if a package of the given type may be sent to the endpoint; false if the
+// caller should use a failover endpoint or keep the package buffered. A true result for a probe must
+// be followed by RecordSuccess, RecordFailure or ReleaseProbe.
+func (b *ClientCircuitBreaker) Allow(endpoint string, packageType PackageType, now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.circuit(endpoint)
+	if c.State == CircuitOpen && now.Sub(c.OpenedAt) >= b.cfg.CoolDown {
+		c.State = CircuitHalfOpen
+		c.ConsecutiveSuccesses = 0
+	}
+	switch c.State {
+	case CircuitClosed:
+		return true
+	case CircuitHalfOpen:
+		if c.probing {
+			return false
+		}
+		if b.cfg.ProbePolicy == CircuitProbeHealthCheck && packageType != TransportPackageTypeHealhcheck {
+			return false
+		}
+		c.probing = true
+		return true
+	default:
+		return false
+	}
+}
+
+// RecordSuccess records a successful send or reconnect to the endpoint.
+func (b *ClientCircuitBreaker) RecordSuccess(endpoint string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.circuit(endpoint)
+	c.ConsecutiveFailures = 0
+	c.probing = false
+	if c.State == CircuitHalfOpen {
+		c.ConsecutiveSuccesses++
+		if c.ConsecutiveSuccesses >= b.cfg.SuccessThreshold {
+			c.State = CircuitClosed
+		}
+	}
+}
+
+// RecordFailure records a failed send or reconnect to the endpoint, opening its circuit once the
+// failure threshold is reached or a probe fails.
+func (b *ClientCircuitBreaker) RecordFailure(endpoint string, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.circuit(endpoint)
+	c.ConsecutiveFailures++
+	c.probing = false
+	if c.State == CircuitHalfOpen || c.ConsecutiveFailures >= b.cfg.FailureThreshold {
+		c.State = CircuitOpen
+		c.OpenedAt = now
+		c.ConsecutiveSuccesses = 0
+	}
+}
+
+// ReleaseProbe records a send to the endpoint that ended without telling whether it's up, e.g. one
+// cancelled by the caller, letting the next package probe it.
+func (b *ClientCircuitBreaker) ReleaseProbe(endpoint string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.circuit(endpoint).probing = false
+}
+
+// State returns a copy of the circuit state of the endpoint.
+func (b *ClientCircuitBreaker) State(endpoint string) CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return *b.circuit(endpoint)
+}
+
+func (b *ClientCircuitBreaker) circuit(endpoint string) *CircuitState {
+	c, ok := b.circuits[endpoint]
+	if !ok {
+		c = &CircuitState{}
+		b.circuits[endpoint] = c
+	}
+	return c
+}
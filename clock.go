@@ -0,0 +1,128 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import "time"
+
+// Clock tells the time and creates timers and tickers, so time based behaviors can be tested
+// without sleeping. See modeltest.FakeClock.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// NewTimer returns a timer firing once after d.
+	NewTimer(d time.Duration) Timer
+	// NewTicker returns a ticker firing every d. d must be > 0.
+	NewTicker(d time.Duration) Ticker
+}
+
+// Timer is the Clock counterpart of time.Timer.
+type Timer interface {
+	// C returns the channel the time is sent on when the timer fires.
+	C() <-chan time.Time
+	// Stop prevents the timer from firing. Returns false if it already fired or was stopped.
+	Stop() bool
+	// Reset changes the timer to fire after d. Returns true if the timer was active.
+	Reset(d time.Duration) bool
+}
+
+// Ticker is the Clock counterpart of time.Ticker.
+type Ticker interface {
+	// C returns the channel the ticks are sent on.
+	C() <-chan time.Time
+	// Stop turns off the ticker. No more ticks are sent.
+	Stop()
+	// Reset stops the ticker and resets its period to d.
+	Reset(d time.Duration)
+}
+
+// SystemClock is the Clock of the time package, used wherever a nil Clock is given.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTimer(d time.Duration) Timer {
+	return systemTimer{time.NewTimer(d)}
+}
+
+func (systemClock) NewTicker(d time.Duration) Ticker {
+	return systemTicker{time.NewTicker(d)}
+}
+
+type systemTimer struct {
+	*time.Timer
+}
+
+func (t systemTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
+
+type systemTicker struct {
+	*time.Ticker
+}
+
+func (t systemTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
+
+// clockOrSystem returns c, or SystemClock if c is nil.
+func clockOrSystem(c Clock) Clock {
+	if c == nil {
+		return SystemClock
+	}
+	return c
+}
+
+// sleep pauses the calling goroutine for d on the clock.
+func sleep(c Clock, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	t := clockOrSystem(c).NewTimer(d)
+	defer t.Stop()
+	<-t.C()
+}
+
+// NewFlushTimer returns a timer firing at the next batch flush of the connection, per
+// SendBatchLogsInterval and FlushAlignment. Reset it with NextFlushDelay after each flush.
+func (c *ClientConfig) NewFlushTimer(clock Clock, connectionID string) Timer {
+	clock = clockOrSystem(clock)
+	return clock.NewTimer(c.NextFlushDelay(clock.Now(), connectionID))
+}
+
+// NextFlushDelay returns the time left until the next batch flush of the connection after now.
+func (c *ClientConfig) NextFlushDelay(now time.Time, connectionID string) time.Duration {
+	return c.FlushAlignment.NextFlush(now, c.SendBatchLogsInterval, connectionID).Sub(now)
+}
+
+// NewHealthCheckTicker returns a ticker firing every HealthCheckInterval, or nil if health checks are disabled.
+func (c *ClientConfig) NewHealthCheckTicker(clock Clock) Ticker {
+	if c.HealthCheckInterval <= 0 {
+		return nil
+	}
+	return clockOrSystem(clock).NewTicker(c.HealthCheckInterval)
+}
+
+// NewConnectionResetTimer returns a timer firing when a connection opened now must be reset, per
+// ConnectionResetInterval, or nil if connections are never reset.
+func (c *ClientConfig) NewConnectionResetTimer(clock Clock) Timer {
+	if c.ConnectionResetInterval <= 0 {
+		return nil
+	}
+	return clockOrSystem(clock).NewTimer(c.ConnectionResetInterval)
+}
@@ -0,0 +1,222 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// ConfigChangeSourceFile represents a change read from a config file.
+	ConfigChangeSourceFile = "file"
+	// ConfigChangeSourcePush represents a change pushed by the server in a config update.
+	ConfigChangeSourcePush = "push"
+	// ConfigChangeSourceAPI represents a change made through the connection API.
+	ConfigChangeSourceAPI = "api"
+)
+
+const (
+	// ConfigChangeActorKey holds the context key of the change author in config change audit logs.
+	ConfigChangeActorKey = "configChange.actor"
+	// ConfigChangeSourceKey holds the context key of the change source in config change audit logs.
+	ConfigChangeSourceKey = "configChange.source"
+	// ConfigChangeTargetKey holds the context key of the changed config in config change audit logs.
+	ConfigChangeTargetKey = "configChange.target"
+	// ConfigChangeSequenceKey holds the context key of the change sequence number in config change audit logs.
+	ConfigChangeSequenceKey = "configChange.sequence"
+	// ConfigChangeFieldsKey holds the context key of the changed fields in config change audit logs.
+	ConfigChangeFieldsKey = "configChange.fields"
+)
+
+// configChangesBucket holds the KVStore bucket of the config change records, keyed by sequence number.
+var configChangesBucket = []byte("configChanges")
+
+// ConfigFieldChange holds a config setting changed.
+// Field: JSON name of the setting.
+// Old: Value before the change.
+// New: Value after the change.
+type ConfigFieldChange struct {
+	Field string
+	Old   interface{}
+	New   interface{}
+}
+
+// ConfigChangeRecord holds a change to a logging config, kept so every config change is auditable.
+// Sequence: Position of the record in its store, set by Append.
+// Actor: Who made the change, e.g. a user, service account or "server".
+// Source: How the change was made. One of "ConfigChangeSource*".
+// Target: Config changed, e.g. the client app name or "server".
+// ChangedAt: Time of the change.
+// Changes: Settings changed, sorted by field.
+type ConfigChangeRecord struct {
+	Sequence  uint64
+	Actor     string
+	Source    string
+	Target    string
+	ChangedAt time.Time
+	Changes   []*ConfigFieldChange
+}
+
+// DiffConfigs returns the top level settings that differ between two configs of the same struct
+// type, e.g. *ClientConfig or *ServerConfigs. A nil config is compared as a zero config. The values of
+// a ClientConfig are taken from its Redacted copy, so a changed secret is reported without its value.
+func DiffConfigs(old, new interface{}) []*ConfigFieldChange {
+	nv := reflect.Indirect(reflect.ValueOf(new))
+	ov := reflect.Indirect(reflect.ValueOf(old))
+	if !nv.IsValid() {
+		if !ov.IsValid() {
+			return nil
+		}
+		nv = reflect.Zero(ov.Type())
+	}
+	if !ov.IsValid() || ov.Type() != nv.Type() {
+		ov = reflect.Zero(nv.Type())
+	}
+	nr, or := redactedConfig(nv), redactedConfig(ov)
+	var changes []*ConfigFieldChange
+	t := nv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if !t.Field(i).IsExported() {
+			continue
+		}
+		if reflect.DeepEqual(ov.Field(i).Interface(), nv.Field(i).Interface()) {
+			continue
+		}
+		changes = append(changes, &ConfigFieldChange{Field: jsonFieldName(t.Field(i)), Old: or.Field(i).Interface(), New: nr.Field(i).Interface()})
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes
+}
+
+// redactedConfig returns the Redacted copy of a ClientConfig value, and any other config as is.
+func redactedConfig(v reflect.Value) reflect.Value {
+	if c, ok := v.Interface().(ClientConfig); ok {
+		return reflect.ValueOf(*c.Redacted())
+	}
+	return v
+}
+
+// NewConfigChangeRecord returns the record of the change from the old to the new config, or nil if
+// nothing changed.
+func NewConfigChangeRecord(actor, source, target string, old, new interface{}, now time.Time) *ConfigChangeRecord {
+	changes := DiffConfigs(old, new)
+	if len(changes) == 0 {
+		return nil
+	}
+	return &ConfigChangeRecord{Actor: actor, Source: source, Target: target, ChangedAt: now, Changes: changes}
+}
+
+// LogData returns the record as an audit log, so config changes go through the logging pipeline itself.
+func (r *ConfigChangeRecord) LogData() *LogData {
+	fields := make([]string, len(r.Changes))
+	changes := make([]interface{}, len(r.Changes))
+	for i, c := range r.Changes {
+		fields[i] = c.Field
+		changes[i] = map[string]interface{}{"field": c.Field, "old": c.Old, "new": c.New}
+	}
+	return &LogData{
+		Timestamp: r.ChangedAt,
+		Level:     LevelInfo,
+		Type:      LogTypeAudit,
+		Message:   fmt.Sprintf("%s config changed: %s", r.Target, strings.Join(fields, ", ")),
+		ContextMap: []interface{}{
+			ConfigChangeActorKey, r.Actor,
+			ConfigChangeSourceKey, r.Source,
+			ConfigChangeTargetKey, r.Target,
+			ConfigChangeSequenceKey, r.Sequence,
+			ConfigChangeFieldsKey, changes,
+		},
+	}
+}
+
+// ConfigChangeStore is an append-only store of config change records: records can be added and
+// read back, but never modified or removed.
+type ConfigChangeStore interface {
+	// Append sets the record Sequence to the next sequence number and stores it.
+	Append(r *ConfigChangeRecord) error
+	// List returns up to limit records with a sequence number greater than after, in sequence order.
+	// Zero limit means no limit.
+	List(after uint64, limit int) ([]*ConfigChangeRecord, error)
+}
+
+// KVConfigChangeStore is a ConfigChangeStore backed by a KVStore. Safe for concurrent use.
+type KVConfigChangeStore struct {
+	kv   KVStore
+	mu   sync.Mutex
+	last uint64
+}
+
+// NewKVConfigChangeStore returns a store appending after the records kv already holds.
+func NewKVConfigChangeStore(kv KVStore) (*KVConfigChangeStore, error) {
+	s := &KVConfigChangeStore{kv: kv}
+	err := kv.ForEach(configChangesBucket, func(key, _ []byte) error {
+		s.last = binary.BigEndian.Uint64(key)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Append implements the ConfigChangeStore interface.
+func (s *KVConfigChangeStore) Append(r *ConfigChangeRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r.Sequence = s.last + 1
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if err := s.kv.Put(configChangesBucket, binary.BigEndian.AppendUint64(nil, r.Sequence), b); err != nil {
+		return err
+	}
+	s.last = r.Sequence
+	return nil
+}
+
+// errStopIteration stops a KVStore ForEach early without reporting an error.
+var errStopIteration = errors.New("stop iteration")
+
+// List implements the ConfigChangeStore interface.
+func (s *KVConfigChangeStore) List(after uint64, limit int) ([]*ConfigChangeRecord, error) {
+	var records []*ConfigChangeRecord
+	err := s.kv.ForEach(configChangesBucket, func(key, value []byte) error {
+		if binary.BigEndian.Uint64(key) <= after {
+			return nil
+		}
+		r := &ConfigChangeRecord{}
+		if err := json.Unmarshal(value, r); err != nil {
+			return err
+		}
+		records = append(records, r)
+		if limit > 0 && len(records) >= limit {
+			return errStopIteration
+		}
+		return nil
+	})
+	if err != nil && err != errStopIteration {
+		return nil, err
+	}
+	return records, nil
+}
@@ -0,0 +1,58 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+// ClientConfigUpdate holds the data of a "TransportPackageTypeConfigUpdate" package, a partial
+// client configuration pushed by the server mid-stream. Nil fields are left unchanged.
+// Version: Monotonically increasing update version. Updates older than the last applied one are ignored.
+// Level: Logging level. One of "Level*".
+// HipriLoggingLevel: Level of the messages that will be sent over the high priority connections.
+// OverflowChannelLoggingLevel: Level of the messages that will be stored in the overflow channel.
+// Sampling: Sampling configuration.
+// BackupHint: true if the client should activate its backup connections; false if they can go back to warm.
+// Not part of the config: clients hand it to their "BackupActivation".
+type ClientConfigUpdate struct {
+	Version                     uint64          `json:"version"`
+	Level                       *byte           `json:"level,omitempty"`
+	HipriLoggingLevel           *byte           `json:"hipriLoggingLevel,omitempty"`
+	OverflowChannelLoggingLevel *byte           `json:"overflowChannelLoggingLevel,omitempty"`
+	Sampling                    *SamplingConfig `json:"sampling,omitempty"`
+	BackupHint                  *bool           `json:"backupHint,omitempty"`
+}
+
+// Apply returns a copy of the config with the update applied. The original config is not modified.
+func (u *ClientConfigUpdate) Apply(cfg *ClientConfig) *ClientConfig {
+	c := *cfg
+	if u.Level != nil {
+		c.Level = *u.Level
+	}
+	if u.HipriLoggingLevel != nil {
+		c.HipriLoggingLevel = *u.HipriLoggingLevel
+	}
+	if u.OverflowChannelLoggingLevel != nil {
+		c.OverflowChannelLoggingLevel = *u.OverflowChannelLoggingLevel
+	}
+	if u.Sampling != nil {
+		s := *u.Sampling
+		c.Sampling = &s
+	}
+	return &c
+}
+
+// IsEmpty returns true if the update doesn't change anything; false otherwise.
+func (u *ClientConfigUpdate) IsEmpty() bool {
+	return u.Level == nil && u.HipriLoggingLevel == nil && u.OverflowChannelLoggingLevel == nil && u.Sampling == nil &&
+		u.BackupHint == nil
+}
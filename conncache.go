@@ -0,0 +1,234 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// errNotModifiedWithoutEntry is returned when the server answers "not modified" for a connection
+	// invalidated during the round trip.
+	errNotModifiedWithoutEntry = errors.New("connection state not modified but no longer cached")
+	// errNoConnectionState is returned when a fetch returns neither a response nor "not modified".
+	errNoConnectionState = errors.New("connection state fetch returned no response")
+)
+
+// ConnectionStateCacheConfig holds the configuration of the client cache of the server connection
+// metadata, so routing decisions during reconnect storms don't wait on control plane round trips.
+// TTL: Time a cached response is used without refreshing it.
+// MaxStale: Time past the TTL a cached response is still used while it is refreshed in the
+// background. Zero refreshes expired responses synchronously.
+// MaxEntries: Maximum number of cached connections. The least recently fetched is evicted first. Zero means no limit.
+type ConnectionStateCacheConfig struct {
+	TTL        time.Duration `json:"ttl"`
+	MaxStale   time.Duration `json:"maxStale"`
+	MaxEntries int           `json:"maxEntries"`
+}
+
+// Validate checks the connection state cache config, returning every invalid field.
+func (c *ConnectionStateCacheConfig) Validate() []*ValidationError {
+	v := &validator{}
+	if c.TTL <= 0 {
+		v.add("ttl", c.TTL, ConstraintPositive)
+	}
+	v.nonNegative("maxStale", int64(c.MaxStale))
+	v.nonNegative("maxEntries", int64(c.MaxEntries))
+	return v.errs
+}
+
+// ConnectionStateFetcher performs a GetConnection round trip. It returns notModified true, and no
+// response, if the server state matches req.IfNoneMatch.
+type ConnectionStateFetcher func(ctx context.Context, req *GetConnectionRequest) (resp *GetConnectionResponse, notModified bool, err error)
+
+// ConnectionStateCacheStats holds the connection state cache counters.
+// Hits: Number of lookups answered with a fresh response.
+// StaleHits: Number of lookups answered with a stale response while it was refreshed.
+// Misses: Number of lookups waiting on a round trip.
+// Refreshes: Number of background refreshes.
+// RefreshErrors: Number of failed background refreshes. The stale response stays cached.
+type ConnectionStateCacheStats struct {
+	Hits          uint64
+	StaleHits     uint64
+	Misses        uint64
+	Refreshes     uint64
+	RefreshErrors uint64
+}
+
+type connectionStateEntry struct {
+	resp      *GetConnectionResponse
+	fetchedAt time.Time
+}
+
+// connectionStateCall holds a round trip shared by every lookup of the same connection.
+// invalidated is set, with mu held, when the connection is invalidated during the round trip, so
+// its result isn't cached.
+type connectionStateCall struct {
+	done        chan struct{}
+	resp        *GetConnectionResponse
+	err         error
+	invalidated bool
+}
+
+// ConnectionStateCache caches the GetConnection responses of the client connections, revalidating
+// them with their ETag. Concurrent lookups of the same connection share one round trip. Safe for
+// concurrent use.
+type ConnectionStateCache struct {
+	cfg      ConnectionStateCacheConfig
+	fetch    ConnectionStateFetcher
+	mu       sync.Mutex
+	entries  map[string]*connectionStateEntry
+	inflight map[string]*connectionStateCall
+	stats    ConnectionStateCacheStats
+	wg       sync.WaitGroup
+}
+
+// NewConnectionStateCache returns an empty cache using fetch for round trips.
+func NewConnectionStateCache(cfg *ConnectionStateCacheConfig, fetch ConnectionStateFetcher) *ConnectionStateCache {
+	return &ConnectionStateCache{
+		cfg:      *cfg,
+		fetch:    fetch,
+		entries:  make(map[string]*connectionStateEntry),
+		inflight: make(map[string]*connectionStateCall),
+	}
+}
+
+// Get returns the state of the connection: from the cache while fresh, from the cache with a
+// background refresh while stale, and from a round trip otherwise. The returned response must not be modified.
+func (c *ConnectionStateCache) Get(ctx context.Context, connectionID string, now time.Time) (*GetConnectionResponse, error) {
+	c.mu.Lock()
+	e, ok := c.entries[connectionID]
+	if ok {
+		age := now.Sub(e.fetchedAt)
+		if age < c.cfg.TTL {
+			c.stats.Hits++
+			c.mu.Unlock()
+			return e.resp, nil
+		}
+		if age < c.cfg.TTL+c.cfg.MaxStale {
+			c.stats.StaleHits++
+			if _, refreshing := c.inflight[connectionID]; !refreshing {
+				c.stats.Refreshes++
+				call := c.start(connectionID, e.resp.ETag, now)
+				c.wg.Add(1)
+				go func() {
+					defer c.wg.Done()
+					<-call.done
+					if call.err != nil {
+						c.mu.Lock()
+						c.stats.RefreshErrors++
+						c.mu.Unlock()
+					}
+				}()
+			}
+			c.mu.Unlock()
+			return e.resp, nil
+		}
+	}
+	c.stats.Misses++
+	call, ok := c.inflight[connectionID]
+	if !ok {
+		etag := ""
+		if e != nil {
+			etag = e.resp.ETag
+		}
+		call = c.start(connectionID, etag, now)
+	}
+	c.mu.Unlock()
+	select {
+	case <-call.done:
+		return call.resp, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// start runs a round trip for the connection in the background. Must be called with mu held.
+func (c *ConnectionStateCache) start(connectionID, etag string, now time.Time) *connectionStateCall {
+	call := &connectionStateCall{done: make(chan struct{})}
+	c.inflight[connectionID] = call
+	go func() {
+		// The round trip outlives the lookup that started it: it is shared with later lookups.
+		resp, notModified, err := c.fetch(context.Background(), &GetConnectionRequest{ConnectionID: connectionID, IfNoneMatch: etag})
+		c.mu.Lock()
+		if c.inflight[connectionID] == call {
+			delete(c.inflight, connectionID)
+		}
+		switch {
+		case err != nil:
+			call.err = err
+		case !notModified && resp == nil:
+			call.err = errNoConnectionState
+		case call.invalidated && notModified:
+			call.err = errNotModifiedWithoutEntry
+		case call.invalidated:
+			call.resp = resp
+		case notModified && c.entries[connectionID] != nil:
+			e := c.entries[connectionID]
+			e.fetchedAt = now
+			call.resp = e.resp
+		case notModified:
+			call.err = errNotModifiedWithoutEntry
+		default:
+			c.entries[connectionID] = &connectionStateEntry{resp: resp, fetchedAt: now}
+			c.evict()
+			call.resp = resp
+		}
+		c.mu.Unlock()
+		close(call.done)
+	}()
+	return call
+}
+
+// evict removes the least recently fetched entries over MaxEntries. Must be called with mu held.
+func (c *ConnectionStateCache) evict() {
+	for c.cfg.MaxEntries > 0 && len(c.entries) > c.cfg.MaxEntries {
+		var oldest string
+		var oldestAt time.Time
+		for id, e := range c.entries {
+			if oldest == "" || e.fetchedAt.Before(oldestAt) {
+				oldest, oldestAt = id, e.fetchedAt
+			}
+		}
+		delete(c.entries, oldest)
+	}
+}
+
+// Invalidate removes the connection from the cache, e.g. once it is closed. A round trip in flight
+// still answers the lookups waiting on it, but its response isn't cached.
+func (c *ConnectionStateCache) Invalidate(connectionID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, connectionID)
+	if call, ok := c.inflight[connectionID]; ok {
+		call.invalidated = true
+		delete(c.inflight, connectionID)
+	}
+}
+
+// Stats returns a copy of the cache counters.
+func (c *ConnectionStateCache) Stats() ConnectionStateCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// Wait blocks until the background refreshes started so far are done.
+func (c *ConnectionStateCache) Wait() {
+	c.wg.Wait()
+}
@@ -0,0 +1,150 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// ConnectionSortByThroughput sorts connections by messages per second.
+	ConnectionSortByThroughput = "throughput"
+	// ConnectionSortByMessages sorts connections by total messages received.
+	ConnectionSortByMessages = "messages"
+	// ConnectionSortByErrors sorts connections by total errors.
+	ConnectionSortByErrors = "errors"
+	// ConnectionSortByHealthCheckLatency sorts connections by last health check latency.
+	ConnectionSortByHealthCheckLatency = "healthCheckLatency"
+)
+
+// ConnectionStats holds connection statistics.
+// MessagesPerSecond: Recent message throughput.
+// BytesPerSecond: Recent payload throughput.
+// TotalMessages: Number of messages received since the connection was opened.
+// TotalErrors: Number of errors processing the connection messages since it was opened.
+// LastHealthCheckLatency: Round trip latency of the last health check.
+type ConnectionStats struct {
+	MessagesPerSecond      float64
+	BytesPerSecond         float64
+	TotalMessages          uint64
+	TotalErrors            uint64
+	LastHealthCheckLatency time.Duration
+}
+
+// ListConnectionsRequest holds list connections request data.
+// SortBy: Sort key. One of "ConnectionSortBy*". Empty keeps the server order.
+// Descending: true to sort from highest to lowest; false otherwise.
+// Limit: Maximum number of connections returned. Zero means no limit.
+// View: Requested view of the connections, capped to the caller role. See ListConnectionResponse.View.
+// IncludeClosed: true to also list the closed and expired connections still retained as tombstones,
+// for debugging; false to list the active and draining ones only.
+type ListConnectionsRequest struct {
+	SortBy        string
+	Descending    bool
+	Limit         int
+	View          ViewLevel
+	IncludeClosed bool
+}
+
+// Includes returns true if connections in the given state are listed; false otherwise.
+func (r *ListConnectionsRequest) Includes(state string) bool {
+	return r == nil || r.IncludeClosed || !IsTombstoneState(state)
+}
+
+// SortConnections sorts and limits the connections as requested.
+func SortConnections(conns []*ListConnectionResponse, req *ListConnectionsRequest) ([]*ListConnectionResponse, error) {
+	if req == nil {
+		return conns, nil
+	}
+	var key func(*ConnectionStats) float64
+	switch req.SortBy {
+	case "":
+	case ConnectionSortByThroughput:
+		key = func(s *ConnectionStats) float64 { return s.MessagesPerSecond }
+	case ConnectionSortByMessages:
+		key = func(s *ConnectionStats) float64 { return float64(s.TotalMessages) }
+	case ConnectionSortByErrors:
+		key = func(s *ConnectionStats) float64 { return float64(s.TotalErrors) }
+	case ConnectionSortByHealthCheckLatency:
+		key = func(s *ConnectionStats) float64 { return float64(s.LastHealthCheckLatency) }
+	default:
+		return nil, fmt.Errorf("unknown sort key %q", req.SortBy)
+	}
+	if key != nil {
+		value := func(c *ListConnectionResponse) float64 {
+			if c.Stats == nil {
+				return 0
+			}
+			return key(c.Stats)
+		}
+		sort.SliceStable(conns, func(i, j int) bool {
+			if req.Descending {
+				return value(conns[i]) > value(conns[j])
+			}
+			return value(conns[i]) < value(conns[j])
+		})
+	}
+	if req.Limit > 0 && len(conns) > req.Limit {
+		conns = conns[:req.Limit]
+	}
+	return conns, nil
+}
+
+// GetConnectionRequest holds get connection request data.
+// ConnectionID: Server provided unique connecton ID.
+// IfNoneMatch: ETags the caller already holds, as in the HTTP If-None-Match header. If the current
+// ETag matches, the server answers "not modified" without regenerating the payload.
+// View: Requested view of the connection, capped to the caller role. See GetConnectionResponse.View.
+type GetConnectionRequest struct {
+	ConnectionID string
+	IfNoneMatch  string
+	View         ViewLevel
+}
+
+// ComputeETag returns a strong ETag for the response content, ignoring its ETag field.
+func ComputeETag(resp *GetConnectionResponse) (string, error) {
+	c := *resp
+	c.ETag = ""
+	b, err := json.Marshal(&c)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`, nil
+}
+
+// NotModified returns true if the given ETag matches the request If-None-Match value; false otherwise.
+// Weak comparison is used, as required for If-None-Match.
+func (r *GetConnectionRequest) NotModified(etag string) bool {
+	if r == nil || r.IfNoneMatch == "" || etag == "" {
+		return false
+	}
+	if strings.TrimSpace(r.IfNoneMatch) == "*" {
+		return true
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(r.IfNoneMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,211 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// ConsoleFormatText renders logs as human friendly lines.
+	ConsoleFormatText = "text"
+	// ConsoleFormatJSON renders logs as JSON lines.
+	ConsoleFormatJSON = "json"
+)
+
+const (
+	// ConsoleColorNone represents uncolored output.
+	ConsoleColorNone = "none"
+	// ConsoleColorRed represents red output.
+	ConsoleColorRed = "red"
+	// ConsoleColorGreen represents green output.
+	ConsoleColorGreen = "green"
+	// ConsoleColorYellow represents yellow output.
+	ConsoleColorYellow = "yellow"
+	// ConsoleColorBlue represents blue output.
+	ConsoleColorBlue = "blue"
+	// ConsoleColorMagenta represents magenta output.
+	ConsoleColorMagenta = "magenta"
+	// ConsoleColorCyan represents cyan output.
+	ConsoleColorCyan = "cyan"
+	// ConsoleColorGray represents gray output.
+	ConsoleColorGray = "gray"
+)
+
+// consoleColorCodes maps the "ConsoleColor*" names to ANSI escape sequences.
+var consoleColorCodes = map[string]string{
+	ConsoleColorNone:    "",
+	ConsoleColorRed:     "\x1b[31m",
+	ConsoleColorGreen:   "\x1b[32m",
+	ConsoleColorYellow:  "\x1b[33m",
+	ConsoleColorBlue:    "\x1b[34m",
+	ConsoleColorMagenta: "\x1b[35m",
+	ConsoleColorCyan:    "\x1b[36m",
+	ConsoleColorGray:    "\x1b[90m",
+}
+
+// consoleColorReset ends a colored sequence.
+const consoleColorReset = "\x1b[0m"
+
+// DefaultConsoleColors is the level color mapping used when the console config doesn't set one.
+var DefaultConsoleColors = map[byte]string{
+	LevelError: ConsoleColorRed,
+	LevelWarn:  ConsoleColorYellow,
+	LevelInfo:  ConsoleColorGreen,
+	LevelDebug: ConsoleColorGray,
+}
+
+// ConsoleSinkConfig holds the configuration of the console sink, rendering logs on the local console
+// instead of sending them to the server, so local development runs the same pipeline as production.
+// Format: Output format. One of "ConsoleFormat*". Defaults to "ConsoleFormatText".
+// Colors: Color of each level in text output. One of "ConsoleColor*". Defaults to "DefaultConsoleColors".
+// NoColor: true to disable colors, e.g. when the output isn't a terminal; false otherwise.
+// IncludeOrigin: true to render the log call site; false otherwise.
+// IncludeCorrelation: true to render the log correlation ID; false otherwise.
+// TimeFormat: Go layout of the rendered timestamps. Defaults to time.RFC3339Nano.
+type ConsoleSinkConfig struct {
+	Format             string          `json:"format"`
+	Colors             map[byte]string `json:"colors"`
+	NoColor            bool            `json:"noColor"`
+	IncludeOrigin      bool            `json:"includeOrigin"`
+	IncludeCorrelation bool            `json:"includeCorrelation"`
+	TimeFormat         string          `json:"timeFormat"`
+}
+
+// Validate checks the console sink config, returning every invalid field.
+func (c *ConsoleSinkConfig) Validate() []*ValidationError {
+	v := &validator{}
+	if c.Format != "" {
+		v.oneOf("format", c.Format, ConsoleFormatText, ConsoleFormatJSON)
+	}
+	levels := make([]int, 0, len(c.Colors))
+	for level := range c.Colors {
+		levels = append(levels, int(level))
+	}
+	sort.Ints(levels)
+	for _, level := range levels {
+		field := fmt.Sprintf("colors[%d]", level)
+		v.level(field, byte(level))
+		if _, ok := consoleColorCodes[c.Colors[byte(level)]]; !ok {
+			v.add(field, c.Colors[byte(level)], "must be one of \"ConsoleColor*\"")
+		}
+	}
+	return v.errs
+}
+
+// ConsoleRenderer renders logs for the console sink. Safe for concurrent use.
+type ConsoleRenderer struct {
+	cfg ConsoleSinkConfig
+}
+
+// NewConsoleRenderer returns a renderer with the given config, or the default config if nil.
+func NewConsoleRenderer(cfg *ConsoleSinkConfig) *ConsoleRenderer {
+	var c ConsoleSinkConfig
+	if cfg != nil {
+		c = *cfg
+	}
+	if c.Format == "" {
+		c.Format = ConsoleFormatText
+	}
+	if c.Colors == nil {
+		c.Colors = DefaultConsoleColors
+	}
+	if c.TimeFormat == "" {
+		c.TimeFormat = time.RFC3339Nano
+	}
+	return &ConsoleRenderer{cfg: c}
+}
+
+// Render returns the log rendered as a single line, newline included.
+func (r *ConsoleRenderer) Render(ld *LogData) ([]byte, error) {
+	if r.cfg.Format == ConsoleFormatJSON {
+		return r.renderJSON(ld)
+	}
+	var sb strings.Builder
+	sb.WriteString(ld.Timestamp.Format(r.cfg.TimeFormat))
+	sb.WriteByte(' ')
+	level := fmt.Sprintf("%-5s", strings.ToUpper(LevelName(ld.Level)))
+	if code := consoleColorCodes[r.cfg.Colors[ld.Level]]; code != "" && !r.cfg.NoColor {
+		level = code + level + consoleColorReset
+	}
+	sb.WriteString(level)
+	sb.WriteByte(' ')
+	sb.WriteString(ld.RenderMessage())
+	if ld.Error != nil {
+		writeConsolePair(&sb, "error", ld.Error.Error())
+	}
+	context := ld.Context()
+	keys := make([]string, 0, len(context))
+	for k := range context {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		writeConsolePair(&sb, k, fmt.Sprint(context[k]))
+	}
+	if r.cfg.IncludeCorrelation && ld.CorrelationData != nil && ld.CorrelationData.CorrelationID != "" {
+		writeConsolePair(&sb, CorrelationIDField, ld.CorrelationData.CorrelationID)
+	}
+	if r.cfg.IncludeOrigin && ld.Origin != nil {
+		writeConsolePair(&sb, "origin", consoleOrigin(ld.Origin))
+	}
+	sb.WriteByte('\n')
+	return []byte(sb.String()), nil
+}
+
+func (r *ConsoleRenderer) renderJSON(ld *LogData) ([]byte, error) {
+	line := map[string]interface{}{
+		"time":    ld.Timestamp.Format(r.cfg.TimeFormat),
+		"level":   LevelName(ld.Level),
+		"message": ld.RenderMessage(),
+	}
+	if ld.Error != nil {
+		line["error"] = ld.Error.Error()
+	}
+	if context := ld.Context(); len(context) > 0 {
+		line["context"] = context
+	}
+	if r.cfg.IncludeCorrelation && ld.CorrelationData != nil && ld.CorrelationData.CorrelationID != "" {
+		line[CorrelationIDField] = ld.CorrelationData.CorrelationID
+	}
+	if r.cfg.IncludeOrigin && ld.Origin != nil {
+		line["origin"] = consoleOrigin(ld.Origin)
+	}
+	b, err := json.Marshal(line)
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+// writeConsolePair writes " key=value", quoting values that would be ambiguous unquoted.
+func writeConsolePair(sb *strings.Builder, key, value string) {
+	sb.WriteByte(' ')
+	sb.WriteString(key)
+	sb.WriteByte('=')
+	if value == "" || strings.ContainsAny(value, " =\"\t\n") {
+		value = strconv.Quote(value)
+	}
+	sb.WriteString(value)
+}
+
+func consoleOrigin(o *Origin) string {
+	return o.File + ":" + strconv.Itoa(o.Line)
+}
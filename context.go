@@ -0,0 +1,176 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// ContextFromPairs converts a flattened key-value list (k1, v1, k2, v2, ...) into a map.
+// Non string keys are formatted with fmt; a trailing key without value is mapped to nil.
+func ContextFromPairs(pairs []interface{}) map[string]interface{} {
+	context := make(map[string]interface{}, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		key, ok := pairs[i].(string)
+		if !ok {
+			key = fmt.Sprint(pairs[i])
+		}
+		if i+1 < len(pairs) {
+			context[key] = pairs[i+1]
+		} else {
+			context[key] = nil
+		}
+	}
+	return context
+}
+
+// Context returns the log ContextMap as a map.
+func (ld *LogData) Context() map[string]interface{} {
+	return ContextFromPairs(ld.ContextMap)
+}
+
+// Attach sets the context key of the log to the value, replacing the value of the key if already set.
+// If the key is set several times, the last value, the one Get and ContextFromPairs resolve, is
+// replaced. Values are stored as is and only serialized with the log.
+func Attach[T any](ld *LogData, key string, value T) {
+	for i := (len(ld.ContextMap) - 1) &^ 1; i >= 0; i -= 2 {
+		if fmt.Sprint(ld.ContextMap[i]) == key {
+			if i+1 < len(ld.ContextMap) {
+				ld.ContextMap[i+1] = value
+			} else {
+				ld.ContextMap = append(ld.ContextMap, value)
+			}
+			return
+		}
+	}
+	ld.ContextMap = append(ld.ContextMap, key, value)
+}
+
+// Get returns the value of the context key of the log as a T. Values of another type, e.g. numbers
+// decoded as float64 from a received log, are converted through their JSON form. Returns false if
+// the key isn't set or its value can't be converted.
+func Get[T any](ld *LogData, key string) (T, bool) {
+	var zero T
+	found := false
+	var value interface{}
+	for i := 0; i+1 < len(ld.ContextMap); i += 2 {
+		if fmt.Sprint(ld.ContextMap[i]) == key {
+			value, found = ld.ContextMap[i+1], true
+		}
+	}
+	if !found {
+		return zero, false
+	}
+	if t, ok := value.(T); ok {
+		return t, true
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return zero, false
+	}
+	var t T
+	if err := json.Unmarshal(b, &t); err != nil {
+		return zero, false
+	}
+	return t, true
+}
+
+// TruncatedContextKey holds the context key added to truncated contexts. Its value is the number of dropped keys.
+const TruncatedContextKey = "_truncated"
+
+type contextEntrySize struct {
+	key  string
+	size int
+}
+
+// TruncateContext drops context keys until the context holds at most maxKeys keys and its
+// estimated serialized size is at most maxBytes. Largest values are dropped first, ties broken
+// by key, so the same context is always truncated the same way. A zero limit means no limit.
+// Truncated contexts get a "TruncatedContextKey" marker, not counted against the limits.
+// The context is modified in place and returned.
+func TruncateContext(context map[string]interface{}, maxBytes, maxKeys int, stats *PipelineStats) map[string]interface{} {
+	if (maxBytes <= 0 && maxKeys <= 0) || len(context) == 0 {
+		return context
+	}
+	entries := make([]contextEntrySize, 0, len(context))
+	total := 0
+	for k, v := range context {
+		size := len(k) + estimateValueSize(v)
+		entries = append(entries, contextEntrySize{key: k, size: size})
+		total += size
+	}
+	if (maxBytes <= 0 || total <= maxBytes) && (maxKeys <= 0 || len(entries) <= maxKeys) {
+		return context
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].size != entries[j].size {
+			return entries[i].size > entries[j].size
+		}
+		return entries[i].key < entries[j].key
+	})
+	dropped := 0
+	for _, e := range entries {
+		if (maxBytes <= 0 || total <= maxBytes) && (maxKeys <= 0 || len(entries)-dropped <= maxKeys) {
+			break
+		}
+		delete(context, e.key)
+		total -= e.size
+		dropped++
+	}
+	context[TruncatedContextKey] = dropped
+	if stats != nil {
+		stats.ContextsTruncated.Add(1)
+		stats.ContextKeysDropped.Add(uint64(dropped))
+	}
+	return context
+}
+
+// estimateValueSize returns the serialized size of the value, or an approximation for common types.
+func estimateValueSize(v interface{}) int {
+	switch t := v.(type) {
+	case nil:
+		return 4
+	case string:
+		return len(t) + 2
+	case []byte:
+		return (len(t)+2)/3*4 + 2
+	case bool:
+		return 5
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return len(fmt.Sprint(t))
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return len(fmt.Sprint(v))
+	}
+	return len(b)
+}
+
+// BuildLoggedData returns the data sent to the logging systems for the log, with its context
+// truncated to the given limits.
+func BuildLoggedData(ld *LogData, maxContextBytes, maxContextKeys int, stats *PipelineStats) *LoggedData {
+	return &LoggedData{
+		Type:            ld.Type,
+		Weight:          ld.Weight,
+		Message:         ld.RenderMessage(),
+		MessageTemplate: ld.MessageTemplate,
+		Params:          ld.Params,
+		Error:           ld.Error,
+		Context:         TruncateContext(ld.Context(), maxContextBytes, maxContextKeys, stats),
+		RetentionHint:   ld.RetentionHint,
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+const (
+	// ContextFieldAny represents a context field accepting values of any type.
+	ContextFieldAny = "any"
+	// ContextFieldString represents a string context field.
+	ContextFieldString = "string"
+	// ContextFieldInt represents an integer context field.
+	ContextFieldInt = "int"
+	// ContextFieldFloat represents a floating point context field.
+	ContextFieldFloat = "float"
+	// ContextFieldBool represents a boolean context field.
+	ContextFieldBool = "bool"
+	// ContextFieldTime represents a time context field.
+	ContextFieldTime = "time"
+)
+
+// ErrIncompatibleContextSchema is returned when the context schema offered by a client conflicts with
+// the one the server knows for it.
+var ErrIncompatibleContextSchema = errors.New("incompatible context schema")
+
+// ContextField describes a field of a context object.
+// Name: Field name.
+// Type: Field value type. One of "ContextField*".
+type ContextField struct {
+	Name string
+	Type string
+}
+
+// ContextSchema describes the context objects a client serializes positionally, keyed by context type
+// ID (see "ContextTypeID"). It replaces the untyped OpenConnectionDataRequest.ContextMaps.
+// Fields are matched by position, so they can only be appended, never reordered or retyped.
+// Version: Client defined version, incremented on every change.
+// Types: Ordered fields of each context type.
+type ContextSchema struct {
+	Version uint64
+	Types   map[string][]ContextField
+}
+
+// ContextSchemaError describes the first conflict found between two context schemas.
+// ContextType: Context type ID of the conflicting type.
+// Index: Position of the conflicting field.
+// Field: Name of the field offered by the client.
+// Reason: Conflict description.
+type ContextSchemaError struct {
+	ContextType string
+	Index       int
+	Field       string
+	Reason      string
+}
+
+// Error implements the error interface.
+func (e *ContextSchemaError) Error() string {
+	return fmt.Sprintf("%s: context type %q field %d (%s): %s", ErrIncompatibleContextSchema, e.ContextType, e.Index, e.Field, e.Reason)
+}
+
+// Unwrap returns ErrIncompatibleContextSchema.
+func (e *ContextSchemaError) Unwrap() error {
+	return ErrIncompatibleContextSchema
+}
+
+// ContextSchemaFromMaps converts legacy context maps into a schema with untyped fields.
+func ContextSchemaFromMaps(maps map[string][]string) *ContextSchema {
+	s := &ContextSchema{Types: make(map[string][]ContextField, len(maps))}
+	for t, names := range maps {
+		fields := make([]ContextField, len(names))
+		for i, name := range names {
+			fields[i] = ContextField{Name: name, Type: ContextFieldAny}
+		}
+		s.Types[t] = fields
+	}
+	return s
+}
+
+// Maps returns the legacy context maps of the schema, for servers that don't support schemas yet.
+func (s *ContextSchema) Maps() map[string][]string {
+	maps := make(map[string][]string, len(s.Types))
+	for t, fields := range s.Types {
+		names := make([]string, len(fields))
+		for i, f := range fields {
+			names[i] = f.Name
+		}
+		maps[t] = names
+	}
+	return maps
+}
+
+// CheckCompatible returns a *ContextSchemaError if the offered schema conflicts with the known one.
+// Fields at the same position must have the same name and type, unless either type is "ContextFieldAny".
+// Types and trailing fields present in only one of the schemas are compatible.
+func (s *ContextSchema) CheckCompatible(offered *ContextSchema) error {
+	if s == nil || offered == nil {
+		return nil
+	}
+	types := make([]string, 0, len(offered.Types))
+	for t := range offered.Types {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	for _, t := range types {
+		known, ok := s.Types[t]
+		if !ok {
+			continue
+		}
+		for i, f := range offered.Types[t] {
+			if i >= len(known) {
+				break
+			}
+			switch k := known[i]; {
+			case k.Name != f.Name:
+				return &ContextSchemaError{ContextType: t, Index: i, Field: f.Name, Reason: fmt.Sprintf("known as %q", k.Name)}
+			case k.Type != f.Type && k.Type != ContextFieldAny && f.Type != ContextFieldAny:
+				return &ContextSchemaError{ContextType: t, Index: i, Field: f.Name, Reason: fmt.Sprintf("type %s, known as %s", f.Type, k.Type)}
+			}
+		}
+	}
+	return nil
+}
+
+// Validate checks the context schema, returning every invalid field.
+func (s *ContextSchema) Validate() []*ValidationError {
+	v := &validator{}
+	for t, fields := range s.Types {
+		names := make(map[string]bool, len(fields))
+		for i, f := range fields {
+			path := fmt.Sprintf("Types[%s][%d]", t, i)
+			if f.Name == "" {
+				v.add(path+".Name", f.Name, ConstraintRequired)
+			} else if names[f.Name] {
+				v.add(path+".Name", f.Name, "must be unique within its context type")
+			}
+			names[f.Name] = true
+			v.oneOf(path+".Type", f.Type, ContextFieldAny, ContextFieldString, ContextFieldInt,
+				ContextFieldFloat, ContextFieldBool, ContextFieldTime)
+		}
+	}
+	return v.errs
+}
+
+// EffectiveContextSchema returns the request context schema, converting the legacy ContextMaps if
+// the client didn't send one. It returns nil if the request has neither.
+func (r *OpenConnectionDataRequest) EffectiveContextSchema() *ContextSchema {
+	if r.ContextSchema != nil {
+		return r.ContextSchema
+	}
+	if r.ContextMaps != nil {
+		return ContextSchemaFromMaps(r.ContextMaps)
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// ControlActionPause pauses the log stream. Logs are buffered until the stream resumes.
+	ControlActionPause = "pause"
+	// ControlActionResume resumes a paused log stream.
+	ControlActionResume = "resume"
+)
+
+// Control holds the data of a "TransportPackageTypeControl" package, sent by the server, or by
+// operators through it, to pause a client stream during incident mitigation without closing its
+// connections.
+// Action: One of "ControlAction*".
+// ConnectionID: Connection the control applies to. Empty applies it to every connection of the client.
+// Reason: Why the stream is paused, reported in the client pause stats.
+// Until: Time a pause ends on its own. Zero pauses until resumed.
+type Control struct {
+	Action       string    `json:"action"`
+	ConnectionID string    `json:"connectionID,omitempty"`
+	Reason       string    `json:"reason,omitempty"`
+	Until        time.Time `json:"until,omitempty"`
+}
+
+// PauseLogging returns the control pausing the stream of the connection, or every connection of
+// the client if connectionID is empty, until resumed or until the given time if not zero.
+func PauseLogging(connectionID, reason string, until time.Time) *Control {
+	return &Control{Action: ControlActionPause, ConnectionID: connectionID, Reason: reason, Until: until}
+}
+
+// ResumeLogging returns the control resuming the stream of the connection, or every connection of
+// the client if connectionID is empty.
+func ResumeLogging(connectionID string) *Control {
+	return &Control{Action: ControlActionResume, ConnectionID: connectionID}
+}
+
+// Validate checks the control, returning every invalid field.
+func (c *Control) Validate() []*ValidationError {
+	v := &validator{}
+	v.oneOf("action", c.Action, ControlActionPause, ControlActionResume)
+	return v.errs
+}
+
+// PauseStats holds the state and counters of a paused stream.
+// Paused: true if the stream is paused; false otherwise.
+// Reason: Reason of the current pause.
+// PausedAt: Time the current pause started. Zero if not paused.
+// Until: Time the current pause ends on its own. Zero if it lasts until resumed.
+// Buffered: Number of logs buffered during the current pause.
+// BufferedBytes: Estimated size of the logs buffered during the current pause.
+// Dropped: Number of logs dropped during the current pause because the buffers were full.
+// TotalPaused: Time spent paused since the stream started, current pause included.
+type PauseStats struct {
+	Paused        bool
+	Reason        string
+	PausedAt      time.Time
+	Until         time.Time
+	Buffered      uint64
+	BufferedBytes int64
+	Dropped       uint64
+	TotalPaused   time.Duration
+}
+
+// PauseState tracks whether the stream of a connection is paused, and what was held back while it
+// was. Safe for concurrent use.
+type PauseState struct {
+	connectionID string
+	mu           sync.Mutex
+	stats        PauseStats
+	totalPaused  time.Duration
+}
+
+// NewPauseState returns the running stream state of the connection.
+func NewPauseState(connectionID string) *PauseState {
+	return &PauseState{connectionID: connectionID}
+}
+
+// Apply applies the control to the stream. Returns false if the control is for another connection.
+// Pausing a paused stream updates its reason and end time; the counters keep running.
+func (s *PauseState) Apply(c *Control, now time.Time) (bool, error) {
+	if c.ConnectionID != "" && c.ConnectionID != s.connectionID {
+		return false, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire(now)
+	switch c.Action {
+	case ControlActionPause:
+		if !s.stats.Paused {
+			s.stats = PauseStats{Paused: true, PausedAt: now}
+		}
+		s.stats.Reason, s.stats.Until = c.Reason, c.Until
+	case ControlActionResume:
+		s.resume(now)
+	default:
+		return false, fmt.Errorf("unknown control action %q", c.Action)
+	}
+	return true, nil
+}
+
+// Paused returns true if the stream is paused; false otherwise, ending pauses past their end time.
+func (s *PauseState) Paused(now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire(now)
+	return s.stats.Paused
+}
+
+// RecordBuffered records a log of the given estimated size held back by the pause.
+func (s *PauseState) RecordBuffered(size int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.Buffered++
+	s.stats.BufferedBytes += size
+}
+
+// RecordDropped records a log dropped during the pause because the buffers were full.
+func (s *PauseState) RecordDropped() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.Dropped++
+}
+
+// Stats returns the stream state and counters.
+func (s *PauseState) Stats(now time.Time) PauseStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire(now)
+	stats := s.stats
+	stats.TotalPaused = s.totalPaused
+	if stats.Paused {
+		stats.TotalPaused += now.Sub(stats.PausedAt)
+	}
+	return stats
+}
+
+func (s *PauseState) expire(now time.Time) {
+	if s.stats.Paused && !s.stats.Until.IsZero() && !now.Before(s.stats.Until) {
+		s.resume(s.stats.Until)
+	}
+}
+
+func (s *PauseState) resume(now time.Time) {
+	if !s.stats.Paused {
+		return
+	}
+	s.totalPaused += now.Sub(s.stats.PausedAt)
+	s.stats = PauseStats{}
+}
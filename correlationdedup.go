@@ -0,0 +1,201 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultCorrelationDedupFalsePositiveRate is the false positive budget used when the config doesn't set one.
+	DefaultCorrelationDedupFalsePositiveRate = 0.001
+	// DefaultCorrelationAnomalyReportSize is the number of anomalies kept per report when the config doesn't set one.
+	DefaultCorrelationAnomalyReportSize = 100
+)
+
+// CorrelationDedupConfig holds the configuration of the server detection of correlation IDs reused
+// across different clients, a sign of ID generation bugs or spoofing. IDs are remembered in rotating
+// bloom filters, so memory stays constant at the cost of a bounded false positive rate.
+// ExpectedIDs: Number of correlation IDs expected per RotationInterval, used to size the filters.
+// FalsePositiveRate: Target ratio, in (0, 1), of IDs wrongly flagged. Defaults to "DefaultCorrelationDedupFalsePositiveRate".
+// RotationInterval: Time after which the oldest filter is discarded. IDs are remembered between one and two intervals.
+// MaxReportedAnomalies: Number of anomalies kept per report. Defaults to "DefaultCorrelationAnomalyReportSize".
+type CorrelationDedupConfig struct {
+	ExpectedIDs          int
+	FalsePositiveRate    float64
+	RotationInterval     time.Duration
+	MaxReportedAnomalies int
+}
+
+// Validate checks the correlation dedup config, returning every invalid field.
+func (c *CorrelationDedupConfig) Validate() []*ValidationError {
+	v := &validator{}
+	if c.ExpectedIDs < 1 {
+		v.add("ExpectedIDs", c.ExpectedIDs, ConstraintPositive)
+	}
+	if c.FalsePositiveRate < 0 || c.FalsePositiveRate >= 1 {
+		v.add("FalsePositiveRate", c.FalsePositiveRate, "must be in [0, 1)")
+	}
+	if c.RotationInterval <= 0 {
+		v.add("RotationInterval", c.RotationInterval, ConstraintPositive)
+	}
+	v.nonNegative("MaxReportedAnomalies", int64(c.MaxReportedAnomalies))
+	return v.errs
+}
+
+// CorrelationAnomaly holds a correlation ID seen from a client after being seen from another one.
+// CorrelationID: Reused correlation ID.
+// ClientID: Client the ID was last seen from.
+// DetectedAt: Time the reuse was detected.
+type CorrelationAnomaly struct {
+	CorrelationID string
+	ClientID      string
+	DetectedAt    time.Time
+}
+
+// CorrelationAnomalyReport holds the anomalies detected over a period.
+// Since: Start of the period.
+// Until: End of the period.
+// Total: Number of anomalies detected, including the ones not kept in Anomalies.
+// Anomalies: First anomalies detected, up to MaxReportedAnomalies.
+// FalsePositiveRate: Target false positive rate of the detection; the expected share of Total that is spurious.
+type CorrelationAnomalyReport struct {
+	Since             time.Time
+	Until             time.Time
+	Total             uint64
+	Anomalies         []CorrelationAnomaly
+	FalsePositiveRate float64
+}
+
+// bloomFilter is a fixed size bloom filter using double hashing over XXHash64.
+type bloomFilter struct {
+	bits []uint64
+	m    uint64
+	k    int
+}
+
+func newBloomFilter(n int, p float64) *bloomFilter {
+	m := uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	if m < 64 {
+		m = 64
+	}
+	k := int(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &bloomFilter{bits: make([]uint64, (m+63)/64), m: m, k: k}
+}
+
+func (f *bloomFilter) add(key []byte) {
+	h1, h2 := XXHash64(key, 0), XXHash64(key, 1)
+	for i := 0; i < f.k; i++ {
+		bit := (h1 + uint64(i)*h2) % f.m
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+func (f *bloomFilter) contains(key []byte) bool {
+	h1, h2 := XXHash64(key, 0), XXHash64(key, 1)
+	for i := 0; i < f.k; i++ {
+		bit := (h1 + uint64(i)*h2) % f.m
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// correlationFilters holds one generation of the filters: the IDs seen, and the ID and client pairs seen.
+type correlationFilters struct {
+	ids   *bloomFilter
+	pairs *bloomFilter
+}
+
+// CorrelationDedup flags correlation IDs seen from more than one client. Safe for concurrent use.
+type CorrelationDedup struct {
+	cfg       CorrelationDedupConfig
+	mu        sync.Mutex
+	current   correlationFilters
+	previous  correlationFilters
+	rotatedAt time.Time
+	report    CorrelationAnomalyReport
+}
+
+// NewCorrelationDedup returns a detector that has seen no ID.
+func NewCorrelationDedup(cfg *CorrelationDedupConfig, now time.Time) *CorrelationDedup {
+	c := *cfg
+	if c.FalsePositiveRate <= 0 {
+		c.FalsePositiveRate = DefaultCorrelationDedupFalsePositiveRate
+	}
+	if c.MaxReportedAnomalies <= 0 {
+		c.MaxReportedAnomalies = DefaultCorrelationAnomalyReportSize
+	}
+	if c.ExpectedIDs < 1 {
+		c.ExpectedIDs = 1
+	}
+	d := &CorrelationDedup{cfg: c, rotatedAt: now}
+	d.current, d.previous = d.newFilters(), d.newFilters()
+	d.report = CorrelationAnomalyReport{Since: now, FalsePositiveRate: c.FalsePositiveRate}
+	return d
+}
+
+func (d *CorrelationDedup) newFilters() correlationFilters {
+	// Each observation tests both filters of two generations, so the budget is split four ways.
+	p := d.cfg.FalsePositiveRate / 4
+	return correlationFilters{ids: newBloomFilter(d.cfg.ExpectedIDs, p), pairs: newBloomFilter(d.cfg.ExpectedIDs, p)}
+}
+
+// Observe records the correlation ID as seen from the client. Returns the anomaly if the ID was
+// already seen from another client; nil otherwise. Empty IDs are ignored.
+func (d *CorrelationDedup) Observe(correlationID, clientID string, now time.Time) *CorrelationAnomaly {
+	if correlationID == "" {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if now.Sub(d.rotatedAt) >= d.cfg.RotationInterval {
+		d.previous, d.current = d.current, d.newFilters()
+		d.rotatedAt = now
+	}
+	id := []byte(correlationID)
+	pair := make([]byte, 0, len(id)+1+len(clientID))
+	pair = append(append(append(pair, id...), 0), clientID...)
+
+	seen := d.current.ids.contains(id) || d.previous.ids.contains(id)
+	seenFromClient := d.current.pairs.contains(pair) || d.previous.pairs.contains(pair)
+	d.current.ids.add(id)
+	d.current.pairs.add(pair)
+	if !seen || seenFromClient {
+		return nil
+	}
+	a := CorrelationAnomaly{CorrelationID: correlationID, ClientID: clientID, DetectedAt: now}
+	d.report.Total++
+	if len(d.report.Anomalies) < d.cfg.MaxReportedAnomalies {
+		d.report.Anomalies = append(d.report.Anomalies, a)
+	}
+	return &a
+}
+
+// Report returns the anomalies detected since the previous report and starts a new one.
+func (d *CorrelationDedup) Report(now time.Time) *CorrelationAnomalyReport {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	r := d.report
+	r.Until = now
+	d.report = CorrelationAnomalyReport{Since: now, FalsePositiveRate: d.cfg.FalsePositiveRate}
+	return &r
+}
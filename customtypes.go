@@ -0,0 +1,226 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// CustomTypeKey holds the field name carrying the type tag of a tagged custom value.
+	CustomTypeKey = "$type"
+	// CustomValueKey holds the field name carrying the serialized value of a tagged custom value.
+	CustomValueKey = "$value"
+)
+
+var (
+	// ErrInvalidCustomType is returned when registering a custom type with an empty name, a version
+	// lower than 1 or a nil value.
+	ErrInvalidCustomType = errors.New("invalid custom type registration")
+	// ErrDuplicateCustomType is returned when a type or tag is already registered.
+	ErrDuplicateCustomType = errors.New("custom type already registered")
+)
+
+// customTypeRegistry maps type tags to concrete types and back.
+type customTypeRegistry struct {
+	mu     sync.RWMutex
+	byTag  map[string]reflect.Type
+	byType map[reflect.Type]string
+}
+
+var customTypes = &customTypeRegistry{
+	byTag:  make(map[string]reflect.Type),
+	byType: make(map[reflect.Type]string),
+}
+
+// builtinCustomTypeTags holds the tags registered by the package itself, always allowed by a "TypeAllowlist".
+var builtinCustomTypeTags = make(map[string]bool)
+
+func init() {
+	// Types that encoding/json can't restore by itself. string, bool and float64 round trip natively.
+	MustRegisterCustomType("int", 1, int(0))
+	MustRegisterCustomType("int8", 1, int8(0))
+	MustRegisterCustomType("int16", 1, int16(0))
+	MustRegisterCustomType("int32", 1, int32(0))
+	MustRegisterCustomType("int64", 1, int64(0))
+	MustRegisterCustomType("uint", 1, uint(0))
+	MustRegisterCustomType("uint8", 1, uint8(0))
+	MustRegisterCustomType("uint16", 1, uint16(0))
+	MustRegisterCustomType("uint32", 1, uint32(0))
+	MustRegisterCustomType("uint64", 1, uint64(0))
+	MustRegisterCustomType("float32", 1, float32(0))
+	MustRegisterCustomType("time", 1, time.Time{})
+	MustRegisterCustomType("duration", 1, time.Duration(0))
+	for tag := range customTypes.byTag {
+		builtinCustomTypeTags[tag] = true
+	}
+}
+
+// CustomTypeTag returns the versioned type tag for the given name and version, i.e. "name/v1".
+func CustomTypeTag(name string, version int) string {
+	return fmt.Sprintf("%s/v%d", name, version)
+}
+
+// RegisterCustomType registers the concrete type of value under the given name and version so
+// values of that type stored in CorrelationData.Custom are restored with their concrete type when
+// deserialized. Registering a new version of an existing name requires a distinct Go type.
+func RegisterCustomType(name string, version int, value interface{}) error {
+	if name == "" || strings.Contains(name, "/") || version < 1 || value == nil {
+		return ErrInvalidCustomType
+	}
+	tag := CustomTypeTag(name, version)
+	t := reflect.TypeOf(value)
+
+	customTypes.mu.Lock()
+	defer customTypes.mu.Unlock()
+	if _, ok := customTypes.byTag[tag]; ok {
+		return fmt.Errorf("%w: %s", ErrDuplicateCustomType, tag)
+	}
+	if _, ok := customTypes.byType[t]; ok {
+		return fmt.Errorf("%w: %s", ErrDuplicateCustomType, t)
+	}
+	customTypes.byTag[tag] = t
+	customTypes.byType[t] = tag
+	return nil
+}
+
+// MustRegisterCustomType is like RegisterCustomType but panics if the registration fails.
+func MustRegisterCustomType(name string, version int, value interface{}) {
+	if err := RegisterCustomType(name, version, value); err != nil {
+		panic(err)
+	}
+}
+
+// UnregisterCustomType removes the registration for the given name and version, if any.
+func UnregisterCustomType(name string, version int) {
+	tag := CustomTypeTag(name, version)
+
+	customTypes.mu.Lock()
+	defer customTypes.mu.Unlock()
+	if t, ok := customTypes.byTag[tag]; ok {
+		delete(customTypes.byTag, tag)
+		delete(customTypes.byType, t)
+	}
+}
+
+// taggedCustomValue is the serialized form of a registered custom value.
+type taggedCustomValue struct {
+	Type  string          `json:"$type"`
+	Value json.RawMessage `json:"$value"`
+}
+
+// MarshalCustomValue serializes v, wrapping it with its type tag if its type is registered.
+func MarshalCustomValue(v interface{}) ([]byte, error) {
+	if v == nil {
+		return []byte("null"), nil
+	}
+	customTypes.mu.RLock()
+	tag, ok := customTypes.byType[reflect.TypeOf(v)]
+	customTypes.mu.RUnlock()
+
+	raw, err := json.Marshal(v)
+	if err != nil || !ok {
+		return raw, err
+	}
+	return json.Marshal(taggedCustomValue{Type: tag, Value: raw})
+}
+
+// UnmarshalCustomValue deserializes data produced by MarshalCustomValue. Tagged values with a
+// registered tag are restored with their concrete type; values with an unknown tag are returned
+// as the generic decoding of their "$value" field.
+func UnmarshalCustomValue(data []byte) (interface{}, error) {
+	var generic interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return nil, err
+	}
+	m, ok := generic.(map[string]interface{})
+	if !ok || len(m) != 2 {
+		return generic, nil
+	}
+	if _, ok := m[CustomValueKey]; !ok {
+		return generic, nil
+	}
+	tag, ok := m[CustomTypeKey].(string)
+	if !ok {
+		return generic, nil
+	}
+
+	var tagged taggedCustomValue
+	if err := json.Unmarshal(data, &tagged); err != nil {
+		return nil, err
+	}
+	customTypes.mu.RLock()
+	t, ok := customTypes.byTag[tag]
+	customTypes.mu.RUnlock()
+	if !ok {
+		return m[CustomValueKey], nil
+	}
+	ptr := reflect.New(t)
+	if err := json.Unmarshal(tagged.Value, ptr.Interface()); err != nil {
+		return nil, fmt.Errorf("custom value %s: %w", tag, err)
+	}
+	return ptr.Elem().Interface(), nil
+}
+
+// correlationDataJSON mirrors CorrelationData without its custom marshaling methods.
+type correlationDataJSON struct {
+	CorrelationID string
+	Name          string
+	Custom        map[string]json.RawMessage `json:",omitempty"`
+}
+
+// MarshalJSON serializes the correlation data tagging the Custom values whose types are registered.
+func (c CorrelationData) MarshalJSON() ([]byte, error) {
+	out := correlationDataJSON{CorrelationID: c.CorrelationID, Name: c.Name}
+	if c.Custom != nil {
+		out.Custom = make(map[string]json.RawMessage, len(c.Custom))
+		for k, v := range c.Custom {
+			raw, err := MarshalCustomValue(v)
+			if err != nil {
+				return nil, fmt.Errorf("custom field %q: %w", k, err)
+			}
+			out.Custom[k] = raw
+		}
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON deserializes the correlation data restoring the concrete types of tagged Custom values.
+func (c *CorrelationData) UnmarshalJSON(data []byte) error {
+	var in correlationDataJSON
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	c.CorrelationID = in.CorrelationID
+	c.Name = in.Name
+	c.Custom = nil
+	if in.Custom != nil {
+		c.Custom = make(map[string]interface{}, len(in.Custom))
+		for k, raw := range in.Custom {
+			v, err := UnmarshalCustomValue(raw)
+			if err != nil {
+				return fmt.Errorf("custom field %q: %w", k, err)
+			}
+			c.Custom[k] = v
+		}
+	}
+	return nil
+}
@@ -0,0 +1,243 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"container/list"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// DedupStorageMemory keeps the dedup window in memory. The window is lost on restart.
+	DedupStorageMemory = "memory"
+	// DedupStorageBolt keeps the dedup window in a bolt database, through a KVStore adapter.
+	DedupStorageBolt = "bolt"
+)
+
+// DefaultDedupWindow is the dedup window used when the config doesn't set one.
+const DefaultDedupWindow = 5 * time.Minute
+
+// dedupBucket holds the KVStore bucket of the dedup window entries.
+var dedupBucket = []byte("dedup")
+
+// ErrDedupStoreRequired is returned when a persistent dedup storage is configured without a KVStore.
+var ErrDedupStoreRequired = errors.New("dedup storage requires a key-value store")
+
+// DedupWindowConfig holds the server side configuration of the exactly-once dedup window, which
+// drops packages retransmitted after a lost acknowledgement.
+// Window: Time a received package ID is remembered. Defaults to "DefaultDedupWindow".
+// MaxEntries: Maximum number of remembered package IDs. The oldest are pruned first. Zero means no limit.
+// Storage: Where the window is kept. One of "DedupStorage*". Defaults to "DedupStorageMemory".
+// Path: Database file path, for persistent storages.
+// PruneInterval: Interval between two prunes of the expired entries.
+type DedupWindowConfig struct {
+	Window        time.Duration
+	MaxEntries    int
+	Storage       string
+	Path          string
+	PruneInterval time.Duration
+}
+
+// DedupKey identifies a package received by the server.
+// ConnectionID: Connection the package was received on. Empty for client scoped keys.
+// ClientID: Client that sent the package, for packages sent over several connections of the client,
+// e.g. hedged. Empty for connection scoped keys.
+// PackageID: Package ID.
+type DedupKey struct {
+	ConnectionID string
+	ClientID     string
+	PackageID    uint64
+}
+
+// DedupWindow remembers the packages received within the window.
+type DedupWindow interface {
+	// Seen records the package as received at now, returning true if it was already received within the window.
+	Seen(key DedupKey, now time.Time) (bool, error)
+	// Prune forgets the packages received before now minus the window, returning how many were forgotten.
+	Prune(now time.Time) (int, error)
+}
+
+// NewDedupWindow returns the dedup window described by the config. kv is only used by persistent storages.
+func NewDedupWindow(cfg *DedupWindowConfig, kv KVStore) (DedupWindow, error) {
+	c := DedupWindowConfig{}
+	if cfg != nil {
+		c = *cfg
+	}
+	if c.Window <= 0 {
+		c.Window = DefaultDedupWindow
+	}
+	switch c.Storage {
+	case "", DedupStorageMemory:
+		return NewMemoryDedupWindow(c.Window, c.MaxEntries), nil
+	case DedupStorageBolt:
+		if kv == nil {
+			return nil, ErrDedupStoreRequired
+		}
+		return NewKVDedupWindow(kv, c.Window), nil
+	default:
+		return nil, fmt.Errorf("unknown dedup storage %q", c.Storage)
+	}
+}
+
+type dedupEntry struct {
+	key  DedupKey
+	seen time.Time
+}
+
+// MemoryDedupWindow is an in-memory DedupWindow. Safe for concurrent use.
+type MemoryDedupWindow struct {
+	window     time.Duration
+	maxEntries int
+	mu         sync.Mutex
+	entries    map[DedupKey]*list.Element
+	order      *list.List
+}
+
+// NewMemoryDedupWindow returns an empty in-memory window.
+func NewMemoryDedupWindow(window time.Duration, maxEntries int) *MemoryDedupWindow {
+	return &MemoryDedupWindow{
+		window:     window,
+		maxEntries: maxEntries,
+		entries:    make(map[DedupKey]*list.Element),
+		order:      list.New(),
+	}
+}
+
+// Seen implements the DedupWindow interface.
+func (w *MemoryDedupWindow) Seen(key DedupKey, now time.Time) (bool, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if e, ok := w.entries[key]; ok {
+		if now.Sub(e.Value.(*dedupEntry).seen) < w.window {
+			return true, nil
+		}
+		w.order.Remove(e)
+		delete(w.entries, key)
+	}
+	w.entries[key] = w.order.PushBack(&dedupEntry{key: key, seen: now})
+	if w.maxEntries > 0 {
+		for w.order.Len() > w.maxEntries {
+			w.remove(w.order.Front())
+		}
+	}
+	return false, nil
+}
+
+// Prune implements the DedupWindow interface.
+func (w *MemoryDedupWindow) Prune(now time.Time) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	pruned := 0
+	for e := w.order.Front(); e != nil && now.Sub(e.Value.(*dedupEntry).seen) >= w.window; e = w.order.Front() {
+		w.remove(e)
+		pruned++
+	}
+	return pruned, nil
+}
+
+// Len returns the number of remembered packages.
+func (w *MemoryDedupWindow) Len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.order.Len()
+}
+
+func (w *MemoryDedupWindow) remove(e *list.Element) {
+	w.order.Remove(e)
+	delete(w.entries, e.Value.(*dedupEntry).key)
+}
+
+// KVDedupWindow is a DedupWindow persisted in a KVStore, surviving server restarts.
+type KVDedupWindow struct {
+	kv     KVStore
+	window time.Duration
+	mu     sync.Mutex
+}
+
+// NewKVDedupWindow returns a window persisted in kv.
+func NewKVDedupWindow(kv KVStore, window time.Duration) *KVDedupWindow {
+	return &KVDedupWindow{kv: kv, window: window}
+}
+
+// Seen implements the DedupWindow interface.
+func (w *KVDedupWindow) Seen(key DedupKey, now time.Time) (bool, error) {
+	k := dedupKVKey(key)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	v, err := w.kv.Get(dedupBucket, k)
+	if err != nil {
+		return false, err
+	}
+	if len(v) == 8 && now.Sub(time.Unix(0, int64(binary.BigEndian.Uint64(v)))) < w.window {
+		return true, nil
+	}
+	var ts [8]byte
+	binary.BigEndian.PutUint64(ts[:], uint64(now.UnixNano()))
+	return false, w.kv.Put(dedupBucket, k, ts[:])
+}
+
+// Prune implements the DedupWindow interface.
+func (w *KVDedupWindow) Prune(now time.Time) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var expired [][]byte
+	err := w.kv.ForEach(dedupBucket, func(k, v []byte) error {
+		if len(v) != 8 || now.Sub(time.Unix(0, int64(binary.BigEndian.Uint64(v)))) >= w.window {
+			expired = append(expired, append([]byte(nil), k...))
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, k := range expired {
+		if err := w.kv.Delete(dedupBucket, k); err != nil {
+			return 0, err
+		}
+	}
+	return len(expired), nil
+}
+
+// dedupKVKey encodes the key as the connection ID, a zero byte, the client ID followed by a zero byte
+// for client scoped keys, and the big endian package ID.
+func dedupKVKey(key DedupKey) []byte {
+	k := make([]byte, 0, len(key.ConnectionID)+len(key.ClientID)+10)
+	k = append(k, key.ConnectionID...)
+	k = append(k, 0)
+	if key.ClientID != "" {
+		k = append(k, key.ClientID...)
+		k = append(k, 0)
+	}
+	return binary.BigEndian.AppendUint64(k, key.PackageID)
+}
+
+// Validate checks the dedup window config, returning every invalid field.
+func (c *DedupWindowConfig) Validate() []*ValidationError {
+	v := &validator{}
+	v.nonNegative("Window", int64(c.Window))
+	v.nonNegative("MaxEntries", int64(c.MaxEntries))
+	v.nonNegative("PruneInterval", int64(c.PruneInterval))
+	if c.Storage != "" {
+		v.oneOf("Storage", c.Storage, DedupStorageMemory, DedupStorageBolt)
+	}
+	if c.Storage == DedupStorageBolt && c.Path == "" {
+		v.add("Path", c.Path, ConstraintRequired)
+	}
+	return v.errs
+}
@@ -0,0 +1,128 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// ErrInvalidDuration is returned when decoding a Duration that isn't a valid duration string, e.g. "5s".
+var ErrInvalidDuration = errors.New("invalid duration")
+
+// Duration is a time.Duration serialized as a duration string, e.g. "30s" or "5m", in JSON and YAML
+// configs. Invalid strings fail at load time. Plain numbers are decoded as nanoseconds.
+type Duration time.Duration
+
+// Duration returns the duration as a time.Duration.
+func (d Duration) Duration() time.Duration {
+	return time.Duration(d)
+}
+
+// String returns the duration string, e.g. "1m30s".
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// MarshalJSON serializes the duration as a duration string.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON deserializes a duration string or a number of nanoseconds.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		var n int64
+		if err := json.Unmarshal(data, &n); err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidDuration, data)
+		}
+		*d = Duration(n)
+		return nil
+	}
+	return d.UnmarshalText([]byte(s))
+}
+
+// MarshalText serializes the duration as a duration string. Used by YAML and other text encoders.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText deserializes a duration string. An empty string is a zero duration.
+func (d *Duration) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*d = 0
+		return nil
+	}
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return fmt.Errorf("%w: %q", ErrInvalidDuration, text)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalYAML serializes the duration as a duration string. Implements the yaml Marshaler interface.
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return d.String(), nil
+}
+
+// UnmarshalYAML deserializes a duration string or a number of nanoseconds, as UnmarshalJSON does.
+// Implements the yaml.v2 Unmarshaler interface, which yaml.v3 also honors.
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var v interface{}
+	if err := unmarshal(&v); err != nil {
+		return err
+	}
+	switch n := v.(type) {
+	case nil:
+		*d = 0
+		return nil
+	case string:
+		return d.UnmarshalText([]byte(n))
+	case int:
+		*d = Duration(n)
+		return nil
+	case int64:
+		*d = Duration(n)
+		return nil
+	case uint64:
+		if n > math.MaxInt64 {
+			return fmt.Errorf("%w: %d", ErrInvalidDuration, n)
+		}
+		*d = Duration(n)
+		return nil
+	default:
+		return fmt.Errorf("%w: %v", ErrInvalidDuration, v)
+	}
+}
+
+// ShutdownTimeoutDuration returns the server shutdown timeout.
+func (c *ServerConfigs) ShutdownTimeoutDuration() time.Duration {
+	return c.ShutdownTimeout.Duration()
+}
+
+// ReadTimeoutDuration returns the server read timeout.
+func (c *ServerConfigs) ReadTimeoutDuration() time.Duration {
+	return c.ReadTimeout.Duration()
+}
+
+// WriteTimeoutDuration returns the server write timeout.
+func (c *ServerConfigs) WriteTimeoutDuration() time.Duration {
+	return c.WriteTimeout.Duration()
+}
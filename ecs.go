@@ -0,0 +1,154 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// ECSVersion holds the Elastic Common Schema version the converter targets.
+	ECSVersion = "8.11.0"
+	// ECSModeStrict rejects context keys and values that aren't valid ECS labels.
+	ECSModeStrict = byte(0)
+	// ECSModeLenient sanitizes context keys and stringifies non scalar values.
+	ECSModeLenient = byte(1)
+)
+
+// ECSFieldError holds a context field that can't be converted to an ECS label in strict mode.
+type ECSFieldError struct {
+	Key    string
+	Reason string
+}
+
+// Error implements the error interface.
+func (e *ECSFieldError) Error() string {
+	return fmt.Sprintf("ecs: context field %q: %s", e.Key, e.Reason)
+}
+
+// LogDataToECS converts the log into a document keyed by Elastic Common Schema field names.
+func LogDataToECS(ld *LogData, mode byte) (map[string]interface{}, error) {
+	doc := map[string]interface{}{
+		"@timestamp":  ld.Timestamp.UTC().Format(time.RFC3339Nano),
+		"ecs.version": ECSVersion,
+		"log.level":   LevelName(ld.Level),
+		"message":     ld.RenderMessage(),
+	}
+	if ld.Type == LogTypeAudit {
+		doc["event.kind"] = "event"
+		doc["event.category"] = "audit"
+	}
+	if ld.Error != nil {
+		doc["error.message"] = ld.Error.Error()
+	}
+	if ld.CorrelationData != nil && ld.CorrelationData.CorrelationID != "" {
+		doc["trace.id"] = ld.CorrelationData.CorrelationID
+	}
+	if err := addECSLabels(doc, ld.Context(), mode); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// LoggedDataToECS converts the logged data into a document keyed by Elastic Common Schema field names.
+// LoggedData doesn't carry the log timestamp and level, so they are passed by the caller.
+func LoggedDataToECS(d *LoggedData, timestamp time.Time, level byte, mode byte) (map[string]interface{}, error) {
+	doc := map[string]interface{}{
+		"@timestamp":  timestamp.UTC().Format(time.RFC3339Nano),
+		"ecs.version": ECSVersion,
+		"log.level":   LevelName(level),
+		"message":     d.Message,
+	}
+	if d.Type == LogTypeAudit {
+		doc["event.kind"] = "event"
+		doc["event.category"] = "audit"
+	}
+	if d.Error != nil {
+		doc["error.message"] = d.Error.Error()
+	}
+	context := d.Context
+	if id, ok := context[CorrelationIDField].(string); ok && id != "" {
+		doc["trace.id"] = id
+		context = copyContextWithout(context, CorrelationIDField)
+	}
+	if err := addECSLabels(doc, context, mode); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func copyContextWithout(context map[string]interface{}, key string) map[string]interface{} {
+	c := make(map[string]interface{}, len(context))
+	for k, v := range context {
+		if k != key {
+			c[k] = v
+		}
+	}
+	return c
+}
+
+func addECSLabels(doc map[string]interface{}, context map[string]interface{}, mode byte) error {
+	for k, v := range context {
+		key := k
+		if !validECSLabelKey(k) {
+			if mode == ECSModeStrict {
+				return &ECSFieldError{Key: k, Reason: "label keys may only contain letters, digits and underscores"}
+			}
+			key = sanitizeECSLabelKey(k)
+		}
+		switch v.(type) {
+		case string, bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		case nil:
+			continue
+		default:
+			if mode == ECSModeStrict {
+				return &ECSFieldError{Key: k, Reason: fmt.Sprintf("unsupported label value type %T", v)}
+			}
+			v = fmt.Sprint(v)
+		}
+		doc["labels."+key] = v
+	}
+	return nil
+}
+
+func validECSLabelKey(k string) bool {
+	if k == "" {
+		return false
+	}
+	for _, r := range k {
+		if !isECSLabelRune(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func isECSLabelRune(r rune) bool {
+	return r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')
+}
+
+func sanitizeECSLabelKey(k string) string {
+	if k == "" {
+		return "_"
+	}
+	return strings.Map(func(r rune) rune {
+		if isECSLabelRune(r) {
+			return r
+		}
+		return '_'
+	}, k)
+}
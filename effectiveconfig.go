@@ -0,0 +1,127 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const (
+	// ConfigSourceDefault represents a setting taken from the package defaults because the client left it unset.
+	ConfigSourceDefault = "default"
+	// ConfigSourceServer represents a setting pushed by the server in a config update.
+	ConfigSourceServer = "server"
+)
+
+// ConfigDifference holds a setting whose effective value differs from the one the client requested.
+// Field: JSON name of the setting.
+// Requested: Value in the client config.
+// Effective: Value the connection is running with.
+// Source: Where the effective value comes from. One of "ConfigSource*".
+type ConfigDifference struct {
+	Field     string
+	Requested interface{}
+	Effective interface{}
+	Source    string
+}
+
+// ConfigReport holds the comparison of the config a client requested with the one it runs with.
+// AppliedUpdateVersion: Version of the last server config update applied. Zero if none was.
+// Differences: Settings whose effective value differs from the requested one, sorted by field.
+type ConfigReport struct {
+	AppliedUpdateVersion uint64
+	Differences          []*ConfigDifference
+}
+
+// WithDefaults returns a copy of the config with the unset settings that have a package default set to it.
+func (c *ClientConfig) WithDefaults() *ClientConfig {
+	d := *c
+	if len(d.DrainOrder) == 0 {
+		d.DrainOrder = append([]DrainClass(nil), DefaultDrainOrder...)
+	}
+	if d.IDGenerator == nil {
+		d.IDGenerator = &IDGeneratorConfig{Type: IDGeneratorUUIDv7}
+	}
+	if d.ChannelScheduler == nil {
+		s := DefaultChannelSchedulerConfig
+		d.ChannelScheduler = &s
+	}
+	if d.Transport == "" {
+		d.Transport = TransportStream
+	}
+	return &d
+}
+
+// EffectiveConfig returns the config a client runs with: its config with the package defaults, overlaid
+// with the server config updates in version order. Updates not newer than the previous one are ignored,
+// as clients do, and nil updates are skipped. The client config is not modified.
+func EffectiveConfig(client *ClientConfig, updates ...*ClientConfigUpdate) (*ClientConfig, uint64) {
+	cfg := client.WithDefaults()
+	sorted := make([]*ClientConfigUpdate, 0, len(updates))
+	for _, u := range updates {
+		if u != nil {
+			sorted = append(sorted, u)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+	var version uint64
+	for _, u := range sorted {
+		if version > 0 && u.Version <= version {
+			continue
+		}
+		cfg = u.Apply(cfg)
+		version = u.Version
+	}
+	return cfg, version
+}
+
+// NewConfigReport compares the client config with its effective config.
+func NewConfigReport(client *ClientConfig, updates ...*ClientConfigUpdate) *ConfigReport {
+	defaulted := client.WithDefaults()
+	effective, version := EffectiveConfig(client, updates...)
+	report := &ConfigReport{AppliedUpdateVersion: version}
+
+	rv, dv, ev := reflect.ValueOf(client).Elem(), reflect.ValueOf(defaulted).Elem(), reflect.ValueOf(effective).Elem()
+	t := rv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		requested, effectiveValue := rv.Field(i).Interface(), ev.Field(i).Interface()
+		if reflect.DeepEqual(requested, effectiveValue) {
+			continue
+		}
+		source := ConfigSourceDefault
+		if !reflect.DeepEqual(dv.Field(i).Interface(), effectiveValue) {
+			source = ConfigSourceServer
+		}
+		report.Differences = append(report.Differences, &ConfigDifference{
+			Field:     jsonFieldName(t.Field(i)),
+			Requested: requested,
+			Effective: effectiveValue,
+			Source:    source,
+		})
+	}
+	sort.Slice(report.Differences, func(i, j int) bool { return report.Differences[i].Field < report.Differences[j].Field })
+	return report
+}
+
+// jsonFieldName returns the name the struct field is serialized with.
+func jsonFieldName(f reflect.StructField) string {
+	name := strings.Split(f.Tag.Get("json"), ",")[0]
+	if name == "" || name == "-" {
+		return f.Name
+	}
+	return name
+}
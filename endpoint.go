@@ -0,0 +1,167 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// EndpointSchemeTCP represents plain framed stream connections. Endpoints without a scheme use it.
+	EndpointSchemeTCP = "tcp"
+	// EndpointSchemeTLS represents framed stream connections over TLS.
+	EndpointSchemeTLS = "tls"
+	// EndpointSchemeGRPC represents gRPC streaming connections.
+	EndpointSchemeGRPC = "grpc"
+	// EndpointSchemeHTTPS represents batched HTTPS connections. Port defaults to 443.
+	EndpointSchemeHTTPS = "https"
+)
+
+const (
+	// EndpointOptionCompression holds the query option setting the payload compression: "gzip", "zstd" or "none".
+	EndpointOptionCompression = "compression"
+	// EndpointOptionHiPri holds the query option setting the number of high priority connections.
+	EndpointOptionHiPri = "hipri"
+	// EndpointOptionConnections holds the query option setting the number of connections.
+	EndpointOptionConnections = "connections"
+)
+
+// ErrInvalidEndpoint is returned when parsing a malformed endpoint.
+var ErrInvalidEndpoint = errors.New("invalid endpoint")
+
+// Endpoint holds a parsed server endpoint, written as a connection string such as
+// "tls://logs-a:7000,logs-b:7000?compression=zstd&hipri=2". Plain "host:port" strings, as used
+// before connection strings, parse as "tcp" endpoints.
+// Scheme: One of "EndpointScheme*".
+// Hosts: "host:port" addresses, in order of preference.
+// Options: Query options. One of "EndpointOption*".
+type Endpoint struct {
+	Scheme  string
+	Hosts   []string
+	Options map[string]string
+}
+
+// ParseEndpoint parses a connection string. Returns an error wrapping ErrInvalidEndpoint if it's malformed.
+func ParseEndpoint(s string) (*Endpoint, error) {
+	e := &Endpoint{Scheme: EndpointSchemeTCP, Options: map[string]string{}}
+	rest := strings.TrimSpace(s)
+	if i := strings.Index(rest, "://"); i >= 0 {
+		e.Scheme, rest = strings.ToLower(rest[:i]), rest[i+3:]
+	}
+	switch e.Scheme {
+	case EndpointSchemeTCP, EndpointSchemeTLS, EndpointSchemeGRPC, EndpointSchemeHTTPS:
+	default:
+		return nil, fmt.Errorf("%w: unknown scheme %q", ErrInvalidEndpoint, e.Scheme)
+	}
+	hosts, query, _ := strings.Cut(rest, "?")
+	hosts = strings.TrimSuffix(hosts, "/")
+	if hosts == "" {
+		return nil, fmt.Errorf("%w: no host", ErrInvalidEndpoint)
+	}
+	for _, h := range strings.Split(hosts, ",") {
+		host, err := e.parseHost(strings.TrimSpace(h))
+		if err != nil {
+			return nil, err
+		}
+		e.Hosts = append(e.Hosts, host)
+	}
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEndpoint, err)
+	}
+	for k, vs := range values {
+		v := vs[len(vs)-1]
+		switch k {
+		case EndpointOptionCompression:
+			if v != "gzip" && v != "zstd" && v != "none" {
+				return nil, fmt.Errorf("%w: unknown compression %q", ErrInvalidEndpoint, v)
+			}
+		case EndpointOptionHiPri, EndpointOptionConnections:
+			if n, err := strconv.Atoi(v); err != nil || n < 0 {
+				return nil, fmt.Errorf("%w: option %s must be a non negative number, got %q", ErrInvalidEndpoint, k, v)
+			}
+		default:
+			return nil, fmt.Errorf("%w: unknown option %q", ErrInvalidEndpoint, k)
+		}
+		e.Options[k] = v
+	}
+	return e, nil
+}
+
+func (e *Endpoint) parseHost(h string) (string, error) {
+	host, port, err := net.SplitHostPort(h)
+	if err != nil {
+		if e.Scheme != EndpointSchemeHTTPS {
+			return "", fmt.Errorf("%w: %v", ErrInvalidEndpoint, err)
+		}
+		host, port = strings.Trim(h, "[]"), "443"
+	}
+	if host == "" {
+		return "", fmt.Errorf("%w: empty host in %q", ErrInvalidEndpoint, h)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return "", fmt.Errorf("%w: invalid port in %q", ErrInvalidEndpoint, h)
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// Option returns the value of the query option, or "" if not set.
+func (e *Endpoint) Option(name string) string {
+	return e.Options[name]
+}
+
+// IntOption returns the numeric value of the query option, or def if not set.
+func (e *Endpoint) IntOption(name string, def int) int {
+	n, err := strconv.Atoi(e.Options[name])
+	if err != nil {
+		return def
+	}
+	return n
+}
+
+// String returns the connection string of the endpoint, with the options sorted by name.
+func (e *Endpoint) String() string {
+	var b strings.Builder
+	b.WriteString(e.Scheme)
+	b.WriteString("://")
+	b.WriteString(strings.Join(e.Hosts, ","))
+	if len(e.Options) > 0 {
+		keys := make([]string, 0, len(e.Options))
+		for k := range e.Options {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for i, k := range keys {
+			if i == 0 {
+				b.WriteByte('?')
+			} else {
+				b.WriteByte('&')
+			}
+			b.WriteString(url.QueryEscape(k) + "=" + url.QueryEscape(e.Options[k]))
+		}
+	}
+	return b.String()
+}
+
+// ParsedEndpoint returns the parsed client Endpoint.
+func (c *ClientConfig) ParsedEndpoint() (*Endpoint, error) {
+	return ParseEndpoint(c.Endpoint)
+}
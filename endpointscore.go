@@ -0,0 +1,219 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// SelectionPolicyOrdered picks the first endpoint host that isn't failing.
+	SelectionPolicyOrdered = "ordered"
+	// SelectionPolicyLowestLatency picks the host with the lowest measured round trip time.
+	SelectionPolicyLowestLatency = "lowestLatency"
+	// SelectionPolicyLatencyWeighted picks hosts at random, weighted by the inverse of their round trip time.
+	SelectionPolicyLatencyWeighted = "latencyWeighted"
+)
+
+// DefaultEndpointRTTSmoothing is the round trip time smoothing factor used when the config doesn't set one.
+const DefaultEndpointRTTSmoothing = 0.2
+
+// SelectionPolicy holds the configuration of the choice of the endpoint host new connections use,
+// among the hosts of the client Endpoint, from the round trip times measured by health checks.
+// Policy: How the host is chosen. One of "SelectionPolicy*". Defaults to "SelectionPolicyOrdered".
+// Smoothing: Weight, in (0, 1], of the latest round trip time in the moving average. Defaults to "DefaultEndpointRTTSmoothing".
+// StaleAfter: Time after which a host measurement is discarded, so hosts are measured again. Zero keeps measurements.
+type SelectionPolicy struct {
+	Policy     string        `json:"policy"`
+	Smoothing  float64       `json:"smoothing"`
+	StaleAfter time.Duration `json:"staleAfter"`
+}
+
+// Validate checks the selection policy, returning every invalid field.
+func (c *SelectionPolicy) Validate() []*ValidationError {
+	v := &validator{}
+	if c.Policy != "" {
+		v.oneOf("policy", c.Policy, SelectionPolicyOrdered, SelectionPolicyLowestLatency, SelectionPolicyLatencyWeighted)
+	}
+	if c.Smoothing < 0 || c.Smoothing > 1 {
+		v.add("smoothing", c.Smoothing, "must be in [0, 1]")
+	}
+	v.nonNegative("staleAfter", int64(c.StaleAfter))
+	return v.errs
+}
+
+// EndpointScore holds the measurements of an endpoint host.
+// RTT: Moving average of the round trip time. Zero if not measured.
+// Samples: Number of round trips measured.
+// ConsecutiveFailures: Number of failed health checks since the last successful one.
+// MeasuredAt: Time of the last measurement.
+type EndpointScore struct {
+	RTT                 time.Duration
+	Samples             int
+	ConsecutiveFailures int
+	MeasuredAt          time.Time
+}
+
+// EndpointScorer measures the round trip time of each endpoint host and picks the host of new
+// connections per its selection policy. Safe for concurrent use.
+type EndpointScorer struct {
+	cfg    SelectionPolicy
+	mu     sync.Mutex
+	scores map[string]*EndpointScore
+}
+
+// NewEndpointScorer returns a scorer with no measurement, using the given policy or the default one if nil.
+func NewEndpointScorer(policy *SelectionPolicy) *EndpointScorer {
+	var c SelectionPolicy
+	if policy != nil {
+		c = *policy
+	}
+	if c.Policy == "" {
+		c.Policy = SelectionPolicyOrdered
+	}
+	if c.Smoothing <= 0 {
+		c.Smoothing = DefaultEndpointRTTSmoothing
+	}
+	return &EndpointScorer{cfg: c, scores: make(map[string]*EndpointScore)}
+}
+
+// Observe records a round trip time measured to the host.
+func (s *EndpointScorer) Observe(host string, rtt time.Duration, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sc := s.score(host, now)
+	if sc.Samples == 0 {
+		sc.RTT = rtt
+	} else {
+		sc.RTT = time.Duration(s.cfg.Smoothing*float64(rtt) + (1-s.cfg.Smoothing)*float64(sc.RTT))
+	}
+	sc.Samples++
+	sc.ConsecutiveFailures = 0
+	sc.MeasuredAt = now
+}
+
+// ObserveHealthCheck records the round trip of a health check sent to the host, whose echo was
+// received at the given time. Failed echoes are recorded as failures.
+func (s *EndpointScorer) ObserveHealthCheck(host string, sent, echo *HealthCheckData, receivedAt time.Time) {
+	if err := sent.VerifyEcho(echo); err != nil {
+		s.ObserveFailure(host, receivedAt)
+		return
+	}
+	s.Observe(host, receivedAt.Sub(sent.Time), receivedAt)
+}
+
+// ObserveFailure records a failed health check or connection attempt to the host. Failing hosts are
+// only picked when every host is failing.
+func (s *EndpointScorer) ObserveFailure(host string, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sc := s.score(host, now)
+	sc.ConsecutiveFailures++
+	sc.MeasuredAt = now
+}
+
+// Score returns a copy of the host measurements.
+func (s *EndpointScorer) Score(host string, now time.Time) EndpointScore {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return *s.score(host, now)
+}
+
+// Select returns the host new connections should use among the candidates, usually the Endpoint
+// Hosts. r is a uniformly distributed random number in [0, 1) used by the weighted policy. Hosts not
+// measured yet are preferred by the lowest latency policy, so they get measured. Returns "" if there
+// is no candidate.
+func (s *EndpointScorer) Select(candidates []string, r float64, now time.Time) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	healthy := make([]string, 0, len(candidates))
+	for _, h := range candidates {
+		if s.score(h, now).ConsecutiveFailures == 0 {
+			healthy = append(healthy, h)
+		}
+	}
+	if len(healthy) == 0 {
+		healthy = candidates
+	}
+	if len(healthy) == 0 {
+		return ""
+	}
+	switch s.cfg.Policy {
+	case SelectionPolicyLowestLatency:
+		best := healthy[0]
+		for _, h := range healthy {
+			sc := s.scores[h]
+			if sc.Samples == 0 {
+				return h
+			}
+			if sc.RTT < s.scores[best].RTT {
+				best = h
+			}
+		}
+		return best
+	case SelectionPolicyLatencyWeighted:
+		return s.weighted(healthy, r)
+	default:
+		return healthy[0]
+	}
+}
+
+// weighted picks a host with a probability proportional to the inverse of its round trip time.
+// Unmeasured hosts get the average weight of the measured ones. Must be called with mu held.
+func (s *EndpointScorer) weighted(hosts []string, r float64) string {
+	weights := make([]float64, len(hosts))
+	var measured, sum float64
+	for i, h := range hosts {
+		if sc := s.scores[h]; sc.Samples > 0 {
+			rtt := sc.RTT
+			if rtt <= 0 {
+				rtt = 1
+			}
+			weights[i] = 1 / float64(rtt)
+			sum += weights[i]
+			measured++
+		}
+	}
+	avg := 1.0
+	if measured > 0 {
+		avg = sum / measured
+	}
+	var total float64
+	for i := range weights {
+		if weights[i] == 0 {
+			weights[i] = avg
+		}
+		total += weights[i]
+	}
+	target := r * total
+	for i, w := range weights {
+		if target < w {
+			return hosts[i]
+		}
+		target -= w
+	}
+	return hosts[len(hosts)-1]
+}
+
+// score returns the measurements of the host, discarding stale ones. Must be called with mu held.
+func (s *EndpointScorer) score(host string, now time.Time) *EndpointScore {
+	sc, ok := s.scores[host]
+	if !ok || (s.cfg.StaleAfter > 0 && !sc.MeasuredAt.IsZero() && now.Sub(sc.MeasuredAt) > s.cfg.StaleAfter) {
+		sc = &EndpointScore{}
+		s.scores[host] = sc
+	}
+	return sc
+}
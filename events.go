@@ -0,0 +1,125 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// InternalEventKind represents the kind of a client internal event.
+type InternalEventKind string
+
+const (
+	// InternalEventLogsDropped represents logs dropped by the client, e.g. on full channels or budgets.
+	InternalEventLogsDropped = InternalEventKind("logsDropped")
+	// InternalEventReconnect represents a connection re-established to the server.
+	InternalEventReconnect = InternalEventKind("reconnect")
+	// InternalEventConfigReload represents a client config update applied.
+	InternalEventConfigReload = InternalEventKind("configReload")
+	// InternalEventDegradationChanged represents a change of the memory budget degradation step.
+	InternalEventDegradationChanged = InternalEventKind("degradationChanged")
+)
+
+// DefaultInternalEventBuffer is the subscription buffer size used when Subscribe is given none.
+const DefaultInternalEventBuffer = 64
+
+// InternalEvent holds an event of the client logging pipeline, so host applications can observe its
+// health programmatically instead of scraping its stderr output.
+// Kind: One of "InternalEvent*".
+// Time: Time the event happened.
+// Message: Human readable description.
+// ConnectionID: Connection the event relates to. Empty if none.
+// Count: Number of logs the event relates to, e.g. the dropped logs.
+// Level: Level of the logs the event relates to, if any. One of "Level*".
+// Details: Kind specific details, e.g. the reason of the drop or the new degradation step.
+type InternalEvent struct {
+	Kind         InternalEventKind
+	Time         time.Time
+	Message      string
+	ConnectionID string
+	Count        int
+	Level        byte
+	Details      map[string]interface{}
+}
+
+// InternalEventSubscription receives the events published after it subscribed. Events that don't
+// fit in its buffer are dropped, so slow subscribers never block the pipeline.
+type InternalEventSubscription struct {
+	bus     *InternalEventBus
+	ch      chan InternalEvent
+	dropped atomic.Uint64
+}
+
+// Events returns the channel the events are delivered on. It's closed by Close.
+func (s *InternalEventSubscription) Events() <-chan InternalEvent {
+	return s.ch
+}
+
+// Dropped returns the number of events dropped because the buffer was full.
+func (s *InternalEventSubscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Close stops the subscription and closes its channel.
+func (s *InternalEventSubscription) Close() {
+	s.bus.unsubscribe(s)
+}
+
+// InternalEventBus fans out the client internal events to its subscribers. Safe for concurrent use.
+type InternalEventBus struct {
+	mu   sync.RWMutex
+	subs map[*InternalEventSubscription]struct{}
+}
+
+// NewInternalEventBus returns a bus without subscribers.
+func NewInternalEventBus() *InternalEventBus {
+	return &InternalEventBus{subs: make(map[*InternalEventSubscription]struct{})}
+}
+
+// Subscribe returns a subscription buffering up to buffer events. A buffer <= 0 uses "DefaultInternalEventBuffer".
+func (b *InternalEventBus) Subscribe(buffer int) *InternalEventSubscription {
+	if buffer <= 0 {
+		buffer = DefaultInternalEventBuffer
+	}
+	s := &InternalEventSubscription{bus: b, ch: make(chan InternalEvent, buffer)}
+	b.mu.Lock()
+	b.subs[s] = struct{}{}
+	b.mu.Unlock()
+	return s
+}
+
+// Publish delivers the event to every subscriber without blocking.
+func (b *InternalEventBus) Publish(ev InternalEvent) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for s := range b.subs {
+		select {
+		case s.ch <- ev:
+		default:
+			s.dropped.Add(1)
+		}
+	}
+}
+
+func (b *InternalEventBus) unsubscribe(s *InternalEventSubscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subs[s]; ok {
+		delete(b.subs, s)
+		close(s.ch)
+	}
+}
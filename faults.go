@@ -0,0 +1,191 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	// LatencyFixed delays every package by Base.
+	LatencyFixed = "fixed"
+	// LatencyUniform delays packages by Base plus a uniformly distributed time in [0, Jitter).
+	LatencyUniform = "uniform"
+	// LatencyExponential delays packages by Base plus an exponentially distributed time of mean Jitter.
+	LatencyExponential = "exponential"
+)
+
+// ErrInjectedDisconnect is returned by a FaultyTransport when it simulates a dropped connection.
+var ErrInjectedDisconnect = errors.New("injected disconnect")
+
+// LatencyDistribution holds the latency injected on each send.
+// Distribution: One of "Latency*". Defaults to "LatencyFixed".
+// Base: Minimum latency.
+// Jitter: Spread of the latency over Base, per Distribution.
+type LatencyDistribution struct {
+	Distribution string        `json:"distribution"`
+	Base         time.Duration `json:"base"`
+	Jitter       time.Duration `json:"jitter"`
+}
+
+// FaultInjectionConfig holds the faults simulated by a FaultyTransport, used by test transports and
+// by the client chaos mode to validate retries, overflow and failover deterministically.
+// Enabled: true if faults are injected; false otherwise.
+// Seed: Seed of the fault decisions. Runs with the same seed and sends inject the same faults.
+// DropRate: Ratio, in [0, 1], of packages silently dropped.
+// CorruptRate: Ratio, in [0, 1], of packages sent with a corrupted payload.
+// Latency: Latency injected before each send. Nil injects none.
+// DisconnectInterval: Time after which the connection is dropped, failing sends until reopened. Zero never disconnects.
+type FaultInjectionConfig struct {
+	Enabled            bool                 `json:"enabled"`
+	Seed               int64                `json:"seed"`
+	DropRate           float64              `json:"dropRate"`
+	CorruptRate        float64              `json:"corruptRate"`
+	Latency            *LatencyDistribution `json:"latency"`
+	DisconnectInterval time.Duration        `json:"disconnectInterval"`
+}
+
+// Validate checks the fault injection config, returning every invalid field.
+func (c *FaultInjectionConfig) Validate() []*ValidationError {
+	v := &validator{}
+	if c.DropRate < 0 || c.DropRate > 1 {
+		v.add("dropRate", c.DropRate, "must be in [0, 1]")
+	}
+	if c.CorruptRate < 0 || c.CorruptRate > 1 {
+		v.add("corruptRate", c.CorruptRate, "must be in [0, 1]")
+	}
+	if c.Latency != nil {
+		if c.Latency.Distribution != "" {
+			v.oneOf("latency.distribution", c.Latency.Distribution, LatencyFixed, LatencyUniform, LatencyExponential)
+		}
+		v.nonNegative("latency.base", int64(c.Latency.Base))
+		v.nonNegative("latency.jitter", int64(c.Latency.Jitter))
+	}
+	v.nonNegative("disconnectInterval", int64(c.DisconnectInterval))
+	return v.errs
+}
+
+// FaultDecision holds the faults injected on one send.
+// Drop: true if the package is silently dropped; false otherwise.
+// Corrupt: true if the package payload is corrupted; false otherwise.
+// Delay: Latency injected before the send.
+type FaultDecision struct {
+	Drop    bool
+	Corrupt bool
+	Delay   time.Duration
+}
+
+// FaultInjector draws the fault decisions from a seeded source. Safe for concurrent use, though
+// decisions are only reproducible when sends happen in the same order.
+type FaultInjector struct {
+	cfg FaultInjectionConfig
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+// NewFaultInjector returns an injector for the config.
+func NewFaultInjector(cfg *FaultInjectionConfig) *FaultInjector {
+	return &FaultInjector{cfg: *cfg, rnd: rand.New(rand.NewSource(cfg.Seed))}
+}
+
+// Decide returns the faults to inject on the next send. Disabled configs inject none.
+func (f *FaultInjector) Decide() FaultDecision {
+	if !f.cfg.Enabled {
+		return FaultDecision{}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	d := FaultDecision{
+		Drop:    f.rnd.Float64() < f.cfg.DropRate,
+		Corrupt: f.rnd.Float64() < f.cfg.CorruptRate,
+	}
+	if l := f.cfg.Latency; l != nil {
+		d.Delay = l.Base
+		switch l.Distribution {
+		case LatencyUniform:
+			if l.Jitter > 0 {
+				d.Delay += time.Duration(f.rnd.Int63n(int64(l.Jitter)))
+			}
+		case LatencyExponential:
+			d.Delay += time.Duration(f.rnd.ExpFloat64() * float64(l.Jitter))
+		}
+	}
+	return d
+}
+
+// FaultyTransport wraps a transport, injecting the faults of its config into the packages it sends.
+// Clock: Times the disconnects and delays. Nil uses SystemClock.
+type FaultyTransport struct {
+	Transport
+	Clock    Clock
+	injector *FaultInjector
+	interval time.Duration
+
+	mu       sync.Mutex
+	openedAt time.Time
+}
+
+// NewFaultyTransport returns a transport injecting the configured faults into the sends of inner.
+func NewFaultyTransport(inner Transport, cfg *FaultInjectionConfig) *FaultyTransport {
+	t := &FaultyTransport{Transport: inner, injector: NewFaultInjector(cfg)}
+	if cfg.Enabled {
+		t.interval = cfg.DisconnectInterval
+	}
+	return t
+}
+
+// Open implements the Transport interface.
+func (t *FaultyTransport) Open(ctx context.Context, endpoint string) error {
+	if err := t.Transport.Open(ctx, endpoint); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	t.openedAt = clockOrSystem(t.Clock).Now()
+	t.mu.Unlock()
+	return nil
+}
+
+// Send implements the Transport interface. Dropped packages return nil, as lost packages do; the
+// payload of corrupted packages is copied before being altered.
+func (t *FaultyTransport) Send(pkg *TransportPackage) error {
+	if t.interval > 0 {
+		t.mu.Lock()
+		expired := !t.openedAt.IsZero() && clockOrSystem(t.Clock).Now().Sub(t.openedAt) >= t.interval
+		if expired {
+			t.openedAt = time.Time{}
+		}
+		t.mu.Unlock()
+		if expired {
+			t.Transport.Close()
+			return ErrInjectedDisconnect
+		}
+	}
+	d := t.injector.Decide()
+	sleep(t.Clock, d.Delay)
+	if d.Drop {
+		return nil
+	}
+	if d.Corrupt && len(pkg.Payload) > 0 {
+		corrupted := *pkg
+		corrupted.Payload = append([]byte(nil), pkg.Payload...)
+		corrupted.Payload[len(corrupted.Payload)/2] ^= 0xff
+		pkg = &corrupted
+	}
+	return t.Transport.Send(pkg)
+}
@@ -0,0 +1,275 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sync"
+)
+
+// EncryptedFieldMarker holds the field name identifying an encrypted context value, holding its algorithm.
+const EncryptedFieldMarker = "$enc"
+
+// FieldEncryptionConfig holds the configuration of the client side encryption of selected context
+// values, so regulated fields cross third party transport hops encrypted.
+// Enabled: true if matching context values are encrypted; false otherwise.
+// KeyPatterns: Context keys to encrypt, as path.Match patterns, e.g. "user.*".
+// KeySource: Where the AES key is read from. One of "KeySource*".
+// KeyReference: Environment variable name or file path holding the base64 encoded key.
+// KeyID: ID of the key, used by the server to select the decryption key.
+// EmitKeyID: true to send KeyID with every encrypted value; false if the server has a single key.
+type FieldEncryptionConfig struct {
+	Enabled      bool     `json:"enabled"`
+	KeyPatterns  []string `json:"keyPatterns"`
+	KeySource    string   `json:"keySource"`
+	KeyReference string   `json:"keyReference"`
+	KeyID        string   `json:"keyID"`
+	EmitKeyID    bool     `json:"emitKeyID"`
+}
+
+// Validate checks the field encryption config, returning every invalid field.
+func (c *FieldEncryptionConfig) Validate() []*ValidationError {
+	if !c.Enabled {
+		return nil
+	}
+	v := &validator{}
+	if len(c.KeyPatterns) == 0 {
+		v.add("keyPatterns", c.KeyPatterns, ConstraintRequired)
+	}
+	for i, p := range c.KeyPatterns {
+		if _, err := path.Match(p, ""); err != nil {
+			v.add(fmt.Sprintf("keyPatterns[%d]", i), p, "must be a valid pattern")
+		}
+	}
+	v.oneOf("keySource", c.KeySource, KeySourceEnv, KeySourceFile)
+	if c.KeyReference == "" {
+		v.add("keyReference", c.KeyReference, ConstraintRequired)
+	}
+	if c.EmitKeyID && c.KeyID == "" {
+		v.add("keyID", c.KeyID, ConstraintRequired)
+	}
+	return v.errs
+}
+
+// EncryptedField holds an encrypted context value. The plaintext is the JSON encoding of the value,
+// authenticated with the context key so values can't be moved between keys.
+// Algorithm: Encryption algorithm. Only "OverflowEncryptionAESGCM" is supported.
+// KeyID: ID of the encryption key. Empty if the config doesn't emit it.
+// Nonce: Encryption nonce.
+// Data: Ciphertext.
+type EncryptedField struct {
+	Algorithm string `json:"$enc"`
+	KeyID     string `json:"kid,omitempty"`
+	Nonce     []byte `json:"nonce"`
+	Data      []byte `json:"data"`
+}
+
+// ParseEncryptedField returns the encrypted field held by a context value, either as set by the
+// client or as decoded from JSON.
+func ParseEncryptedField(v interface{}) (*EncryptedField, bool) {
+	switch f := v.(type) {
+	case *EncryptedField:
+		return f, true
+	case map[string]interface{}:
+		alg, ok := f[EncryptedFieldMarker].(string)
+		if !ok {
+			return nil, false
+		}
+		kid, _ := f["kid"].(string)
+		nonce, err1 := decodeBase64Field(f["nonce"])
+		data, err2 := decodeBase64Field(f["data"])
+		if err1 != nil || err2 != nil {
+			return nil, false
+		}
+		return &EncryptedField{Algorithm: alg, KeyID: kid, Nonce: nonce, Data: data}, true
+	default:
+		return nil, false
+	}
+}
+
+func decodeBase64Field(v interface{}) ([]byte, error) {
+	s, ok := v.(string)
+	if !ok {
+		return nil, fmt.Errorf("not a base64 string: %T", v)
+	}
+	return base64.StdEncoding.DecodeString(s)
+}
+
+// FieldEncryptor encrypts the context values matching the config key patterns. Safe for concurrent use.
+type FieldEncryptor struct {
+	patterns []string
+	keyID    string
+	aead     cipher.AEAD
+}
+
+// NewFieldEncryptor loads the config key and returns its encryptor.
+func NewFieldEncryptor(cfg *FieldEncryptionConfig) (*FieldEncryptor, error) {
+	key, err := loadAESKey(cfg.KeySource, cfg.KeyReference)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAESGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	e := &FieldEncryptor{patterns: cfg.KeyPatterns, aead: aead}
+	if cfg.EmitKeyID {
+		e.keyID = cfg.KeyID
+	}
+	return e, nil
+}
+
+// Matches returns true if the context key must be encrypted; false otherwise.
+func (e *FieldEncryptor) Matches(key string) bool {
+	for _, p := range e.patterns {
+		if ok, _ := path.Match(p, key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// EncryptField encrypts a context value.
+func (e *FieldEncryptor) EncryptField(key string, value interface{}) (*EncryptedField, error) {
+	plaintext, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, e.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return &EncryptedField{
+		Algorithm: OverflowEncryptionAESGCM,
+		KeyID:     e.keyID,
+		Nonce:     nonce,
+		Data:      e.aead.Seal(nil, nonce, plaintext, []byte(key)),
+	}, nil
+}
+
+// EncryptLogData replaces the log context values whose keys match with their encryption. The
+// ContextMap is copied, so slices shared with the caller are not modified.
+func (e *FieldEncryptor) EncryptLogData(ld *LogData) error {
+	var pairs []interface{}
+	for i := 0; i+1 < len(ld.ContextMap); i += 2 {
+		key := fmt.Sprint(ld.ContextMap[i])
+		if !e.Matches(key) {
+			continue
+		}
+		if _, ok := ld.ContextMap[i+1].(*EncryptedField); ok {
+			continue
+		}
+		f, err := e.EncryptField(key, ld.ContextMap[i+1])
+		if err != nil {
+			return fmt.Errorf("context %q: %w", key, err)
+		}
+		if pairs == nil {
+			pairs = append([]interface{}(nil), ld.ContextMap...)
+		}
+		pairs[i+1] = f
+	}
+	if pairs != nil {
+		ld.ContextMap = pairs
+	}
+	return nil
+}
+
+// FieldDecryptor decrypts the encrypted context values on the server.
+type FieldDecryptor interface {
+	DecryptField(key string, f *EncryptedField) (interface{}, error)
+}
+
+// AESFieldDecryptor is a FieldDecryptor holding AES-GCM keys by key ID. Safe for concurrent use.
+type AESFieldDecryptor struct {
+	mu         sync.RWMutex
+	keys       map[string]cipher.AEAD
+	defaultKey string
+}
+
+// NewAESFieldDecryptor returns a decryptor without keys.
+func NewAESFieldDecryptor() *AESFieldDecryptor {
+	return &AESFieldDecryptor{keys: make(map[string]cipher.AEAD)}
+}
+
+// AddKey adds a key. The first key added is used for values without key ID.
+func (d *AESFieldDecryptor) AddKey(keyID string, key []byte) error {
+	aead, err := newAESGCM(key)
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.keys) == 0 {
+		d.defaultKey = keyID
+	}
+	d.keys[keyID] = aead
+	return nil
+}
+
+// DecryptField implements the FieldDecryptor interface.
+func (d *AESFieldDecryptor) DecryptField(key string, f *EncryptedField) (interface{}, error) {
+	if f.Algorithm != OverflowEncryptionAESGCM {
+		return nil, fmt.Errorf("unsupported field encryption algorithm %q", f.Algorithm)
+	}
+	keyID := f.KeyID
+	d.mu.RLock()
+	if keyID == "" {
+		keyID = d.defaultKey
+	}
+	aead, ok := d.keys[keyID]
+	d.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownOverflowKey, keyID)
+	}
+	plaintext, err := aead.Open(nil, f.Nonce, f.Data, []byte(key))
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	if err := json.Unmarshal(plaintext, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// DecryptContext replaces the encrypted values of the context with their decryption, in place.
+func DecryptContext(context map[string]interface{}, d FieldDecryptor) error {
+	for k, v := range context {
+		f, ok := ParseEncryptedField(v)
+		if !ok {
+			continue
+		}
+		plain, err := d.DecryptField(k, f)
+		if err != nil {
+			return fmt.Errorf("context %q: %w", k, err)
+		}
+		context[k] = plain
+	}
+	return nil
+}
+
+func newAESGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidOverflowKey, err)
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,102 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// FlushRequest holds the data of a "TransportPackageTypeFlushRequest" package.
+// FlushToken: Client generated token identifying the flush.
+// Before: Every log buffered before this time should be persisted before the flush completes.
+type FlushRequest struct {
+	FlushToken string
+	Before     time.Time
+}
+
+// FlushResult holds the data of a "TransportPackageTypeFlushResult" package sent by the server once
+// every log covered by a flush request has been persisted.
+// FlushToken: Token of the completed flush request.
+// LastPersistedPackageID: ID of the last package persisted before the flush completed.
+// Duration: Time the server took to complete the flush.
+// Error: Error message if the flush failed; empty otherwise.
+type FlushResult struct {
+	FlushToken             string
+	LastPersistedPackageID uint64
+	Duration               time.Duration
+	Error                  string
+}
+
+// NewFlushRequest returns a flush request with a random token covering the logs buffered before the given time.
+func NewFlushRequest(before time.Time) (*FlushRequest, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return &FlushRequest{FlushToken: hex.EncodeToString(b), Before: before}, nil
+}
+
+// FlushTracker notifies callers waiting for flush requests to complete.
+type FlushTracker struct {
+	mu      sync.Mutex
+	pending map[string]chan *FlushResult
+}
+
+// NewFlushTracker returns an empty flush tracker.
+func NewFlushTracker() *FlushTracker {
+	return &FlushTracker{pending: make(map[string]chan *FlushResult)}
+}
+
+// Register starts tracking the given flush request and returns a channel that receives its result.
+func (t *FlushTracker) Register(req *FlushRequest) <-chan *FlushResult {
+	ch := make(chan *FlushResult, 1)
+	t.mu.Lock()
+	t.pending[req.FlushToken] = ch
+	t.mu.Unlock()
+	return ch
+}
+
+// Complete delivers the result to the caller waiting on its token. Returns false if the token is unknown.
+func (t *FlushTracker) Complete(res *FlushResult) bool {
+	t.mu.Lock()
+	ch, ok := t.pending[res.FlushToken]
+	delete(t.pending, res.FlushToken)
+	t.mu.Unlock()
+	if ok {
+		ch <- res
+	}
+	return ok
+}
+
+// Cancel stops tracking the given token, closing its result channel.
+func (t *FlushTracker) Cancel(token string) {
+	t.mu.Lock()
+	ch, ok := t.pending[token]
+	delete(t.pending, token)
+	t.mu.Unlock()
+	if ok {
+		close(ch)
+	}
+}
+
+// Pending returns the number of flush requests waiting for a result.
+func (t *FlushTracker) Pending() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.pending)
+}
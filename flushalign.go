@@ -0,0 +1,62 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import "time"
+
+// FlushAlignment holds the alignment of the batch flushes to wall clock boundaries, multiple of
+// SendBatchLogsInterval, so per minute aggregations downstream see consistent batches. A per
+// connection jitter keeps a fleet of clients from flushing all at once.
+// Enabled: true to align flushes; false to flush SendBatchLogsInterval after the previous flush.
+// MaxJitter: Maximum delay added after each boundary. Each connection gets a stable delay in [0, MaxJitter).
+type FlushAlignment struct {
+	Enabled   bool          `json:"enabled"`
+	MaxJitter time.Duration `json:"maxJitter"`
+}
+
+// Validate checks the flush alignment, returning every invalid field.
+func (a *FlushAlignment) Validate() []*ValidationError {
+	v := &validator{}
+	v.nonNegative("maxJitter", int64(a.MaxJitter))
+	return v.errs
+}
+
+// FlushJitter returns the stable flush delay of the connection, in [0, maxJitter).
+func FlushJitter(connectionID string, maxJitter time.Duration) time.Duration {
+	if maxJitter <= 0 {
+		return 0
+	}
+	return time.Duration(XXHash64([]byte(connectionID), 0) % uint64(maxJitter))
+}
+
+// NextFlush returns the time of the next batch flush of the connection after now. Unaligned
+// flushes happen interval after now; aligned ones at the next multiple of interval since the Unix
+// epoch, plus the connection jitter.
+func (a *FlushAlignment) NextFlush(now time.Time, interval time.Duration, connectionID string) time.Time {
+	if a == nil || !a.Enabled || interval <= 0 {
+		return now.Add(interval)
+	}
+	jitter := FlushJitter(connectionID, a.MaxJitter)
+	sinceEpoch := time.Duration(now.UnixNano())
+	boundary := sinceEpoch % interval
+	if boundary < 0 {
+		boundary += interval
+	}
+	next := now.Add(-boundary).Add(jitter)
+	for !next.After(now) {
+		next = next.Add(interval)
+	}
+	return next
+}
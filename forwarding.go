@@ -0,0 +1,96 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"strings"
+	"time"
+)
+
+// UpstreamForwardingConfig holds the configuration of the fan-in aggregation mode, where the server
+// acts as a regional aggregator re-forwarding the received log groups to a central server with the
+// same client models, enabling tiered topologies.
+// Enabled: true if received log groups are forwarded upstream; false otherwise.
+// Endpoint: Address of the central server.
+// AppName: App name the aggregator connects upstream as.
+// NumberOfConnections: Number of connections to the central server.
+// TargetBatchSize: Number of logs re-batched together before being forwarded.
+// MaxBatchBytes: Maximum estimated size of a forwarded batch. Zero means no limit.
+// FlushInterval: Maximum time logs wait to be re-batched, as a duration string, e.g. "1s".
+// CredentialSource: Where the upstream credential is read from. One of "KeySource*". Empty sends none.
+// CredentialReference: Environment variable name or file path holding the upstream credential.
+// PreserveIdentity: true to forward the identity of the originating clients with each batch; false
+// to forward every batch as the aggregator.
+type UpstreamForwardingConfig struct {
+	Enabled             bool
+	Endpoint            string
+	AppName             string
+	NumberOfConnections int
+	TargetBatchSize     int
+	MaxBatchBytes       int
+	FlushInterval       Duration
+	CredentialSource    string
+	CredentialReference string
+	PreserveIdentity    bool
+}
+
+// Validate checks the upstream forwarding config, returning every invalid field.
+func (c *UpstreamForwardingConfig) Validate() []*ValidationError {
+	if !c.Enabled {
+		return nil
+	}
+	v := &validator{}
+	if c.Endpoint == "" {
+		v.add("Endpoint", c.Endpoint, ConstraintRequired)
+	}
+	if c.NumberOfConnections < 1 {
+		v.add("NumberOfConnections", c.NumberOfConnections, ConstraintPositive)
+	}
+	v.nonNegative("TargetBatchSize", int64(c.TargetBatchSize))
+	v.nonNegative("MaxBatchBytes", int64(c.MaxBatchBytes))
+	v.nonNegative("FlushInterval", int64(c.FlushInterval))
+	if c.CredentialSource != "" {
+		v.oneOf("CredentialSource", c.CredentialSource, KeySourceEnv, KeySourceFile)
+		if c.CredentialReference == "" {
+			v.add("CredentialReference", c.CredentialReference, ConstraintRequired)
+		}
+	}
+	return v.errs
+}
+
+// ClientConfig returns the client config of the upstream connections.
+func (c *UpstreamForwardingConfig) ClientConfig() *ClientConfig {
+	return &ClientConfig{
+		Enabled:                c.Enabled,
+		AppName:                c.AppName,
+		Endpoint:               c.Endpoint,
+		NumberOfConnections:    c.NumberOfConnections,
+		TargetMessageBatchSize: c.TargetBatchSize,
+		SendBatchLogsInterval:  time.Duration(c.FlushInterval),
+		Level:                  LevelDebug,
+	}
+}
+
+// LoadCredential reads the upstream credential. Returns "" if no CredentialSource is set.
+func (c *UpstreamForwardingConfig) LoadCredential() (string, error) {
+	if c.CredentialSource == "" {
+		return "", nil
+	}
+	secret, err := readSecret(c.CredentialSource, c.CredentialReference)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(secret), nil
+}
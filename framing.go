@@ -0,0 +1,167 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// MaxFramePayloadSize is the largest payload ReadTransportPackage accepts.
+const MaxFramePayloadSize = 64 << 20
+
+const (
+	// frameFlagFlushImmediately holds the frame flags bit carrying the package FlushImmediately flag.
+	frameFlagFlushImmediately = byte(0x01)
+	// frameFlagSchema holds the frame flags bit set when the frame carries a content type and schema ID.
+	frameFlagSchema = byte(0x02)
+)
+
+// maxFrameContentTypeSize is the longest content type ReadTransportPackage accepts.
+const maxFrameContentTypeSize = 255
+
+// ErrFrameTooLarge is returned when a framed package payload exceeds "MaxFramePayloadSize".
+var ErrFrameTooLarge = errors.New("framed payload too large")
+
+// WriteTransportPackage writes the package ID, type, retry count and payload to w, in the frame
+// layout every peer reads. It is WriteFrame without negotiated capabilities.
+func WriteTransportPackage(w io.Writer, pkg *TransportPackage) error {
+	return WriteFrame(w, pkg, 0)
+}
+
+// ReadTransportPackage reads a package written by WriteTransportPackage. It is ReadFrame without
+// negotiated capabilities.
+func ReadTransportPackage(r *bufio.Reader) (*TransportPackage, error) {
+	return ReadFrame(r, 0)
+}
+
+// WriteFrame writes the package to w in the frame layout of the capabilities negotiated with the
+// peer. Data is not written; it is expected to be already serialized into Payload.
+// Frame layout: uvarint ID | type byte | retry count byte | [flags] | uvarint payload length | payload.
+// The flags byte is only written to peers that negotiated "CapabilityFrameFlags". It carries the
+// FlushImmediately flag, and whether the schema part follows: uvarint content type length |
+// content type | uvarint schema ID. The schema part is only written to peers that also negotiated
+// "CapabilityPayloadSchema". Packages sent to other peers lose their flags and schema.
+func WriteFrame(w io.Writer, pkg *TransportPackage, caps Capabilities) error {
+	if len(pkg.ContentType) > maxFrameContentTypeSize {
+		return fmt.Errorf("content type longer than %d bytes", maxFrameContentTypeSize)
+	}
+	header := make([]byte, 0, 4*binary.MaxVarintLen64+3+len(pkg.ContentType))
+	header = binary.AppendUvarint(header, pkg.ID)
+	header = append(header, byte(pkg.Type), pkg.RetryCount)
+	if caps.Has(CapabilityFrameFlags) {
+		var flags byte
+		if pkg.FlushImmediately {
+			flags |= frameFlagFlushImmediately
+		}
+		hasSchema := caps.Has(CapabilityPayloadSchema) && (pkg.ContentType != "" || pkg.SchemaID != 0)
+		if hasSchema {
+			flags |= frameFlagSchema
+		}
+		header = append(header, flags)
+		if hasSchema {
+			header = binary.AppendUvarint(header, uint64(len(pkg.ContentType)))
+			header = append(header, pkg.ContentType...)
+			header = binary.AppendUvarint(header, uint64(pkg.SchemaID))
+		}
+	}
+	header = binary.AppendUvarint(header, uint64(len(pkg.Payload)))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(pkg.Payload)
+	return err
+}
+
+// ReadFrame reads a package written by WriteFrame with the same capabilities. Returns io.EOF if r
+// is at the end of the stream before the frame starts, io.ErrUnexpectedEOF if it ends mid frame.
+func ReadFrame(r *bufio.Reader, caps Capabilities) (*TransportPackage, error) {
+	id, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	pkg := &TransportPackage{ID: id}
+	typ, err := r.ReadByte()
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	pkg.Type = PackageType(typ)
+	if pkg.RetryCount, err = r.ReadByte(); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if caps.Has(CapabilityFrameFlags) {
+		flags, err := r.ReadByte()
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		pkg.FlushImmediately = flags&frameFlagFlushImmediately != 0
+		if flags&frameFlagSchema != 0 {
+			if !caps.Has(CapabilityPayloadSchema) {
+				return nil, errors.New("frame schema part without the payload schema capability")
+			}
+			if err := readFrameSchema(r, pkg); err != nil {
+				return nil, err
+			}
+		}
+	}
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if size > MaxFramePayloadSize {
+		return nil, fmt.Errorf("%w: %d bytes", ErrFrameTooLarge, size)
+	}
+	pkg.Payload = make([]byte, size)
+	if _, err := io.ReadFull(r, pkg.Payload); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return pkg, nil
+}
+
+// readFrameSchema reads the content type and schema ID of a frame into the package.
+func readFrameSchema(r *bufio.Reader, pkg *TransportPackage) error {
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+	if size > maxFrameContentTypeSize {
+		return fmt.Errorf("%w: %d bytes content type", ErrFrameTooLarge, size)
+	}
+	contentType := make([]byte, size)
+	if _, err := io.ReadFull(r, contentType); err != nil {
+		return unexpectedEOF(err)
+	}
+	pkg.ContentType = string(contentType)
+	id, err := binary.ReadUvarint(r)
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+	if id > math.MaxUint32 {
+		return fmt.Errorf("schema ID %d out of range", id)
+	}
+	pkg.SchemaID = uint32(id)
+	return nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
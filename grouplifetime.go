@@ -0,0 +1,148 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// GroupSealClosed represents a group closed explicitly by the correlation flow.
+	GroupSealClosed = "closed"
+	// GroupSealIdle represents a group that received no log for IdleTimeout.
+	GroupSealIdle = "idle"
+	// GroupSealLifetime represents a group open for longer than MaxLifetime.
+	GroupSealLifetime = "lifetime"
+	// GroupSealFull represents a group that reached MaxLogsPerGroup.
+	GroupSealFull = "full"
+)
+
+// GroupLifetimeConfig holds the limits of the correlated log groups, so correlations that never end
+// explicitly don't grow memory without bounds.
+// IdleTimeout: Time without logs after which a group is sealed. Zero means no timeout.
+// MaxLifetime: Time after the first log after which a group is sealed. Zero means no limit.
+// MaxLogsPerGroup: Number of logs after which a group is sealed. Later logs start a new group. Zero means no limit.
+type GroupLifetimeConfig struct {
+	IdleTimeout     time.Duration `json:"idleTimeout"`
+	MaxLifetime     time.Duration `json:"maxLifetime"`
+	MaxLogsPerGroup int           `json:"maxLogsPerGroup"`
+}
+
+// Validate checks the group lifetime config, returning every invalid field.
+func (c *GroupLifetimeConfig) Validate() []*ValidationError {
+	v := &validator{}
+	v.nonNegative("idleTimeout", int64(c.IdleTimeout))
+	v.nonNegative("maxLifetime", int64(c.MaxLifetime))
+	v.nonNegative("maxLogsPerGroup", int64(c.MaxLogsPerGroup))
+	return v.errs
+}
+
+type trackedGroup struct {
+	group    *LogGroup
+	openedAt time.Time
+	lastLog  time.Time
+}
+
+// GroupTracker accumulates correlated logs into groups and dispatches each group once sealed,
+// explicitly or by the lifetime limits. Safe for concurrent use.
+type GroupTracker struct {
+	cfg      GroupLifetimeConfig
+	dispatch func(group *LogGroup, reason string)
+	mu       sync.Mutex
+	groups   map[string]*trackedGroup
+}
+
+// NewGroupTracker returns a tracker calling dispatch with every sealed group and the "GroupSeal*" reason.
+// dispatch is called without the tracker lock held.
+func NewGroupTracker(cfg *GroupLifetimeConfig, dispatch func(group *LogGroup, reason string)) *GroupTracker {
+	return &GroupTracker{cfg: *cfg, dispatch: dispatch, groups: make(map[string]*trackedGroup)}
+}
+
+// Add appends the log to the group of its correlation, opening the group if needed. Logs without
+// correlation data can't be grouped and are dispatched alone.
+func (t *GroupTracker) Add(ld *LogData, now time.Time) {
+	if ld.CorrelationData == nil || ld.CorrelationData.CorrelationID == "" {
+		t.dispatch(&LogGroup{CorrelationData: ld.CorrelationData, Logs: []*LogData{ld}}, GroupSealClosed)
+		return
+	}
+	id := ld.CorrelationData.CorrelationID
+	t.mu.Lock()
+	g, ok := t.groups[id]
+	if !ok {
+		g = &trackedGroup{group: &LogGroup{CorrelationData: ld.CorrelationData}, openedAt: now}
+		t.groups[id] = g
+	}
+	g.group.Logs = append(g.group.Logs, ld)
+	g.lastLog = now
+	var full *LogGroup
+	if t.cfg.MaxLogsPerGroup > 0 && len(g.group.Logs) >= t.cfg.MaxLogsPerGroup {
+		delete(t.groups, id)
+		full = g.group
+	}
+	t.mu.Unlock()
+	if full != nil {
+		t.dispatch(full, GroupSealFull)
+	}
+}
+
+// Close seals and dispatches the group of the correlation, if open.
+func (t *GroupTracker) Close(correlationID string) {
+	t.mu.Lock()
+	g, ok := t.groups[correlationID]
+	delete(t.groups, correlationID)
+	t.mu.Unlock()
+	if ok {
+		t.dispatch(g.group, GroupSealClosed)
+	}
+}
+
+// Expire seals and dispatches the groups past their idle timeout or maximum lifetime, oldest first.
+// It should be called periodically, e.g. every IdleTimeout / 2.
+func (t *GroupTracker) Expire(now time.Time) {
+	type sealed struct {
+		g      *trackedGroup
+		reason string
+	}
+	var expired []sealed
+	t.mu.Lock()
+	for id, g := range t.groups {
+		reason := ""
+		switch {
+		case t.cfg.MaxLifetime > 0 && now.Sub(g.openedAt) >= t.cfg.MaxLifetime:
+			reason = GroupSealLifetime
+		case t.cfg.IdleTimeout > 0 && now.Sub(g.lastLog) >= t.cfg.IdleTimeout:
+			reason = GroupSealIdle
+		default:
+			continue
+		}
+		delete(t.groups, id)
+		expired = append(expired, sealed{g: g, reason: reason})
+	}
+	t.mu.Unlock()
+
+	sort.Slice(expired, func(i, j int) bool { return expired[i].g.openedAt.Before(expired[j].g.openedAt) })
+	for _, s := range expired {
+		t.dispatch(s.g.group, s.reason)
+	}
+}
+
+// Open returns the number of open groups.
+func (t *GroupTracker) Open() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.groups)
+}
@@ -0,0 +1,107 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrHealthCheckNonceMismatch is returned when a health check echo doesn't carry the nonce of the health check sent.
+	ErrHealthCheckNonceMismatch = errors.New("health check nonce mismatch")
+	// ErrHealthCheckPayloadMismatch is returned when a health check echo doesn't carry the payload of the health check sent.
+	ErrHealthCheckPayloadMismatch = errors.New("health check payload mismatch")
+)
+
+// HealthCheckData holds the data of a "TransportPackageTypeHealhcheck" package. The server echoes
+// the nonce and payload back so the client can tell a live round trip from a stale or corrupted one.
+// Time: Time the health check was sent.
+// SLO: Delivery SLO evaluation of the client. Nil if the client has no delivery SLO.
+// Nonce: Random value the server must echo back.
+// Payload: Random padding the server must echo back, sized per the client HealthCheckPayloadSize to
+// probe MTU and latency under realistic package sizes. Empty if no payload size is set.
+type HealthCheckData struct {
+	Time    time.Time
+	SLO     *SLOState
+	Nonce   string
+	Payload []byte
+}
+
+// NewHealthCheckData returns health check data sent at the given time, with a random nonce and
+// payloadSize random payload bytes.
+func NewHealthCheckData(now time.Time, payloadSize int) (*HealthCheckData, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	d := &HealthCheckData{Time: now, Nonce: hex.EncodeToString(nonce)}
+	if payloadSize > 0 {
+		d.Payload = make([]byte, payloadSize)
+		if _, err := rand.Read(d.Payload); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// Echo returns the health check data the server sends back for the received health check.
+func (d *HealthCheckData) Echo() *HealthCheckData {
+	return &HealthCheckData{Time: d.Time, Nonce: d.Nonce, Payload: d.Payload}
+}
+
+// VerifyEcho checks the echo received for the health check. Returns ErrHealthCheckNonceMismatch or
+// ErrHealthCheckPayloadMismatch if the echo doesn't match; nil otherwise.
+func (d *HealthCheckData) VerifyEcho(echo *HealthCheckData) error {
+	if echo == nil || echo.Nonce != d.Nonce {
+		return ErrHealthCheckNonceMismatch
+	}
+	if !bytes.Equal(echo.Payload, d.Payload) {
+		return ErrHealthCheckPayloadMismatch
+	}
+	return nil
+}
+
+// HealthCheckFailures counts the consecutive failed health checks of a connection against the
+// client HealthCheckFailureThreshold. Not safe for concurrent use; each connection owns one.
+type HealthCheckFailures struct {
+	threshold   int
+	consecutive int
+}
+
+// NewHealthCheckFailures returns a counter deeming connections unhealthy after threshold consecutive failures.
+func NewHealthCheckFailures(threshold int) *HealthCheckFailures {
+	return &HealthCheckFailures{threshold: threshold}
+}
+
+// Record adds the outcome of a health check, where err is the send error or the VerifyEcho error.
+// Echo mismatches count as failures. Returns true if the connection is unhealthy; false otherwise.
+func (f *HealthCheckFailures) Record(err error) bool {
+	if err == nil {
+		f.consecutive = 0
+		return false
+	}
+	f.consecutive++
+	return f.Unhealthy()
+}
+
+// Unhealthy returns true if the failure threshold was reached; false otherwise. A zero threshold
+// deems connections unhealthy on the first failure.
+func (f *HealthCheckFailures) Unhealthy() bool {
+	return f.consecutive > 0 && f.consecutive >= f.threshold
+}
@@ -0,0 +1,183 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// ErrNoHedgeSenders is returned when hedging a package without any connection to send it over.
+var ErrNoHedgeSenders = errors.New("no connection to send the package over")
+
+// HedgingConfig holds the configuration of the hedged sends of high priority packages: a package not
+// acknowledged within Delay is sent again over the next high priority connection, primary then
+// backup, cutting the tail latency of critical error delivery. Every copy keeps the package ID, so
+// the server drops the duplicates with a DedupMiddleware scoped to the client, which requires the
+// high priority package IDs to be unique per client.
+// Enabled: true if high priority packages are hedged; false if they are sent once.
+// Delay: Time waited for an acknowledgement before sending the next copy. Failed sends are hedged right away.
+// MaxHedges: Maximum number of copies sent on top of the first send.
+// CancelOnFirstAck: true to cancel the copies in flight once one is acknowledged; false to let them complete.
+type HedgingConfig struct {
+	Enabled          bool          `json:"enabled"`
+	Delay            time.Duration `json:"delay"`
+	MaxHedges        int           `json:"maxHedges"`
+	CancelOnFirstAck bool          `json:"cancelOnFirstAck"`
+}
+
+// Validate checks the hedging config, returning every invalid field.
+func (c *HedgingConfig) Validate() []*ValidationError {
+	v := &validator{}
+	v.nonNegative("delay", int64(c.Delay))
+	v.nonNegative("maxHedges", int64(c.MaxHedges))
+	return v.errs
+}
+
+// HedgeSender sends a package over a connection, returning once it's acknowledged or failed. The
+// package is shared by the concurrent copies and must not be modified.
+type HedgeSender func(ctx context.Context, pkg *TransportPackage) error
+
+// HedgingStats holds the hedging counters.
+// Packages: Number of packages sent.
+// Hedges: Number of copies sent on top of the first sends.
+// HedgeWins: Number of packages first acknowledged on a hedge rather than on their first send.
+// Failed: Number of packages every copy of which failed.
+type HedgingStats struct {
+	Packages  uint64
+	Hedges    uint64
+	HedgeWins uint64
+	Failed    uint64
+}
+
+// Hedger sends the high priority packages with hedging. Safe for concurrent use.
+// Clock: Times the hedge delays. Nil uses SystemClock.
+type Hedger struct {
+	Clock     Clock
+	config    HedgingConfig
+	packages  atomic.Uint64
+	hedges    atomic.Uint64
+	hedgeWins atomic.Uint64
+	failed    atomic.Uint64
+}
+
+// NewHedger returns a hedger with the given config. A nil config never hedges.
+func NewHedger(cfg *HedgingConfig) *Hedger {
+	h := &Hedger{}
+	if cfg != nil {
+		h.config = *cfg
+	}
+	return h
+}
+
+// NewHedger returns the hedger of the high priority packages, per the Hedging config.
+func (c *ClientConfig) NewHedger() *Hedger {
+	return NewHedger(c.Hedging)
+}
+
+type hedgeResult struct {
+	sender int
+	err    error
+}
+
+// Send sends the package over senders[0], hedging it over the next senders, in order, per the config.
+// Only "TransportPackageTypeHiPriLog" packages are hedged; others go over senders[0] only. Returns
+// the index of the sender that first acknowledged the package, or the error of the last failed copy.
+func (h *Hedger) Send(ctx context.Context, pkg *TransportPackage, senders []HedgeSender) (int, error) {
+	if len(senders) == 0 {
+		return -1, ErrNoHedgeSenders
+	}
+	h.packages.Add(1)
+	attempts := 1
+	if h.config.Enabled && pkg.Type == TransportPackageTypeHiPriLog {
+		attempts = min(len(senders), 1+h.config.MaxHedges)
+	}
+	if h.config.CancelOnFirstAck {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+	}
+
+	results := make(chan hedgeResult, attempts)
+	launched := 0
+	launch := func() {
+		i := launched
+		launched++
+		if i > 0 {
+			h.hedges.Add(1)
+		}
+		go func() { results <- hedgeResult{sender: i, err: senders[i](ctx, pkg)} }()
+	}
+	launch()
+	if attempts > 1 {
+		t := clockOrSystem(h.Clock).NewTimer(h.config.Delay)
+		defer t.Stop()
+		// rearm restarts the delay, dropping a tick already fired so it doesn't hedge right away.
+		rearm := func() {
+			if !t.Stop() {
+				select {
+				case <-t.C():
+				default:
+				}
+			}
+			t.Reset(h.config.Delay)
+		}
+		for done, lastErr := 0, error(nil); ; {
+			select {
+			case r := <-results:
+				if r.err == nil {
+					if r.sender > 0 {
+						h.hedgeWins.Add(1)
+					}
+					return r.sender, nil
+				}
+				done, lastErr = done+1, r.err
+				if launched < attempts {
+					launch()
+					rearm()
+				} else if done == launched {
+					h.failed.Add(1)
+					return -1, lastErr
+				}
+			case <-t.C():
+				if launched < attempts {
+					launch()
+					t.Reset(h.config.Delay)
+				}
+			case <-ctx.Done():
+				h.failed.Add(1)
+				return -1, ctx.Err()
+			}
+		}
+	}
+	r := <-results
+	if r.err != nil {
+		h.failed.Add(1)
+		return -1, r.err
+	}
+	return 0, nil
+}
+
+// Stats returns a copy of the hedging counters.
+func (h *Hedger) Stats() HedgingStats {
+	return HedgingStats{
+		Packages:  h.packages.Load(),
+		Hedges:    h.hedges.Load(),
+		HedgeWins: h.hedgeWins.Load(),
+		Failed:    h.failed.Load(),
+	}
+}
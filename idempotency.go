@@ -0,0 +1,204 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"container/list"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultIdempotencyRetention is the idempotency key retention used when the config doesn't set one.
+	DefaultIdempotencyRetention = 10 * time.Minute
+	// DefaultIdempotencyMaxKeys is the maximum number of retained idempotency keys used when the config doesn't set one.
+	DefaultIdempotencyMaxKeys = 100000
+)
+
+// IdempotencyConfig holds the server side retention of the connection open idempotency keys.
+// Retention: Time a key is remembered after the open it was sent with. Defaults to "DefaultIdempotencyRetention".
+// MaxKeys: Maximum number of remembered keys. The oldest are forgotten first. Defaults to "DefaultIdempotencyMaxKeys".
+type IdempotencyConfig struct {
+	Retention time.Duration
+	MaxKeys   int
+}
+
+// Validate checks the idempotency config, returning every invalid field.
+func (c *IdempotencyConfig) Validate() []*ValidationError {
+	v := &validator{}
+	v.nonNegative("Retention", int64(c.Retention))
+	v.nonNegative("MaxKeys", int64(c.MaxKeys))
+	return v.errs
+}
+
+// NewIdempotencyKey returns a random idempotency key. Clients generate one per logical open and
+// reuse it for every retry of that open.
+func NewIdempotencyKey() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
+
+type idempotencyKey struct {
+	clientID string
+	key      string
+}
+
+type idempotencyEntry struct {
+	key          idempotencyKey
+	connectionID string
+	createdAt    time.Time
+	// pending is closed once the open holding the reservation is remembered or released. Nil once it is.
+	pending chan struct{}
+}
+
+// IdempotencyCache remembers the connection allocated for each open idempotency key, scoped by client
+// ID, so retried opens return the original connection. Safe for concurrent use.
+type IdempotencyCache struct {
+	retention time.Duration
+	maxKeys   int
+	mu        sync.Mutex
+	entries   map[idempotencyKey]*list.Element
+	order     *list.List
+}
+
+// NewIdempotencyCache returns an empty cache with the config retention.
+func NewIdempotencyCache(cfg *IdempotencyConfig) *IdempotencyCache {
+	c := &IdempotencyCache{
+		retention: DefaultIdempotencyRetention,
+		maxKeys:   DefaultIdempotencyMaxKeys,
+		entries:   make(map[idempotencyKey]*list.Element),
+		order:     list.New(),
+	}
+	if cfg != nil && cfg.Retention > 0 {
+		c.retention = cfg.Retention
+	}
+	if cfg != nil && cfg.MaxKeys > 0 {
+		c.maxKeys = cfg.MaxKeys
+	}
+	return c
+}
+
+// ConnectionID returns the connection allocated for the request idempotency key, if the key is still retained.
+func (c *IdempotencyCache) ConnectionID(req *OpenConnectionDataRequest, now time.Time) (string, bool) {
+	if req.IdempotencyKey == "" {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[idempotencyKey{clientID: req.ClientID, key: req.IdempotencyKey}]
+	if !ok {
+		return "", false
+	}
+	entry := e.Value.(*idempotencyEntry)
+	if now.Sub(entry.createdAt) >= c.retention {
+		c.remove(e)
+		return "", false
+	}
+	if entry.pending != nil {
+		return "", false
+	}
+	return entry.connectionID, true
+}
+
+// Reserve atomically returns the connection allocated for the request idempotency key or reserves
+// the key for the caller, so concurrent retries of the same open don't both open a connection. If
+// another open holds the key, it returns a channel closed once that open is remembered or released,
+// after which the caller calls Reserve again. A caller getting reserved set to true must call
+// Remember once the connection is opened, or Release if the open failed. Requests without a key are
+// always reserved.
+func (c *IdempotencyCache) Reserve(req *OpenConnectionDataRequest, now time.Time) (connectionID string, reserved bool, wait <-chan struct{}) {
+	if req.IdempotencyKey == "" {
+		return "", true, nil
+	}
+	k := idempotencyKey{clientID: req.ClientID, key: req.IdempotencyKey}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[k]; ok {
+		entry := e.Value.(*idempotencyEntry)
+		switch {
+		case now.Sub(entry.createdAt) >= c.retention:
+			c.remove(e)
+		case entry.pending != nil:
+			return "", false, entry.pending
+		default:
+			return entry.connectionID, false, nil
+		}
+	}
+	c.push(&idempotencyEntry{key: k, createdAt: now, pending: make(chan struct{})})
+	return "", true, nil
+}
+
+// Release drops the reservation of the request idempotency key after a failed open, waking the
+// opens waiting on it. Completed keys are kept.
+func (c *IdempotencyCache) Release(req *OpenConnectionDataRequest) {
+	if req.IdempotencyKey == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[idempotencyKey{clientID: req.ClientID, key: req.IdempotencyKey}]; ok && e.Value.(*idempotencyEntry).pending != nil {
+		c.remove(e)
+	}
+}
+
+// Remember records the connection allocated for the request idempotency key, completing its
+// reservation if any. Requests without a key are ignored.
+func (c *IdempotencyCache) Remember(req *OpenConnectionDataRequest, connectionID string, now time.Time) {
+	if req.IdempotencyKey == "" {
+		return
+	}
+	k := idempotencyKey{clientID: req.ClientID, key: req.IdempotencyKey}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[k]; ok {
+		c.remove(e)
+	}
+	c.push(&idempotencyEntry{key: k, connectionID: connectionID, createdAt: now})
+}
+
+// push adds the entry, forgetting the oldest keys beyond the maximum.
+func (c *IdempotencyCache) push(entry *idempotencyEntry) {
+	c.entries[entry.key] = c.order.PushBack(entry)
+	for c.order.Len() > c.maxKeys {
+		c.remove(c.order.Front())
+	}
+}
+
+// Prune forgets the keys older than the retention, returning how many were forgotten.
+func (c *IdempotencyCache) Prune(now time.Time) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	pruned := 0
+	for e := c.order.Front(); e != nil && now.Sub(e.Value.(*idempotencyEntry).createdAt) >= c.retention; e = c.order.Front() {
+		c.remove(e)
+		pruned++
+	}
+	return pruned
+}
+
+func (c *IdempotencyCache) remove(e *list.Element) {
+	entry := e.Value.(*idempotencyEntry)
+	c.order.Remove(e)
+	delete(c.entries, entry.key)
+	if entry.pending != nil {
+		close(entry.pending)
+		entry.pending = nil
+	}
+}
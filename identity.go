@@ -0,0 +1,120 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"os"
+	"time"
+)
+
+const (
+	// IdentityHostnameField holds the context field name of the client hostname.
+	IdentityHostnameField = "hostname"
+	// IdentityPodIDField holds the context field name of the client pod ID.
+	IdentityPodIDField = "podID"
+	// IdentityClusterNameField holds the context field name of the client Kubernetes cluster name.
+	IdentityClusterNameField = "clusterName"
+	// IdentityNamespaceField holds the context field name of the client Kubernetes namespace.
+	IdentityNamespaceField = "namespace"
+	// IdentityContainerIDField holds the context field name of the client container ID.
+	IdentityContainerIDField = "containerID"
+	// IdentityRegionField holds the context field name of the client region.
+	IdentityRegionField = "region"
+	// IdentityZoneField holds the context field name of the client zone.
+	IdentityZoneField = "zone"
+	// IdentityInstanceIDField holds the context field name of the client instance ID.
+	IdentityInstanceIDField = "instanceID"
+	// IdentityVersionField holds the context field name of the client binary version.
+	IdentityVersionField = "version"
+	// IdentityStartupTimeField holds the context field name of the client startup time.
+	IdentityStartupTimeField = "startupTime"
+)
+
+// processStartTime approximates the time the client process started.
+var processStartTime = time.Now()
+
+// ClientIdentity holds metadata identifying the client instance sending the logs.
+// Hostname: Client host name.
+// PodID: Kubernetes pod ID, if any.
+// ClusterName: Kubernetes cluster name, if any.
+// Namespace: Kubernetes namespace of the pod, if any.
+// ContainerID: Container ID, if any.
+// Region: Cloud region the client is running in.
+// Zone: Cloud zone the client is running in.
+// InstanceID: Cloud instance (VM) ID.
+// Version: Client binary version.
+// StartupTime: Time the client process started.
+type ClientIdentity struct {
+	Hostname    string    `json:"hostname,omitempty"`
+	PodID       string    `json:"podID,omitempty"`
+	ClusterName string    `json:"clusterName,omitempty"`
+	Namespace   string    `json:"namespace,omitempty"`
+	ContainerID string    `json:"containerID,omitempty"`
+	Region      string    `json:"region,omitempty"`
+	Zone        string    `json:"zone,omitempty"`
+	InstanceID  string    `json:"instanceID,omitempty"`
+	Version     string    `json:"version,omitempty"`
+	StartupTime time.Time `json:"startupTime"`
+}
+
+// NewClientIdentity returns an identity with the host name and startup time of the current
+// process filled in. The remaining fields are environment specific and are left to the caller.
+func NewClientIdentity(version string) *ClientIdentity {
+	hostname, _ := os.Hostname()
+	return &ClientIdentity{
+		Hostname:    hostname,
+		Version:     version,
+		StartupTime: processStartTime,
+	}
+}
+
+// Labels returns the non empty identity fields keyed by their "Identity*Field" names.
+func (ci *ClientIdentity) Labels() map[string]interface{} {
+	labels := make(map[string]interface{})
+	if ci == nil {
+		return labels
+	}
+	add := func(k, v string) {
+		if v != "" {
+			labels[k] = v
+		}
+	}
+	add(IdentityHostnameField, ci.Hostname)
+	add(IdentityPodIDField, ci.PodID)
+	add(IdentityClusterNameField, ci.ClusterName)
+	add(IdentityNamespaceField, ci.Namespace)
+	add(IdentityContainerIDField, ci.ContainerID)
+	add(IdentityRegionField, ci.Region)
+	add(IdentityZoneField, ci.Zone)
+	add(IdentityInstanceIDField, ci.InstanceID)
+	add(IdentityVersionField, ci.Version)
+	if !ci.StartupTime.IsZero() {
+		labels[IdentityStartupTimeField] = ci.StartupTime
+	}
+	return labels
+}
+
+// MergeInto adds the identity labels to the log context, without overriding values set by the log itself.
+func (ci *ClientIdentity) MergeInto(context map[string]interface{}) map[string]interface{} {
+	if context == nil {
+		context = make(map[string]interface{})
+	}
+	for k, v := range ci.Labels() {
+		if _, ok := context[k]; !ok {
+			context[k] = v
+		}
+	}
+	return context
+}
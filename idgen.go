@@ -0,0 +1,222 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// IDGeneratorUUIDv7 represents the time sortable UUID version 7 generator (RFC 9562).
+	IDGeneratorUUIDv7 = "uuidv7"
+	// IDGeneratorULID represents the monotonic ULID generator.
+	IDGeneratorULID = "ulid"
+	// IDGeneratorSnowflake represents the Snowflake-style 64 bit generator. Requires a unique node ID per process.
+	IDGeneratorSnowflake = "snowflake"
+)
+
+// IDGenerator generates unique IDs for correlations and connections.
+type IDGenerator interface {
+	NewID() (string, error)
+}
+
+// IDGeneratorConfig holds the ID generation configuration.
+// Type: Generator type. One of "IDGenerator*". Defaults to "IDGeneratorUUIDv7".
+// NodeID: Node ID used by the Snowflake generator, in [0, 1023].
+type IDGeneratorConfig struct {
+	Type   string `json:"type"`
+	NodeID int64  `json:"nodeID"`
+}
+
+// NewIDGenerator returns the generator described by the config.
+func NewIDGenerator(cfg *IDGeneratorConfig) (IDGenerator, error) {
+	if cfg == nil {
+		return &UUIDv7Generator{}, nil
+	}
+	switch cfg.Type {
+	case "", IDGeneratorUUIDv7:
+		return &UUIDv7Generator{}, nil
+	case IDGeneratorULID:
+		return &ULIDGenerator{}, nil
+	case IDGeneratorSnowflake:
+		return NewSnowflakeGenerator(cfg.NodeID)
+	default:
+		return nil, fmt.Errorf("unknown id generator %q", cfg.Type)
+	}
+}
+
+// UUIDv7Generator generates UUID version 7 IDs: a 48 bit millisecond timestamp followed by random bits.
+type UUIDv7Generator struct{}
+
+// NewID implements the IDGenerator interface.
+func (g *UUIDv7Generator) NewID() (string, error) {
+	var u [16]byte
+	if _, err := rand.Read(u[6:]); err != nil {
+		return "", err
+	}
+	ms := uint64(time.Now().UnixMilli())
+	u[0] = byte(ms >> 40)
+	u[1] = byte(ms >> 32)
+	u[2] = byte(ms >> 24)
+	u[3] = byte(ms >> 16)
+	u[4] = byte(ms >> 8)
+	u[5] = byte(ms)
+	u[6] = 0x70 | u[6]&0x0f
+	u[8] = 0x80 | u[8]&0x3f
+
+	var s [36]byte
+	hex.Encode(s[0:8], u[0:4])
+	s[8] = '-'
+	hex.Encode(s[9:13], u[4:6])
+	s[13] = '-'
+	hex.Encode(s[14:18], u[6:8])
+	s[18] = '-'
+	hex.Encode(s[19:23], u[8:10])
+	s[23] = '-'
+	hex.Encode(s[24:], u[10:])
+	return string(s[:]), nil
+}
+
+const crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ULIDGenerator generates monotonic ULIDs: a 48 bit millisecond timestamp followed by 80 random
+// bits, incremented instead of regenerated within the same millisecond so IDs stay sorted.
+type ULIDGenerator struct {
+	mu      sync.Mutex
+	lastMs  uint64
+	entropy [10]byte
+}
+
+// NewID implements the IDGenerator interface.
+func (g *ULIDGenerator) NewID() (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ms := uint64(time.Now().UnixMilli())
+	if ms <= g.lastMs {
+		ms = g.lastMs
+		if !incrementBytes(g.entropy[:]) {
+			ms++
+		}
+	}
+	if ms != g.lastMs {
+		if _, err := rand.Read(g.entropy[:]); err != nil {
+			return "", err
+		}
+		g.lastMs = ms
+	}
+
+	var u [16]byte
+	u[0] = byte(ms >> 40)
+	u[1] = byte(ms >> 32)
+	u[2] = byte(ms >> 24)
+	u[3] = byte(ms >> 16)
+	u[4] = byte(ms >> 8)
+	u[5] = byte(ms)
+	copy(u[6:], g.entropy[:])
+	return encodeCrockford(u), nil
+}
+
+// incrementBytes increments the big endian number in place, returning false on overflow.
+func incrementBytes(b []byte) bool {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i]++
+		if b[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeCrockford encodes the 128 bits as 26 Crockford base32 characters.
+func encodeCrockford(u [16]byte) string {
+	hi := binary.BigEndian.Uint64(u[:8])
+	lo := binary.BigEndian.Uint64(u[8:])
+	var s [26]byte
+	for i := 25; i >= 0; i-- {
+		s[i] = crockfordAlphabet[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(s[:])
+}
+
+// SnowflakeEpoch is the epoch of the Snowflake generator timestamps.
+var SnowflakeEpoch = time.Date(2018, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+const (
+	snowflakeNodeBits     = 10
+	snowflakeSequenceBits = 12
+	snowflakeMaxNode      = 1<<snowflakeNodeBits - 1
+	snowflakeMaxSequence  = 1<<snowflakeSequenceBits - 1
+)
+
+// SnowflakeGenerator generates 64 bit IDs made of a 41 bit millisecond timestamp since
+// "SnowflakeEpoch", a 10 bit node ID and a 12 bit sequence. IDs are unique only if every
+// process uses a distinct node ID.
+type SnowflakeGenerator struct {
+	mu       sync.Mutex
+	nodeID   int64
+	lastMs   int64
+	sequence int64
+}
+
+// NewSnowflakeGenerator returns a Snowflake generator for the given node ID.
+func NewSnowflakeGenerator(nodeID int64) (*SnowflakeGenerator, error) {
+	if nodeID < 0 || nodeID > snowflakeMaxNode {
+		return nil, fmt.Errorf("snowflake node id %d out of range [0, %d]", nodeID, snowflakeMaxNode)
+	}
+	return &SnowflakeGenerator{nodeID: nodeID}, nil
+}
+
+// NewID implements the IDGenerator interface.
+func (g *SnowflakeGenerator) NewID() (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ms := time.Since(SnowflakeEpoch).Milliseconds()
+	if ms < g.lastMs {
+		ms = g.lastMs
+	}
+	if ms == g.lastMs {
+		g.sequence = (g.sequence + 1) & snowflakeMaxSequence
+		if g.sequence == 0 {
+			ms++
+		}
+	} else {
+		g.sequence = 0
+	}
+	g.lastMs = ms
+	id := ms<<(snowflakeNodeBits+snowflakeSequenceBits) | g.nodeID<<snowflakeSequenceBits | g.sequence
+	return strconv.FormatInt(id, 10), nil
+}
+
+// Validate checks the ID generator config, returning every invalid field.
+func (c *IDGeneratorConfig) Validate() []*ValidationError {
+	v := &validator{}
+	if c.Type != "" {
+		v.oneOf("type", c.Type, IDGeneratorUUIDv7, IDGeneratorULID, IDGeneratorSnowflake)
+	}
+	if c.Type == IDGeneratorSnowflake && (c.NodeID < 0 || c.NodeID > snowflakeMaxNode) {
+		v.add("nodeID", c.NodeID, fmt.Sprintf("must be in [0, %d]", snowflakeMaxNode))
+	}
+	return v.errs
+}
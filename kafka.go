@@ -0,0 +1,127 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"text/template"
+)
+
+const (
+	// KafkaAcksNone doesn't wait for any acknowledgement of the records.
+	KafkaAcksNone = "none"
+	// KafkaAcksLeader waits for the partition leader to write the records.
+	KafkaAcksLeader = "leader"
+	// KafkaAcksAll waits for every in-sync replica to write the records.
+	KafkaAcksAll = "all"
+)
+
+const (
+	// KafkaCompressionNone sends the record batches uncompressed.
+	KafkaCompressionNone = "none"
+	// KafkaCompressionGzip compresses the record batches with gzip.
+	KafkaCompressionGzip = "gzip"
+	// KafkaCompressionSnappy compresses the record batches with snappy.
+	KafkaCompressionSnappy = "snappy"
+	// KafkaCompressionLZ4 compresses the record batches with lz4.
+	KafkaCompressionLZ4 = "lz4"
+	// KafkaCompressionZstd compresses the record batches with zstd.
+	KafkaCompressionZstd = "zstd"
+)
+
+const (
+	// KafkaSASLPlain authenticates with SASL/PLAIN.
+	KafkaSASLPlain = "PLAIN"
+	// KafkaSASLScramSHA256 authenticates with SASL/SCRAM-SHA-256.
+	KafkaSASLScramSHA256 = "SCRAM-SHA-256"
+	// KafkaSASLScramSHA512 authenticates with SASL/SCRAM-SHA-512.
+	KafkaSASLScramSHA512 = "SCRAM-SHA-512"
+)
+
+// ErrInvalidKafkaTopic is returned when the topic template of a record renders an empty or incomplete topic.
+var ErrInvalidKafkaTopic = errors.New("invalid Kafka topic")
+
+// KafkaOutputConfig holds the configuration of the Kafka output of a server logging config. Records
+// are mapped from the logged data per the KafkaMapping config.
+// Brokers: Bootstrap brokers, as "host:port".
+// TopicTemplate: Go text/template rendering the topic of each record over the key extractor document,
+// e.g. "logs.{{.Labels.tenant}}". See PartitionKeyExtractor.
+// Acks: Acknowledgement awaited for the records. One of "KafkaAcks*". Defaults to "KafkaAcksAll".
+// Compression: Compression of the record batches. One of "KafkaCompression*". Defaults to "KafkaCompressionNone".
+// SASLMechanism: SASL mechanism authenticating to the brokers. One of "KafkaSASL*". Empty disables SASL.
+// SASLSecretRef: Reference of the secret holding the SASL username and password.
+// TLSSecretRef: Reference of the secret holding the CA and client certificates. Empty connects in plaintext.
+type KafkaOutputConfig struct {
+	Brokers       []string
+	TopicTemplate string
+	Acks          string
+	Compression   string
+	SASLMechanism string
+	SASLSecretRef string
+	TLSSecretRef  string
+}
+
+// Validate checks the Kafka output config, returning every invalid field.
+func (c *KafkaOutputConfig) Validate() []*ValidationError {
+	v := &validator{}
+	if len(c.Brokers) == 0 {
+		v.add("Brokers", c.Brokers, ConstraintRequired)
+	}
+	for i, broker := range c.Brokers {
+		if _, _, err := net.SplitHostPort(broker); err != nil {
+			v.add(fmt.Sprintf("Brokers[%d]", i), broker, "must be host:port")
+		}
+	}
+	if c.TopicTemplate == "" {
+		v.add("TopicTemplate", c.TopicTemplate, ConstraintRequired)
+	} else if _, err := parseTopicTemplate(c.TopicTemplate); err != nil {
+		v.add("TopicTemplate", c.TopicTemplate, "must be a valid template")
+	}
+	if c.Acks != "" {
+		v.oneOf("Acks", c.Acks, KafkaAcksNone, KafkaAcksLeader, KafkaAcksAll)
+	}
+	if c.Compression != "" {
+		v.oneOf("Compression", c.Compression, KafkaCompressionNone, KafkaCompressionGzip, KafkaCompressionSnappy, KafkaCompressionLZ4, KafkaCompressionZstd)
+	}
+	if c.SASLMechanism != "" {
+		v.oneOf("SASLMechanism", c.SASLMechanism, KafkaSASLPlain, KafkaSASLScramSHA256, KafkaSASLScramSHA512)
+		if c.SASLSecretRef == "" {
+			v.add("SASLSecretRef", c.SASLSecretRef, ConstraintRequired)
+		}
+	}
+	return v.errs
+}
+
+// EffectiveAcks returns the config acks, or "KafkaAcksAll" if none is set.
+func (c *KafkaOutputConfig) EffectiveAcks() string {
+	if c.Acks != "" {
+		return c.Acks
+	}
+	return KafkaAcksAll
+}
+
+// EffectiveCompression returns the config compression, or "KafkaCompressionNone" if none is set.
+func (c *KafkaOutputConfig) EffectiveCompression() string {
+	if c.Compression != "" {
+		return c.Compression
+	}
+	return KafkaCompressionNone
+}
+
+func parseTopicTemplate(text string) (*template.Template, error) {
+	return template.New("topic").Option("missingkey=zero").Parse(text)
+}
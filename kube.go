@@ -0,0 +1,334 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"time"
+)
+
+const (
+	// KubeAPIVersion holds the API group and version of the Kubernetes logging config objects.
+	KubeAPIVersion = "logging.liviapetrin.io/v1alpha1"
+	// KubeKindClientConfig holds the kind of the "LoggingClientConfig" objects.
+	KubeKindClientConfig = "LoggingClientConfig"
+	// KubeKindServerConfig holds the kind of the "LoggingServerConfig" objects.
+	KubeKindServerConfig = "LoggingServerConfig"
+)
+
+// kubeNamePattern matches the DNS-1123 subdomain names Kubernetes requires for object names.
+var kubeNamePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+
+// TypeMeta holds the API version and kind of a Kubernetes object, mirroring the Kubernetes
+// apimachinery type so operators can manage the logging configs without depending on it here.
+// APIVersion: API group and version. See "KubeAPIVersion".
+// Kind: Object kind. One of "KubeKind*".
+type TypeMeta struct {
+	APIVersion string `json:"apiVersion,omitempty"`
+	Kind       string `json:"kind,omitempty"`
+}
+
+// ObjectMeta holds the metadata of a Kubernetes object, mirroring the apimachinery fields operators use.
+// Name: Object name, unique within its namespace.
+// Namespace: Object namespace.
+// UID: Unique ID set by the API server.
+// ResourceVersion: Opaque version of the object, for optimistic concurrency.
+// Generation: Sequence number of the spec changes, set by the API server.
+// CreationTimestamp: Time the object was created.
+// Labels: Key-value pairs used to select objects.
+// Annotations: Key-value pairs holding arbitrary metadata.
+type ObjectMeta struct {
+	Name              string            `json:"name,omitempty"`
+	Namespace         string            `json:"namespace,omitempty"`
+	UID               string            `json:"uid,omitempty"`
+	ResourceVersion   string            `json:"resourceVersion,omitempty"`
+	Generation        int64             `json:"generation,omitempty"`
+	CreationTimestamp time.Time         `json:"creationTimestamp,omitempty"`
+	Labels            map[string]string `json:"labels,omitempty"`
+	Annotations       map[string]string `json:"annotations,omitempty"`
+}
+
+// ListMeta holds the metadata of a Kubernetes object list.
+// ResourceVersion: Opaque version of the list.
+// Continue: Token of the next page, if any.
+type ListMeta struct {
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+	Continue        string `json:"continue,omitempty"`
+}
+
+// ConfigCondition holds an observation of a logging config object state.
+// Type: Condition type, e.g. "Applied".
+// Status: "True", "False" or "Unknown".
+// Reason: Machine readable reason of the last transition.
+// Message: Human readable details.
+// LastTransitionTime: Time the status last changed.
+type ConfigCondition struct {
+	Type               string    `json:"type"`
+	Status             string    `json:"status"`
+	Reason             string    `json:"reason,omitempty"`
+	Message            string    `json:"message,omitempty"`
+	LastTransitionTime time.Time `json:"lastTransitionTime,omitempty"`
+}
+
+// ConfigStatus holds the status of a logging config object, written by the operator.
+// ObservedGeneration: Generation of the spec the operator last acted on.
+// Conditions: Current conditions of the object.
+type ConfigStatus struct {
+	ObservedGeneration int64             `json:"observedGeneration,omitempty"`
+	Conditions         []ConfigCondition `json:"conditions,omitempty"`
+}
+
+// LoggingClientConfig holds a client logging config as a Kubernetes object.
+type LoggingClientConfig struct {
+	TypeMeta `json:",inline"`
+	Metadata ObjectMeta   `json:"metadata,omitempty"`
+	Spec     ClientConfig `json:"spec"`
+	Status   ConfigStatus `json:"status,omitempty"`
+}
+
+// LoggingClientConfigList holds a list of "LoggingClientConfig" objects.
+type LoggingClientConfigList struct {
+	TypeMeta `json:",inline"`
+	Metadata ListMeta              `json:"metadata,omitempty"`
+	Items    []LoggingClientConfig `json:"items"`
+}
+
+// LoggingServerConfig holds the server logging configs as a Kubernetes object.
+type LoggingServerConfig struct {
+	TypeMeta `json:",inline"`
+	Metadata ObjectMeta           `json:"metadata,omitempty"`
+	Spec     ServerLoggingConfigs `json:"spec"`
+	Status   ConfigStatus         `json:"status,omitempty"`
+}
+
+// LoggingServerConfigList holds a list of "LoggingServerConfig" objects.
+type LoggingServerConfigList struct {
+	TypeMeta `json:",inline"`
+	Metadata ListMeta              `json:"metadata,omitempty"`
+	Items    []LoggingServerConfig `json:"items"`
+}
+
+// DeepCopyInto copies the object into out, sharing no memory with it.
+func (in *LoggingClientConfig) DeepCopyInto(out *LoggingClientConfig) {
+	deepCopyInto(in, out)
+}
+
+// DeepCopy returns a copy of the object sharing no memory with it.
+func (in *LoggingClientConfig) DeepCopy() *LoggingClientConfig {
+	if in == nil {
+		return nil
+	}
+	out := &LoggingClientConfig{}
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto copies the list into out, sharing no memory with it.
+func (in *LoggingClientConfigList) DeepCopyInto(out *LoggingClientConfigList) {
+	deepCopyInto(in, out)
+}
+
+// DeepCopy returns a copy of the list sharing no memory with it.
+func (in *LoggingClientConfigList) DeepCopy() *LoggingClientConfigList {
+	if in == nil {
+		return nil
+	}
+	out := &LoggingClientConfigList{}
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto copies the object into out, sharing no memory with it.
+func (in *LoggingServerConfig) DeepCopyInto(out *LoggingServerConfig) {
+	deepCopyInto(in, out)
+}
+
+// DeepCopy returns a copy of the object sharing no memory with it.
+func (in *LoggingServerConfig) DeepCopy() *LoggingServerConfig {
+	if in == nil {
+		return nil
+	}
+	out := &LoggingServerConfig{}
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto copies the list into out, sharing no memory with it.
+func (in *LoggingServerConfigList) DeepCopyInto(out *LoggingServerConfigList) {
+	deepCopyInto(in, out)
+}
+
+// DeepCopy returns a copy of the list sharing no memory with it.
+func (in *LoggingServerConfigList) DeepCopy() *LoggingServerConfigList {
+	if in == nil {
+		return nil
+	}
+	out := &LoggingServerConfigList{}
+	in.DeepCopyInto(out)
+	return out
+}
+
+// deepCopyInto copies *in into *out, following pointers, slices, maps and interfaces through the
+// exported fields, so the config structs don't need hand written copies kept in sync with their
+// fields. Unexported fields, e.g. of time.Time, are copied by value.
+func deepCopyInto(in, out interface{}) {
+	reflect.ValueOf(out).Elem().Set(deepCopyValue(reflect.ValueOf(in).Elem()))
+}
+
+func deepCopyValue(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type().Elem())
+		c.Elem().Set(deepCopyValue(v.Elem()))
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(deepCopyValue(v.Index(i)))
+		}
+		return c
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			c.SetMapIndex(iter.Key(), deepCopyValue(iter.Value()))
+		}
+		return c
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type()).Elem()
+		c.Set(deepCopyValue(v.Elem()))
+		return c
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if c.Field(i).CanSet() {
+				c.Field(i).Set(deepCopyValue(v.Field(i)))
+			}
+		}
+		return c
+	default:
+		return v
+	}
+}
+
+// validateKubeObject checks the type and object metadata of a logging config object.
+func validateKubeObject(v *validator, tm *TypeMeta, meta *ObjectMeta, kind string) {
+	if tm.APIVersion != KubeAPIVersion {
+		v.add("apiVersion", tm.APIVersion, fmt.Sprintf("must be %q", KubeAPIVersion))
+	}
+	if tm.Kind != kind {
+		v.add("kind", tm.Kind, fmt.Sprintf("must be %q", kind))
+	}
+	if len(meta.Name) > 253 || !kubeNamePattern.MatchString(meta.Name) {
+		v.add("metadata.name", meta.Name, "must be a DNS-1123 subdomain")
+	}
+}
+
+// Validate checks the object, returning every invalid field.
+func (in *LoggingClientConfig) Validate() []*ValidationError {
+	v := &validator{}
+	validateKubeObject(v, &in.TypeMeta, &in.Metadata, KubeKindClientConfig)
+	v.nest("spec", in.Spec.Validate())
+	return v.errs
+}
+
+// Validate checks the object, returning every invalid field.
+func (in *LoggingServerConfig) Validate() []*ValidationError {
+	v := &validator{}
+	validateKubeObject(v, &in.TypeMeta, &in.Metadata, KubeKindServerConfig)
+	v.nest("spec", in.Spec.Validate())
+	return v.errs
+}
+
+// AdmissionRequest holds the part of a Kubernetes validating webhook AdmissionReview request used
+// to validate logging config objects.
+// UID: Request ID, echoed in the response.
+// Kind: Kind of the object.
+// Operation: "CREATE", "UPDATE", "DELETE" or "CONNECT".
+// Object: Object being admitted.
+type AdmissionRequest struct {
+	UID       string          `json:"uid"`
+	Kind      TypeMeta        `json:"kind"`
+	Operation string          `json:"operation"`
+	Object    json.RawMessage `json:"object,omitempty"`
+}
+
+// AdmissionStatus holds the reason an object was denied.
+// Code: HTTP status code.
+// Message: Human readable validation errors.
+type AdmissionStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// AdmissionResponse holds the part of a Kubernetes validating webhook AdmissionReview response.
+// UID: ID of the request.
+// Allowed: true if the object is valid; false otherwise.
+// Result: Why the object was denied. Nil if allowed.
+type AdmissionResponse struct {
+	UID     string           `json:"uid"`
+	Allowed bool             `json:"allowed"`
+	Result  *AdmissionStatus `json:"status,omitempty"`
+}
+
+// ReviewAdmission validates the logging config object of a webhook request. Deletions and objects
+// of other kinds are allowed.
+func ReviewAdmission(req *AdmissionRequest) *AdmissionResponse {
+	resp := &AdmissionResponse{UID: req.UID, Allowed: true}
+	if req.Operation == "DELETE" || len(req.Object) == 0 {
+		return resp
+	}
+	var errs ValidationErrors
+	var err error
+	switch req.Kind.Kind {
+	case KubeKindClientConfig:
+		obj := &LoggingClientConfig{}
+		if err = json.Unmarshal(req.Object, obj); err == nil {
+			errs = obj.Validate()
+		}
+	case KubeKindServerConfig:
+		obj := &LoggingServerConfig{}
+		if err = json.Unmarshal(req.Object, obj); err == nil {
+			errs = obj.Validate()
+		}
+	default:
+		return resp
+	}
+	if err == nil {
+		err = errs.Err()
+	}
+	if err != nil {
+		resp.Allowed = false
+		resp.Result = &AdmissionStatus{Code: http.StatusUnprocessableEntity, Message: err.Error()}
+	}
+	return resp
+}
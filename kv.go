@@ -0,0 +1,97 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"sort"
+	"sync"
+)
+
+// KVStore is the bucketed key-value storage used to persist server state. Its methods map one to
+// one to bolt (bbolt) bucket operations, so a bolt database can back it through a thin adapter
+// without this package depending on bolt. Get returns nil if the key doesn't exist; ForEach
+// iterates in key order and stops at the first error.
+type KVStore interface {
+	Get(bucket, key []byte) ([]byte, error)
+	Put(bucket, key, value []byte) error
+	Delete(bucket, key []byte) error
+	ForEach(bucket []byte, fn func(key, value []byte) error) error
+}
+
+// MemoryKVStore is an in-memory KVStore. Safe for concurrent use.
+type MemoryKVStore struct {
+	mu      sync.RWMutex
+	buckets map[string]map[string][]byte
+}
+
+// NewMemoryKVStore returns an empty in-memory store.
+func NewMemoryKVStore() *MemoryKVStore {
+	return &MemoryKVStore{buckets: make(map[string]map[string][]byte)}
+}
+
+// Get implements the KVStore interface.
+func (s *MemoryKVStore) Get(bucket, key []byte) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	v, ok := s.buckets[string(bucket)][string(key)]
+	if !ok {
+		return nil, nil
+	}
+	return append([]byte(nil), v...), nil
+}
+
+// Put implements the KVStore interface.
+func (s *MemoryKVStore) Put(bucket, key, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.buckets[string(bucket)]
+	if !ok {
+		b = make(map[string][]byte)
+		s.buckets[string(bucket)] = b
+	}
+	b[string(key)] = append([]byte(nil), value...)
+	return nil
+}
+
+// Delete implements the KVStore interface.
+func (s *MemoryKVStore) Delete(bucket, key []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.buckets[string(bucket)], string(key))
+	return nil
+}
+
+// ForEach implements the KVStore interface. fn must not modify the store.
+func (s *MemoryKVStore) ForEach(bucket []byte, fn func(key, value []byte) error) error {
+	s.mu.RLock()
+	b := s.buckets[string(bucket)]
+	keys := make([]string, 0, len(b))
+	for k := range b {
+		keys = append(keys, k)
+	}
+	values := make(map[string][]byte, len(b))
+	for k, v := range b {
+		values[k] = v
+	}
+	s.mu.RUnlock()
+
+	sort.Strings(keys)
+	for _, k := range keys {
+		if err := fn([]byte(k), values[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
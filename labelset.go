@@ -0,0 +1,149 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// LabelSet holds a set of key-value labels, e.g. the common labels of a client or the labels a
+// routing rule matches on.
+type LabelSet struct {
+	labels      map[string]string
+	fingerprint atomic.Uint64
+	computed    atomic.Bool
+}
+
+// NewLabelSet returns a label set holding a copy of the given labels.
+func NewLabelSet(labels map[string]string) *LabelSet {
+	ls := &LabelSet{labels: make(map[string]string, len(labels))}
+	for k, v := range labels {
+		ls.labels[k] = v
+	}
+	return ls
+}
+
+// Len returns the number of labels.
+func (ls *LabelSet) Len() int {
+	return len(ls.labels)
+}
+
+// Get returns the value of the given label.
+func (ls *LabelSet) Get(name string) (string, bool) {
+	v, ok := ls.labels[name]
+	return v, ok
+}
+
+// Map returns a copy of the labels.
+func (ls *LabelSet) Map() map[string]string {
+	m := make(map[string]string, len(ls.labels))
+	for k, v := range ls.labels {
+		m[k] = v
+	}
+	return m
+}
+
+// Equal returns true if both sets hold exactly the same labels; false otherwise.
+func (ls *LabelSet) Equal(other *LabelSet) bool {
+	if len(ls.labels) != len(other.labels) {
+		return false
+	}
+	for k, v := range ls.labels {
+		if ov, ok := other.labels[k]; !ok || ov != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Fingerprint returns a 64 bit xxHash based fingerprint of the labels. The fingerprint doesn't
+// depend on the order labels were added in. It is computed once and cached.
+func (ls *LabelSet) Fingerprint() uint64 {
+	if ls.computed.Load() {
+		return ls.fingerprint.Load()
+	}
+	var sum uint64
+	buf := make([]byte, 0, 64)
+	for k, v := range ls.labels {
+		buf = append(buf[:0], k...)
+		buf = append(buf, 0xff)
+		buf = append(buf, v...)
+		sum += XXHash64(buf, 0)
+	}
+	fp := xxAvalanche(sum + uint64(len(ls.labels))*xxPrime5)
+	ls.fingerprint.Store(fp)
+	ls.computed.Store(true)
+	return fp
+}
+
+// LabelSetIndex deduplicates label sets by fingerprint, checking for fingerprint collisions.
+// Safe for concurrent use.
+type LabelSetIndex struct {
+	mu         sync.RWMutex
+	sets       map[uint64][]*LabelSet
+	collisions uint64
+}
+
+// NewLabelSetIndex returns an empty index.
+func NewLabelSetIndex() *LabelSetIndex {
+	return &LabelSetIndex{sets: make(map[uint64][]*LabelSet)}
+}
+
+// Intern returns the indexed label set equal to ls, adding ls to the index if there is none.
+// The returned set can be compared by pointer with other interned sets.
+func (i *LabelSetIndex) Intern(ls *LabelSet) *LabelSet {
+	fp := ls.Fingerprint()
+	i.mu.RLock()
+	for _, s := range i.sets[fp] {
+		if s.Equal(ls) {
+			i.mu.RUnlock()
+			return s
+		}
+	}
+	i.mu.RUnlock()
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for _, s := range i.sets[fp] {
+		if s.Equal(ls) {
+			return s
+		}
+	}
+	if len(i.sets[fp]) > 0 {
+		i.collisions++
+	}
+	i.sets[fp] = append(i.sets[fp], ls)
+	return ls
+}
+
+// Lookup returns the indexed label set equal to ls, if any.
+func (i *LabelSetIndex) Lookup(ls *LabelSet) (*LabelSet, bool) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	for _, s := range i.sets[ls.Fingerprint()] {
+		if s.Equal(ls) {
+			return s, true
+		}
+	}
+	return nil, false
+}
+
+// Collisions returns the number of distinct label sets indexed under an already used fingerprint.
+func (i *LabelSetIndex) Collisions() uint64 {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.collisions
+}
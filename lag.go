@@ -0,0 +1,196 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// LagSortByLag sorts lag reports by number of unacknowledged packages.
+	LagSortByLag = "lag"
+	// LagSortByOldestUnprocessed sorts lag reports by age of the oldest unprocessed package.
+	LagSortByOldestUnprocessed = "oldestUnprocessed"
+)
+
+// ClientLagReport holds how far the server is behind on the packages of a connection.
+// ClientID: Client provided unique client ID.
+// ConnectionID: Server provided unique connecton ID.
+// Backend: Server logging config the connection logs are written with, as "group/name".
+// LastReceivedID: ID of the last package received.
+// LastAckedID: ID of the last package acknowledged, i.e. written to the backend.
+// Lag: Number of packages received but not acknowledged.
+// OldestUnprocessedAge: Time since the oldest package not acknowledged was received. Zero if none.
+type ClientLagReport struct {
+	ClientID             string
+	ConnectionID         string
+	Backend              string
+	LastReceivedID       uint64
+	LastAckedID          uint64
+	Lag                  int
+	OldestUnprocessedAge time.Duration
+}
+
+// ListClientLagRequest holds list client lag request data.
+// MinLag: Connections with a smaller lag are left out.
+// MinOldestUnprocessedAge: Connections whose oldest unprocessed package is younger are left out.
+// SortBy: Sort key. One of "LagSortBy*". Empty keeps the server order.
+// Descending: true to sort from highest to lowest; false otherwise.
+// Limit: Maximum number of reports returned. Zero means no limit.
+type ListClientLagRequest struct {
+	MinLag                  int
+	MinOldestUnprocessedAge time.Duration
+	SortBy                  string
+	Descending              bool
+	Limit                   int
+}
+
+// ListClientLagResponse holds list client lag response data.
+// GeneratedAt: Time the reports were computed.
+// Reports: Lag of each connection, as requested.
+type ListClientLagResponse struct {
+	GeneratedAt time.Time
+	Reports     []*ClientLagReport
+}
+
+// FilterClientLag filters, sorts and limits the reports as requested.
+func FilterClientLag(reports []*ClientLagReport, req *ListClientLagRequest) ([]*ClientLagReport, error) {
+	if req == nil {
+		return reports, nil
+	}
+	var key func(*ClientLagReport) int64
+	switch req.SortBy {
+	case "":
+	case LagSortByLag:
+		key = func(r *ClientLagReport) int64 { return int64(r.Lag) }
+	case LagSortByOldestUnprocessed:
+		key = func(r *ClientLagReport) int64 { return int64(r.OldestUnprocessedAge) }
+	default:
+		return nil, fmt.Errorf("unknown sort key %q", req.SortBy)
+	}
+	filtered := make([]*ClientLagReport, 0, len(reports))
+	for _, r := range reports {
+		if r.Lag >= req.MinLag && r.OldestUnprocessedAge >= req.MinOldestUnprocessedAge {
+			filtered = append(filtered, r)
+		}
+	}
+	if key != nil {
+		sort.SliceStable(filtered, func(i, j int) bool {
+			if req.Descending {
+				return key(filtered[i]) > key(filtered[j])
+			}
+			return key(filtered[i]) < key(filtered[j])
+		})
+	}
+	if req.Limit > 0 && len(filtered) > req.Limit {
+		filtered = filtered[:req.Limit]
+	}
+	return filtered, nil
+}
+
+type lagPackage struct {
+	id         uint64
+	receivedAt time.Time
+}
+
+type connectionLag struct {
+	report  ClientLagReport
+	pending []lagPackage
+}
+
+// ClientLagTracker tracks the packages received and acknowledged on each connection. Safe for concurrent use.
+type ClientLagTracker struct {
+	mu    sync.Mutex
+	conns map[string]*connectionLag
+	order []string
+}
+
+// NewClientLagTracker returns a tracker without connection.
+func NewClientLagTracker() *ClientLagTracker {
+	return &ClientLagTracker{conns: make(map[string]*connectionLag)}
+}
+
+// Received records a package received on the connection.
+func (t *ClientLagTracker) Received(clientID, connectionID, backend string, packageID uint64, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c, ok := t.conns[connectionID]
+	if !ok {
+		c = &connectionLag{report: ClientLagReport{ClientID: clientID, ConnectionID: connectionID}}
+		t.conns[connectionID] = c
+		t.order = append(t.order, connectionID)
+	}
+	c.report.Backend = backend
+	c.report.LastReceivedID = packageID
+	c.pending = append(c.pending, lagPackage{id: packageID, receivedAt: now})
+}
+
+// Acked records a package of the connection as written to the backend. Packages may be acknowledged out of order.
+func (t *ClientLagTracker) Acked(connectionID string, packageID uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c, ok := t.conns[connectionID]
+	if !ok {
+		return
+	}
+	c.report.LastAckedID = packageID
+	for i, p := range c.pending {
+		if p.id == packageID {
+			c.pending = append(c.pending[:i], c.pending[i+1:]...)
+			break
+		}
+	}
+}
+
+// Remove stops tracking the connection, e.g. once it is closed.
+func (t *ClientLagTracker) Remove(connectionID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.conns[connectionID]; !ok {
+		return
+	}
+	delete(t.conns, connectionID)
+	for i, id := range t.order {
+		if id == connectionID {
+			t.order = append(t.order[:i], t.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// List returns the lag of the tracked connections, in the order they were first seen, filtered,
+// sorted and limited per the request.
+func (t *ClientLagTracker) List(req *ListClientLagRequest, now time.Time) (*ListClientLagResponse, error) {
+	t.mu.Lock()
+	reports := make([]*ClientLagReport, len(t.order))
+	for i, id := range t.order {
+		c := t.conns[id]
+		r := c.report
+		r.Lag = len(c.pending)
+		if len(c.pending) > 0 && now.After(c.pending[0].receivedAt) {
+			r.OldestUnprocessedAge = now.Sub(c.pending[0].receivedAt)
+		}
+		reports[i] = &r
+	}
+	t.mu.Unlock()
+	reports, err := FilterClientLag(reports, req)
+	if err != nil {
+		return nil, err
+	}
+	return &ListClientLagResponse{GeneratedAt: now, Reports: reports}, nil
+}
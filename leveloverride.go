@@ -0,0 +1,49 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import "fmt"
+
+// LevelOverrideRule holds a logging level applying to the logs matching a selector instead of the
+// global level, e.g. to silence a noisy component or to enable debug logs for a single module.
+// Match: Logs the rule applies to, usually by Labels or MessagePrefix.
+// Level: Logging level of the matching logs. One of "Level*".
+type LevelOverrideRule struct {
+	Match LogMatch `json:"match"`
+	Level byte     `json:"level"`
+}
+
+// EffectiveLevel returns the logging level applying to the log: the level of the first matching
+// override rule, or the config level if none matches.
+func (c *ClientConfig) EffectiveLevel(ld *LogData, context map[string]interface{}) byte {
+	for i := range c.LevelOverrides {
+		if c.LevelOverrides[i].Match.Matches(ld, context) {
+			return c.LevelOverrides[i].Level
+		}
+	}
+	return c.Level
+}
+
+// ShouldLog returns true if the log is at or more severe than its effective level; false if it
+// must be dropped before being queued.
+func (c *ClientConfig) ShouldLog(ld *LogData, context map[string]interface{}) bool {
+	return ld.Level <= c.EffectiveLevel(ld, context)
+}
+
+func validateLevelOverrides(v *validator, rules []LevelOverrideRule) {
+	for i, r := range rules {
+		v.level(fmt.Sprintf("levelOverrides[%d].level", i), r.Level)
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+// Severity holds a backend specific log severity.
+// Name: Severity name as expected by the backend.
+// Number: Severity numeric value as expected by the backend.
+type Severity struct {
+	Name   string
+	Number int
+}
+
+// LevelMapping translates internal levels ("Level*") to backend specific severities.
+type LevelMapping map[byte]Severity
+
+var (
+	// StackdriverLevelMapping maps the internal levels to Stackdriver (Cloud Logging) severities.
+	StackdriverLevelMapping = LevelMapping{
+		LevelError: {Name: "ERROR", Number: 500},
+		LevelWarn:  {Name: "WARNING", Number: 400},
+		LevelInfo:  {Name: "INFO", Number: 200},
+		LevelDebug: {Name: "DEBUG", Number: 100},
+	}
+	// SyslogLevelMapping maps the internal levels to syslog (RFC 5424) severities.
+	SyslogLevelMapping = LevelMapping{
+		LevelError: {Name: "err", Number: 3},
+		LevelWarn:  {Name: "warning", Number: 4},
+		LevelInfo:  {Name: "info", Number: 6},
+		LevelDebug: {Name: "debug", Number: 7},
+	}
+	// DefaultLevelMapping is used when a server logging config doesn't define a level mapping.
+	DefaultLevelMapping = StackdriverLevelMapping
+)
+
+// Severity returns the backend severity of the given level. Backends with fewer severities than
+// internal levels may leave levels unmapped; those use the severity of the closest more severe
+// mapped level, or the least severe mapped level if none.
+func (m LevelMapping) Severity(level byte) Severity {
+	if len(m) == 0 {
+		return DefaultLevelMapping.Severity(level)
+	}
+	for l := int(level); l >= int(LevelError); l-- {
+		if s, ok := m[byte(l)]; ok {
+			return s
+		}
+	}
+	for l := int(level) + 1; l <= int(LevelDebug); l++ {
+		if s, ok := m[byte(l)]; ok {
+			return s
+		}
+	}
+	return DefaultLevelMapping.Severity(level)
+}
+
+// Severity returns the backend severity of the given level according to the config level mapping.
+func (c *ServerLoggingConfig) Severity(level byte) Severity {
+	return c.LevelMapping.Severity(level)
+}
+
+// LevelName returns the lower case name of the given level, e.g. "error".
+func LevelName(level byte) string {
+	switch level {
+	case LevelError:
+		return "error"
+	case LevelWarn:
+		return "warn"
+	case LevelInfo:
+		return "info"
+	case LevelDebug:
+		return "debug"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// LogType represents the type of a log. One of "LogType*" or a type registered with RegisterLogType.
+type LogType byte
+
+const (
+	// LogTypeLog represents a log of type 'log'.
+	LogTypeLog = LogType(0)
+	// LogTypeAudit represents a log of type 'audit'.
+	LogTypeAudit = LogType(1)
+	// LogTypeUnknown represents a log received with a type name that isn't registered on this peer.
+	// It can't be registered, so "UnknownLogTypesReject" rejects it.
+	LogTypeUnknown = LogType(255)
+)
+
+const (
+	// UnknownLogTypesReject rejects logs of unregistered types.
+	UnknownLogTypesReject = "reject"
+	// UnknownLogTypesPassThrough accepts logs of unregistered types, routing them as their numeric value.
+	UnknownLogTypesPassThrough = "passThrough"
+)
+
+var (
+	// ErrDuplicateLogType is returned when a log type name or value is already registered.
+	ErrDuplicateLogType = errors.New("log type already registered")
+	// ErrUnknownLogType is returned when a log type is not registered and unknown types are rejected.
+	ErrUnknownLogType = errors.New("unknown log type")
+)
+
+// logTypeRegistry maps log types to names and back.
+type logTypeRegistry struct {
+	mu     sync.RWMutex
+	names  map[LogType]string
+	values map[string]LogType
+}
+
+var logTypes = &logTypeRegistry{
+	names:  map[LogType]string{LogTypeLog: "log", LogTypeAudit: "audit"},
+	values: map[string]LogType{"log": LogTypeLog, "audit": LogTypeAudit},
+}
+
+// RegisterLogType registers a deployment specific log type, e.g. "security" or "billing", so it is
+// named in routing rules, accepted by name in JSON input and accepted when unknown types are rejected.
+// Names must not be numeric, so they can't be mistaken for unregistered values.
+func RegisterLogType(name string, t LogType) error {
+	if name == "" {
+		return errors.New("empty log type name")
+	}
+	if t == LogTypeUnknown {
+		return fmt.Errorf("reserved log type %d", t)
+	}
+	if _, err := strconv.Atoi(name); err == nil {
+		return fmt.Errorf("numeric log type name %q", name)
+	}
+
+	logTypes.mu.Lock()
+	defer logTypes.mu.Unlock()
+	if _, ok := logTypes.values[name]; ok {
+		return fmt.Errorf("%w: %s", ErrDuplicateLogType, name)
+	}
+	if existing, ok := logTypes.names[t]; ok {
+		return fmt.Errorf("%w: %d is %s", ErrDuplicateLogType, t, existing)
+	}
+	logTypes.names[t] = name
+	logTypes.values[name] = t
+	return nil
+}
+
+// MustRegisterLogType is like RegisterLogType but panics if the registration fails.
+func MustRegisterLogType(name string, t LogType) {
+	if err := RegisterLogType(name, t); err != nil {
+		panic(err)
+	}
+}
+
+// LogTypeByName returns the log type registered with the given name.
+func LogTypeByName(name string) (LogType, bool) {
+	logTypes.mu.RLock()
+	defer logTypes.mu.RUnlock()
+	t, ok := logTypes.values[name]
+	return t, ok
+}
+
+// IsRegistered returns true if the type is built-in or registered; false otherwise.
+func (t LogType) IsRegistered() bool {
+	logTypes.mu.RLock()
+	defer logTypes.mu.RUnlock()
+	_, ok := logTypes.names[t]
+	return ok
+}
+
+// String returns the registered name of the type, or its numeric value if it isn't registered.
+func (t LogType) String() string {
+	logTypes.mu.RLock()
+	name, ok := logTypes.names[t]
+	logTypes.mu.RUnlock()
+	if !ok {
+		return strconv.Itoa(int(t))
+	}
+	return name
+}
+
+// UnmarshalJSON deserializes a type from either its numeric value, the wire encoding, or its
+// registered name. Unregistered names decode to "LogTypeUnknown", left to CheckLogType.
+func (t *LogType) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		var n uint8
+		if err := json.Unmarshal(data, &n); err != nil {
+			return fmt.Errorf("invalid log type %s", data)
+		}
+		*t = LogType(n)
+		return nil
+	}
+	v, ok := LogTypeByName(name)
+	if !ok {
+		v = LogTypeUnknown
+	}
+	*t = v
+	return nil
+}
+
+// CheckLogType returns ErrUnknownLogType if the type isn't registered and the policy is
+// "UnknownLogTypesReject". An empty policy passes unknown types through.
+func CheckLogType(t LogType, policy string) error {
+	if policy == UnknownLogTypesReject && !t.IsRegistered() {
+		return fmt.Errorf("%w: %d", ErrUnknownLogType, t)
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// DegradationAction represents what the client sheds at one step of the degradation ladder.
+type DegradationAction string
+
+const (
+	// DegradeDropDebug drops new 'debug' logs.
+	DegradeDropDebug = DegradationAction("dropDebug")
+	// DegradeDropInfo drops new 'info' logs.
+	DegradeDropInfo = DegradationAction("dropInfo")
+	// DegradeDropContext drops the context of new logs, keeping their message.
+	DegradeDropContext = DegradationAction("dropContext")
+	// DegradeDropWarn drops new 'warn' logs.
+	DegradeDropWarn = DegradationAction("dropWarn")
+)
+
+// logDataOverhead holds the estimated bytes retained by a queued LogData besides its variable size fields.
+const logDataOverhead = 256
+
+// DegradationStep holds one step of the degradation ladder.
+// AtFraction: Budget usage fraction, in (0, 1], from which the step applies.
+// Action: What the step sheds. One of "Degrade*".
+type DegradationStep struct {
+	AtFraction float64           `json:"atFraction"`
+	Action     DegradationAction `json:"action"`
+}
+
+// DefaultDegradationLadder is the degradation ladder used when the memory budget config doesn't define one.
+var DefaultDegradationLadder = []DegradationStep{
+	{AtFraction: 0.7, Action: DegradeDropDebug},
+	{AtFraction: 0.8, Action: DegradeDropInfo},
+	{AtFraction: 0.9, Action: DegradeDropContext},
+	{AtFraction: 0.95, Action: DegradeDropWarn},
+}
+
+// MemoryBudgetConfig holds the configuration of the client memory budget, bounding the bytes
+// retained by logs queued across every channel and overflow buffer so logging can never exhaust the
+// host application memory. Logs that would take usage over MaxBytes are always dropped, whatever
+// the ladder.
+// MaxBytes: Maximum estimated bytes retained by queued logs. Zero means no budget.
+// Ladder: Steps applied as usage grows, ordered by AtFraction. Defaults to "DefaultDegradationLadder".
+type MemoryBudgetConfig struct {
+	MaxBytes int64             `json:"maxBytes"`
+	Ladder   []DegradationStep `json:"ladder"`
+}
+
+// Validate checks the memory budget config, returning every invalid field.
+func (c *MemoryBudgetConfig) Validate() []*ValidationError {
+	v := &validator{}
+	v.nonNegative("maxBytes", c.MaxBytes)
+	prev := 0.0
+	for i, step := range c.Ladder {
+		field := fmt.Sprintf("ladder[%d]", i)
+		if step.AtFraction <= 0 || step.AtFraction > 1 {
+			v.add(field+".atFraction", step.AtFraction, "must be in (0, 1]")
+		} else if step.AtFraction < prev {
+			v.add(field+".atFraction", step.AtFraction, "must be >= the previous step atFraction")
+		}
+		prev = step.AtFraction
+		v.oneOf(field+".action", string(step.Action),
+			string(DegradeDropDebug), string(DegradeDropInfo), string(DegradeDropContext), string(DegradeDropWarn))
+	}
+	return v.errs
+}
+
+// EstimateLogDataSize returns the estimated bytes retained by the log while queued.
+func EstimateLogDataSize(ld *LogData) int64 {
+	size := logDataOverhead + len(ld.Message) + len(ld.MessageTemplate)
+	for _, p := range ld.Params {
+		size += estimateValueSize(p)
+	}
+	for _, kv := range ld.ContextMap {
+		size += estimateValueSize(kv)
+	}
+	if ld.Error != nil {
+		size += len(ld.Error.Error())
+	}
+	return int64(size)
+}
+
+// MemoryBudgetStats holds a point in time copy of the memory budget accounting.
+// UsedBytes: Estimated bytes retained by queued logs.
+// MaxBytes: Budget size.
+// DroppedByLevel: Logs shed per level, indexed by "Level*".
+// ContextsDropped: Logs admitted without their context.
+type MemoryBudgetStats struct {
+	UsedBytes       int64
+	MaxBytes        int64
+	DroppedByLevel  [LevelDebug + 1]uint64
+	ContextsDropped uint64
+}
+
+// MemoryBudget accounts the bytes retained by queued logs and sheds new logs per the degradation
+// ladder. Safe for concurrent use.
+type MemoryBudget struct {
+	max             int64
+	ladder          []DegradationStep
+	used            atomic.Int64
+	dropped         [LevelDebug + 1]atomic.Uint64
+	contextsDropped atomic.Uint64
+}
+
+// NewMemoryBudget returns an empty budget for the config.
+func NewMemoryBudget(cfg *MemoryBudgetConfig) *MemoryBudget {
+	ladder := cfg.Ladder
+	if len(ladder) == 0 {
+		ladder = DefaultDegradationLadder
+	}
+	return &MemoryBudget{max: cfg.MaxBytes, ladder: ladder}
+}
+
+// Admit reserves the estimated size of the log before it's queued. Returns the reserved size, to be
+// given back with Release once the log leaves the client, and true if the log can be queued; false
+// if it was shed. The context of an admitted log is cleared in place when a "DegradeDropContext" step
+// applies. Shed logs are left unmodified.
+func (b *MemoryBudget) Admit(ld *LogData) (int64, bool) {
+	fullSize := EstimateLogDataSize(ld)
+	if b.max <= 0 {
+		b.used.Add(fullSize)
+		return fullSize, true
+	}
+	bareSize := int64(-1)
+	for {
+		used := b.used.Load()
+		size, dropContext := fullSize, false
+		next := used + size
+		for _, step := range b.ladder {
+			if float64(next) < step.AtFraction*float64(b.max) {
+				break
+			}
+			switch step.Action {
+			case DegradeDropDebug, DegradeDropInfo, DegradeDropWarn:
+				if ld.Level >= degradationLevel(step.Action) {
+					return 0, b.shed(ld)
+				}
+			case DegradeDropContext:
+				if len(ld.ContextMap) > 0 && !dropContext {
+					if bareSize < 0 {
+						bare := *ld
+						bare.ContextMap = nil
+						bareSize = EstimateLogDataSize(&bare)
+					}
+					size, dropContext = bareSize, true
+					next = used + size
+				}
+			}
+		}
+		if next > b.max {
+			return 0, b.shed(ld)
+		}
+		if b.used.CompareAndSwap(used, next) {
+			if dropContext {
+				ld.ContextMap = nil
+				b.contextsDropped.Add(1)
+			}
+			return size, true
+		}
+	}
+}
+
+// Release gives back the size reserved by Admit.
+func (b *MemoryBudget) Release(size int64) {
+	b.used.Add(-size)
+}
+
+// Stats returns a copy of the current accounting.
+func (b *MemoryBudget) Stats() MemoryBudgetStats {
+	s := MemoryBudgetStats{
+		UsedBytes:       b.used.Load(),
+		MaxBytes:        b.max,
+		ContextsDropped: b.contextsDropped.Load(),
+	}
+	for level := range b.dropped {
+		s.DroppedByLevel[level] = b.dropped[level].Load()
+	}
+	return s
+}
+
+func (b *MemoryBudget) shed(ld *LogData) bool {
+	if int(ld.Level) < len(b.dropped) {
+		b.dropped[ld.Level].Add(1)
+	}
+	return false
+}
+
+// degradationLevel returns the most severe level shed by a drop action.
+func degradationLevel(action DegradationAction) byte {
+	switch action {
+	case DegradeDropWarn:
+		return LevelWarn
+	case DegradeDropInfo:
+		return LevelInfo
+	default:
+		return LevelDebug
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import "unicode/utf8"
+
+const (
+	// MessageTruncationHead keeps the start of oversized messages.
+	MessageTruncationHead = "head"
+	// MessageTruncationTail keeps the end of oversized messages, e.g. for stack traces ending with the cause.
+	MessageTruncationTail = "tail"
+)
+
+// MessageLengthContextKey holds the context key added to logs with a truncated message. Its value is
+// the original message length in bytes.
+const MessageLengthContextKey = "_messageLength"
+
+// TruncateMessage bounds the rendered message of the log to maxBytes, keeping its head or tail per
+// policy without splitting UTF-8 sequences, so giant messages (base64 blobs, SQL) are bounded
+// predictably instead of being rejected by the backend. Truncated logs get a "MessageLengthContextKey"
+// marker and lose their MessageTemplate, as the message no longer renders from it. A zero limit
+// means no limit. The log is modified in place. Returns true if the message was truncated.
+func TruncateMessage(ld *LogData, maxBytes int, policy string, stats *PipelineStats) bool {
+	if maxBytes <= 0 {
+		return false
+	}
+	msg := ld.RenderMessage()
+	if len(msg) <= maxBytes {
+		return false
+	}
+	ld.Message = truncateUTF8(msg, maxBytes, policy)
+	ld.MessageTemplate, ld.Params = "", nil
+	// Capped so the marker never lands in the spare capacity of a ContextMap shared with the caller.
+	n := len(ld.ContextMap)
+	ld.ContextMap = append(ld.ContextMap[:n:n], MessageLengthContextKey, len(msg))
+	if stats != nil {
+		stats.MessagesTruncated.Add(1)
+	}
+	return true
+}
+
+// TruncateMessageFor is like TruncateMessage with the client config limit and policy.
+func TruncateMessageFor(ld *LogData, cfg *ClientConfig, stats *PipelineStats) bool {
+	return TruncateMessage(ld, cfg.MaxMessageBytes, cfg.MessageTruncation, stats)
+}
+
+// truncateUTF8 returns at most maxBytes bytes of s, from its end for "MessageTruncationTail" and from
+// its start otherwise, dropping partial UTF-8 sequences at the cut.
+func truncateUTF8(s string, maxBytes int, policy string) string {
+	if policy == MessageTruncationTail {
+		start := len(s) - maxBytes
+		for start < len(s) && !utf8.RuneStart(s[start]) {
+			start++
+		}
+		return s[start:]
+	}
+	end := maxBytes
+	for end > 0 && !utf8.RuneStart(s[end]) {
+		end--
+	}
+	return s[:end]
+}
@@ -0,0 +1,310 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+const (
+	// PartitionKeySourceField takes the message key from a JSONPath field.
+	PartitionKeySourceField = "field"
+	// PartitionKeySourceTemplate renders the message key with a Go text/template.
+	PartitionKeySourceTemplate = "template"
+)
+
+// PartitionKeyExtractor holds the extraction of the message key of the logged data, so records of
+// the same key, e.g. the same correlation or tenant, land in the same Kafka partition and keep
+// their order. The extractor sees the JSON document of the logged data, as TransformTemplate does,
+// with the log CorrelationData and the connection Labels added.
+// Source: Where the key comes from. One of "PartitionKeySource*".
+// Field: JSONPath of the key, e.g. "$.CorrelationData.CorrelationID" or "$.Labels.tenant". Used by "PartitionKeySourceField".
+// Template: Go text/template rendering the key, e.g. "{{.Labels.tenant}}/{{.CorrelationData.Name}}". Used by "PartitionKeySourceTemplate".
+// Fallback: Key of the logs the field matches nothing in, or the template renders empty for or misses
+// a key in, e.g. the CorrelationData of logs without one. Empty leaves them keyless, spread across partitions.
+type PartitionKeyExtractor struct {
+	Source   string
+	Field    string
+	Template string
+	Fallback string
+}
+
+// Validate checks the key extractor, returning every invalid field.
+func (e *PartitionKeyExtractor) Validate() []*ValidationError {
+	v := &validator{}
+	v.oneOf("Source", e.Source, PartitionKeySourceField, PartitionKeySourceTemplate)
+	switch e.Source {
+	case PartitionKeySourceField:
+		if e.Field == "" {
+			v.add("Field", e.Field, ConstraintRequired)
+		} else if _, err := parseJSONPath(e.Field); err != nil {
+			v.add("Field", e.Field, "must be a valid JSONPath")
+		}
+	case PartitionKeySourceTemplate:
+		if e.Template == "" {
+			v.add("Template", e.Template, ConstraintRequired)
+		} else if _, err := template.New("key").Parse(e.Template); err != nil {
+			v.add("Template", e.Template, "must be a valid template")
+		}
+	}
+	return v.errs
+}
+
+// KeyExtractor applies a compiled key extractor. Safe for concurrent use.
+type KeyExtractor struct {
+	tmpl     *template.Template
+	path     []jsonPathSegment
+	fallback string
+}
+
+// Compile parses the key extractor.
+func (e *PartitionKeyExtractor) Compile() (*KeyExtractor, error) {
+	ke := &KeyExtractor{fallback: e.Fallback}
+	var err error
+	switch e.Source {
+	case PartitionKeySourceField:
+		ke.path, err = parseJSONPath(e.Field)
+	case PartitionKeySourceTemplate:
+		ke.tmpl, err = template.New("key").Option("missingkey=error").Parse(e.Template)
+	default:
+		err = fmt.Errorf("unknown partition key source %q", e.Source)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ke, nil
+}
+
+// Extract returns the message key of the logged data, logged with the given correlation data over a
+// connection with the given labels.
+func (e *KeyExtractor) Extract(ld *LoggedData, cd *CorrelationData, labels map[string]string) (string, error) {
+	doc, err := messageKeyDocument(ld, cd, labels)
+	if err != nil {
+		return "", err
+	}
+	return e.extract(doc)
+}
+
+func (e *KeyExtractor) extract(doc map[string]interface{}) (string, error) {
+	var key string
+	if e.tmpl != nil {
+		// A missing key is an execution error, or renders "<no value>" when reached through a nil value.
+		var buf bytes.Buffer
+		if err := e.tmpl.Execute(&buf, doc); err == nil && !strings.Contains(buf.String(), "<no value>") {
+			key = buf.String()
+		}
+	} else if value, ok := evalJSONPath(doc, e.path); ok {
+		key = keyString(value)
+	}
+	if key == "" {
+		key = e.fallback
+	}
+	return key, nil
+}
+
+// messageKeyDocument returns the logged data document with the CorrelationData and Labels members added.
+func messageKeyDocument(ld *LoggedData, cd *CorrelationData, labels map[string]string) (map[string]interface{}, error) {
+	doc, err := loggedDataDocument(ld)
+	if err != nil {
+		return nil, err
+	}
+	if cd != nil {
+		raw, err := json.Marshal(cd)
+		if err != nil {
+			return nil, err
+		}
+		var correlation map[string]interface{}
+		if err := json.Unmarshal(raw, &correlation); err != nil {
+			return nil, err
+		}
+		doc["CorrelationData"] = correlation
+	}
+	l := make(map[string]interface{}, len(labels))
+	for k, v := range labels {
+		l[k] = v
+	}
+	doc["Labels"] = l
+	return doc, nil
+}
+
+// keyString returns a key matched by a JSONPath as a string: strings as is, other values as JSON.
+func keyString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return ""
+		}
+		return string(b)
+	}
+}
+
+// KafkaMapping holds the mapping of the logged data into the records a Kafka producer publishes.
+// The record value is the Transform payload of the config, or the logged data document if it has none.
+// Key: Extraction of the record key, also set as the logged data MessageKey. Nil leaves records keyless.
+// Headers: Record headers mapped to the JSONPath of their value in the key extractor document,
+// e.g. "correlation-id": "$.CorrelationData.CorrelationID". Headers whose path matches nothing are left out.
+type KafkaMapping struct {
+	Key     *PartitionKeyExtractor
+	Headers map[string]string
+}
+
+// Validate checks the Kafka mapping, returning every invalid field.
+func (m *KafkaMapping) Validate() []*ValidationError {
+	v := &validator{}
+	if m.Key != nil {
+		v.nest("Key", m.Key.Validate())
+	}
+	for header, path := range m.Headers {
+		if header == "" {
+			v.add("Headers", header, "keys must not be empty")
+		}
+		if _, err := parseJSONPath(path); err != nil {
+			v.add("Headers."+header, path, "must be a valid JSONPath")
+		}
+	}
+	return v.errs
+}
+
+// KafkaHeader holds a Kafka record header.
+type KafkaHeader struct {
+	Key   string
+	Value string
+}
+
+// KafkaRecord holds a record published to Kafka.
+// Topic: Topic rendered by the Kafka output TopicTemplate. Empty without a Kafka output.
+// Key: Record key, partitioned on by the producer. Empty for keyless records.
+// Value: JSON payload.
+// Headers: Record headers, sorted by key.
+type KafkaRecord struct {
+	Topic   string
+	Key     string
+	Value   []byte
+	Headers []KafkaHeader
+}
+
+type kafkaHeaderPath struct {
+	key  string
+	path []jsonPathSegment
+}
+
+// KafkaMapper applies a compiled Kafka mapping. Safe for concurrent use.
+type KafkaMapper struct {
+	topic     *template.Template
+	key       *KeyExtractor
+	headers   []kafkaHeaderPath
+	transform *Transformer
+}
+
+// NewKafkaMapper compiles the KafkaMapping, Transform and Kafka TopicTemplate of the config.
+func (c *ServerLoggingConfig) NewKafkaMapper() (*KafkaMapper, error) {
+	m := &KafkaMapper{}
+	if c.Kafka != nil {
+		topic, err := parseTopicTemplate(c.Kafka.TopicTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("topic: %w", err)
+		}
+		m.topic = topic
+	}
+	if c.Transform != nil {
+		tr, err := c.Transform.Compile()
+		if err != nil {
+			return nil, fmt.Errorf("transform: %w", err)
+		}
+		m.transform = tr
+	}
+	if c.KafkaMapping == nil {
+		return m, nil
+	}
+	if c.KafkaMapping.Key != nil {
+		ke, err := c.KafkaMapping.Key.Compile()
+		if err != nil {
+			return nil, fmt.Errorf("key: %w", err)
+		}
+		m.key = ke
+	}
+	headers := make([]string, 0, len(c.KafkaMapping.Headers))
+	for header := range c.KafkaMapping.Headers {
+		headers = append(headers, header)
+	}
+	sort.Strings(headers)
+	for _, header := range headers {
+		path, err := parseJSONPath(c.KafkaMapping.Headers[header])
+		if err != nil {
+			return nil, fmt.Errorf("header %q: %w", header, err)
+		}
+		m.headers = append(m.headers, kafkaHeaderPath{key: header, path: path})
+	}
+	return m, nil
+}
+
+// Map returns the record of the logged data, logged with the given correlation data over a
+// connection with the given labels, and sets the logged data MessageKey to the record key.
+func (m *KafkaMapper) Map(ld *LoggedData, cd *CorrelationData, labels map[string]string) (*KafkaRecord, error) {
+	rec := &KafkaRecord{}
+	if m.topic != nil || m.key != nil || len(m.headers) > 0 {
+		doc, err := messageKeyDocument(ld, cd, labels)
+		if err != nil {
+			return nil, err
+		}
+		if m.topic != nil {
+			var buf bytes.Buffer
+			if err := m.topic.Execute(&buf, doc); err != nil {
+				return nil, fmt.Errorf("topic: %w", err)
+			}
+			if rec.Topic = buf.String(); rec.Topic == "" || strings.Contains(rec.Topic, "<no value>") {
+				return nil, fmt.Errorf("%w: %q", ErrInvalidKafkaTopic, rec.Topic)
+			}
+		}
+		if m.key != nil {
+			if rec.Key, err = m.key.extract(doc); err != nil {
+				return nil, fmt.Errorf("key: %w", err)
+			}
+		}
+		for _, h := range m.headers {
+			if value, ok := evalJSONPath(doc, h.path); ok {
+				rec.Headers = append(rec.Headers, KafkaHeader{Key: h.key, Value: keyString(value)})
+			}
+		}
+	}
+	ld.MessageKey = rec.Key
+	var payload interface{}
+	var err error
+	if m.transform != nil {
+		payload, err = m.transform.Apply(ld)
+	} else {
+		payload, err = loggedDataDocument(ld)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if rec.Value, err = json.Marshal(payload); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
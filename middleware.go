@@ -0,0 +1,202 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// MiddlewareAuth names the "AuthMiddleware".
+	MiddlewareAuth = "auth"
+	// MiddlewareQuota names the "QuotaMiddleware".
+	MiddlewareQuota = "quota"
+	// MiddlewareDedup names the "DedupMiddleware".
+	MiddlewareDedup = "dedup"
+	// MiddlewareMetrics names the "MetricsMiddleware".
+	MiddlewareMetrics = "metrics"
+)
+
+var (
+	// ErrUnauthorized is returned by the AuthMiddleware for packages failing authorization.
+	ErrUnauthorized = errors.New("unauthorized package")
+	// ErrQuotaExceeded is returned by the QuotaMiddleware for packages over the connection quota.
+	ErrQuotaExceeded = errors.New("package quota exceeded")
+	// ErrUnknownMiddleware is returned when building a chain naming a middleware that isn't available.
+	ErrUnknownMiddleware = errors.New("unknown middleware")
+)
+
+// Handler handles a package received by the server.
+type Handler func(pkg *TransportPackage) error
+
+// PackageMiddleware wraps the handling of received packages, so server cross-cutting concerns can be
+// composed instead of hard-coded into the receive loop. Middlewares handle the packages of one
+// connection and call next to pass the package on, or return without calling it to stop it.
+type PackageMiddleware interface {
+	Handle(pkg *TransportPackage, next Handler) error
+}
+
+// PackageMiddlewareFunc adapts a function to the PackageMiddleware interface.
+type PackageMiddlewareFunc func(pkg *TransportPackage, next Handler) error
+
+// Handle implements the PackageMiddleware interface.
+func (f PackageMiddlewareFunc) Handle(pkg *TransportPackage, next Handler) error {
+	return f(pkg, next)
+}
+
+// Chain returns the handler running the middlewares in order before the final handler.
+func Chain(final Handler, middlewares ...PackageMiddleware) Handler {
+	h := final
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		mw, next := middlewares[i], h
+		h = func(pkg *TransportPackage) error {
+			return mw.Handle(pkg, next)
+		}
+	}
+	return h
+}
+
+// BuildMiddlewareChain returns the handler running the middlewares named by the config Middleware, in
+// order, before the final handler. available maps names to the middlewares of the connection, e.g.
+// the "Middleware*" built-ins. Returns ErrUnknownMiddleware if a name isn't available.
+func (c *ServerConfigs) BuildMiddlewareChain(available map[string]PackageMiddleware, final Handler) (Handler, error) {
+	middlewares := make([]PackageMiddleware, 0, len(c.Middleware))
+	for _, name := range c.Middleware {
+		mw, ok := available[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownMiddleware, name)
+		}
+		middlewares = append(middlewares, mw)
+	}
+	return Chain(final, middlewares...), nil
+}
+
+// AuthMiddleware stops the packages the Authorize function rejects.
+type AuthMiddleware struct {
+	Authorize func(pkg *TransportPackage) error
+}
+
+// Handle implements the PackageMiddleware interface.
+func (m *AuthMiddleware) Handle(pkg *TransportPackage, next Handler) error {
+	if err := m.Authorize(pkg); err != nil {
+		return fmt.Errorf("%w: %v", ErrUnauthorized, err)
+	}
+	return next(pkg)
+}
+
+// QuotaMiddleware limits the packages of a connection with a token bucket. Safe for concurrent use.
+// Clock: Refills the bucket. Nil uses SystemClock.
+type QuotaMiddleware struct {
+	Clock  Clock
+	rate   float64
+	burst  float64
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewQuotaMiddleware returns a quota allowing rate packages per second, with bursts of up to burst packages.
+func NewQuotaMiddleware(rate float64, burst int) *QuotaMiddleware {
+	return &QuotaMiddleware{rate: rate, burst: float64(burst), tokens: float64(burst)}
+}
+
+// Handle implements the PackageMiddleware interface.
+func (m *QuotaMiddleware) Handle(pkg *TransportPackage, next Handler) error {
+	if !m.take(clockOrSystem(m.Clock).Now()) {
+		return fmt.Errorf("%w: package %d", ErrQuotaExceeded, pkg.ID)
+	}
+	return next(pkg)
+}
+
+func (m *QuotaMiddleware) take(now time.Time) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.last.IsZero() {
+		m.tokens += now.Sub(m.last).Seconds() * m.rate
+		if m.tokens > m.burst {
+			m.tokens = m.burst
+		}
+	}
+	m.last = now
+	if m.tokens < 1 {
+		return false
+	}
+	m.tokens--
+	return true
+}
+
+// DedupMiddleware silently stops the packages of the connection already received within the window.
+// ClientID: Client of the connection. When set, "TransportPackageTypeHiPriLog" packages, which a
+// Hedger sends over several connections, are deduplicated across the connections of the client.
+// Clock: Times the packages received. Nil uses SystemClock.
+type DedupMiddleware struct {
+	Window       DedupWindow
+	ConnectionID string
+	ClientID     string
+	Clock        Clock
+}
+
+// Handle implements the PackageMiddleware interface.
+func (m *DedupMiddleware) Handle(pkg *TransportPackage, next Handler) error {
+	key := DedupKey{ConnectionID: m.ConnectionID, PackageID: pkg.ID}
+	if m.ClientID != "" && pkg.Type == TransportPackageTypeHiPriLog {
+		key = DedupKey{ClientID: m.ClientID, PackageID: pkg.ID}
+	}
+	seen, err := m.Window.Seen(key, clockOrSystem(m.Clock).Now())
+	if err != nil {
+		return err
+	}
+	if seen {
+		return nil
+	}
+	return next(pkg)
+}
+
+// PackageMetrics holds the counters of a MetricsMiddleware. Safe for concurrent use.
+// Packages: Number of packages handled.
+// Failed: Number of packages the rest of the chain returned an error for.
+// PayloadBytes: Total payload size of the packages handled.
+// HandleNanos: Total time spent in the rest of the chain, in nanoseconds.
+type PackageMetrics struct {
+	Packages     atomic.Uint64
+	Failed       atomic.Uint64
+	PayloadBytes atomic.Uint64
+	HandleNanos  atomic.Uint64
+}
+
+// MetricsMiddleware counts the packages going through the rest of the chain.
+// Clock: Times the rest of the chain. Nil uses SystemClock.
+type MetricsMiddleware struct {
+	Metrics *PackageMetrics
+	Clock   Clock
+}
+
+// Handle implements the PackageMiddleware interface.
+func (m *MetricsMiddleware) Handle(pkg *TransportPackage, next Handler) error {
+	clock := clockOrSystem(m.Clock)
+	start := clock.Now()
+	err := next(pkg)
+	m.Metrics.Packages.Add(1)
+	m.Metrics.PayloadBytes.Add(uint64(len(pkg.Payload)))
+	m.Metrics.HandleNanos.Add(uint64(clock.Now().Sub(start)))
+	if err != nil {
+		m.Metrics.Failed.Add(1)
+	}
+	return err
+}
@@ -30,15 +30,25 @@ const (
 	// LevelDebug represents a log of 'debug' level.
 	LevelDebug = byte(3)
 	// TransportPackageTypeLog represents a package of type 'log'.
-	TransportPackageTypeLog = byte(0)
+	TransportPackageTypeLog = PackageType(0)
 	// TransportPackageTypeHiPriLog represents a package of type 'high priority log'.
-	TransportPackageTypeHiPriLog = byte(1)
+	TransportPackageTypeHiPriLog = PackageType(1)
 	// TransportPackageTypeHealhcheck represents a package of type 'healthcheck'.
-	TransportPackageTypeHealhcheck = byte(2)
-	// LogTypeLog represents a log of type 'log'.
-	LogTypeLog = byte(0)
-	// LogTypeAudit represents a log of type 'audit'.
-	LogTypeAudit = byte(1)
+	TransportPackageTypeHealhcheck = PackageType(2)
+	// TransportPackageTypeFlushRequest represents a package of type 'flush request'.
+	TransportPackageTypeFlushRequest = PackageType(3)
+	// TransportPackageTypeFlushResult represents a package of type 'flush result'.
+	TransportPackageTypeFlushResult = PackageType(4)
+	// TransportPackageTypeChunk represents a package of type 'chunk', holding a slice of an oversized log entry.
+	TransportPackageTypeChunk = PackageType(5)
+	// TransportPackageTypeConfigUpdate represents a package of type 'config update', pushed from server to client.
+	TransportPackageTypeConfigUpdate = PackageType(6)
+	// TransportPackageTypeScopeDefinition represents a package of type 'scope definition'.
+	TransportPackageTypeScopeDefinition = PackageType(7)
+	// TransportPackageTypeDeliveryReceipt represents a package of type 'delivery receipt', pushed from server to client.
+	TransportPackageTypeDeliveryReceipt = PackageType(8)
+	// TransportPackageTypeControl represents a package of type 'control', pausing or resuming a client stream.
+	TransportPackageTypeControl = PackageType(9)
 	// ContextTypeID holds the context type ID.
 	ContextTypeID = "t"
 	// CorrelationIDField holds the correlation id field name.
@@ -55,15 +65,30 @@ const (
 // Data: Package specific reference to the concrete oject.
 // Payload: Data variable serialized.
 // RetryCount: Number of retries executed on this package.
+// FlushImmediately: true if the package bypasses batching; false otherwise. Clients send it on its own as
+// soon as it's created, ahead of anything queued, and servers persist it and flush their sinks before
+// acknowledging it. Used for crash context that must get out before the process dies. See PanicHandler.
+// Only framed for peers that negotiated "CapabilityFrameFlags".
+// ContentType: Media type of Payload, e.g. "JSONContentType". Empty if the payload is described by its
+// package type only, as sent by older clients.
+// SchemaID: ID of the payload schema in the "SchemaRegistry". Zero if unset.
+// ContentType and SchemaID are only framed for peers that negotiated "CapabilityPayloadSchema".
 type TransportPackage struct {
-	ID         uint64
-	Type       byte
-	Data       interface{}
-	Payload    []byte
-	RetryCount byte
+	ID               uint64
+	Type             PackageType
+	Data             interface{}
+	Payload          []byte
+	RetryCount       byte
+	FlushImmediately bool
+	ContentType      string
+	SchemaID         uint32
 }
 
 // CorrelationData contains common data related to correlated logs.
+// CorrelationID: Unique ID shared by the correlated logs.
+// Name: Correlation name.
+// Custom: User specific correlation data. Values of types registered with RegisterCustomType keep their
+// concrete type when serialized.
 type CorrelationData struct {
 	CorrelationID string
 	Name          string
@@ -73,51 +98,78 @@ type CorrelationData struct {
 // LogData holds log data.
 // Timestamp: Log timestamp.
 // Level: One of "Level*".
-// Type: One of "LogType*".
+// Type: One of "LogType*" or a type registered with RegisterLogType.
 // Weight: Log weight.
 // Message: Log Message.
 // Context: User specific log context data.
 // Error: Log error data.
 // ContextMap: Context object serialized into a map.
 // Linked: Linked LogData objects.
+// Sampling: Upstream sampling decision. Nil if the log wasn't sampled.
+// MessageTemplate: Message template with "{}" placeholders, rendered late with Params. Used when Message is empty.
+// Params: Message template params.
+// Origin: Call site the log was emitted from. Nil if not captured.
+// ScopeID: ID of the scope of the sub-logger that emitted the log. Empty if none.
+// RetentionHint: How long backends supporting per entry retention should keep the log. Nil if none.
 type LogData struct {
 	Timestamp       time.Time
 	Level           byte
-	Type            byte
+	Type            LogType
 	Weight          int
 	Message         string
 	Error           error
 	ContextMap      []interface{}
 	CorrelationData *CorrelationData
 	ContextMaps     map[string][]string // todo: remove and check how to pass to workers this info.
+	Sampling        *SamplingDecision
+	MessageTemplate string
+	Params          []interface{}
+	Origin          *Origin
+	ScopeID         string
+	RetentionHint   *RetentionHint `json:",omitempty"`
 }
 
 // LogGroup holds a collection of log data and its common data.
 // CorrelationData: Logs correlation data.
 // Logs: List of logs beloging to this group.
+// Sampling: Upstream sampling decision applying to every log without its own decision.
+// PartitionKey: Key mapped by a "PartitionAssigner" to the connection the group is sent over, so groups
+// with the same key keep their order. Empty groups can go over any connection.
+// ContainsErrors: true if the group holds at least one "LevelError" log and was scheduled ahead of the
+// other normal groups, so the server can process it first too; false otherwise.
 // TODO: have a common props map here with all common props values.
 type LogGroup struct {
 	CorrelationData *CorrelationData
 	Logs            []*LogData
+	Sampling        *SamplingDecision
+	PartitionKey    string `json:",omitempty"`
+	ContainsErrors  bool   `json:",omitempty"`
 }
 
 // LoggedData holds log data that is sent to the logging systems.
+// MessageTemplate and Params are kept next to the rendered Message so backends can query on params.
+// RetentionHint is passed on to backends supporting per entry retention.
+// MessageKey is the record key of backends partitioning on it, e.g. Kafka. See PartitionKeyExtractor.
 type LoggedData struct {
-	Type    byte                   `json:"Type,omitempty"`
-	Weight  int                    `json:"Weight,omitempty"`
-	Message string                 `json:"Message,omitempty"`
-	Error   error                  `json:"Error,omitempty"`
-	Context map[string]interface{} `json:"Context,omitempty"`
+	Type            LogType                `json:"Type,omitempty"`
+	Weight          int                    `json:"Weight,omitempty"`
+	Message         string                 `json:"Message,omitempty"`
+	Error           error                  `json:"Error,omitempty"`
+	Context         map[string]interface{} `json:"Context,omitempty"`
+	MessageTemplate string                 `json:"MessageTemplate,omitempty"`
+	Params          []interface{}          `json:"Params,omitempty"`
+	RetentionHint   *RetentionHint         `json:"RetentionHint,omitempty"`
+	MessageKey      string                 `json:"MessageKey,omitempty"`
 }
 
 // ClientConfig holds client logging configuration.
 // Enabled: true if logging is enabled; false otherwise.
 // AppName: Name of the logging app.
 // Level: Logging level. One of "LogType*".
-// Endpoint: Server endpoint.
+// Endpoint: Server endpoint connection string, e.g. "tls://logs-a:7000,logs-b:7000?compression=zstd". See ParseEndpoint.
 // NumberOfConnections: Number of connections the client will keep with the server.
 // NumberOfHiPriConnections: Number of high priority connections the client will keep with the server.
-// NumberOfBackupConnections: Number of backup connections the client will keep with the server.
+// NumberOfBackupConnections: Number of backup connections the client will keep with the server. See BackupActivation.
 // NumberOfHiPriBackupConnections: Number of high priority connections the client will keep with the server.
 // ConnectionResetInterval: Interval which the client will reset its connection to the server.
 // ChannelSize: Size of the channel used to temporarily hold messages that will be sent to the server.
@@ -125,55 +177,151 @@ type LoggedData struct {
 // OverflowChannelLoggingLevel: Level of the messages that will be stored in the overflow channel.
 // HipriLoggingLevel: Level of the nessages that will be sent over the high priority connections.
 // HipriChannelSize: Size of the channel used to temporarily hold high priority messages that will be sent to the server.
+// ChannelMaxBytes: Maximum estimated bytes held by each channel, on top of its size. Zero means no limit.
+// ChannelOverflow: What happens to messages sent to a full channel. One of "QueueOverflow*". Defaults to "QueueOverflowReject".
 // TargetMessageBatchSize: Number of messages that should be batched together before being sent to the server.
 // SendBatchLogsInterval: The maximum interval which the batched log messages should be sent to the server.
 // CommonLabels: Key-value data pairs that should be attached to every log message.
 // ServerConfigName: Server configuration name the client should default to.
 // HealthCheckInterval: Interval which the client will send a health check command to the server.
 // HealthCheckFailureThreshold: Number of failed send healh check commands for a connection to be deemed unhealthy.
+// Health checks whose echo doesn't match what was sent count as failed.
+// HealthCheckPayloadSize: Size of the random payload sent, and echoed back, with each health check. Zero sends none.
 // UserRequestTimout: Used to estimate requests that timed out on clients. This value is used to set the 'timedout'
 //   field in the request tracking log entry.
 // ConnectionShutdownTimout: Maximum time to wait for the logs to drain during shutdown for each connection.
+// OverflowEncryption: Encryption configuration of the entries spilled to the disk overflow buffer.
+// DrainOrder: Order in which the log classes are drained during shutdown. Defaults to "DefaultDrainOrder".
+// IDGenerator: Generator of the correlation IDs.
+// RecoveryPolicy: How buffered logs are replayed after a reconnection.
+// ChannelScheduler: How batches from the high priority and normal channels are interleaved on shared connections.
+// HTTPFallback: Batched HTTP transport used when streaming connections can't be kept open.
+// MaxContextBytes: Maximum estimated serialized size of a log context. Zero means no limit.
+// MaxContextKeys: Maximum number of keys of a log context. Zero means no limit.
+// MaxMessageBytes: Maximum size of a log message. Zero means no limit.
+// MessageTruncation: Part of oversized messages kept. One of "MessageTruncation*". Defaults to "MessageTruncationHead".
+// Sampling: Client side sampling configuration. Nil means no sampling.
+// Capture: Capture mode configuration, teeing every serialized package to local files.
+// Transport: Name of the transport used to talk to the server. Defaults to "TransportStream".
+// QUIC: QUIC transport configuration, used when Transport is "TransportQUIC".
+// DisableOriginCapture: true to skip capturing the call site of each log, e.g. in hot paths; false otherwise.
+// AdaptiveBatching: Latency driven batch sizing. When set, replaces TargetMessageBatchSize.
+// DeliverySLO: Log delivery objective, evaluated by the client and reported in its health checks.
+// ZeroizeSensitiveBuffers: true to overwrite the buffers of high priority and audit packages before reusing them; false otherwise.
+// GroupLifetime: Limits after which correlated log groups are sealed and sent without an explicit close.
+// CircuitBreaker: Per endpoint circuit breaker consulted before sends and reconnects. Nil disables it.
+// FieldEncryption: Encryption of selected context values before serialization.
+// LevelOverrides: Levels applying to the logs matching a selector, evaluated in order before queueing.
+// FlushAlignment: Alignment of the SendBatchLogsInterval flushes to wall clock boundaries.
+// MemoryBudget: Bound of the memory retained by queued logs, shedding logs per a degradation ladder when hit.
+// BackupActivation: When the backup connections carry traffic. Nil means they always do.
+// FaultInjection: Faults injected into the client transports in chaos mode. Nil injects none.
+// Retention: Retention hints set on the logs before queueing. See ApplyRetention.
+// Warmup: Connections established before the client reports ready. Nil reports ready at once.
+// Processors: Names of the processors run, in order, on each log before queueing. See BuildProcessorChain.
+// RedactedKeys: Context keys whose value the "ProcessorRedaction" processor replaces.
+// Preemption: Whether high priority packages preempt the normal batch being built. Nil means they don't.
+// Outbox: Transactional outbox table drained by the client. Nil means no outbox.
+// Console: Console sink rendering logs locally instead of sending them. Nil sends them to the server.
+// ConnectionStateCache: Cache of the server connection metadata. Nil performs a round trip per lookup.
+// EndpointSelection: How new connections choose among the Endpoint hosts. Nil uses the first host that isn't failing.
+// SerializerWorkers: Number of batches serialized concurrently by the "SerializerPool". Zero uses GOMAXPROCS.
+// UsageProfile: Expected usage sent in the open requests so the server can size its buffers. Nil sends none.
+// AccessLog: How HTTP access logs are built. Nil keeps remote IPs as is and ignores forwarding headers.
+// Hedging: Hedged sends of the high priority packages over the backup high priority connections. Nil sends them once.
 type ClientConfig struct {
-	Enabled                        bool              `json:"enabled"`
-	AppName                        string            `json:"appName"`
-	Level                          byte              `json:"level"`
-	Endpoint                       string            `json:"endpoint"`
-	NumberOfConnections            int               `json:"numberOfConnections"`
-	NumberOfHiPriConnections       int               `json:"numberOfHiPriConnections"`
-	NumberOfBackupConnections      int               `json:"numberOfBackupConnections"`
-	NumberOfHiPriBackupConnections int               `json:"numberOfHiPriBackupConnections"`
-	ConnectionResetInterval        time.Duration     `json:"connectionResetInterval"`
-	ChannelSize                    int               `json:"channelSize"`
-	OverflowChannelSize            int               `json:"overflowChannelSize"`
-	OverflowChannelLoggingLevel    byte              `json:"overflowChannelLoggingLevel"`
-	HipriLoggingLevel              byte              `json:"hipriLoggingLevel"`
-	HipriChannelSize               int               `json:"hipriChannelSize"`
-	TargetMessageBatchSize         int               `json:"targetMessageBatchSize"`
-	SendBatchLogsInterval          time.Duration     `json:"sendBatchLogsInterval"`
-	CommonLabels                   map[string]string `json:"commonLabels"`
-	ServerConfigGroup              string            `json:"serverConfigGroup"`
-	ServerConfigName               string            `json:"serverConfigName"`
-	HealthCheckInterval            time.Duration     `json:"healthCheckInterval"`
-	HealthCheckFailureThreshold    int               `json:"healthCheckFailureThreshold"`
-	RequestTrackingTimout          int               `json:"requestTrackingTimout"`
-	ConnectionShutdownTimout       time.Duration     `json:"connectionShutdownTimout"`
-	ProjectID                      string            `json:"ProjectID"`           // TODO: remove. Here just for direct logging tests.
-	CredentialsFilePath            string            `json:"CredentialsFilePath"` // TODO: remove. Here just for direct logging tests.
+	Enabled                        bool                        `json:"enabled"`
+	AppName                        string                      `json:"appName"`
+	Level                          byte                        `json:"level"`
+	Endpoint                       string                      `json:"endpoint"`
+	NumberOfConnections            int                         `json:"numberOfConnections"`
+	NumberOfHiPriConnections       int                         `json:"numberOfHiPriConnections"`
+	NumberOfBackupConnections      int                         `json:"numberOfBackupConnections"`
+	NumberOfHiPriBackupConnections int                         `json:"numberOfHiPriBackupConnections"`
+	ConnectionResetInterval        time.Duration               `json:"connectionResetInterval"`
+	ChannelSize                    int                         `json:"channelSize"`
+	OverflowChannelSize            int                         `json:"overflowChannelSize"`
+	OverflowChannelLoggingLevel    byte                        `json:"overflowChannelLoggingLevel"`
+	HipriLoggingLevel              byte                        `json:"hipriLoggingLevel"`
+	HipriChannelSize               int                         `json:"hipriChannelSize"`
+	ChannelMaxBytes                int64                       `json:"channelMaxBytes"`
+	ChannelOverflow                string                      `json:"channelOverflow"`
+	TargetMessageBatchSize         int                         `json:"targetMessageBatchSize"`
+	SendBatchLogsInterval          time.Duration               `json:"sendBatchLogsInterval"`
+	CommonLabels                   map[string]string           `json:"commonLabels"`
+	ServerConfigGroup              string                      `json:"serverConfigGroup"`
+	ServerConfigName               string                      `json:"serverConfigName"`
+	HealthCheckInterval            time.Duration               `json:"healthCheckInterval"`
+	HealthCheckFailureThreshold    int                         `json:"healthCheckFailureThreshold"`
+	HealthCheckPayloadSize         int                         `json:"healthCheckPayloadSize"`
+	RequestTrackingTimout          int                         `json:"requestTrackingTimout"`
+	ConnectionShutdownTimout       time.Duration               `json:"connectionShutdownTimout"`
+	OverflowEncryption             *OverflowEncryptionConfig   `json:"overflowEncryption"`
+	DrainOrder                     []DrainClass                `json:"drainOrder"`
+	IDGenerator                    *IDGeneratorConfig          `json:"idGenerator"`
+	RecoveryPolicy                 *RecoveryPolicy             `json:"recoveryPolicy"`
+	ChannelScheduler               *ChannelSchedulerConfig     `json:"channelScheduler"`
+	HTTPFallback                   *HTTPFallbackConfig         `json:"httpFallback"`
+	MaxContextBytes                int                         `json:"maxContextBytes"`
+	MaxContextKeys                 int                         `json:"maxContextKeys"`
+	MaxMessageBytes                int                         `json:"maxMessageBytes"`
+	MessageTruncation              string                      `json:"messageTruncation"`
+	Sampling                       *SamplingConfig             `json:"sampling"`
+	Capture                        *CaptureConfig              `json:"capture"`
+	Transport                      string                      `json:"transport"`
+	QUIC                           *QUICConfig                 `json:"quic"`
+	DisableOriginCapture           bool                        `json:"disableOriginCapture"`
+	AdaptiveBatching               *AdaptiveBatchingConfig     `json:"adaptiveBatching"`
+	DeliverySLO                    *DeliverySLOConfig          `json:"deliverySLO"`
+	ZeroizeSensitiveBuffers        bool                        `json:"zeroizeSensitiveBuffers"`
+	GroupLifetime                  *GroupLifetimeConfig        `json:"groupLifetime"`
+	CircuitBreaker                 *CircuitBreakerConfig       `json:"circuitBreaker"`
+	FieldEncryption                *FieldEncryptionConfig      `json:"fieldEncryption"`
+	LevelOverrides                 []LevelOverrideRule         `json:"levelOverrides"`
+	FlushAlignment                 *FlushAlignment             `json:"flushAlignment"`
+	MemoryBudget                   *MemoryBudgetConfig         `json:"memoryBudget"`
+	BackupActivation               *BackupActivationPolicy     `json:"backupActivation"`
+	FaultInjection                 *FaultInjectionConfig       `json:"faultInjection"`
+	Retention                      *RetentionPolicy            `json:"retention"`
+	Warmup                         *WarmupConfig               `json:"warmup"`
+	Processors                     []string                    `json:"processors"`
+	RedactedKeys                   []string                    `json:"redactedKeys"`
+	Preemption                     *PreemptionPolicy           `json:"preemption"`
+	Outbox                         *OutboxConfig               `json:"outbox"`
+	Console                        *ConsoleSinkConfig          `json:"console"`
+	ConnectionStateCache           *ConnectionStateCacheConfig `json:"connectionStateCache"`
+	EndpointSelection              *SelectionPolicy            `json:"endpointSelection"`
+	SerializerWorkers              int                         `json:"serializerWorkers"`
+	UsageProfile                   *UsageProfile               `json:"usageProfile"`
+	AccessLog                      *AccessLogConfig            `json:"accessLog"`
+	Hedging                        *HedgingConfig              `json:"hedging"`
+	ProjectID                      string                      `json:"ProjectID"`           // TODO: remove. Here just for direct logging tests.
+	CredentialsFilePath            string                      `json:"CredentialsFilePath"` // TODO: remove. Here just for direct logging tests.
 }
 
 // ServerConfigs ... TODO
 // ServicePort holds the server port.
-// ShutdownTimeout contains the timeout to shutdown the server.
+// ShutdownTimeout contains the timeout to shutdown the server, as a duration string, e.g. "30s".
 // ReadTimeout holds the read timeout.
 // WriteTimeout holds the write timeout.
 // Logging contains the logging configs.
+// IDGenerator holds the generator of the connection IDs.
+// OpenIdempotency holds the retention of the connection open idempotency keys.
+// UpstreamForwarding holds the forwarding of the received logs to a central server. Nil disables it.
+// ConnectionTombstoneRetention holds how long closed and expired connections are kept, and listed, before
+// being removed. Zero removes them as soon as they are closed.
+// Middleware holds the names of the middlewares received packages go through, in order. See BuildMiddlewareChain.
 type ServerConfigs struct {
-	ServicePort     int
-	ShutdownTimeout string
-	ReadTimeout     string
-	WriteTimeout    string
-	Logging         *ServerLoggingConfigs
+	ServicePort                  int
+	ShutdownTimeout              Duration
+	ReadTimeout                  Duration
+	WriteTimeout                 Duration
+	Logging                      *ServerLoggingConfigs
+	IDGenerator                  *IDGeneratorConfig
+	OpenIdempotency              *IdempotencyConfig
+	UpstreamForwarding           *UpstreamForwardingConfig
+	Middleware                   []string
+	ConnectionTombstoneRetention Duration
 }
 
 // ServerLoggingConfigs ... TODO
@@ -183,18 +331,45 @@ type ServerLoggingConfigs struct {
 	DefaultConfigName      string
 	DeliveryMethod         byte
 	Configs                []*ServerLoggingConfig
+	DedupWindow            *DedupWindowConfig
+	UnknownLogTypes        string
+	CorrelationDedup       *CorrelationDedupConfig
 }
 
 // ServerLoggingConfig ... TODO
+// AuthMode: How the server authenticates to the backend. One of "AuthMode*". See EffectiveAuthMode.
+// Scopes: OAuth scopes requested for the backend credentials. Defaults to "DefaultLoggingScopes".
+// ImpersonationTarget: Service account impersonated with the base credentials, if any.
+// Partitioning: Per app partitioning of the message channel. Nil shares MessagesChannelSize across apps.
+// Transform: Transformation of the logged data into the backend payload. Nil writes the logged data as is.
+// AuditEncryption: Application layer encryption of the audit logs for the backend. Nil sends them as is.
+// Tiers: App tiers the config is selected for, one of "UsageTier*". See SelectConfig.
+// Output: Where the logs are written. One of "Output*", or a custom output added with RegisterBackend. Defaults to "OutputCloudLogging". See NewBackend.
+// Kafka: Kafka output. Required by "OutputKafka".
+// KafkaMapping: Mapping of the logged data into Kafka records. Nil writes keyless records with no headers.
+// Delivery: Retries and circuit breaking of the backend writes. Nil writes once.
 type ServerLoggingConfig struct {
 	Group               string
 	Name                string
 	ProjectID           string
 	CredentialsFilePath string
+	AuthMode            string
+	Scopes              []string
+	ImpersonationTarget string
 	Level               byte
 	NumberOfWorkers     int
 	MessagesChannelSize int
 	ShutdownTimeout     time.Duration
+	LevelMapping        LevelMapping
+	Bulkhead            *BulkheadConfig
+	Partitioning        *PartitionConfig
+	Transform           *TransformTemplate
+	AuditEncryption     *AuditEncryptionConfig
+	Tiers               []string
+	Output              string
+	Kafka               *KafkaOutputConfig
+	KafkaMapping        *KafkaMapping
+	Delivery            *BackendDeliveryConfig
 }
 
 // OpenConnectionDataRequest holds open connection request data.
@@ -202,28 +377,46 @@ type ServerLoggingConfig struct {
 // IsHiPri: true if the requesting connection should be high priority; false otherwise.
 // ConfigName: Default server config name used for the connection.
 // CommonLabels: Key-value data pairs that should be attached to every log message for this connection.
-// ContextMaps: Key-value data pairs containing the maps for each context object.
+// ContextMaps: Key-value data pairs containing the maps for each context object. Deprecated: use ContextSchema.
+// ClientIdentity: Client instance metadata merged by the server into every log's context.
+// Capabilities: Protocol features supported by the client.
+// ContextSchema: Typed, versioned description of the context objects, checked by the server at connection time.
+// IdempotencyKey: Client generated key, reused by retries of the same open so they return the original connection.
+// UsageProfile: Opt-in expected usage of the connection. Nil if the client didn't send one.
 type OpenConnectionDataRequest struct {
-	ClientID      string
-	IsHiPri       bool
-	ClientConfigs *ClientConfig
-	ContextMaps   map[string][]string
+	ClientID       string
+	IsHiPri        bool
+	ClientConfigs  *ClientConfig
+	ContextMaps    map[string][]string
+	ClientIdentity *ClientIdentity
+	Capabilities   Capabilities
+	ContextSchema  *ContextSchema
+	IdempotencyKey string
+	UsageProfile   *UsageProfile
 }
 
 // OpenConnectionDataResponse holds open connection response data.
 // ConnectionID: Server provided unique connecton ID.
 // StreamingEndpoint: Server provided streaming endpoint the client should use to start the streaming connection.
+// Capabilities: Protocol features supported by both the client and the server.
 type OpenConnectionDataResponse struct {
 	ConnectionID      string
 	StreamingEndpoint string
+	Capabilities      Capabilities
 }
 
 // ListConnectionResponse holds a list of connections response data.
 // ClientID: Client provided unique client ID.
 // ConnectionID: Server provided unique connecton ID.
+// Stats: Connection statistics.
+// State: Lifecycle state of the connection. One of "ConnectionState*".
+// ClosedAt: Time the connection was closed or expired, if it was.
 type ListConnectionResponse struct {
 	ClientID     string
 	ConnectionID string
+	Stats        *ConnectionStats
+	State        string     `json:",omitempty"`
+	ClosedAt     *time.Time `json:",omitempty"`
 }
 
 // GetConnectionResponse holds connection response data.
@@ -233,6 +426,12 @@ type ListConnectionResponse struct {
 // StreamingEndpoint: Server provided streaming endpoint the client should use to start the streaming connection.
 // IsHiPri: true if the requesting connection should be high priority; false otherwise.
 // ClientConfigs: Holds client logging configuration.
+// Version: Connection state version, incremented by the server on every change.
+// ETag: Opaque validator of the response content. See ComputeETag.
+// RecentErrors: Last failures reported by the client for the connection, oldest first.
+// ConfigReport: Differences between the client requested config and the one the connection runs with.
+// State: Lifecycle state of the connection. One of "ConnectionState*". Empty from older servers.
+// ClosedAt: Time the connection was closed or expired, if it was.
 type GetConnectionResponse struct {
 	IsActive          bool
 	ClientID          string
@@ -241,6 +440,12 @@ type GetConnectionResponse struct {
 	IsHiPri           bool
 	ClientConfigs     *ClientConfig
 	LastReceivedTime  string
+	Version           uint64
+	ETag              string
+	RecentErrors      []*TransportError
+	ConfigReport      *ConfigReport
+	State             string     `json:",omitempty"`
+	ClosedAt          *time.Time `json:",omitempty"`
 }
 
 // PostConnectionRequest holds post connection request data.
@@ -0,0 +1,210 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package modeltest
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/liviapetrin/model"
+)
+
+// FakeClock is a model.Clock whose time only moves when told to, so timers, tickers and intervals
+// fire deterministically. Safe for concurrent use.
+type FakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []*fakeWaiter
+}
+
+// fakeWaiter is a pending timer or ticker of a FakeClock.
+type fakeWaiter struct {
+	clock  *FakeClock
+	c      chan time.Time
+	when   time.Time
+	period time.Duration
+	active bool
+}
+
+// NewFakeClock returns a fake clock stopped at start, e.g. BaseTime.
+func NewFakeClock(start time.Time) *FakeClock {
+	return &FakeClock{now: start}
+}
+
+// Now implements the model.Clock interface.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// NewTimer implements the model.Clock interface.
+func (c *FakeClock) NewTimer(d time.Duration) model.Timer {
+	return c.add(d, 0)
+}
+
+// NewTicker implements the model.Clock interface.
+func (c *FakeClock) NewTicker(d time.Duration) model.Ticker {
+	if d <= 0 {
+		panic("non-positive interval for FakeClock.NewTicker")
+	}
+	return fakeTicker{c.add(d, d)}
+}
+
+func (c *FakeClock) add(d, period time.Duration) *fakeWaiter {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	w := &fakeWaiter{clock: c, c: make(chan time.Time, 1), when: c.now.Add(d), period: period, active: true}
+	c.waiters = append(c.waiters, w)
+	c.fire()
+	return w
+}
+
+// Advance moves the time forward by d, firing the timers and tickers due on the way, in order.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.Set(c.Now().Add(d))
+}
+
+// Set moves the time to t, firing the timers and tickers due up to t, in order. Time never goes back.
+func (c *FakeClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for {
+		next := c.nextDue(t)
+		if next == nil {
+			break
+		}
+		if next.when.After(c.now) {
+			c.now = next.when
+		}
+		c.fire()
+	}
+	if t.After(c.now) {
+		c.now = t
+	}
+}
+
+// Waiters returns the number of active timers and tickers, e.g. to wait until the code under test
+// armed its timer before calling Advance.
+func (c *FakeClock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for _, w := range c.waiters {
+		if w.active {
+			n++
+		}
+	}
+	return n
+}
+
+// has returns true if the waiter is still tracked, e.g. stopped but not yet forgotten by fire; false otherwise.
+func (c *FakeClock) has(w *fakeWaiter) bool {
+	for _, tracked := range c.waiters {
+		if tracked == w {
+			return true
+		}
+	}
+	return false
+}
+
+// nextDue returns the active waiter firing first, if it fires by t.
+func (c *FakeClock) nextDue(t time.Time) *fakeWaiter {
+	var next *fakeWaiter
+	for _, w := range c.waiters {
+		if w.active && !w.when.After(t) && (next == nil || w.when.Before(next.when)) {
+			next = w
+		}
+	}
+	return next
+}
+
+// fire sends the current time on the channels of the waiters due, dropping the ticks of full
+// channels like time.Ticker does, and forgets the stopped ones.
+func (c *FakeClock) fire() {
+	sort.SliceStable(c.waiters, func(i, j int) bool { return c.waiters[i].when.Before(c.waiters[j].when) })
+	active := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.active && !w.when.After(c.now) {
+			select {
+			case w.c <- c.now:
+			default:
+			}
+			if w.period > 0 {
+				for !w.when.After(c.now) {
+					w.when = w.when.Add(w.period)
+				}
+			} else {
+				w.active = false
+			}
+		}
+		if w.active {
+			active = append(active, w)
+		}
+	}
+	for i := len(active); i < len(c.waiters); i++ {
+		c.waiters[i] = nil
+	}
+	c.waiters = active
+}
+
+// C implements the model.Timer interface.
+func (w *fakeWaiter) C() <-chan time.Time {
+	return w.c
+}
+
+// Stop implements the model.Timer interface.
+func (w *fakeWaiter) Stop() bool {
+	w.clock.mu.Lock()
+	defer w.clock.mu.Unlock()
+	wasActive := w.active
+	w.active = false
+	return wasActive
+}
+
+// Reset implements the model.Timer interface.
+func (w *fakeWaiter) Reset(d time.Duration) bool {
+	w.clock.mu.Lock()
+	defer w.clock.mu.Unlock()
+	wasActive := w.active
+	w.when = w.clock.now.Add(d)
+	if !wasActive {
+		w.active = true
+		if !w.clock.has(w) {
+			w.clock.waiters = append(w.clock.waiters, w)
+		}
+	}
+	w.clock.fire()
+	return wasActive
+}
+
+// fakeTicker adapts a fakeWaiter to the model.Ticker interface.
+type fakeTicker struct {
+	*fakeWaiter
+}
+
+// Stop implements the model.Ticker interface.
+func (t fakeTicker) Stop() {
+	t.fakeWaiter.Stop()
+}
+
+// Reset implements the model.Ticker interface.
+func (t fakeTicker) Reset(d time.Duration) {
+	t.fakeWaiter.clock.mu.Lock()
+	t.period = d
+	t.fakeWaiter.clock.mu.Unlock()
+	t.fakeWaiter.Reset(d)
+}
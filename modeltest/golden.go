@@ -0,0 +1,54 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package modeltest
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/liviapetrin/model"
+)
+
+// GoldenLogGroupJSON holds the serialized form of FakeLogGroup(3). Payloads produced by older
+// versions of the model must keep decoding into an equivalent group.
+const GoldenLogGroupJSON = `{"CorrelationData":{"CorrelationID":"corr-3","Name":"fake","Custom":{"size":{"$type":"int/v1","$value":3}}},"Logs":[{"Timestamp":"2018-01-01T13:42:12.742165Z","Level":2,"Type":0,"Weight":3,"Message":"connection reset by peer","Error":null,"ContextMap":["requestID","req-5e1a31f6","attempt",1],"CorrelationData":{"CorrelationID":"corr-3","Name":"fake","Custom":{"size":{"$type":"int/v1","$value":3}}},"ContextMaps":null},{"Timestamp":"2018-01-01T16:33:11.947779Z","Level":3,"Type":0,"Weight":7,"Message":"user logged in","Error":null,"ContextMap":["requestID","req-6cb50b02","attempt",3],"CorrelationData":{"CorrelationID":"corr-3","Name":"fake","Custom":{"size":{"$type":"int/v1","$value":3}}},"ContextMaps":null},{"Timestamp":"2018-01-01T05:58:19.823358Z","Level":2,"Type":1,"Weight":2,"Message":"cache miss","Error":null,"ContextMap":["requestID","req-9d40d6d1","attempt",4],"CorrelationData":{"CorrelationID":"corr-3","Name":"fake","Custom":{"size":{"$type":"int/v1","$value":3}}},"ContextMaps":null}]}`
+
+// GoldenClientConfigJSON holds the serialized form of FakeClientConfig().
+const GoldenClientConfigJSON = `{"enabled":true,"appName":"fake-app","level":2,"endpoint":"localhost:8080","numberOfConnections":1,"numberOfHiPriConnections":1,"numberOfBackupConnections":0,"numberOfHiPriBackupConnections":0,"connectionResetInterval":3600000000000,"channelSize":100,"overflowChannelSize":10,"overflowChannelLoggingLevel":1,"hipriLoggingLevel":0,"hipriChannelSize":10,"targetMessageBatchSize":10,"sendBatchLogsInterval":100000000,"commonLabels":{"env":"test"},"serverConfigGroup":"","serverConfigName":"default","healthCheckInterval":1000000000,"healthCheckFailureThreshold":3,"requestTrackingTimout":30,"connectionShutdownTimout":1000000000,"overflowEncryption":null,"ProjectID":"","CredentialsFilePath":""}`
+
+// AssertGoldenLogGroup fails the test if GoldenLogGroupJSON doesn't decode into FakeLogGroup(3).
+func AssertGoldenLogGroup(t testing.TB) {
+	t.Helper()
+	var got model.LogGroup
+	if err := json.Unmarshal([]byte(GoldenLogGroupJSON), &got); err != nil {
+		t.Fatalf("decoding golden log group: %v", err)
+	}
+	if want := FakeLogGroup(3); !reflect.DeepEqual(&got, want) {
+		t.Errorf("golden log group mismatch:\n got: %+v\nwant: %+v", &got, want)
+	}
+}
+
+// AssertGoldenClientConfig fails the test if GoldenClientConfigJSON doesn't decode into FakeClientConfig().
+func AssertGoldenClientConfig(t testing.TB) {
+	t.Helper()
+	var got model.ClientConfig
+	if err := json.Unmarshal([]byte(GoldenClientConfigJSON), &got); err != nil {
+		t.Fatalf("decoding golden client config: %v", err)
+	}
+	if want := FakeClientConfig(); !reflect.DeepEqual(&got, want) {
+		t.Errorf("golden client config mismatch:\n got: %+v\nwant: %+v", &got, want)
+	}
+}
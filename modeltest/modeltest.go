@@ -0,0 +1,203 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package modeltest provides deterministic fixtures, golden payloads and invariant checkers for
+// tests of packages built on top of the logging model.
+package modeltest
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/liviapetrin/model"
+)
+
+// BaseTime is the time all generated timestamps are relative to.
+var BaseTime = time.Date(2018, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+var fakeMessages = []string{
+	"request received",
+	"request completed",
+	"cache miss",
+	"retrying operation",
+	"connection reset by peer",
+	"user logged in",
+}
+
+// FakeLogData returns a log generated deterministically from the given seed.
+func FakeLogData(seed int64) *model.LogData {
+	r := rand.New(rand.NewSource(seed))
+	ld := &model.LogData{
+		Timestamp: BaseTime.Add(time.Duration(r.Int63n(int64(24 * time.Hour)))).Truncate(time.Microsecond),
+		Level:     byte(r.Intn(int(model.LevelDebug) + 1)),
+		Type:      model.LogTypeLog,
+		Weight:    r.Intn(10),
+		Message:   fakeMessages[r.Intn(len(fakeMessages))],
+		ContextMap: []interface{}{
+			"requestID", fmt.Sprintf("req-%08x", r.Uint32()),
+			"attempt", float64(r.Intn(5)),
+		},
+	}
+	if r.Intn(10) == 0 {
+		ld.Type = model.LogTypeAudit
+	}
+	return ld
+}
+
+// FakeLogGroup returns a correlated group of n logs. Log i is generated with FakeLogData(i).
+func FakeLogGroup(n int) *model.LogGroup {
+	cd := &model.CorrelationData{
+		CorrelationID: fmt.Sprintf("corr-%d", n),
+		Name:          "fake",
+		Custom:        map[string]interface{}{"size": n},
+	}
+	g := &model.LogGroup{CorrelationData: cd, Logs: make([]*model.LogData, n)}
+	for i := range g.Logs {
+		ld := FakeLogData(int64(i))
+		ld.CorrelationData = cd
+		g.Logs[i] = ld
+	}
+	return g
+}
+
+// FakeClientConfig returns a valid client configuration with small, test friendly values.
+func FakeClientConfig() *model.ClientConfig {
+	return &model.ClientConfig{
+		Enabled:                     true,
+		AppName:                     "fake-app",
+		Level:                       model.LevelInfo,
+		Endpoint:                    "localhost:8080",
+		NumberOfConnections:         1,
+		NumberOfHiPriConnections:    1,
+		ConnectionResetInterval:     time.Hour,
+		ChannelSize:                 100,
+		OverflowChannelSize:         10,
+		OverflowChannelLoggingLevel: model.LevelWarn,
+		HipriLoggingLevel:           model.LevelError,
+		HipriChannelSize:            10,
+		TargetMessageBatchSize:      10,
+		SendBatchLogsInterval:       100 * time.Millisecond,
+		CommonLabels:                map[string]string{"env": "test"},
+		ServerConfigName:            "default",
+		HealthCheckInterval:         time.Second,
+		HealthCheckFailureThreshold: model.RetryCount,
+		RequestTrackingTimout:       30,
+		ConnectionShutdownTimout:    time.Second,
+	}
+}
+
+// ValidateTransportPackage checks the package invariants, returning the first violation found.
+func ValidateTransportPackage(pkg *model.TransportPackage) error {
+	if pkg == nil {
+		return errors.New("nil transport package")
+	}
+	if pkg.RetryCount > model.RetryCount {
+		return fmt.Errorf("package %d: retry count %d exceeds %d", pkg.ID, pkg.RetryCount, model.RetryCount)
+	}
+	if pkg.Data == nil && len(pkg.Payload) == 0 && pkg.Type != model.TransportPackageTypeHealhcheck {
+		return fmt.Errorf("package %d: neither data nor payload set", pkg.ID)
+	}
+	if err := model.VisitPackage(pkg, packageValidator{}); err != nil {
+		return fmt.Errorf("package %d: %w", pkg.ID, err)
+	}
+	return nil
+}
+
+// packageValidator checks the package data matches the package type.
+type packageValidator struct{}
+
+func (packageValidator) VisitLog(pkg *model.TransportPackage) error {
+	switch d := pkg.Data.(type) {
+	case nil:
+	case *model.LogGroup:
+		for i, ld := range d.Logs {
+			if ld == nil {
+				return fmt.Errorf("nil log at index %d", i)
+			}
+		}
+	case *model.LogData:
+	default:
+		return fmt.Errorf("unexpected log data type %T", pkg.Data)
+	}
+	return nil
+}
+
+func (v packageValidator) VisitHiPriLog(pkg *model.TransportPackage) error {
+	return v.VisitLog(pkg)
+}
+
+func (packageValidator) VisitHealthCheck(pkg *model.TransportPackage) error {
+	return expectData[*model.HealthCheckData](pkg, "health check")
+}
+
+func (packageValidator) VisitFlushRequest(pkg *model.TransportPackage) error {
+	return expectData[*model.FlushRequest](pkg, "flush request")
+}
+
+func (packageValidator) VisitFlushResult(pkg *model.TransportPackage) error {
+	return expectData[*model.FlushResult](pkg, "flush result")
+}
+
+func (packageValidator) VisitChunk(pkg *model.TransportPackage) error {
+	if err := expectData[*model.Chunk](pkg, "chunk"); err != nil {
+		return err
+	}
+	if c, ok := pkg.Data.(*model.Chunk); ok && (c.Total <= 0 || c.Index < 0 || c.Index >= c.Total) {
+		return fmt.Errorf("chunk index %d out of range [0, %d)", c.Index, c.Total)
+	}
+	return nil
+}
+
+func (packageValidator) VisitConfigUpdate(pkg *model.TransportPackage) error {
+	return expectData[*model.ClientConfigUpdate](pkg, "config update")
+}
+
+func (packageValidator) VisitScopeDefinition(pkg *model.TransportPackage) error {
+	return expectData[*model.ScopeDefinitions](pkg, "scope definition")
+}
+
+func (packageValidator) VisitDeliveryReceipt(pkg *model.TransportPackage) error {
+	return expectData[*model.DeliveryReceipt](pkg, "delivery receipt")
+}
+
+func (packageValidator) VisitControl(pkg *model.TransportPackage) error {
+	if err := expectData[*model.Control](pkg, "control"); err != nil {
+		return err
+	}
+	if c, ok := pkg.Data.(*model.Control); ok {
+		if errs := c.Validate(); len(errs) > 0 {
+			return errs[0]
+		}
+	}
+	return nil
+}
+
+// expectData returns an error if the package data is set and isn't a T.
+func expectData[T any](pkg *model.TransportPackage, name string) error {
+	if _, ok := pkg.Data.(T); pkg.Data != nil && !ok {
+		return fmt.Errorf("unexpected %s data type %T", name, pkg.Data)
+	}
+	return nil
+}
+
+// AssertValidTransportPackage fails the test if the package violates any invariant.
+func AssertValidTransportPackage(t testing.TB, pkg *model.TransportPackage) {
+	t.Helper()
+	if err := ValidateTransportPackage(pkg); err != nil {
+		t.Errorf("invalid transport package: %v", err)
+	}
+}
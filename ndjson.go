@@ -0,0 +1,208 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/url"
+	"time"
+)
+
+// NDJSONContentType holds the content type of NDJSON encoded batches.
+const NDJSONContentType = "application/x-ndjson"
+
+// HTTPFallbackConfig holds the configuration of the batched HTTP transport used when streaming
+// connections can't be kept open, e.g. behind proxies that kill long lived connections.
+// Enabled: true if the client should fall back to HTTP when streaming fails; false otherwise.
+// Endpoint: URL the NDJSON encoded batches are POSTed to.
+// FlushInterval: Maximum interval between two POSTs.
+// MaxBatchSize: Maximum number of log groups per POST.
+// MaxBatchBytes: Maximum encoded size of a POST body. Zero means no limit.
+// RequestTimeout: Timeout of each POST.
+type HTTPFallbackConfig struct {
+	Enabled        bool          `json:"enabled"`
+	Endpoint       string        `json:"endpoint"`
+	FlushInterval  time.Duration `json:"flushInterval"`
+	MaxBatchSize   int           `json:"maxBatchSize"`
+	MaxBatchBytes  int           `json:"maxBatchBytes"`
+	RequestTimeout time.Duration `json:"requestTimeout"`
+}
+
+// logDataAlias has the LogData fields without the wireLogData JSON methods.
+type logDataAlias LogData
+
+// logDataJSON shadows the LogData Error field, which encoding/json can't restore, with its message.
+type logDataJSON struct {
+	*logDataAlias
+	Error *string
+}
+
+func newLogDataJSON(ld *LogData) logDataJSON {
+	out := logDataJSON{logDataAlias: (*logDataAlias)(ld)}
+	if ld.Error != nil {
+		msg := ld.Error.Error()
+		out.Error = &msg
+	}
+	return out
+}
+
+// wireLogData serializes a log of the NDJSON, LogBatch and outbox encodings, with Error encoded as its message.
+type wireLogData LogData
+
+// MarshalJSON serializes the log, encoding Error as its message.
+func (ld *wireLogData) MarshalJSON() ([]byte, error) {
+	return json.Marshal(newLogDataJSON((*LogData)(ld)))
+}
+
+// UnmarshalJSON deserializes the log, restoring Error from its message.
+func (ld *wireLogData) UnmarshalJSON(data []byte) error {
+	var in struct {
+		*logDataAlias
+		Error json.RawMessage
+	}
+	in.logDataAlias = (*logDataAlias)(ld)
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	ld.Error = nil
+	if len(in.Error) > 0 && !bytes.Equal(in.Error, []byte("null")) {
+		var msg string
+		if err := json.Unmarshal(in.Error, &msg); err != nil {
+			msg = string(in.Error)
+		}
+		ld.Error = errors.New(msg)
+	}
+	return nil
+}
+
+// toWireLogs returns the logs as wire logs, sharing their data.
+func toWireLogs(logs []*LogData) []*wireLogData {
+	if logs == nil {
+		return nil
+	}
+	out := make([]*wireLogData, len(logs))
+	for i, ld := range logs {
+		out[i] = (*wireLogData)(ld)
+	}
+	return out
+}
+
+// fromWireLogs returns the wire logs as logs, sharing their data.
+func fromWireLogs(logs []*wireLogData) []*LogData {
+	if logs == nil {
+		return nil
+	}
+	out := make([]*LogData, len(logs))
+	for i, ld := range logs {
+		out[i] = (*LogData)(ld)
+	}
+	return out
+}
+
+// logGroupAlias has the LogGroup fields.
+type logGroupAlias LogGroup
+
+// ndjsonGroup is the NDJSON line of a log group.
+type ndjsonGroup struct {
+	*logGroupAlias
+	Logs []*wireLogData
+}
+
+// NDJSONEncoder writes log groups as newline delimited JSON, one group per line.
+type NDJSONEncoder struct {
+	enc *json.Encoder
+}
+
+// NewNDJSONEncoder returns an encoder writing to w.
+func NewNDJSONEncoder(w io.Writer) *NDJSONEncoder {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return &NDJSONEncoder{enc: enc}
+}
+
+// Encode writes the group followed by a newline.
+func (e *NDJSONEncoder) Encode(g *LogGroup) error {
+	return e.enc.Encode(&ndjsonGroup{logGroupAlias: (*logGroupAlias)(g), Logs: toWireLogs(g.Logs)})
+}
+
+// NDJSONDecoder reads log groups written by an NDJSONEncoder.
+type NDJSONDecoder struct {
+	dec *json.Decoder
+}
+
+// NewNDJSONDecoder returns a decoder reading from r.
+func NewNDJSONDecoder(r io.Reader) *NDJSONDecoder {
+	return &NDJSONDecoder{dec: json.NewDecoder(r)}
+}
+
+// Decode reads the next group. Returns io.EOF when there are no more groups.
+func (d *NDJSONDecoder) Decode() (*LogGroup, error) {
+	g := &LogGroup{}
+	line := &ndjsonGroup{logGroupAlias: (*logGroupAlias)(g)}
+	if err := d.dec.Decode(line); err != nil {
+		return nil, err
+	}
+	g.Logs = fromWireLogs(line.Logs)
+	return g, nil
+}
+
+// EncodeNDJSON encodes the batch of groups.
+func EncodeNDJSON(groups []*LogGroup) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := NewNDJSONEncoder(&buf)
+	for _, g := range groups {
+		if err := enc.Encode(g); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// DecodeNDJSON decodes a batch of groups encoded by EncodeNDJSON.
+func DecodeNDJSON(data []byte) ([]*LogGroup, error) {
+	dec := NewNDJSONDecoder(bytes.NewReader(data))
+	var groups []*LogGroup
+	for {
+		g, err := dec.Decode()
+		if err == io.EOF {
+			return groups, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, g)
+	}
+}
+
+// Validate checks the HTTP fallback config, returning every invalid field.
+func (c *HTTPFallbackConfig) Validate() []*ValidationError {
+	if !c.Enabled {
+		return nil
+	}
+	v := &validator{}
+	if u, err := url.Parse(c.Endpoint); err != nil || u.Scheme == "" || u.Host == "" {
+		v.add("endpoint", c.Endpoint, "must be an absolute URL")
+	}
+	v.nonNegative("flushInterval", int64(c.FlushInterval))
+	if c.MaxBatchSize < 1 {
+		v.add("maxBatchSize", c.MaxBatchSize, ConstraintPositive)
+	}
+	v.nonNegative("maxBatchBytes", int64(c.MaxBatchBytes))
+	v.nonNegative("requestTimeout", int64(c.RequestTimeout))
+	return v.errs
+}
@@ -0,0 +1,270 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OpenMetricsContentType holds the content type of the OpenMetrics text exposition format.
+const OpenMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+const (
+	// MetricTypeGauge represents an OpenMetrics gauge.
+	MetricTypeGauge = "gauge"
+	// MetricTypeCounter represents an OpenMetrics counter.
+	MetricTypeCounter = "counter"
+	// MetricTypeHistogram represents an OpenMetrics histogram.
+	MetricTypeHistogram = "histogram"
+)
+
+// Metric family names emitted by the servers. Counter names don't include the "_total" suffix,
+// added to their samples.
+const (
+	// MetricConnections holds the number of known connections, by state and priority.
+	MetricConnections = "cloudlogger_connections"
+	// MetricPackagesReceived holds the number of packages received, by server config.
+	MetricPackagesReceived = "cloudlogger_packages_received"
+	// MetricAcksSent holds the number of acknowledgements sent, by server config.
+	MetricAcksSent = "cloudlogger_acks_sent"
+	// MetricBackendWriteLatency holds the backend write latency, by server config.
+	MetricBackendWriteLatency = "cloudlogger_backend_write_latency_seconds"
+)
+
+// Metric label names emitted by the servers.
+const (
+	// MetricLabelState holds the connection state label. One of "ConnectionState*", or "inactive" for the
+	// inactive connections of servers reporting no state.
+	MetricLabelState = "state"
+	// MetricLabelPriority holds the connection priority label. "hipri" or "normal".
+	MetricLabelPriority = "priority"
+	// MetricLabelConfigGroup holds the server config group label.
+	MetricLabelConfigGroup = "config_group"
+	// MetricLabelConfigName holds the server config name label.
+	MetricLabelConfigName = "config_name"
+)
+
+// DefaultWriteLatencyBuckets holds the upper bounds, in seconds, of the backend write latency histogram.
+var DefaultWriteLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// MetricFamily holds an OpenMetrics metric family.
+// Name: Family name.
+// Type: One of "MetricType*".
+// Help: Family description.
+// Unit: Family unit, e.g. "seconds". Empty if unitless.
+// Metrics: Family samples, one per label set.
+type MetricFamily struct {
+	Name    string
+	Type    string
+	Help    string
+	Unit    string
+	Metrics []*Metric
+}
+
+// Metric holds the value of a metric family for a label set.
+// Labels: Label values by label name.
+// Value: Gauge or counter value.
+// Buckets: Cumulative histogram buckets, without the +Inf one, which is Count.
+// Count: Number of histogram observations.
+// Sum: Sum of the histogram observations.
+type Metric struct {
+	Labels  map[string]string
+	Value   float64
+	Buckets []HistogramBucket
+	Count   uint64
+	Sum     float64
+}
+
+// HistogramBucket holds the cumulative count of the observations less than or equal to UpperBound.
+type HistogramBucket struct {
+	UpperBound float64
+	Count      uint64
+}
+
+// LatencyHistogram holds backend write latencies in DefaultWriteLatencyBuckets buckets. Not safe
+// for concurrent use.
+type LatencyHistogram struct {
+	Counts []uint64
+	Count  uint64
+	Sum    time.Duration
+}
+
+// Observe records a latency.
+func (h *LatencyHistogram) Observe(d time.Duration) {
+	if h.Counts == nil {
+		h.Counts = make([]uint64, len(DefaultWriteLatencyBuckets))
+	}
+	for i, ub := range DefaultWriteLatencyBuckets {
+		if d.Seconds() <= ub {
+			h.Counts[i]++
+		}
+	}
+	h.Count++
+	h.Sum += d
+}
+
+// WorkerStats holds the counters of the workers of a server logging config.
+// ConfigGroup: Server config group.
+// ConfigName: Server config name.
+// PackagesReceived: Number of packages received.
+// AcksSent: Number of acknowledgements sent.
+// WriteLatency: Backend write latencies.
+type WorkerStats struct {
+	ConfigGroup      string
+	ConfigName       string
+	PackagesReceived uint64
+	AcksSent         uint64
+	WriteLatency     LatencyHistogram
+}
+
+// ConnectionMetricFamilies returns the connection gauges of the server connection registry, by state,
+// so the closed and expired tombstones aren't counted as live connections.
+func ConnectionMetricFamilies(conns []*GetConnectionResponse) []*MetricFamily {
+	counts := make(map[[2]string]float64)
+	for _, state := range []string{ConnectionStateActive, ConnectionStateDraining, ConnectionStateClosed, ConnectionStateExpired} {
+		for _, priority := range []string{"hipri", "normal"} {
+			counts[[2]string{state, priority}] = 0
+		}
+	}
+	for _, c := range conns {
+		state, priority := c.State, "normal"
+		if state == "" {
+			state = "inactive"
+			if c.IsActive {
+				state = ConnectionStateActive
+			}
+		}
+		if c.IsHiPri {
+			priority = "hipri"
+		}
+		counts[[2]string{state, priority}]++
+	}
+	f := &MetricFamily{Name: MetricConnections, Type: MetricTypeGauge, Help: "Known connections."}
+	for k, v := range counts {
+		f.Metrics = append(f.Metrics, &Metric{Labels: map[string]string{MetricLabelState: k[0], MetricLabelPriority: k[1]}, Value: v})
+	}
+	return []*MetricFamily{f}
+}
+
+// WorkerMetricFamilies returns the counters and latency histograms of the server logging configs.
+func WorkerMetricFamilies(stats []*WorkerStats) []*MetricFamily {
+	received := &MetricFamily{Name: MetricPackagesReceived, Type: MetricTypeCounter, Help: "Packages received."}
+	acks := &MetricFamily{Name: MetricAcksSent, Type: MetricTypeCounter, Help: "Acknowledgements sent."}
+	latency := &MetricFamily{Name: MetricBackendWriteLatency, Type: MetricTypeHistogram, Help: "Backend write latency.", Unit: "seconds"}
+	for _, s := range stats {
+		labels := map[string]string{MetricLabelConfigGroup: s.ConfigGroup, MetricLabelConfigName: s.ConfigName}
+		received.Metrics = append(received.Metrics, &Metric{Labels: labels, Value: float64(s.PackagesReceived)})
+		acks.Metrics = append(acks.Metrics, &Metric{Labels: labels, Value: float64(s.AcksSent)})
+		m := &Metric{Labels: labels, Count: s.WriteLatency.Count, Sum: s.WriteLatency.Sum.Seconds()}
+		for i, ub := range DefaultWriteLatencyBuckets {
+			var n uint64
+			if i < len(s.WriteLatency.Counts) {
+				n = s.WriteLatency.Counts[i]
+			}
+			m.Buckets = append(m.Buckets, HistogramBucket{UpperBound: ub, Count: n})
+		}
+		latency.Metrics = append(latency.Metrics, m)
+	}
+	return []*MetricFamily{received, acks, latency}
+}
+
+// WriteOpenMetrics writes the families in the OpenMetrics text exposition format, samples sorted
+// by labels so the output is stable.
+func WriteOpenMetrics(w io.Writer, families []*MetricFamily) error {
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		bw.WriteString("# TYPE " + f.Name + " " + f.Type + "\n")
+		if f.Unit != "" {
+			bw.WriteString("# UNIT " + f.Name + " " + f.Unit + "\n")
+		}
+		if f.Help != "" {
+			bw.WriteString("# HELP " + f.Name + " " + escapeMetricText(f.Help, false) + "\n")
+		}
+		metrics := append([]*Metric(nil), f.Metrics...)
+		sort.SliceStable(metrics, func(i, j int) bool {
+			return formatMetricLabels(metrics[i].Labels, "") < formatMetricLabels(metrics[j].Labels, "")
+		})
+		for _, m := range metrics {
+			switch f.Type {
+			case MetricTypeCounter:
+				writeMetricSample(bw, f.Name+"_total", formatMetricLabels(m.Labels, ""), m.Value)
+			case MetricTypeHistogram:
+				for _, b := range m.Buckets {
+					le := `le="` + formatMetricValue(b.UpperBound) + `"`
+					writeMetricSample(bw, f.Name+"_bucket", formatMetricLabels(m.Labels, le), float64(b.Count))
+				}
+				writeMetricSample(bw, f.Name+"_bucket", formatMetricLabels(m.Labels, `le="+Inf"`), float64(m.Count))
+				writeMetricSample(bw, f.Name+"_count", formatMetricLabels(m.Labels, ""), float64(m.Count))
+				writeMetricSample(bw, f.Name+"_sum", formatMetricLabels(m.Labels, ""), m.Sum)
+			default:
+				writeMetricSample(bw, f.Name, formatMetricLabels(m.Labels, ""), m.Value)
+			}
+		}
+	}
+	bw.WriteString("# EOF\n")
+	return bw.Flush()
+}
+
+func writeMetricSample(w *bufio.Writer, name, labels string, value float64) {
+	w.WriteString(name + labels + " " + formatMetricValue(value) + "\n")
+}
+
+// formatMetricLabels returns the labels sorted by name, in exposition format, with extra appended.
+func formatMetricLabels(labels map[string]string, extra string) string {
+	if len(labels) == 0 && extra == "" {
+		return ""
+	}
+	names := make([]string, 0, len(labels))
+	for k := range labels {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	parts := make([]string, 0, len(names)+1)
+	for _, k := range names {
+		parts = append(parts, k+`="`+escapeMetricText(labels[k], true)+`"`)
+	}
+	if extra != "" {
+		parts = append(parts, extra)
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func formatMetricValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+func escapeMetricText(s string, quote bool) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	if quote {
+		s = strings.ReplaceAll(s, `"`, `\"`)
+	}
+	return s
+}
@@ -0,0 +1,74 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"runtime"
+	"strings"
+)
+
+// Origin holds the call site a log was emitted from.
+// File: Source file path.
+// Line: Source line number.
+// Function: Function name, without package, e.g. "(*Server).Start".
+// Package: Package import path.
+type Origin struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Function string `json:"function"`
+	Package  string `json:"package"`
+}
+
+// CaptureOrigin returns the call site skip frames above the caller of CaptureOrigin, i.e. skip
+// zero returns the caller itself. Logging helpers add their own depth to skip. Returns nil if the
+// stack isn't that deep.
+func CaptureOrigin(skip int) *Origin {
+	var pcs [1]uintptr
+	if runtime.Callers(skip+2, pcs[:]) == 0 {
+		return nil
+	}
+	return OriginFromPC(pcs[0])
+}
+
+// CaptureOriginFor is like CaptureOrigin but returns nil without walking the stack if the client
+// config disables origin capture.
+func CaptureOriginFor(cfg *ClientConfig, skip int) *Origin {
+	if cfg != nil && cfg.DisableOriginCapture {
+		return nil
+	}
+	return CaptureOrigin(skip + 1)
+}
+
+// OriginFromPC returns the call site of the given program counter, as returned by runtime.Callers.
+func OriginFromPC(pc uintptr) *Origin {
+	if pc == 0 {
+		return nil
+	}
+	frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+	pkg, fn := splitFunctionName(frame.Function)
+	return &Origin{File: frame.File, Line: frame.Line, Function: fn, Package: pkg}
+}
+
+// splitFunctionName splits a fully qualified function name such as
+// "github.com/org/repo/pkg.(*Type).Method" into its package path and function name.
+func splitFunctionName(name string) (pkg, fn string) {
+	slash := strings.LastIndex(name, "/")
+	dot := strings.Index(name[slash+1:], ".")
+	if dot < 0 {
+		return "", name
+	}
+	dot += slash + 1
+	return name[:dot], name[dot+1:]
+}
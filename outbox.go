@@ -0,0 +1,272 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// OutboxPlaceholderQuestion represents "?" statement placeholders, e.g. MySQL and SQLite.
+	OutboxPlaceholderQuestion = "question"
+	// OutboxPlaceholderDollar represents "$1" statement placeholders, e.g. PostgreSQL.
+	OutboxPlaceholderDollar = "dollar"
+)
+
+const (
+	// DefaultOutboxBatchSize is the number of records read per poll when the config doesn't set one.
+	DefaultOutboxBatchSize = 100
+	// DefaultOutboxPollInterval is the interval between polls when the config doesn't set one.
+	DefaultOutboxPollInterval = time.Second
+)
+
+var outboxTablePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// ErrInvalidOutboxTable is returned when the outbox table name isn't a plain, optionally schema qualified, identifier.
+var ErrInvalidOutboxTable = errors.New("invalid outbox table name")
+
+// OutboxConfig holds the configuration of the transactional outbox. Services write their audit logs
+// to the outbox table in the transaction of their database changes, and the client drains the table,
+// so audit entries exist if and only if the transaction committed.
+// Table: Outbox table name, optionally schema qualified. See OutboxTableDDL.
+// Placeholder: Statement placeholder style of the database. One of "OutboxPlaceholder*".
+// BatchSize: Number of records read per poll. Defaults to "DefaultOutboxBatchSize".
+// PollInterval: Interval between polls of an empty outbox. Defaults to "DefaultOutboxPollInterval".
+type OutboxConfig struct {
+	Table        string        `json:"table"`
+	Placeholder  string        `json:"placeholder"`
+	BatchSize    int           `json:"batchSize"`
+	PollInterval time.Duration `json:"pollInterval"`
+}
+
+// Validate checks the outbox config, returning every invalid field.
+func (c *OutboxConfig) Validate() []*ValidationError {
+	v := &validator{}
+	if !outboxTablePattern.MatchString(c.Table) {
+		v.add("table", c.Table, "must be a valid table name")
+	}
+	v.oneOf("placeholder", c.Placeholder, OutboxPlaceholderQuestion, OutboxPlaceholderDollar)
+	v.nonNegative("batchSize", int64(c.BatchSize))
+	v.nonNegative("pollInterval", int64(c.PollInterval))
+	return v.errs
+}
+
+// OutboxRecord holds a row of the outbox table.
+// ID: Time ordered UUIDv7, so the outbox is drained in write order.
+// CreatedAt: Unix nanoseconds time the record was written.
+// Payload: JSON serialized LogData, with Error encoded as its message.
+// DeliveredAt: Unix nanoseconds time the client sent the record. Null until then.
+type OutboxRecord struct {
+	ID          string
+	CreatedAt   int64
+	Payload     []byte
+	DeliveredAt *int64
+}
+
+// OutboxTableDDL returns the statement creating the outbox table. The column types are portable
+// across the usual SQL databases; services may create an equivalent table with their own migrations.
+func OutboxTableDDL(table string) string {
+	return "CREATE TABLE IF NOT EXISTS " + table + " (\n" +
+		"\tid VARCHAR(36) PRIMARY KEY,\n" +
+		"\tcreated_at BIGINT NOT NULL,\n" +
+		"\tpayload TEXT NOT NULL,\n" +
+		"\tdelivered_at BIGINT\n" +
+		")"
+}
+
+// NewOutboxRecord returns the outbox record of the log.
+func NewOutboxRecord(ld *LogData, now time.Time) (*OutboxRecord, error) {
+	id, err := (&UUIDv7Generator{}).NewID()
+	if err != nil {
+		return nil, err
+	}
+	payload, err := json.Marshal((*wireLogData)(ld))
+	if err != nil {
+		return nil, err
+	}
+	return &OutboxRecord{ID: id, CreatedAt: now.UnixNano(), Payload: payload}, nil
+}
+
+// LogData returns the log held by the record.
+func (r *OutboxRecord) LogData() (*LogData, error) {
+	ld := &LogData{}
+	if err := json.Unmarshal(r.Payload, (*wireLogData)(ld)); err != nil {
+		return nil, fmt.Errorf("outbox record %s: %w", r.ID, err)
+	}
+	return ld, nil
+}
+
+// WriteOutbox inserts the log, written at now, into the outbox table within the caller's transaction.
+// Returns ErrInvalidOutboxTable if the table name could inject SQL, whether or not Validate was called.
+func (c *OutboxConfig) WriteOutbox(ctx context.Context, tx *sql.Tx, ld *LogData, now time.Time) error {
+	if err := c.checkTable(); err != nil {
+		return err
+	}
+	r, err := NewOutboxRecord(ld, now)
+	if err != nil {
+		return err
+	}
+	query := fmt.Sprintf("INSERT INTO %s (id, created_at, payload) VALUES (%s)", c.Table, c.placeholders(1, 3))
+	_, err = tx.ExecContext(ctx, query, r.ID, r.CreatedAt, string(r.Payload))
+	return err
+}
+
+// checkTable returns ErrInvalidOutboxTable if the table name can't be interpolated in a statement.
+func (c *OutboxConfig) checkTable() error {
+	if !outboxTablePattern.MatchString(c.Table) {
+		return fmt.Errorf("%w: %q", ErrInvalidOutboxTable, c.Table)
+	}
+	return nil
+}
+
+// placeholders returns n comma separated placeholders numbered from first.
+func (c *OutboxConfig) placeholders(first, n int) string {
+	p := make([]string, n)
+	for i := range p {
+		if c.Placeholder == OutboxPlaceholderDollar {
+			p[i] = fmt.Sprintf("$%d", first+i)
+		} else {
+			p[i] = "?"
+		}
+	}
+	return strings.Join(p, ", ")
+}
+
+// OutboxReader drains the undelivered records of the outbox table, oldest first. Records are
+// delivered at least once: a record sent but not yet marked delivered when the client stops is
+// sent again by the next reader.
+// Clock: Times the deliveries and the polls. Nil uses SystemClock.
+// OnDeadLetter: Reports a record whose payload can't be decoded. Drain marks such records delivered
+// without sending them, so they don't block the outbox. Nil drops them unreported.
+type OutboxReader struct {
+	Clock        Clock
+	OnDeadLetter func(rec *OutboxRecord, err error)
+	cfg          OutboxConfig
+	db           *sql.DB
+}
+
+// NewOutboxReader returns a reader of the outbox table of db.
+func NewOutboxReader(cfg *OutboxConfig, db *sql.DB) *OutboxReader {
+	c := *cfg
+	if c.BatchSize <= 0 {
+		c.BatchSize = DefaultOutboxBatchSize
+	}
+	if c.PollInterval <= 0 {
+		c.PollInterval = DefaultOutboxPollInterval
+	}
+	return &OutboxReader{cfg: c, db: db}
+}
+
+// Fetch returns the oldest undelivered records, up to the batch size.
+func (r *OutboxReader) Fetch(ctx context.Context) ([]*OutboxRecord, error) {
+	if err := r.cfg.checkTable(); err != nil {
+		return nil, err
+	}
+	query := fmt.Sprintf("SELECT id, created_at, payload FROM %s WHERE delivered_at IS NULL ORDER BY id LIMIT %d",
+		r.cfg.Table, r.cfg.BatchSize)
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var records []*OutboxRecord
+	for rows.Next() {
+		rec := &OutboxRecord{}
+		var payload string
+		if err := rows.Scan(&rec.ID, &rec.CreatedAt, &payload); err != nil {
+			return nil, err
+		}
+		rec.Payload = []byte(payload)
+		records = append(records, rec)
+	}
+	return records, rows.Err()
+}
+
+// MarkDelivered sets the delivery time of the records.
+func (r *OutboxReader) MarkDelivered(ctx context.Context, records []*OutboxRecord, now time.Time) error {
+	if len(records) == 0 {
+		return nil
+	}
+	if err := r.cfg.checkTable(); err != nil {
+		return err
+	}
+	args := make([]interface{}, 0, len(records)+1)
+	args = append(args, now.UnixNano())
+	for _, rec := range records {
+		args = append(args, rec.ID)
+	}
+	query := fmt.Sprintf("UPDATE %s SET delivered_at = %s WHERE id IN (%s)",
+		r.cfg.Table, r.cfg.placeholders(1, 1), r.cfg.placeholders(2, len(records)))
+	_, err := r.db.ExecContext(ctx, query, args...)
+	return err
+}
+
+// Drain sends the outbox records until the context is done, polling the table when it is empty. A
+// record is marked delivered once send returns nil for its batch; a send error is retried at the
+// next poll. Records whose payload can't be decoded are reported to OnDeadLetter and marked
+// delivered. Drain returns the context error, or the first database error.
+func (r *OutboxReader) Drain(ctx context.Context, send func(logs []*LogData) error) error {
+	clock := clockOrSystem(r.Clock)
+	for {
+		records, err := r.Fetch(ctx)
+		if err != nil {
+			return err
+		}
+		logs := make([]*LogData, 0, len(records))
+		valid := make([]*OutboxRecord, 0, len(records))
+		var dead []*OutboxRecord
+		for _, rec := range records {
+			ld, err := rec.LogData()
+			if err != nil {
+				if r.OnDeadLetter != nil {
+					r.OnDeadLetter(rec, err)
+				}
+				dead = append(dead, rec)
+				continue
+			}
+			logs = append(logs, ld)
+			valid = append(valid, rec)
+		}
+		if err := r.MarkDelivered(ctx, dead, clock.Now()); err != nil {
+			return err
+		}
+		sent := len(valid) == 0
+		if len(valid) > 0 {
+			if err := send(logs); err == nil {
+				if err := r.MarkDelivered(ctx, valid, clock.Now()); err != nil {
+					return err
+				}
+				sent = true
+			}
+		}
+		if sent && len(records) == r.cfg.BatchSize {
+			continue
+		}
+		poll := clock.NewTimer(r.cfg.PollInterval)
+		select {
+		case <-ctx.Done():
+			poll.Stop()
+			return ctx.Err()
+		case <-poll.C():
+		}
+	}
+}
@@ -0,0 +1,278 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// OverflowEncryptionAESGCM represents the AES-GCM overflow encryption algorithm.
+	OverflowEncryptionAESGCM = "AES-GCM"
+	// KeySourceEnv represents a key read, base64 encoded, from an environment variable.
+	KeySourceEnv = "env"
+	// KeySourceFile represents a key read, base64 encoded, from a file.
+	KeySourceFile = "file"
+)
+
+var (
+	// ErrUnknownOverflowKey is returned when an overflow entry was encrypted with a key not present in the key ring.
+	ErrUnknownOverflowKey = errors.New("unknown overflow encryption key")
+	// ErrInvalidOverflowKey is returned when an overflow encryption key is not a valid AES key.
+	ErrInvalidOverflowKey = errors.New("invalid overflow encryption key")
+)
+
+// OverflowEncryptionConfig holds the encryption configuration of the disk overflow buffer.
+// Enabled: true if entries written to the disk overflow buffer are encrypted; false otherwise.
+// Algorithm: Encryption algorithm. Only "OverflowEncryptionAESGCM" is supported.
+// KeySource: Where the key is read from. One of "KeySource*".
+// KeyReference: Environment variable name or file path holding the base64 encoded key.
+// KeyID: ID of the key, stored in each segment header to allow key rotation.
+// RotationInterval: Interval after which new segments should be written with a new key.
+type OverflowEncryptionConfig struct {
+	Enabled          bool          `json:"enabled"`
+	Algorithm        string        `json:"algorithm"`
+	KeySource        string        `json:"keySource"`
+	KeyReference     string        `json:"keyReference"`
+	KeyID            string        `json:"keyID"`
+	RotationInterval time.Duration `json:"rotationInterval"`
+}
+
+// OverflowSegmentHeader holds the metadata written at the start of each disk overflow buffer segment.
+// SegmentID: Sequential segment number.
+// CreatedAt: Time the segment was created.
+// Algorithm: Encryption algorithm of the segment entries. Empty if not encrypted.
+// KeyID: ID of the key used to encrypt the segment entries.
+// KeyCreatedAt: Time the key was created, used to decide when to rotate keys.
+type OverflowSegmentHeader struct {
+	SegmentID    uint64
+	CreatedAt    time.Time
+	Algorithm    string
+	KeyID        string
+	KeyCreatedAt time.Time
+}
+
+// OverflowEntry holds a transport package payload written to the disk overflow buffer.
+// SegmentID: ID of the segment holding the entry.
+// PackageID: ID of the package the payload belongs to.
+// PackageType: Type of the package the payload belongs to.
+// Encrypted: true if Payload is encrypted; false otherwise.
+// Nonce: Encryption nonce.
+// Payload: Package payload, encrypted if Encrypted is true.
+type OverflowEntry struct {
+	SegmentID   uint64
+	PackageID   uint64
+	PackageType PackageType
+	Encrypted   bool
+	Nonce       []byte
+	Payload     []byte
+}
+
+// OverflowKey holds an overflow encryption key.
+// ID: Key ID.
+// Key: 16, 24 or 32 bytes AES key.
+// CreatedAt: Time the key was created.
+type OverflowKey struct {
+	ID        string
+	Key       []byte
+	CreatedAt time.Time
+}
+
+// LoadOverflowKey reads the key described by the config.
+func LoadOverflowKey(cfg *OverflowEncryptionConfig) (*OverflowKey, error) {
+	key, err := loadAESKey(cfg.KeySource, cfg.KeyReference)
+	if err != nil {
+		return nil, err
+	}
+	return &OverflowKey{ID: cfg.KeyID, Key: key, CreatedAt: time.Now()}, nil
+}
+
+// loadAESKey reads a base64 encoded AES key from the given source. One of "KeySource*".
+func loadAESKey(source, reference string) ([]byte, error) {
+	encoded, err := readSecret(source, reference)
+	if err != nil {
+		return nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidOverflowKey, err)
+	}
+	if _, err := aes.NewCipher(key); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidOverflowKey, err)
+	}
+	return key, nil
+}
+
+// readSecret returns the secret held by the environment variable or file reference, per source. One of "KeySource*".
+func readSecret(source, reference string) (string, error) {
+	switch source {
+	case KeySourceEnv:
+		return os.Getenv(reference), nil
+	case KeySourceFile:
+		b, err := os.ReadFile(reference)
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	default:
+		return "", fmt.Errorf("unknown key source %q", source)
+	}
+}
+
+// OverflowKeyRing holds the current overflow encryption key and the previous ones, so segments
+// written before a key rotation can still be decrypted.
+// Clock: Times the segment creations. Nil uses SystemClock.
+type OverflowKeyRing struct {
+	Clock   Clock
+	mu      sync.RWMutex
+	current string
+	keys    map[string]cipher.AEAD
+	created map[string]time.Time
+}
+
+// NewOverflowKeyRing returns a key ring using the given key as the current key.
+func NewOverflowKeyRing(key *OverflowKey) (*OverflowKeyRing, error) {
+	r := &OverflowKeyRing{keys: make(map[string]cipher.AEAD), created: make(map[string]time.Time)}
+	if err := r.Rotate(key); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Rotate adds the key to the ring and makes it the current key.
+func (r *OverflowKeyRing) Rotate(key *OverflowKey) error {
+	block, err := aes.NewCipher(key.Key)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidOverflowKey, err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.keys[key.ID] = aead
+	r.created[key.ID] = key.CreatedAt
+	r.current = key.ID
+	return nil
+}
+
+// Forget removes a retired key from the ring. Entries encrypted with it can no longer be decrypted.
+func (r *OverflowKeyRing) Forget(keyID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if keyID != r.current {
+		delete(r.keys, keyID)
+		delete(r.created, keyID)
+	}
+}
+
+// NewSegmentHeader returns the header of a new segment encrypted with the current key.
+func (r *OverflowKeyRing) NewSegmentHeader(segmentID uint64) *OverflowSegmentHeader {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return &OverflowSegmentHeader{
+		SegmentID:    segmentID,
+		CreatedAt:    clockOrSystem(r.Clock).Now(),
+		Algorithm:    OverflowEncryptionAESGCM,
+		KeyID:        r.current,
+		KeyCreatedAt: r.created[r.current],
+	}
+}
+
+// Seal encrypts the entry payload in place with the key of the segment header.
+func (r *OverflowKeyRing) Seal(header *OverflowSegmentHeader, entry *OverflowEntry) error {
+	if entry.Encrypted {
+		return nil
+	}
+	aead, err := r.aead(header.KeyID)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	entry.Nonce = nonce
+	entry.Payload = aead.Seal(nil, nonce, entry.Payload, overflowEntryAAD(entry))
+	entry.Encrypted = true
+	return nil
+}
+
+// Open decrypts the entry payload in place with the key of the segment header.
+func (r *OverflowKeyRing) Open(header *OverflowSegmentHeader, entry *OverflowEntry) error {
+	if !entry.Encrypted {
+		return nil
+	}
+	aead, err := r.aead(header.KeyID)
+	if err != nil {
+		return err
+	}
+	payload, err := aead.Open(nil, entry.Nonce, entry.Payload, overflowEntryAAD(entry))
+	if err != nil {
+		return err
+	}
+	entry.Payload = payload
+	entry.Nonce = nil
+	entry.Encrypted = false
+	return nil
+}
+
+func (r *OverflowKeyRing) aead(keyID string) (cipher.AEAD, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	aead, ok := r.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownOverflowKey, keyID)
+	}
+	return aead, nil
+}
+
+// overflowEntryAAD binds the ciphertext to its segment, package and type so entries can't be swapped.
+func overflowEntryAAD(entry *OverflowEntry) []byte {
+	aad := make([]byte, 17)
+	binary.BigEndian.PutUint64(aad, entry.SegmentID)
+	binary.BigEndian.PutUint64(aad[8:], entry.PackageID)
+	aad[16] = byte(entry.PackageType)
+	return aad
+}
+
+// Validate checks the overflow encryption config, returning every invalid field.
+func (c *OverflowEncryptionConfig) Validate() []*ValidationError {
+	if !c.Enabled {
+		return nil
+	}
+	v := &validator{}
+	v.oneOf("algorithm", c.Algorithm, OverflowEncryptionAESGCM)
+	v.oneOf("keySource", c.KeySource, KeySourceEnv, KeySourceFile)
+	if c.KeyReference == "" {
+		v.add("keyReference", c.KeyReference, ConstraintRequired)
+	}
+	if c.KeyID == "" {
+		v.add("keyID", c.KeyID, ConstraintRequired)
+	}
+	v.nonNegative("rotationInterval", int64(c.RotationInterval))
+	return v.errs
+}
@@ -0,0 +1,96 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrUnknownPackageType is returned when dispatching a package whose type isn't one of "TransportPackageType*".
+var ErrUnknownPackageType = errors.New("unknown package type")
+
+// PackageType represents the type of a transport package. One of "TransportPackageType*".
+type PackageType byte
+
+var packageTypeNames = [...]string{
+	TransportPackageTypeLog:             "log",
+	TransportPackageTypeHiPriLog:        "hipriLog",
+	TransportPackageTypeHealhcheck:      "healthcheck",
+	TransportPackageTypeFlushRequest:    "flushRequest",
+	TransportPackageTypeFlushResult:     "flushResult",
+	TransportPackageTypeChunk:           "chunk",
+	TransportPackageTypeConfigUpdate:    "configUpdate",
+	TransportPackageTypeScopeDefinition: "scopeDefinition",
+	TransportPackageTypeDeliveryReceipt: "deliveryReceipt",
+	TransportPackageTypeControl:         "control",
+}
+
+// Valid returns true if the type is one of "TransportPackageType*"; false otherwise.
+func (t PackageType) Valid() bool {
+	return int(t) < len(packageTypeNames)
+}
+
+// String returns the name of the type, or its number for unknown types.
+func (t PackageType) String() string {
+	if !t.Valid() {
+		return fmt.Sprintf("PackageType(%d)", byte(t))
+	}
+	return packageTypeNames[t]
+}
+
+// PackageVisitor handles transport packages, one method per package type. Adding a package type adds
+// a method, so every handler fails to compile until it handles the new type.
+type PackageVisitor interface {
+	VisitLog(pkg *TransportPackage) error
+	VisitHiPriLog(pkg *TransportPackage) error
+	VisitHealthCheck(pkg *TransportPackage) error
+	VisitFlushRequest(pkg *TransportPackage) error
+	VisitFlushResult(pkg *TransportPackage) error
+	VisitChunk(pkg *TransportPackage) error
+	VisitConfigUpdate(pkg *TransportPackage) error
+	VisitScopeDefinition(pkg *TransportPackage) error
+	VisitDeliveryReceipt(pkg *TransportPackage) error
+	VisitControl(pkg *TransportPackage) error
+}
+
+// VisitPackage calls the visitor method matching the package type. Returns ErrUnknownPackageType if
+// the type isn't one of "TransportPackageType*".
+func VisitPackage(pkg *TransportPackage, visitor PackageVisitor) error {
+	switch pkg.Type {
+	case TransportPackageTypeLog:
+		return visitor.VisitLog(pkg)
+	case TransportPackageTypeHiPriLog:
+		return visitor.VisitHiPriLog(pkg)
+	case TransportPackageTypeHealhcheck:
+		return visitor.VisitHealthCheck(pkg)
+	case TransportPackageTypeFlushRequest:
+		return visitor.VisitFlushRequest(pkg)
+	case TransportPackageTypeFlushResult:
+		return visitor.VisitFlushResult(pkg)
+	case TransportPackageTypeChunk:
+		return visitor.VisitChunk(pkg)
+	case TransportPackageTypeConfigUpdate:
+		return visitor.VisitConfigUpdate(pkg)
+	case TransportPackageTypeScopeDefinition:
+		return visitor.VisitScopeDefinition(pkg)
+	case TransportPackageTypeDeliveryReceipt:
+		return visitor.VisitDeliveryReceipt(pkg)
+	case TransportPackageTypeControl:
+		return visitor.VisitControl(pkg)
+	default:
+		return fmt.Errorf("%w %d", ErrUnknownPackageType, byte(pkg.Type))
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+const (
+	// PanicValueKey holds the context key of the recovered panic value.
+	PanicValueKey = "panic"
+	// PanicStackKey holds the context key of the stack of the panicking goroutine.
+	PanicStackKey = "stack"
+)
+
+// PanicLogData returns the 'error' level log of a recovered panic, with the panic value and stack in
+// its context and the panicking call site as its Origin.
+func PanicLogData(recovered interface{}, stack []byte, now time.Time) *LogData {
+	err, ok := recovered.(error)
+	if ok {
+		err = fmt.Errorf("panic: %w", err)
+	} else {
+		err = fmt.Errorf("panic: %v", recovered)
+	}
+	return &LogData{
+		Timestamp:  now,
+		Level:      LevelError,
+		Type:       LogTypeLog,
+		Message:    err.Error(),
+		Error:      err,
+		ContextMap: []interface{}{PanicValueKey, fmt.Sprint(recovered), PanicStackKey, string(stack)},
+		Origin:     panicOrigin(),
+	}
+}
+
+// NewPanicPackage returns the high priority package carrying the panic log, flagged FlushImmediately.
+func NewPanicPackage(id uint64, ld *LogData) *TransportPackage {
+	return &TransportPackage{
+		ID:               id,
+		Type:             TransportPackageTypeHiPriLog,
+		Data:             ld,
+		FlushImmediately: true,
+	}
+}
+
+// PanicHandler reports recovered panics before the process dies.
+// NextID: Returns the ID of the next package.
+// Send: Sends the package right away, bypassing batching, and returns once it's acknowledged or failed.
+// Repanic: true to panic again with the recovered value once the package is sent; false to swallow the panic.
+// Clock: Timestamps the panic logs. Nil uses SystemClock.
+type PanicHandler struct {
+	NextID  func() uint64
+	Send    func(*TransportPackage) error
+	Repanic bool
+	Clock   Clock
+}
+
+// Recover reports the panic of the calling goroutine, if any. Must be deferred directly, i.e.
+// "defer h.Recover()", as recover only stops panics when called by the deferred function itself.
+func (h *PanicHandler) Recover() {
+	r := recover()
+	if r == nil {
+		return
+	}
+	h.Handle(r, debug.Stack())
+	if h.Repanic {
+		panic(r)
+	}
+}
+
+// Handle sends the package of a panic recovered by the caller, returning the send error.
+func (h *PanicHandler) Handle(recovered interface{}, stack []byte) error {
+	return h.Send(NewPanicPackage(h.NextID(), PanicLogData(recovered, stack, clockOrSystem(h.Clock).Now())))
+}
+
+// panicOrigin returns the call site that panicked, i.e. the first frame outside the runtime following
+// runtime.gopanic in the current stack, so runtime panics such as nil dereferences report the user
+// code rather than runtime.panicmem. Returns nil if the goroutine isn't panicking.
+func panicOrigin() *Origin {
+	pcs := make([]uintptr, 64)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	panicking := false
+	for {
+		frame, more := frames.Next()
+		if panicking && !strings.HasPrefix(frame.Function, "runtime.") {
+			pkg, fn := splitFunctionName(frame.Function)
+			return &Origin{File: frame.File, Line: frame.Line, Function: fn, Package: pkg}
+		}
+		panicking = panicking || frame.Function == "runtime.gopanic"
+		if !more {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"errors"
+	"sync"
+)
+
+const (
+	// PartitionOverflowDropNewest rejects messages enqueued to a full partition.
+	PartitionOverflowDropNewest = "dropNewest"
+	// PartitionOverflowDropOldest drops the oldest message of a full partition to make room.
+	PartitionOverflowDropOldest = "dropOldest"
+)
+
+// PartitionOverflowKey holds the partition shared by the apps beyond MaxPartitions.
+const PartitionOverflowKey = "_overflow"
+
+// DefaultPartitionQueueSize holds the capacity of each partition when the config doesn't set one.
+const DefaultPartitionQueueSize = 1024
+
+// ErrPartitionFull is returned when a message is rejected because its partition is full.
+var ErrPartitionFull = errors.New("partition full")
+
+// PartitionConfig holds the configuration of the per app partitioning of the server message
+// channels, so one app can't fill the shared channel and delay every other app's logs.
+// MaxPartitions: Maximum number of app partitions. Apps beyond it share "PartitionOverflowKey". Zero means no limit.
+// QueueSize: Capacity of each partition. Defaults to "DefaultPartitionQueueSize".
+// OverflowPolicy: What happens to messages enqueued to a full partition. One of "PartitionOverflow*".
+type PartitionConfig struct {
+	MaxPartitions  int
+	QueueSize      int
+	OverflowPolicy string
+}
+
+// Validate checks the partition config, returning every invalid field.
+func (c *PartitionConfig) Validate() []*ValidationError {
+	v := &validator{}
+	v.nonNegative("MaxPartitions", int64(c.MaxPartitions))
+	v.nonNegative("QueueSize", int64(c.QueueSize))
+	if c.OverflowPolicy != "" {
+		v.oneOf("OverflowPolicy", c.OverflowPolicy, PartitionOverflowDropNewest, PartitionOverflowDropOldest)
+	}
+	return v.errs
+}
+
+// partitionItem holds a queued message with the app it was enqueued for, which differs from the
+// partition app in the overflow partition.
+type partitionItem struct {
+	app string
+	msg interface{}
+}
+
+type partitionQueue struct {
+	app     string
+	items   []partitionItem
+	head    int
+	len     int
+	dropped uint64
+}
+
+// PartitionStats holds the counters of a partition.
+// App: App name, or "PartitionOverflowKey".
+// Queued: Number of messages waiting.
+// Dropped: Number of messages dropped by the overflow policy since the partition was created.
+type PartitionStats struct {
+	App     string
+	Queued  int
+	Dropped uint64
+}
+
+// PartitionedQueue holds the server messages in a bounded queue per app, dequeued round robin
+// across apps. Partitions are created on the first message of their app and removed once drained,
+// so only apps with queued messages hold memory. Safe for concurrent use.
+type PartitionedQueue struct {
+	cfg        PartitionConfig
+	mu         sync.Mutex
+	partitions map[string]*partitionQueue
+	order      []*partitionQueue
+	next       int
+	dropped    uint64
+}
+
+// NewPartitionedQueue returns an empty queue.
+func NewPartitionedQueue(cfg *PartitionConfig) *PartitionedQueue {
+	c := *cfg
+	if c.OverflowPolicy == "" {
+		c.OverflowPolicy = PartitionOverflowDropNewest
+	}
+	if c.QueueSize < 1 {
+		c.QueueSize = DefaultPartitionQueueSize
+	}
+	return &PartitionedQueue{cfg: c, partitions: make(map[string]*partitionQueue)}
+}
+
+// Enqueue adds the message to the partition of the app. It returns ErrPartitionFull if the
+// partition is full and the policy is "PartitionOverflowDropNewest".
+func (q *PartitionedQueue) Enqueue(app string, msg interface{}) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	p := q.partition(app)
+	if p.len == len(p.items) {
+		p.dropped++
+		q.dropped++
+		if q.cfg.OverflowPolicy == PartitionOverflowDropNewest {
+			return ErrPartitionFull
+		}
+		p.items[p.head] = partitionItem{}
+		p.head = (p.head + 1) % len(p.items)
+		p.len--
+	}
+	p.items[(p.head+p.len)%len(p.items)] = partitionItem{app: app, msg: msg}
+	p.len++
+	return nil
+}
+
+// Dequeue removes the next message, taking one message per partition in turn. The app returned is
+// the one the message was enqueued for, even if it was queued in the overflow partition.
+func (q *PartitionedQueue) Dequeue() (app string, msg interface{}, ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.order) == 0 {
+		return "", nil, false
+	}
+	i := q.next % len(q.order)
+	p := q.order[i]
+	item := p.items[p.head]
+	p.items[p.head] = partitionItem{}
+	p.head = (p.head + 1) % len(p.items)
+	p.len--
+	if p.len > 0 {
+		q.next = i + 1
+	} else {
+		delete(q.partitions, p.app)
+		q.order = append(q.order[:i], q.order[i+1:]...)
+		q.next = i
+	}
+	if len(q.order) > 0 {
+		q.next %= len(q.order)
+	}
+	return item.app, item.msg, true
+}
+
+// Dropped returns the number of messages dropped by the overflow policy since the queue was created.
+func (q *PartitionedQueue) Dropped() uint64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.dropped
+}
+
+// Stats returns the counters of every partition holding messages, in creation order.
+func (q *PartitionedQueue) Stats() []PartitionStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	stats := make([]PartitionStats, len(q.order))
+	for i, p := range q.order {
+		stats[i] = PartitionStats{App: p.app, Queued: p.len, Dropped: p.dropped}
+	}
+	return stats
+}
+
+func (q *PartitionedQueue) partition(app string) *partitionQueue {
+	if p, ok := q.partitions[app]; ok {
+		return p
+	}
+	if q.cfg.MaxPartitions > 0 && len(q.partitions) >= q.cfg.MaxPartitions {
+		app = PartitionOverflowKey
+		if p, ok := q.partitions[app]; ok {
+			return p
+		}
+	}
+	p := &partitionQueue{app: app, items: make([]partitionItem, q.cfg.QueueSize)}
+	q.partitions[app] = p
+	q.order = append(q.order, p)
+	return p
+}
@@ -0,0 +1,64 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import "sync/atomic"
+
+// PartitionAssigner consistently maps group partition keys to one of the client connections, so
+// groups with the same key are sent in order over the same stream. Keys are placed with jump
+// consistent hashing, so changing the number of connections only moves the keys it has to. Safe
+// for concurrent use.
+type PartitionAssigner struct {
+	connections int32
+	next        atomic.Uint64
+}
+
+// NewPartitionAssigner returns an assigner over the given number of connections.
+func NewPartitionAssigner(connections int) *PartitionAssigner {
+	return &PartitionAssigner{connections: int32(connections)}
+}
+
+// Assign returns the index, in [0, connections), of the connection the key is sent over. Empty keys
+// are spread round robin. Returns -1 if there are no connections.
+func (a *PartitionAssigner) Assign(key string) int {
+	if a.connections <= 0 {
+		return -1
+	}
+	if key == "" {
+		return int(a.next.Add(1)-1) % int(a.connections)
+	}
+	return int(jumpHash(XXHash64([]byte(key), 0), a.connections))
+}
+
+// AssignGroup returns the index of the connection the group is sent over. Groups without a
+// PartitionKey fall back to their correlation ID.
+func (a *PartitionAssigner) AssignGroup(g *LogGroup) int {
+	key := g.PartitionKey
+	if key == "" && g.CorrelationData != nil {
+		key = g.CorrelationData.CorrelationID
+	}
+	return a.Assign(key)
+}
+
+// jumpHash returns the bucket, in [0, buckets), of the key, per Lamping and Veach jump consistent hash.
+func jumpHash(key uint64, buckets int32) int32 {
+	b, j := int64(-1), int64(0)
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int32(b)
+}
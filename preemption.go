@@ -0,0 +1,186 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import "time"
+
+// PreemptionPolicy holds the configuration of the high priority preemption of the normal batch being
+// built. A preempting high priority package goes to the front of the send queue and the partial
+// normal batch is sealed and queued behind the normal packages already queued, so error logs don't
+// wait behind info and debug load and normal logs keep their order.
+// Enabled: true if high priority packages preempt the normal batch; false if they are queued in order.
+// MinSealSize: Smallest partial batch sealed on preemption. Smaller ones keep building. Zero seals any non empty batch.
+// CoolDown: Minimum time between two preemptions, so a burst of high priority packages doesn't split
+// the normal traffic into tiny batches. Packages arriving during the cool-down are still sent first.
+// BoostErrorBatches: true if normal batches holding at least one "LevelError" log are flagged
+// "ContainsErrors" and queued ahead of the pure info and debug batches, behind the high priority
+// packages; false if they are queued in order. Independent of Enabled.
+type PreemptionPolicy struct {
+	Enabled           bool          `json:"enabled"`
+	MinSealSize       int           `json:"minSealSize"`
+	CoolDown          time.Duration `json:"coolDown"`
+	BoostErrorBatches bool          `json:"boostErrorBatches"`
+}
+
+// Validate checks the preemption policy, returning every invalid field.
+func (c *PreemptionPolicy) Validate() []*ValidationError {
+	v := &validator{}
+	v.nonNegative("minSealSize", int64(c.MinSealSize))
+	v.nonNegative("coolDown", int64(c.CoolDown))
+	return v.errs
+}
+
+// PreemptionStats holds the preemption counters.
+// Preemptions: Number of high priority packages sent ahead of the queued normal packages.
+// SealedEarly: Number of partial normal batches sealed by a preemption.
+// SealedEarlyLogs: Number of logs in the partial normal batches sealed by a preemption.
+// BoostedBatches: Number of normal batches holding errors queued ahead of other normal batches.
+type PreemptionStats struct {
+	Preemptions     uint64
+	SealedEarly     uint64
+	SealedEarlyLogs uint64
+	BoostedBatches  uint64
+}
+
+// SendQueue builds the normal logs into batches of the target size and orders the packages to send,
+// letting high priority packages preempt and error batches be boosted per the preemption policy. The
+// queue holds the preempting high priority packages first, then the boosted batches, then the rest.
+// Not safe for concurrent use.
+// NextID: Returns the ID of the next package. Required.
+type SendQueue struct {
+	NextID     func() uint64
+	policy     PreemptionPolicy
+	batchSize  int
+	building   []*LogData
+	queue      []*TransportPackage
+	hipri      int
+	boosted    int
+	lastSealed time.Time
+	stats      PreemptionStats
+}
+
+// NewSendQueue returns an empty send queue building batches of batchSize logs. A nil policy never preempts.
+func NewSendQueue(policy *PreemptionPolicy, batchSize int, nextID func() uint64) *SendQueue {
+	q := &SendQueue{NextID: nextID, batchSize: batchSize}
+	if policy != nil {
+		q.policy = *policy
+	}
+	if q.batchSize < 1 {
+		q.batchSize = 1
+	}
+	return q
+}
+
+// AddLog adds a normal log to the batch being built, queueing the batch once full.
+func (q *SendQueue) AddLog(ld *LogData) {
+	q.building = append(q.building, ld)
+	if len(q.building) >= q.batchSize {
+		q.enqueue(q.seal())
+	}
+}
+
+// AddHiPri queues a high priority package. With preemption enabled it is queued ahead of every normal
+// package, and the partial batch, if large enough and out of the cool-down, is sealed and queued
+// behind the normal packages already queued.
+func (q *SendQueue) AddHiPri(pkg *TransportPackage, now time.Time) {
+	if !q.policy.Enabled {
+		// Every package queued so far, boosted or not, goes ahead of it, and later boosted batches
+		// behind it.
+		q.queue = append(q.queue, pkg)
+		q.hipri, q.boosted = len(q.queue), 0
+		return
+	}
+	if q.hipri < len(q.queue) {
+		q.stats.Preemptions++
+	}
+	q.queue = insertPackage(q.queue, q.hipri, pkg)
+	q.hipri++
+	n := len(q.building)
+	if n == 0 || n < q.policy.MinSealSize || (!q.lastSealed.IsZero() && now.Sub(q.lastSealed) < q.policy.CoolDown) {
+		return
+	}
+	q.enqueue(q.seal())
+	q.lastSealed = now
+	q.stats.SealedEarly++
+	q.stats.SealedEarlyLogs += uint64(n)
+}
+
+// Flush queues the batch being built, if any, e.g. when "SendBatchLogsInterval" elapses.
+func (q *SendQueue) Flush() {
+	if len(q.building) > 0 {
+		q.enqueue(q.seal())
+	}
+}
+
+// Next removes and returns the next package to send, or nil if none is queued.
+func (q *SendQueue) Next() *TransportPackage {
+	if len(q.queue) == 0 {
+		return nil
+	}
+	pkg := q.queue[0]
+	q.queue[0] = nil
+	q.queue = q.queue[1:]
+	if q.hipri > 0 {
+		q.hipri--
+	} else if q.boosted > 0 {
+		q.boosted--
+	}
+	return pkg
+}
+
+// Len returns the number of queued packages, not counting the batch being built.
+func (q *SendQueue) Len() int {
+	return len(q.queue)
+}
+
+// Stats returns a copy of the preemption counters.
+func (q *SendQueue) Stats() PreemptionStats {
+	return q.stats
+}
+
+func (q *SendQueue) seal() *TransportPackage {
+	g := &LogGroup{Logs: q.building, ContainsErrors: q.policy.BoostErrorBatches && containsErrors(q.building)}
+	q.building = nil
+	return &TransportPackage{ID: q.NextID(), Type: TransportPackageTypeLog, Data: g}
+}
+
+// enqueue queues a sealed batch, behind the other boosted batches if it contains errors, else at the end.
+func (q *SendQueue) enqueue(pkg *TransportPackage) {
+	if !pkg.Data.(*LogGroup).ContainsErrors {
+		q.queue = append(q.queue, pkg)
+		return
+	}
+	if q.hipri+q.boosted < len(q.queue) {
+		q.stats.BoostedBatches++
+	}
+	q.queue = insertPackage(q.queue, q.hipri+q.boosted, pkg)
+	q.boosted++
+}
+
+func containsErrors(logs []*LogData) bool {
+	for _, ld := range logs {
+		if ld.Level == LevelError {
+			return true
+		}
+	}
+	return false
+}
+
+func insertPackage(queue []*TransportPackage, i int, pkg *TransportPackage) []*TransportPackage {
+	queue = append(queue, nil)
+	copy(queue[i+1:], queue[i:])
+	queue[i] = pkg
+	return queue
+}
@@ -0,0 +1,248 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"container/heap"
+	"sync"
+)
+
+// LogBuffer holds the logs of a client channel waiting to be sent. Implemented by BoundedQueue, first
+// in first out, and PriorityBuffer, most important first.
+type LogBuffer interface {
+	// TryPush adds the log without blocking, returning the logs evicted to make room, or ErrQueueFull.
+	TryPush(ld *LogData) ([]*LogData, error)
+	// PopBatch removes up to max logs, stopping before maxBytes is exceeded. Zero means no limit.
+	PopBatch(max int, maxBytes int64) []*LogData
+	// Ready returns a channel receiving a value when logs may be available.
+	Ready() <-chan struct{}
+	// Len returns the number of buffered logs.
+	Len() int
+	// Bytes returns the estimated bytes of the buffered logs.
+	Bytes() int64
+	// Dropped returns the number of logs rejected or evicted.
+	Dropped() uint64
+}
+
+var (
+	_ LogBuffer = (*BoundedQueue)(nil)
+	_ LogBuffer = (*PriorityBuffer)(nil)
+)
+
+// priorityEntry is a PriorityBuffer entry, indexed in both of its heaps.
+type priorityEntry struct {
+	queueEntry
+	seq        uint64
+	index      int
+	evictIndex int
+}
+
+// priorityHeap is a max-heap of entries, the most important at the root.
+type priorityHeap []*priorityEntry
+
+func (h priorityHeap) Len() int           { return len(h) }
+func (h priorityHeap) Less(i, j int) bool { return moreImportant(h[i], h[j]) }
+
+func (h priorityHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index, h[j].index = i, j
+}
+
+func (h *priorityHeap) Push(x interface{}) {
+	e := x.(*priorityEntry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *priorityHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return e
+}
+
+// evictionHeap is a min-heap of entries, the least important, first to evict, at the root.
+type evictionHeap []*priorityEntry
+
+func (h evictionHeap) Len() int           { return len(h) }
+func (h evictionHeap) Less(i, j int) bool { return moreImportant(h[j], h[i]) }
+
+func (h evictionHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].evictIndex, h[j].evictIndex = i, j
+}
+
+func (h *evictionHeap) Push(x interface{}) {
+	e := x.(*priorityEntry)
+	e.evictIndex = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *evictionHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return e
+}
+
+// moreImportant orders entries by Level, most severe first, then by Weight, heaviest first, then by
+// Timestamp and push order, oldest first.
+func moreImportant(a, b *priorityEntry) bool {
+	if a.ld.Level != b.ld.Level {
+		return a.ld.Level < b.ld.Level
+	}
+	if a.ld.Weight != b.ld.Weight {
+		return a.ld.Weight > b.ld.Weight
+	}
+	if !a.ld.Timestamp.Equal(b.ld.Timestamp) {
+		return a.ld.Timestamp.Before(b.ld.Timestamp)
+	}
+	return a.seq < b.seq
+}
+
+// PriorityBuffer holds the logs waiting to be sent, bounded by count and by estimated bytes, and
+// hands them out most important first: by Level, then Weight, then Timestamp. When full, the least
+// important logs are evicted to make room for more important ones, so a saturated high priority
+// channel sends its most important logs first rather than its oldest. The entries are also kept
+// in an eviction heap, so pushing and evicting are O(log n) per log. Safe for concurrent use.
+type PriorityBuffer struct {
+	maxLen   int
+	maxBytes int64
+
+	mu      sync.Mutex
+	heap    priorityHeap
+	evict   evictionHeap
+	seq     uint64
+	bytes   int64
+	dropped uint64
+	ready   chan struct{}
+}
+
+// NewPriorityBuffer returns an empty buffer holding at most maxLen logs and maxBytes estimated bytes,
+// per EstimateLogDataSize. A zero limit means no limit.
+func NewPriorityBuffer(maxLen int, maxBytes int64) *PriorityBuffer {
+	return &PriorityBuffer{maxLen: maxLen, maxBytes: maxBytes, ready: make(chan struct{}, 1)}
+}
+
+// NewHiPriBuffer returns the buffer of the high priority channel, of HipriChannelSize logs and
+// bounded by ChannelMaxBytes.
+func (c *ClientConfig) NewHiPriBuffer() *PriorityBuffer {
+	return NewPriorityBuffer(c.HipriChannelSize, c.ChannelMaxBytes)
+}
+
+// TryPush adds the log without blocking. It returns the less important logs evicted to make room,
+// or ErrQueueFull if the log was rejected because it isn't more important than the logs it would
+// evict, in which case nothing is evicted. Logs larger than the whole byte limit are always rejected.
+func (b *PriorityBuffer) TryPush(ld *LogData) ([]*LogData, error) {
+	e := &priorityEntry{queueEntry: queueEntry{ld: ld, size: EstimateLogDataSize(ld)}}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	e.seq = b.seq
+	if b.maxBytes > 0 && e.size > b.maxBytes {
+		b.dropped++
+		return nil, ErrQueueFull
+	}
+
+	// Take the victims off the eviction heap, least important first, putting them back if the log
+	// doesn't fit.
+	var victims []*priorityEntry
+	bytes := b.bytes
+	for (b.maxLen > 0 && len(b.evict) >= b.maxLen) || (b.maxBytes > 0 && bytes+e.size > b.maxBytes) {
+		if len(b.evict) == 0 || !moreImportant(e, b.evict[0]) {
+			for _, v := range victims {
+				heap.Push(&b.evict, v)
+			}
+			b.dropped++
+			return nil, ErrQueueFull
+		}
+		v := heap.Pop(&b.evict).(*priorityEntry)
+		victims = append(victims, v)
+		bytes -= v.size
+	}
+
+	var evicted []*LogData
+	if len(victims) > 0 {
+		evicted = make([]*LogData, len(victims))
+		for i, v := range victims {
+			heap.Remove(&b.heap, v.index)
+			evicted[i] = v.ld
+		}
+		b.bytes = bytes
+		b.dropped += uint64(len(evicted))
+	}
+	b.seq++
+	heap.Push(&b.heap, e)
+	heap.Push(&b.evict, e)
+	b.bytes += e.size
+	select {
+	case b.ready <- struct{}{}:
+	default:
+	}
+	return evicted, nil
+}
+
+// PopBatch removes up to max logs, most important first, stopping before maxBytes is exceeded. At
+// least one log is returned if the buffer isn't empty. A zero limit means no limit.
+func (b *PriorityBuffer) PopBatch(max int, maxBytes int64) []*LogData {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var batch []*LogData
+	var bytes int64
+	for len(b.heap) > 0 && (max <= 0 || len(batch) < max) {
+		if len(batch) > 0 && maxBytes > 0 && bytes+b.heap[0].size > maxBytes {
+			break
+		}
+		e := heap.Pop(&b.heap).(*priorityEntry)
+		heap.Remove(&b.evict, e.evictIndex)
+		bytes += e.size
+		batch = append(batch, e.ld)
+	}
+	b.bytes -= bytes
+	if len(b.heap) > 0 {
+		select {
+		case b.ready <- struct{}{}:
+		default:
+		}
+	}
+	return batch
+}
+
+// Ready returns a channel receiving a value when logs may be available.
+func (b *PriorityBuffer) Ready() <-chan struct{} {
+	return b.ready
+}
+
+// Len returns the number of buffered logs.
+func (b *PriorityBuffer) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.heap)
+}
+
+// Bytes returns the estimated bytes of the buffered logs.
+func (b *PriorityBuffer) Bytes() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.bytes
+}
+
+// Dropped returns the number of logs rejected or evicted.
+func (b *PriorityBuffer) Dropped() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.dropped
+}
@@ -0,0 +1,192 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+)
+
+const (
+	// ProcessorRedaction names the "RedactionProcessor".
+	ProcessorRedaction = "redaction"
+	// ProcessorIdentity names the "IdentityProcessor".
+	ProcessorIdentity = "identity"
+	// ProcessorLevelOverrides names the "LevelOverrideProcessor".
+	ProcessorLevelOverrides = "levelOverrides"
+	// ProcessorSampling names the "SamplingProcessor".
+	ProcessorSampling = "sampling"
+)
+
+// RedactedValue replaces the value of redacted context keys.
+const RedactedValue = "[REDACTED]"
+
+// ErrUnknownProcessor is returned when building a chain naming a processor that isn't available.
+var ErrUnknownProcessor = errors.New("unknown processor")
+
+// Processor transforms a log on the client before it is queued, so per deployment transformations
+// plug in without patching the pipeline. Process returns the log to pass on, or nil to drop it.
+// Processors must not modify the log they are given: they return a modified copy instead.
+type Processor interface {
+	Process(ld *LogData) (*LogData, error)
+}
+
+// ProcessorFunc adapts a function to the Processor interface.
+type ProcessorFunc func(ld *LogData) (*LogData, error)
+
+// Process implements the Processor interface.
+func (f ProcessorFunc) Process(ld *LogData) (*LogData, error) {
+	return f(ld)
+}
+
+// ProcessorChain runs processors in order, each on the log returned by the previous one.
+type ProcessorChain []Processor
+
+// Process implements the Processor interface. It stops at the first processor dropping the log or
+// returning an error.
+func (c ProcessorChain) Process(ld *LogData) (*LogData, error) {
+	for i, p := range c {
+		var err error
+		if ld, err = p.Process(ld); err != nil {
+			return nil, fmt.Errorf("processor %d: %w", i, err)
+		}
+		if ld == nil {
+			return nil, nil
+		}
+	}
+	return ld, nil
+}
+
+// BuildProcessorChain returns the chain of the processors named by the config Processors, in order.
+// available maps names to processors, e.g. the built-ins returned by DefaultProcessors. Returns
+// ErrUnknownProcessor if a name isn't available.
+func (c *ClientConfig) BuildProcessorChain(available map[string]Processor) (ProcessorChain, error) {
+	chain := make(ProcessorChain, 0, len(c.Processors))
+	for _, name := range c.Processors {
+		p, ok := available[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownProcessor, name)
+		}
+		chain = append(chain, p)
+	}
+	return chain, nil
+}
+
+// DefaultProcessors returns the "Processor*" built-ins configured from the client config.
+func (c *ClientConfig) DefaultProcessors(identity *ClientIdentity) map[string]Processor {
+	return map[string]Processor{
+		ProcessorRedaction:      &RedactionProcessor{Keys: c.RedactedKeys},
+		ProcessorIdentity:       &IdentityProcessor{Identity: identity},
+		ProcessorLevelOverrides: &LevelOverrideProcessor{Config: c},
+		ProcessorSampling:       &SamplingProcessor{Config: c.Sampling},
+	}
+}
+
+// RedactionProcessor replaces the value of the given context keys with "RedactedValue".
+type RedactionProcessor struct {
+	Keys []string
+}
+
+// Process implements the Processor interface.
+func (p *RedactionProcessor) Process(ld *LogData) (*LogData, error) {
+	var out *LogData
+	for i := 0; i+1 < len(ld.ContextMap); i += 2 {
+		key := fmt.Sprint(ld.ContextMap[i])
+		for _, k := range p.Keys {
+			if k != key {
+				continue
+			}
+			if out == nil {
+				out = copyLogData(ld)
+			}
+			out.ContextMap[i+1] = RedactedValue
+			break
+		}
+	}
+	if out == nil {
+		return ld, nil
+	}
+	return out, nil
+}
+
+// IdentityProcessor adds the client identity labels to the log context, without overriding values
+// set by the log itself.
+type IdentityProcessor struct {
+	Identity *ClientIdentity
+}
+
+// Process implements the Processor interface.
+func (p *IdentityProcessor) Process(ld *LogData) (*LogData, error) {
+	labels := p.Identity.Labels()
+	if len(labels) == 0 {
+		return ld, nil
+	}
+	out := copyLogData(ld)
+	for k, v := range labels {
+		if _, ok := Get[interface{}](out, k); !ok {
+			out.ContextMap = append(out.ContextMap, k, v)
+		}
+	}
+	return out, nil
+}
+
+// LevelOverrideProcessor drops the logs less severe than their effective level. See ClientConfig.ShouldLog.
+type LevelOverrideProcessor struct {
+	Config *ClientConfig
+}
+
+// Process implements the Processor interface.
+func (p *LevelOverrideProcessor) Process(ld *LogData) (*LogData, error) {
+	if !p.Config.ShouldLog(ld, ld.Context()) {
+		return nil, nil
+	}
+	return ld, nil
+}
+
+// SamplingProcessor samples logs per the sampling config, recording its decision in the kept logs.
+// Rand: Returns a uniformly distributed random number in [0, 1). Defaults to math/rand.Float64.
+type SamplingProcessor struct {
+	Config *SamplingConfig
+	Rand   func() float64
+}
+
+// Process implements the Processor interface.
+func (p *SamplingProcessor) Process(ld *LogData) (*LogData, error) {
+	if p.Config == nil || p.Config.Rate <= 0 || p.Config.Rate >= 1 || ld.Level <= p.Config.MinLevel {
+		return ld, nil
+	}
+	r := rand.Float64
+	if p.Rand != nil {
+		r = p.Rand
+	}
+	decision := ld.Sampling.Resample(p.Config.Rate, p.Config.Policy, r())
+	if decision != nil && !decision.Sampled {
+		return nil, nil
+	}
+	if decision == ld.Sampling {
+		return ld, nil
+	}
+	out := *ld
+	out.Sampling = decision
+	return &out, nil
+}
+
+// copyLogData returns a copy of the log with its own context slice.
+func copyLogData(ld *LogData) *LogData {
+	out := *ld
+	out.ContextMap = append(make([]interface{}, 0, len(ld.ContextMap)), ld.ContextMap...)
+	return &out
+}
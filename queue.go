@@ -0,0 +1,235 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+)
+
+const (
+	// QueueOverflowReject rejects logs pushed to a full queue.
+	QueueOverflowReject = "reject"
+	// QueueOverflowDropOldest evicts the oldest logs of a full queue to make room.
+	QueueOverflowDropOldest = "dropOldest"
+	// QueueOverflowDropLeastSevere evicts the oldest of the least severe logs of a full queue to make
+	// room, rejecting the pushed log instead if it's not more severe than any queued log.
+	QueueOverflowDropLeastSevere = "dropLeastSevere"
+)
+
+// ErrQueueFull is returned when a log is rejected because the queue is full.
+var ErrQueueFull = errors.New("queue full")
+
+type queueEntry struct {
+	ld   *LogData
+	size int64
+}
+
+// boundedEntry is a BoundedQueue entry, linked in the queue order and in the order of its level.
+type boundedEntry struct {
+	queueEntry
+	order *list.Element
+	level *list.Element
+}
+
+// queueLevel holds the entries of a level, oldest first, with their estimated bytes.
+type queueLevel struct {
+	entries list.List
+	bytes   int64
+}
+
+// BoundedQueue holds the logs waiting to be sent, bounded by count and by estimated bytes, replacing
+// plain channels whose only limit is the element count and which can't evict. Entries are also
+// indexed by level, so evicting is O(1) per evicted log, or O(levels) for "QueueOverflowDropLeastSevere".
+// Safe for concurrent use.
+type BoundedQueue struct {
+	maxLen   int
+	maxBytes int64
+	overflow string
+
+	mu      sync.Mutex
+	entries list.List
+	levels  map[byte]*queueLevel
+	bytes   int64
+	dropped uint64
+	ready   chan struct{}
+}
+
+// NewBoundedQueue returns an empty queue holding at most maxLen logs and maxBytes estimated bytes,
+// per EstimateLogDataSize. A zero limit means no limit. overflow is one of "QueueOverflow*", and
+// defaults to "QueueOverflowReject".
+func NewBoundedQueue(maxLen int, maxBytes int64, overflow string) *BoundedQueue {
+	if overflow == "" {
+		overflow = QueueOverflowReject
+	}
+	return &BoundedQueue{
+		maxLen:   maxLen,
+		maxBytes: maxBytes,
+		overflow: overflow,
+		levels:   make(map[byte]*queueLevel),
+		ready:    make(chan struct{}, 1),
+	}
+}
+
+// NewChannelQueue returns the queue of a client channel of the given size, e.g. ChannelSize, bounded
+// and evicting per the config ChannelMaxBytes and ChannelOverflow.
+func (c *ClientConfig) NewChannelQueue(size int) *BoundedQueue {
+	return NewBoundedQueue(size, c.ChannelMaxBytes, c.ChannelOverflow)
+}
+
+// TryPush adds the log without blocking. It returns the logs evicted to make room, or ErrQueueFull
+// if the log was rejected, in which case nothing is evicted. Logs larger than the whole byte limit
+// are always rejected.
+func (q *BoundedQueue) TryPush(ld *LogData) ([]*LogData, error) {
+	size := EstimateLogDataSize(ld)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.fits(ld, size) {
+		q.dropped++
+		return nil, ErrQueueFull
+	}
+	var evicted []*LogData
+	for q.full(size) {
+		e := q.victim(ld)
+		q.remove(e)
+		evicted = append(evicted, e.ld)
+	}
+	q.dropped += uint64(len(evicted))
+
+	e := &boundedEntry{queueEntry: queueEntry{ld: ld, size: size}}
+	l := q.levels[ld.Level]
+	if l == nil {
+		l = &queueLevel{}
+		q.levels[ld.Level] = l
+	}
+	e.order = q.entries.PushBack(e)
+	e.level = l.entries.PushBack(e)
+	l.bytes += size
+	q.bytes += size
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+	return evicted, nil
+}
+
+// PopBatch removes up to max logs, oldest first, stopping before maxBytes is exceeded. At least one
+// log is returned if the queue isn't empty. A zero limit means no limit.
+func (q *BoundedQueue) PopBatch(max int, maxBytes int64) []*LogData {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var batch []*LogData
+	var bytes int64
+	for el := q.entries.Front(); el != nil && (max <= 0 || len(batch) < max); el = q.entries.Front() {
+		e := el.Value.(*boundedEntry)
+		if len(batch) > 0 && maxBytes > 0 && bytes+e.size > maxBytes {
+			break
+		}
+		bytes += e.size
+		batch = append(batch, e.ld)
+		q.remove(e)
+	}
+	if batch == nil {
+		batch = []*LogData{}
+	}
+	if q.entries.Len() > 0 {
+		select {
+		case q.ready <- struct{}{}:
+		default:
+		}
+	}
+	return batch
+}
+
+// Ready returns a channel receiving a value when logs may be available, for consumers to wait on
+// instead of receiving from a channel.
+func (q *BoundedQueue) Ready() <-chan struct{} {
+	return q.ready
+}
+
+// Len returns the number of queued logs.
+func (q *BoundedQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.entries.Len()
+}
+
+// Bytes returns the estimated bytes of the queued logs.
+func (q *BoundedQueue) Bytes() int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.bytes
+}
+
+// Dropped returns the number of logs rejected or evicted.
+func (q *BoundedQueue) Dropped() uint64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.dropped
+}
+
+// full returns true if a log of the given size doesn't fit in the queue; false otherwise.
+func (q *BoundedQueue) full(size int64) bool {
+	return (q.maxLen > 0 && q.entries.Len() >= q.maxLen) || (q.maxBytes > 0 && q.bytes+size > q.maxBytes)
+}
+
+// fits returns true if the pushed log fits once every entry the overflow policy may evict for it is
+// evicted; false if it must be rejected.
+func (q *BoundedQueue) fits(ld *LogData, size int64) bool {
+	if q.maxBytes > 0 && size > q.maxBytes {
+		return false
+	}
+	n, bytes := q.entries.Len(), q.bytes
+	switch q.overflow {
+	case QueueOverflowDropOldest:
+		n, bytes = 0, 0
+	case QueueOverflowDropLeastSevere:
+		for level, l := range q.levels {
+			if level > ld.Level {
+				n -= l.entries.Len()
+				bytes -= l.bytes
+			}
+		}
+	}
+	return (q.maxLen <= 0 || n < q.maxLen) && (q.maxBytes <= 0 || bytes+size <= q.maxBytes)
+}
+
+// victim returns the next entry to evict for the pushed log, which fits per fits.
+func (q *BoundedQueue) victim(ld *LogData) *boundedEntry {
+	if q.overflow == QueueOverflowDropOldest {
+		return q.entries.Front().Value.(*boundedEntry)
+	}
+	var victim *queueLevel
+	least := ld.Level
+	for level, l := range q.levels {
+		if level > least {
+			victim, least = l, level
+		}
+	}
+	return victim.entries.Front().Value.(*boundedEntry)
+}
+
+// remove unlinks the entry from the queue and from its level.
+func (q *BoundedQueue) remove(e *boundedEntry) {
+	q.entries.Remove(e.order)
+	l := q.levels[e.ld.Level]
+	l.entries.Remove(e.level)
+	l.bytes -= e.size
+	if l.entries.Len() == 0 {
+		delete(q.levels, e.ld.Level)
+	}
+	q.bytes -= e.size
+}
@@ -0,0 +1,114 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"time"
+)
+
+// TransportQUIC is the name of the QUIC transport.
+const TransportQUIC = "quic"
+
+// QUICALPN holds the ALPN protocol negotiated by the QUIC transport.
+const QUICALPN = "cloudlogger"
+
+// DefaultQUICSessionCacheSize is the TLS session cache size used when the QUIC config doesn't set one.
+const DefaultQUICSessionCacheSize = 64
+
+// QUICConfig holds the QUIC transport configuration.
+// Enable0RTT: true to send the first packages in 0-RTT data when reconnecting to a known server; false otherwise.
+// 0-RTT data can be replayed by an attacker, so servers must dedup packages by ID.
+// SessionCacheSize: Number of TLS sessions kept for resumption. Defaults to "DefaultQUICSessionCacheSize".
+// MaxIdleTimeout: Time after which an idle connection is closed.
+// KeepAlivePeriod: Interval between keep alive frames. Zero disables keep alives.
+// DisableConnectionMigration: true to close the connection when the client address changes; false to migrate it.
+type QUICConfig struct {
+	Enable0RTT                 bool          `json:"enable0RTT"`
+	SessionCacheSize           int           `json:"sessionCacheSize"`
+	MaxIdleTimeout             time.Duration `json:"maxIdleTimeout"`
+	KeepAlivePeriod            time.Duration `json:"keepAlivePeriod"`
+	DisableConnectionMigration bool          `json:"disableConnectionMigration"`
+}
+
+// QUICDialer opens a QUIC connection to the endpoint and returns its bidirectional stream. This
+// package doesn't depend on a QUIC implementation: binaries using the QUIC transport provide one
+// through RegisterQUICTransport. The dialer must use tlsConfig as given so sessions are resumed.
+type QUICDialer func(ctx context.Context, endpoint string, tlsConfig *tls.Config, config *QUICConfig) (io.ReadWriteCloser, error)
+
+// QUICTransport frames packages over a QUIC stream. The TLS session cache outlives the
+// connection so reconnections after "ConnectionResetInterval" resume the session, with 0-RTT
+// if enabled.
+type QUICTransport struct {
+	*StreamTransport
+	config    QUICConfig
+	tlsConfig *tls.Config
+}
+
+// NewQUICTransport returns a QUIC transport using the given dialer.
+func NewQUICTransport(dial QUICDialer, tlsConfig *tls.Config, config *QUICConfig) *QUICTransport {
+	t := &QUICTransport{}
+	if config != nil {
+		t.config = *config
+	}
+	if t.config.SessionCacheSize <= 0 {
+		t.config.SessionCacheSize = DefaultQUICSessionCacheSize
+	}
+	if tlsConfig != nil {
+		t.tlsConfig = tlsConfig.Clone()
+	} else {
+		t.tlsConfig = &tls.Config{}
+	}
+	if len(t.tlsConfig.NextProtos) == 0 {
+		t.tlsConfig.NextProtos = []string{QUICALPN}
+	}
+	t.tlsConfig.MinVersion = tls.VersionTLS13
+	if t.tlsConfig.ClientSessionCache == nil {
+		t.tlsConfig.ClientSessionCache = tls.NewLRUClientSessionCache(t.config.SessionCacheSize)
+	}
+	t.StreamTransport = NewStreamTransport(func(ctx context.Context, endpoint string) (io.ReadWriteCloser, error) {
+		return dial(ctx, endpoint, t.tlsConfig, &t.config)
+	})
+	return t
+}
+
+// RegisterQUICTransport registers the QUIC transport under "TransportQUIC" using the given dialer.
+// Every transport created by the registration shares the same TLS session cache.
+func RegisterQUICTransport(dial QUICDialer, tlsConfig *tls.Config, config *QUICConfig) {
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	} else {
+		tlsConfig = tlsConfig.Clone()
+	}
+	if tlsConfig.ClientSessionCache == nil {
+		size := DefaultQUICSessionCacheSize
+		if config != nil && config.SessionCacheSize > 0 {
+			size = config.SessionCacheSize
+		}
+		tlsConfig.ClientSessionCache = tls.NewLRUClientSessionCache(size)
+	}
+	RegisterTransport(TransportQUIC, func() Transport { return NewQUICTransport(dial, tlsConfig, config) })
+}
+
+// Validate checks the QUIC config, returning every invalid field.
+func (c *QUICConfig) Validate() []*ValidationError {
+	v := &validator{}
+	v.nonNegative("sessionCacheSize", int64(c.SessionCacheSize))
+	v.nonNegative("maxIdleTimeout", int64(c.MaxIdleTimeout))
+	v.nonNegative("keepAlivePeriod", int64(c.KeepAlivePeriod))
+	return v.errs
+}
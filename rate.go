@@ -0,0 +1,89 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// RateBucketSeconds holds the width, in seconds, of the sliding rate buckets.
+	RateBucketSeconds = 5
+	// rateBuckets holds the number of buckets, covering the longest (15m) window plus the current bucket.
+	rateBuckets = 15*60/RateBucketSeconds + 1
+)
+
+// Rates holds event rates, in events per second, over sliding windows.
+// Rate1m: Rate over the last minute.
+// Rate5m: Rate over the last 5 minutes.
+// Rate15m: Rate over the last 15 minutes.
+type Rates struct {
+	Rate1m  float64
+	Rate5m  float64
+	Rate15m float64
+}
+
+// SlidingRate counts events in RateBucketSeconds wide buckets to compute rates over the last 1, 5 and
+// 15 minutes. Updates are lock-free. The zero value is ready to use.
+type SlidingRate struct {
+	// buckets pack the bucket epoch (upper 32 bits) with its count (lower 32 bits), so a bucket is
+	// reset and incremented with a single compare and swap.
+	buckets [rateBuckets]atomic.Uint64
+}
+
+// Add records n events at the given time.
+func (r *SlidingRate) Add(now time.Time, n uint32) {
+	epoch := rateEpoch(now)
+	b := &r.buckets[epoch%rateBuckets]
+	for {
+		old := b.Load()
+		next := uint64(epoch)<<32 | uint64(n)
+		if uint32(old>>32) == epoch {
+			next = old + uint64(n)
+		}
+		if b.CompareAndSwap(old, next) {
+			return
+		}
+	}
+}
+
+// Rates returns the rates over the windows ending at the given time. The current, partial bucket
+// is counted, so rates are slightly underestimated until it fills.
+func (r *SlidingRate) Rates(now time.Time) Rates {
+	return Rates{
+		Rate1m:  r.rate(now, time.Minute),
+		Rate5m:  r.rate(now, 5*time.Minute),
+		Rate15m: r.rate(now, 15*time.Minute),
+	}
+}
+
+func (r *SlidingRate) rate(now time.Time, window time.Duration) float64 {
+	epoch := rateEpoch(now)
+	n := uint32(window / (RateBucketSeconds * time.Second))
+	var total uint64
+	for i := uint32(0); i < n; i++ {
+		e := epoch - i
+		v := r.buckets[e%rateBuckets].Load()
+		if uint32(v>>32) == e {
+			total += v & 0xffffffff
+		}
+	}
+	return float64(total) / window.Seconds()
+}
+
+func rateEpoch(t time.Time) uint32 {
+	return uint32(t.Unix() / RateBucketSeconds)
+}
@@ -0,0 +1,94 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"time"
+)
+
+const (
+	// ReceiptBackendCloudLogging represents IDs assigned by Cloud Logging, i.e. entry insertIds.
+	ReceiptBackendCloudLogging = "cloudLogging"
+	// ReceiptBackendLoki represents IDs assigned by Loki, i.e. entry hashes.
+	ReceiptBackendLoki = "loki"
+)
+
+// deliveryReceiptsBucket holds the KVStore bucket of the delivery receipts, keyed by big endian package ID.
+var deliveryReceiptsBucket = []byte("receipts")
+
+// DeliveryReceipt holds the persistence proof of one package, mapping each of its logs to the ID
+// the backend assigned when storing it. Sent by the server in "TransportPackageTypeDeliveryReceipt"
+// packages to clients that negotiated "CapabilityDeliveryReceipts".
+// PackageID: ID of the persisted package.
+// Backend: Backend that persisted the logs. One of "ReceiptBackend*", or any other backend name.
+// LogName: Backend log or stream the logs were written to.
+// BackendIDs: Backend assigned ID of each log, in package order. Empty for logs dropped by the server, e.g. sampled out.
+// PersistedAt: Time the backend acknowledged the write.
+type DeliveryReceipt struct {
+	PackageID   uint64    `json:"packageID"`
+	Backend     string    `json:"backend"`
+	LogName     string    `json:"logName,omitempty"`
+	BackendIDs  []string  `json:"backendIDs"`
+	PersistedAt time.Time `json:"persistedAt"`
+}
+
+// BackendID returns the backend assigned ID of the log at the given package index, or "" if the log wasn't persisted.
+func (r *DeliveryReceipt) BackendID(index int) string {
+	if index < 0 || index >= len(r.BackendIDs) {
+		return ""
+	}
+	return r.BackendIDs[index]
+}
+
+// Persisted returns the number of logs of the package the backend assigned an ID to.
+func (r *DeliveryReceipt) Persisted() int {
+	n := 0
+	for _, id := range r.BackendIDs {
+		if id != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// SaveDeliveryReceipt stores the receipt in kv, replacing any previous receipt of the same package.
+func SaveDeliveryReceipt(kv KVStore, r *DeliveryReceipt) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return kv.Put(deliveryReceiptsBucket, receiptKey(r.PackageID), b)
+}
+
+// LoadDeliveryReceipt reads the receipt of the given package written by SaveDeliveryReceipt. It
+// returns nil if kv holds none.
+func LoadDeliveryReceipt(kv KVStore, packageID uint64) (*DeliveryReceipt, error) {
+	b, err := kv.Get(deliveryReceiptsBucket, receiptKey(packageID))
+	if err != nil || b == nil {
+		return nil, err
+	}
+	r := &DeliveryReceipt{}
+	if err := json.Unmarshal(b, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// receiptKey returns the KVStore key of a package receipt. Big endian keys keep bolt cursors in package order.
+func receiptKey(packageID uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, packageID)
+}
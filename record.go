@@ -0,0 +1,146 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// OverflowEntryVersion holds the layout version of the overflow entries written by EncodeOverflowEntry.
+const OverflowEntryVersion = 1
+
+var (
+	// ErrRecordTooNew is returned when decoding a record written by a newer version of the library.
+	ErrRecordTooNew = errors.New("record version too new")
+	// ErrMissingRecordMigration is returned when no migration upgrades a record from its version.
+	ErrMissingRecordMigration = errors.New("missing record migration")
+)
+
+// RecordEnvelope holds a persisted record with the version of the layout it was written with, so
+// records spilled to disk by an older library version can be migrated instead of misread.
+// Version: Layout version of Data.
+// Data: JSON serialized record.
+type RecordEnvelope struct {
+	Version int
+	Data    json.RawMessage
+}
+
+// RecordMigration converts a serialized record from a layout version to the next one.
+type RecordMigration func(old []byte) ([]byte, error)
+
+// RecordMigrations holds the migrations of a record kind up to its current layout version. Safe for
+// concurrent use.
+type RecordMigrations struct {
+	current int
+	mu      sync.RWMutex
+	steps   map[int]RecordMigration
+}
+
+// NewRecordMigrations returns the migrations of a record kind whose current layout version is current.
+func NewRecordMigrations(current int) *RecordMigrations {
+	return &RecordMigrations{current: current, steps: make(map[int]RecordMigration)}
+}
+
+// Register sets the migration converting records from fromVersion to fromVersion+1, replacing any
+// previous registration. A library version changing the layout bumps the current version and
+// registers the migration from the previous one.
+func (m *RecordMigrations) Register(fromVersion int, migration RecordMigration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.steps[fromVersion] = migration
+}
+
+// MigrateRecord converts a serialized record from fromVersion to the current version, one version
+// at a time. Returns ErrMissingRecordMigration if a step isn't registered and ErrRecordTooNew if
+// fromVersion is newer than the current version.
+func (m *RecordMigrations) MigrateRecord(old []byte, fromVersion int) ([]byte, error) {
+	if fromVersion > m.current {
+		return nil, fmt.Errorf("%w: %d > %d", ErrRecordTooNew, fromVersion, m.current)
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	data := old
+	for v := fromVersion; v < m.current; v++ {
+		step, ok := m.steps[v]
+		if !ok {
+			return nil, fmt.Errorf("%w: from version %d", ErrMissingRecordMigration, v)
+		}
+		var err error
+		if data, err = step(data); err != nil {
+			return nil, fmt.Errorf("migrating from version %d: %w", v, err)
+		}
+	}
+	return data, nil
+}
+
+// Wrap returns the JSON serialized record in an envelope at the current version.
+func (m *RecordMigrations) Wrap(data []byte) ([]byte, error) {
+	return json.Marshal(&RecordEnvelope{Version: m.current, Data: data})
+}
+
+// Unwrap returns the record held by a serialized envelope, migrated to the current version. A record
+// without an envelope, written before records were versioned, is migrated as a whole from version 0.
+func (m *RecordMigrations) Unwrap(record []byte) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(record, &fields); err != nil {
+		return nil, err
+	}
+	version, hasVersion := fields["Version"]
+	data, hasData := fields["Data"]
+	if !hasVersion || !hasData {
+		return m.MigrateRecord(record, 0)
+	}
+	var fromVersion int
+	if err := json.Unmarshal(version, &fromVersion); err != nil {
+		return nil, err
+	}
+	return m.MigrateRecord(data, fromVersion)
+}
+
+// OverflowEntryMigrations holds the migrations of the overflow entries read by DecodeOverflowEntry.
+var OverflowEntryMigrations = NewRecordMigrations(OverflowEntryVersion)
+
+func init() {
+	// Version 0 entries, spilled without an envelope, have the version 1 layout.
+	OverflowEntryMigrations.Register(0, func(old []byte) ([]byte, error) {
+		return old, nil
+	})
+}
+
+// EncodeOverflowEntry serializes the entry in a versioned envelope, for the disk overflow buffer.
+func EncodeOverflowEntry(e *OverflowEntry) ([]byte, error) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	return OverflowEntryMigrations.Wrap(data)
+}
+
+// DecodeOverflowEntry deserializes an entry written by EncodeOverflowEntry, by this or an older
+// version of the library.
+func DecodeOverflowEntry(record []byte) (*OverflowEntry, error) {
+	data, err := OverflowEntryMigrations.Unwrap(record)
+	if err != nil {
+		return nil, err
+	}
+	e := &OverflowEntry{}
+	if err := json.Unmarshal(data, e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
@@ -0,0 +1,152 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import "time"
+
+const (
+	// ReplaySourceNone represents that nothing should be sent right now.
+	ReplaySourceNone = byte(0)
+	// ReplaySourceLive represents that the next batch should come from the live channels.
+	ReplaySourceLive = byte(1)
+	// ReplaySourceReplay represents that the next batch should come from the overflow channel or disk buffer.
+	ReplaySourceReplay = byte(2)
+)
+
+// RecoveryPolicy governs how overflow channel and disk buffered logs are re-injected after a reconnection.
+// MaxReplayRate: Maximum number of buffered logs replayed per second. Zero means no limit.
+// InterleaveRatio: Number of live batches sent between two replayed batches while both are available.
+// Zero gives replayed batches priority over live ones.
+// MaxReplayDuration: Maximum time spent replaying. Zero means no limit.
+// DropOnTimeout: true to drop the logs still buffered when MaxReplayDuration is hit; false to keep them
+// for the next recovery.
+type RecoveryPolicy struct {
+	MaxReplayRate     int           `json:"maxReplayRate"`
+	InterleaveRatio   int           `json:"interleaveRatio"`
+	MaxReplayDuration time.Duration `json:"maxReplayDuration"`
+	DropOnTimeout     bool          `json:"dropOnTimeout"`
+}
+
+// ReplayState holds the progress of a recovery replay.
+// Started: Time the replay started.
+// Pending: Number of buffered logs still to be replayed.
+// Replayed: Number of buffered logs replayed.
+// Dropped: Number of buffered logs dropped because the replay timed out.
+// LiveSent: Number of live batches sent during the replay.
+// Done: true once nothing is left to replay or the replay timed out; false otherwise.
+type ReplayState struct {
+	Started  time.Time
+	Pending  int
+	Replayed int
+	Dropped  int
+	LiveSent int
+	Done     bool
+
+	policy          RecoveryPolicy
+	tokens          float64
+	lastRefill      time.Time
+	liveSinceReplay int
+}
+
+// NewReplayState starts a replay of the given number of buffered logs.
+func NewReplayState(policy *RecoveryPolicy, pending int, now time.Time) *ReplayState {
+	s := &ReplayState{Started: now, Pending: pending, Done: pending == 0, lastRefill: now}
+	if policy != nil {
+		s.policy = *policy
+	}
+	s.tokens = float64(s.policy.MaxReplayRate)
+	return s
+}
+
+// NextSource returns where the next batch should be taken from. One of "ReplaySource*".
+func (s *ReplayState) NextSource(now time.Time, liveAvailable bool) byte {
+	s.checkTimeout(now)
+	if s.Done {
+		if liveAvailable {
+			return ReplaySourceLive
+		}
+		return ReplaySourceNone
+	}
+	if liveAvailable && s.liveSinceReplay < s.policy.InterleaveRatio {
+		return ReplaySourceLive
+	}
+	if s.Allowance(now) > 0 {
+		return ReplaySourceReplay
+	}
+	if liveAvailable {
+		return ReplaySourceLive
+	}
+	return ReplaySourceNone
+}
+
+// Allowance returns how many buffered logs can be replayed right now under the rate limit.
+func (s *ReplayState) Allowance(now time.Time) int {
+	if s.Done {
+		return 0
+	}
+	if s.policy.MaxReplayRate <= 0 {
+		return s.Pending
+	}
+	rate := float64(s.policy.MaxReplayRate)
+	s.tokens += now.Sub(s.lastRefill).Seconds() * rate
+	if s.tokens > rate {
+		s.tokens = rate
+	}
+	s.lastRefill = now
+	if n := int(s.tokens); n < s.Pending {
+		return n
+	}
+	return s.Pending
+}
+
+// RecordReplayed records that n buffered logs were replayed.
+func (s *ReplayState) RecordReplayed(n int) {
+	if n > s.Pending {
+		n = s.Pending
+	}
+	s.Pending -= n
+	s.Replayed += n
+	s.tokens -= float64(n)
+	s.liveSinceReplay = 0
+	if s.Pending == 0 {
+		s.Done = true
+	}
+}
+
+// RecordLive records that a live batch was sent.
+func (s *ReplayState) RecordLive() {
+	s.LiveSent++
+	s.liveSinceReplay++
+}
+
+func (s *ReplayState) checkTimeout(now time.Time) {
+	if s.Done || s.policy.MaxReplayDuration <= 0 || now.Sub(s.Started) < s.policy.MaxReplayDuration {
+		return
+	}
+	if s.policy.DropOnTimeout {
+		s.Dropped += s.Pending
+		s.Pending = 0
+	}
+	s.Done = true
+}
+
+// Validate checks the recovery policy, returning every invalid field.
+func (p *RecoveryPolicy) Validate() []*ValidationError {
+	v := &validator{}
+	v.nonNegative("maxReplayRate", int64(p.MaxReplayRate))
+	v.nonNegative("interleaveRatio", int64(p.InterleaveRatio))
+	v.nonNegative("maxReplayDuration", int64(p.MaxReplayDuration))
+	return v.errs
+}
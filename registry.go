@@ -0,0 +1,247 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+const (
+	// ConnectionStateActive represents an open connection.
+	ConnectionStateActive = "active"
+	// ConnectionStateDraining represents a connection being shut down, still sending its queued logs.
+	ConnectionStateDraining = "draining"
+	// ConnectionStateClosed represents a connection closed by the client or the server.
+	ConnectionStateClosed = "closed"
+	// ConnectionStateExpired represents a connection removed after receiving nothing for too long.
+	ConnectionStateExpired = "expired"
+)
+
+// ConnectionRegistrySnapshotVersion holds the format version of the registry snapshots written by this
+// package. Version 2 added the closed and expired tombstones, which older readers would restore as
+// active connections.
+const ConnectionRegistrySnapshotVersion = 2
+
+var (
+	// registryConnectionsBucket holds the KVStore bucket of the connection records, keyed by connection ID.
+	registryConnectionsBucket = []byte("connections")
+	// registryMetaBucket holds the KVStore bucket of the snapshot metadata.
+	registryMetaBucket = []byte("registry")
+	// registryMetaKey holds the key of the snapshot metadata in registryMetaBucket.
+	registryMetaKey = []byte("meta")
+)
+
+// ConnectionRecord holds the state of a connection persisted across server restarts, so clients can
+// resume their connections without re-opening them.
+// ConnectionID: Server provided unique connecton ID.
+// ClientID: Client provided ID.
+// IsHiPri: true if the connection is high priority; false otherwise.
+// StreamingEndpoint: Streaming endpoint the client uses for the connection.
+// ClientConfigs: Client logging configuration.
+// ContextMaps: Key-value data pairs containing the maps for each context object.
+// ContextSchema: Context schema accepted at connection time, checked again when the client resumes.
+// ClientIdentity: Client instance metadata.
+// Capabilities: Negotiated protocol features.
+// OpenedAt: Time the connection was opened.
+// LastReceivedTime: Time the last package was received.
+// LastPackageID: ID of the last package processed, so retransmissions after the restart are recognized.
+// Version: Connection state version.
+// State: Lifecycle state of the connection. One of "ConnectionState*". Empty in snapshots written
+// before states were recorded, meaning "ConnectionStateActive".
+// ClosedAt: Time the connection was closed or expired. Zero while it is active or draining.
+type ConnectionRecord struct {
+	ConnectionID      string
+	ClientID          string
+	IsHiPri           bool
+	StreamingEndpoint string
+	ClientConfigs     *ClientConfig
+	ContextMaps       map[string][]string
+	ContextSchema     *ContextSchema
+	ClientIdentity    *ClientIdentity
+	Capabilities      Capabilities
+	OpenedAt          time.Time
+	LastReceivedTime  time.Time
+	LastPackageID     uint64
+	Version           uint64
+	State             string `json:",omitempty"`
+	ClosedAt          time.Time
+}
+
+// EffectiveState returns the record State, or "ConnectionStateActive" if unset.
+func (r *ConnectionRecord) EffectiveState() string {
+	if r.State == "" {
+		return ConnectionStateActive
+	}
+	return r.State
+}
+
+// SetState moves the connection to the given state, one of "ConnectionState*", setting ClosedAt when
+// it becomes a tombstone and clearing it when it becomes active or draining again. The record is soft deleted: it stays in the registry until PruneTombstones
+// removes it.
+func (r *ConnectionRecord) SetState(state string, now time.Time) {
+	switch {
+	case !IsTombstoneState(state):
+		r.ClosedAt = time.Time{}
+	case !IsTombstoneState(r.EffectiveState()):
+		r.ClosedAt = now
+	}
+	r.State = state
+	r.Version++
+}
+
+// IsTombstoneState returns true if connections in the state are tombstones, i.e. closed or expired; false otherwise.
+func IsTombstoneState(state string) bool {
+	return state == ConnectionStateClosed || state == ConnectionStateExpired
+}
+
+// PruneTombstones returns the records without the tombstones closed for retention or longer, and the
+// IDs of the removed ones.
+func PruneTombstones(records []*ConnectionRecord, retention time.Duration, now time.Time) ([]*ConnectionRecord, []string) {
+	kept := records[:0:0]
+	var pruned []string
+	for _, r := range records {
+		if IsTombstoneState(r.EffectiveState()) && now.Sub(r.ClosedAt) >= retention {
+			pruned = append(pruned, r.ConnectionID)
+			continue
+		}
+		kept = append(kept, r)
+	}
+	return kept, pruned
+}
+
+// ConnectionRegistrySnapshot holds the known connections of a server at a point in time.
+// FormatVersion: Snapshot format version. See "ConnectionRegistrySnapshotVersion".
+// TakenAt: Time the snapshot was taken.
+// Connections: Known connections, sorted by connection ID.
+type ConnectionRegistrySnapshot struct {
+	FormatVersion int
+	TakenAt       time.Time
+	Connections   []*ConnectionRecord
+}
+
+// registrySnapshotMeta holds the snapshot fields stored next to the records in a KVStore.
+type registrySnapshotMeta struct {
+	FormatVersion int
+	TakenAt       time.Time
+}
+
+// NewConnectionRegistrySnapshot returns a snapshot of the given records, sorted by connection ID.
+func NewConnectionRegistrySnapshot(records []*ConnectionRecord, takenAt time.Time) *ConnectionRegistrySnapshot {
+	sorted := append([]*ConnectionRecord(nil), records...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ConnectionID < sorted[j].ConnectionID })
+	return &ConnectionRegistrySnapshot{
+		FormatVersion: ConnectionRegistrySnapshotVersion,
+		TakenAt:       takenAt,
+		Connections:   sorted,
+	}
+}
+
+// SaveConnectionRegistryJSON writes the snapshot as JSON.
+func SaveConnectionRegistryJSON(w io.Writer, snap *ConnectionRegistrySnapshot) error {
+	return json.NewEncoder(w).Encode(snap)
+}
+
+// LoadConnectionRegistryJSON reads a snapshot written by SaveConnectionRegistryJSON.
+func LoadConnectionRegistryJSON(r io.Reader) (*ConnectionRegistrySnapshot, error) {
+	snap := &ConnectionRegistrySnapshot{}
+	if err := json.NewDecoder(r).Decode(snap); err != nil {
+		return nil, err
+	}
+	if err := checkRegistryFormatVersion(snap.FormatVersion); err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+// SaveConnectionRegistryKV writes the snapshot to kv, e.g. a bolt database, one record per
+// connection. Records of connections no longer in the snapshot are deleted.
+func SaveConnectionRegistryKV(kv KVStore, snap *ConnectionRegistrySnapshot) error {
+	keep := make(map[string]bool, len(snap.Connections))
+	for _, rec := range snap.Connections {
+		b, err := json.Marshal(rec)
+		if err != nil {
+			return fmt.Errorf("connection %s: %w", rec.ConnectionID, err)
+		}
+		if err := kv.Put(registryConnectionsBucket, []byte(rec.ConnectionID), b); err != nil {
+			return err
+		}
+		keep[rec.ConnectionID] = true
+	}
+
+	var stale [][]byte
+	err := kv.ForEach(registryConnectionsBucket, func(k, _ []byte) error {
+		if !keep[string(k)] {
+			stale = append(stale, append([]byte(nil), k...))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, k := range stale {
+		if err := kv.Delete(registryConnectionsBucket, k); err != nil {
+			return err
+		}
+	}
+
+	meta, err := json.Marshal(registrySnapshotMeta{FormatVersion: snap.FormatVersion, TakenAt: snap.TakenAt})
+	if err != nil {
+		return err
+	}
+	return kv.Put(registryMetaBucket, registryMetaKey, meta)
+}
+
+// LoadConnectionRegistryKV reads a snapshot written by SaveConnectionRegistryKV. It returns an
+// empty snapshot if kv holds none.
+func LoadConnectionRegistryKV(kv KVStore) (*ConnectionRegistrySnapshot, error) {
+	snap := &ConnectionRegistrySnapshot{FormatVersion: ConnectionRegistrySnapshotVersion}
+	b, err := kv.Get(registryMetaBucket, registryMetaKey)
+	if err != nil {
+		return nil, err
+	}
+	if b != nil {
+		var meta registrySnapshotMeta
+		if err := json.Unmarshal(b, &meta); err != nil {
+			return nil, err
+		}
+		if err := checkRegistryFormatVersion(meta.FormatVersion); err != nil {
+			return nil, err
+		}
+		snap.FormatVersion, snap.TakenAt = meta.FormatVersion, meta.TakenAt
+	}
+	err = kv.ForEach(registryConnectionsBucket, func(k, v []byte) error {
+		rec := &ConnectionRecord{}
+		if err := json.Unmarshal(v, rec); err != nil {
+			return fmt.Errorf("connection %s: %w", k, err)
+		}
+		snap.Connections = append(snap.Connections, rec)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+func checkRegistryFormatVersion(version int) error {
+	if version < 1 || version > ConnectionRegistrySnapshotVersion {
+		return fmt.Errorf("unsupported connection registry snapshot version %d", version)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// RetentionShort represents logs kept for days, e.g. debug logs.
+	RetentionShort = "short"
+	// RetentionStandard represents logs kept for the backend default retention.
+	RetentionStandard = "standard"
+	// RetentionLong represents logs kept for years, e.g. audit logs.
+	RetentionLong = "long"
+)
+
+// RetentionHint holds how long a log should be kept by backends supporting per entry retention.
+// Backends map classes to their own retention periods; Duration takes precedence when set.
+// Class: Retention class. One of "Retention*".
+// Duration: Exact retention period.
+type RetentionHint struct {
+	Class    string        `json:"class,omitempty"`
+	Duration time.Duration `json:"duration,omitempty"`
+}
+
+// RetentionRule holds the retention hint of the logs matching a selector.
+// Match: Logs the rule applies to, usually by Levels or Types.
+// Hint: Retention hint of the matching logs.
+type RetentionRule struct {
+	Match LogMatch      `json:"match"`
+	Hint  RetentionHint `json:"hint"`
+}
+
+// RetentionPolicy maps logs to their retention hint, e.g. so debug logs expire in days while audit
+// logs persist for years.
+// Rules: Rules evaluated in order; the first matching rule applies.
+// Default: Hint of the logs no rule matches. Nil leaves them without a hint.
+type RetentionPolicy struct {
+	Rules   []RetentionRule `json:"rules"`
+	Default *RetentionHint  `json:"default"`
+}
+
+// Validate checks the retention policy, returning every invalid field.
+func (p *RetentionPolicy) Validate() []*ValidationError {
+	v := &validator{}
+	for i := range p.Rules {
+		p.Rules[i].Hint.validate(v, fmt.Sprintf("rules[%d].hint", i))
+	}
+	if p.Default != nil {
+		p.Default.validate(v, "default")
+	}
+	return v.errs
+}
+
+func (h *RetentionHint) validate(v *validator, field string) {
+	if h.Class == "" && h.Duration == 0 {
+		v.add(field, h, "must set a class or a duration")
+	}
+	if h.Class != "" {
+		v.oneOf(field+".class", h.Class, RetentionShort, RetentionStandard, RetentionLong)
+	}
+	v.nonNegative(field+".duration", int64(h.Duration))
+}
+
+// HintFor returns the retention hint of the log, or nil if it has none.
+func (p *RetentionPolicy) HintFor(ld *LogData, context map[string]interface{}) *RetentionHint {
+	for i := range p.Rules {
+		if p.Rules[i].Match.Matches(ld, context) {
+			hint := p.Rules[i].Hint
+			return &hint
+		}
+	}
+	if p.Default == nil {
+		return nil
+	}
+	hint := *p.Default
+	return &hint
+}
+
+// ApplyRetention sets the RetentionHint of the log from the client retention policy, unless the log
+// already has one.
+func (c *ClientConfig) ApplyRetention(ld *LogData, context map[string]interface{}) {
+	if c.Retention != nil && ld.RetentionHint == nil {
+		ld.RetentionHint = c.Retention.HintFor(ld, context)
+	}
+}
@@ -0,0 +1,217 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ErrDisallowedType is wrapped by the DisallowedTypeError returned when strict decoding finds a type
+// that isn't allowlisted.
+var ErrDisallowedType = errors.New("disallowed type")
+
+// DisallowedTypeError is returned when strict decoding finds a custom value whose type tag isn't in
+// the allowlist, registered or not.
+// Tag: Rejected "$type" tag.
+// Path: JSON path of the rejected value in the payload, e.g. "$.CorrelationData.Custom.user".
+type DisallowedTypeError struct {
+	Tag  string
+	Path string
+}
+
+// Error implements the error interface.
+func (e *DisallowedTypeError) Error() string {
+	return fmt.Sprintf("%v %q at %s", ErrDisallowedType, e.Tag, e.Path)
+}
+
+// Unwrap returns ErrDisallowedType.
+func (e *DisallowedTypeError) Unwrap() error {
+	return ErrDisallowedType
+}
+
+// TypeAllowlist holds the custom type tags strict decoding accepts, on top of the built-in ones.
+type TypeAllowlist struct {
+	tags map[string]bool
+}
+
+// NewTypeAllowlist returns an allowlist of the built-in custom types and the given tags, e.g.
+// CustomTypeTag("user", 1).
+func NewTypeAllowlist(tags ...string) *TypeAllowlist {
+	a := &TypeAllowlist{tags: make(map[string]bool, len(tags))}
+	for _, tag := range tags {
+		a.tags[tag] = true
+	}
+	return a
+}
+
+// Allows returns true if values tagged with the given tag can be decoded; false otherwise.
+func (a *TypeAllowlist) Allows(tag string) bool {
+	return builtinCustomTypeTags[tag] || (a != nil && a.tags[tag])
+}
+
+// PackageDecoder decodes transport package payloads into their Data, for packages received across a
+// trust boundary. Data is only ever decoded into the concrete type of the package type, never into a
+// type named by the payload itself.
+// Strict: true if payloads with unknown fields, trailing data or custom values whose tag isn't in
+// Allowlist are rejected; false if they are decoded leniently, like encoding/json does.
+// Allowlist: Custom types accepted in strict mode. Nil only accepts the built-in ones.
+type PackageDecoder struct {
+	Strict    bool
+	Allowlist *TypeAllowlist
+}
+
+// Decode sets the package Data to its decoded Payload. Returns ErrUnknownPackageType for unknown
+// package types and a DisallowedTypeError for disallowed custom values.
+func (d *PackageDecoder) Decode(pkg *TransportPackage) error {
+	return VisitPackage(pkg, packageDataDecoder{d})
+}
+
+// Unmarshal decodes data into v, a pointer, with the decoder strictness and allowlist.
+func (d *PackageDecoder) Unmarshal(data []byte, v interface{}) error {
+	if !d.Strict {
+		return json.Unmarshal(data, v)
+	}
+	var generic interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return err
+	}
+	if err := d.checkValues(generic, "$"); err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("unexpected data after the payload")
+	}
+	return nil
+}
+
+// correlationDataFields holds the JSON fields of CorrelationData. Its UnmarshalJSON method decodes
+// leniently, so strict decoding checks them on the generic decoding.
+var correlationDataFields = []string{"CorrelationID", "Name", "Custom"}
+
+// checkValues walks the generic decoding of a payload looking for tagged custom values and for
+// unknown CorrelationData fields.
+func (d *PackageDecoder) checkValues(v interface{}, path string) error {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if tag, ok := v[CustomTypeKey].(string); ok && len(v) == 2 {
+			if _, ok := v[CustomValueKey]; ok && !d.Allowlist.Allows(tag) {
+				return &DisallowedTypeError{Tag: tag, Path: path}
+			}
+		}
+		for k, e := range v {
+			if cd, ok := e.(map[string]interface{}); ok && strings.EqualFold(k, "CorrelationData") {
+				if err := checkKnownFields(cd, correlationDataFields, path+"."+k); err != nil {
+					return err
+				}
+			}
+			if err := d.checkValues(e, path+"."+k); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for i, e := range v {
+			if err := d.checkValues(e, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkKnownFields returns an error if the object has a field not in known, matched case
+// insensitively like encoding/json does.
+func checkKnownFields(v map[string]interface{}, known []string, path string) error {
+	for k := range v {
+		found := false
+		for _, f := range known {
+			if strings.EqualFold(k, f) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("json: unknown field %q at %s", k, path)
+		}
+	}
+	return nil
+}
+
+// packageDataDecoder decodes the payload of each package type into its data type.
+type packageDataDecoder struct {
+	d *PackageDecoder
+}
+
+func (v packageDataDecoder) VisitLog(pkg *TransportPackage) error {
+	return decodePackageData(v.d, pkg, &LogGroup{})
+}
+
+func (v packageDataDecoder) VisitHiPriLog(pkg *TransportPackage) error {
+	return decodePackageData(v.d, pkg, &LogGroup{})
+}
+
+func (v packageDataDecoder) VisitHealthCheck(pkg *TransportPackage) error {
+	return decodePackageData(v.d, pkg, &HealthCheckData{})
+}
+
+func (v packageDataDecoder) VisitFlushRequest(pkg *TransportPackage) error {
+	return decodePackageData(v.d, pkg, &FlushRequest{})
+}
+
+func (v packageDataDecoder) VisitFlushResult(pkg *TransportPackage) error {
+	return decodePackageData(v.d, pkg, &FlushResult{})
+}
+
+func (v packageDataDecoder) VisitChunk(pkg *TransportPackage) error {
+	return decodePackageData(v.d, pkg, &Chunk{})
+}
+
+func (v packageDataDecoder) VisitConfigUpdate(pkg *TransportPackage) error {
+	return decodePackageData(v.d, pkg, &ClientConfigUpdate{})
+}
+
+func (v packageDataDecoder) VisitScopeDefinition(pkg *TransportPackage) error {
+	return decodePackageData(v.d, pkg, &ScopeDefinitions{})
+}
+
+func (v packageDataDecoder) VisitDeliveryReceipt(pkg *TransportPackage) error {
+	return decodePackageData(v.d, pkg, &DeliveryReceipt{})
+}
+
+func (v packageDataDecoder) VisitControl(pkg *TransportPackage) error {
+	return decodePackageData(v.d, pkg, &Control{})
+}
+
+// decodePackageData decodes the package payload into data and sets it as the package Data. Empty
+// payloads leave Data unset.
+func decodePackageData[T any](d *PackageDecoder, pkg *TransportPackage, data *T) error {
+	if len(pkg.Payload) == 0 {
+		return nil
+	}
+	if err := d.Unmarshal(pkg.Payload, data); err != nil {
+		return fmt.Errorf("%s package %d: %w", pkg.Type, pkg.ID, err)
+	}
+	pkg.Data = data
+	return nil
+}
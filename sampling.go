@@ -0,0 +1,95 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+// SamplingDecision holds the sampling decision taken upstream for a log or log group.
+// Sampled: true if the log was kept by the sampler; false otherwise.
+// Rate: Probability, in (0, 1], the log was kept with.
+// Policy: Name of the sampling policy that took the decision.
+type SamplingDecision struct {
+	Sampled bool    `json:"sampled"`
+	Rate    float64 `json:"rate"`
+	Policy  string  `json:"policy,omitempty"`
+}
+
+// Weight returns the number of logs a kept log stands for, i.e. 1/Rate, so backends can up-weight counts.
+func (d *SamplingDecision) Weight() float64 {
+	if d == nil || d.Rate <= 0 || d.Rate >= 1 {
+		return 1
+	}
+	return 1 / d.Rate
+}
+
+// ResampleRate returns the probability a downstream sampler should keep an already sampled log
+// with so the overall keep rate is target instead of the product of both rates.
+// Returns 1 if the upstream rate is already at or below the target.
+func (d *SamplingDecision) ResampleRate(target float64) float64 {
+	upstream := 1.0
+	if d != nil && d.Rate > 0 && d.Rate < 1 {
+		upstream = d.Rate
+	}
+	if target >= upstream {
+		return 1
+	}
+	if target <= 0 {
+		return 0
+	}
+	return target / upstream
+}
+
+// Resample returns the decision of a downstream sampler targeting the given overall rate. r is a
+// uniformly distributed random number in [0, 1) used to decide whether the log is kept.
+func (d *SamplingDecision) Resample(target float64, policy string, r float64) *SamplingDecision {
+	if d != nil && !d.Sampled {
+		return d
+	}
+	rate := d.ResampleRate(target)
+	if rate >= 1 {
+		return d
+	}
+	upstream := 1.0
+	if d != nil && d.Rate > 0 {
+		upstream = d.Rate
+	}
+	return &SamplingDecision{Sampled: r < rate, Rate: upstream * rate, Policy: policy}
+}
+
+// EffectiveSampling returns the log sampling decision, falling back to the group one.
+func (ld *LogData) EffectiveSampling(group *LogGroup) *SamplingDecision {
+	if ld.Sampling != nil || group == nil {
+		return ld.Sampling
+	}
+	return group.Sampling
+}
+
+// SamplingConfig holds the client side sampling configuration.
+// Rate: Probability, in (0, 1], a log is kept with. Zero or one means no sampling.
+// Policy: Name of the sampling policy, reported in each log's SamplingDecision.
+// MinLevel: Logs at this level or more severe are never sampled out. One of "Level*".
+type SamplingConfig struct {
+	Rate     float64 `json:"rate"`
+	Policy   string  `json:"policy"`
+	MinLevel byte    `json:"minLevel"`
+}
+
+// Validate checks the sampling config, returning every invalid field.
+func (c *SamplingConfig) Validate() []*ValidationError {
+	v := &validator{}
+	if c.Rate < 0 || c.Rate > 1 {
+		v.add("rate", c.Rate, "must be in [0, 1]")
+	}
+	v.level("minLevel", c.MinLevel)
+	return v.errs
+}
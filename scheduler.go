@@ -0,0 +1,130 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+const (
+	// ChannelNone represents that no channel has a batch ready.
+	ChannelNone = byte(0)
+	// ChannelHiPri represents the high priority channel.
+	ChannelHiPri = byte(1)
+	// ChannelNormal represents the normal channel.
+	ChannelNormal = byte(2)
+)
+
+// ChannelSchedulerConfig holds the configuration of the batch interleaving between channels
+// sharing the same connections.
+// HiPriWeight: Share of the batches taken from the high priority channel while both channels have batches ready.
+// NormalWeight: Share of the batches taken from the normal channel while both channels have batches ready.
+// MaxConsecutiveHiPri: Maximum number of consecutive high priority batches sent while normal batches
+// are waiting. Zero means no limit.
+type ChannelSchedulerConfig struct {
+	HiPriWeight         int `json:"hipriWeight"`
+	NormalWeight        int `json:"normalWeight"`
+	MaxConsecutiveHiPri int `json:"maxConsecutiveHiPri"`
+}
+
+// DefaultChannelSchedulerConfig is used when the client config doesn't define a channel scheduler.
+var DefaultChannelSchedulerConfig = ChannelSchedulerConfig{HiPriWeight: 4, NormalWeight: 1, MaxConsecutiveHiPri: 16}
+
+// ChannelSchedulerStats holds the channel scheduler counters.
+// HiPriBatches: Number of batches taken from the high priority channel.
+// NormalBatches: Number of batches taken from the normal channel.
+// StarvationOverrides: Number of times a normal batch was forced after MaxConsecutiveHiPri high priority batches.
+type ChannelSchedulerStats struct {
+	HiPriBatches        uint64
+	NormalBatches       uint64
+	StarvationOverrides uint64
+}
+
+// ChannelScheduler decides which channel the next batch is taken from using smooth weighted round
+// robin, so neither channel is starved while both have batches ready. Not safe for concurrent use.
+type ChannelScheduler struct {
+	config           ChannelSchedulerConfig
+	hipriCurrent     int
+	normalCurrent    int
+	consecutiveHiPri int
+	stats            ChannelSchedulerStats
+}
+
+// NewChannelScheduler returns a scheduler with the given config, or the default config if nil.
+func NewChannelScheduler(config *ChannelSchedulerConfig) *ChannelScheduler {
+	c := DefaultChannelSchedulerConfig
+	if config != nil {
+		c = *config
+	}
+	if c.HiPriWeight <= 0 {
+		c.HiPriWeight = 1
+	}
+	if c.NormalWeight <= 0 {
+		c.NormalWeight = 1
+	}
+	return &ChannelScheduler{config: c}
+}
+
+// Next returns the channel the next batch should be taken from. One of "Channel*".
+func (s *ChannelScheduler) Next(hipriReady, normalReady bool) byte {
+	switch {
+	case hipriReady && normalReady:
+	case hipriReady:
+		return s.pick(ChannelHiPri)
+	case normalReady:
+		return s.pick(ChannelNormal)
+	default:
+		return ChannelNone
+	}
+
+	if s.config.MaxConsecutiveHiPri > 0 && s.consecutiveHiPri >= s.config.MaxConsecutiveHiPri {
+		s.stats.StarvationOverrides++
+		return s.pick(ChannelNormal)
+	}
+	s.hipriCurrent += s.config.HiPriWeight
+	s.normalCurrent += s.config.NormalWeight
+	total := s.config.HiPriWeight + s.config.NormalWeight
+	if s.hipriCurrent >= s.normalCurrent {
+		s.hipriCurrent -= total
+		return s.pick(ChannelHiPri)
+	}
+	s.normalCurrent -= total
+	return s.pick(ChannelNormal)
+}
+
+func (s *ChannelScheduler) pick(channel byte) byte {
+	if channel == ChannelHiPri {
+		s.stats.HiPriBatches++
+		s.consecutiveHiPri++
+	} else {
+		s.stats.NormalBatches++
+		s.consecutiveHiPri = 0
+	}
+	return channel
+}
+
+// Stats returns a copy of the scheduler counters.
+func (s *ChannelScheduler) Stats() ChannelSchedulerStats {
+	return s.stats
+}
+
+// Validate checks the channel scheduler config, returning every invalid field.
+func (c *ChannelSchedulerConfig) Validate() []*ValidationError {
+	v := &validator{}
+	if c.HiPriWeight < 1 {
+		v.add("hipriWeight", c.HiPriWeight, ConstraintPositive)
+	}
+	if c.NormalWeight < 1 {
+		v.add("normalWeight", c.NormalWeight, ConstraintPositive)
+	}
+	v.nonNegative("maxConsecutiveHiPri", int64(c.MaxConsecutiveHiPri))
+	return v.errs
+}
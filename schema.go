@@ -0,0 +1,166 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+const (
+	// JSONContentType holds the content type of JSON payloads.
+	JSONContentType = "application/json"
+	// LogBatchContentType holds the content type of the "LogBatch" wire format.
+	LogBatchContentType = "application/vnd.logging.batch+json"
+	// LogBatchDeltasContentType holds the content type of the "LogBatch" wire format with delta encoded timestamps.
+	LogBatchDeltasContentType = "application/vnd.logging.batch-deltas"
+)
+
+const (
+	// SchemaIDLogGroupJSON represents a LogGroup serialized as plain JSON.
+	SchemaIDLogGroupJSON = uint32(1)
+	// SchemaIDLogBatch represents a LogGroup serialized with EncodeLogBatch.
+	SchemaIDLogBatch = uint32(2)
+	// SchemaIDLogBatchDeltas represents a LogGroup serialized with EncodeLogBatchFor with "CapabilityTimestampDeltas".
+	SchemaIDLogBatchDeltas = uint32(3)
+)
+
+var (
+	// ErrUnknownSchema is returned when a package schema ID isn't registered.
+	ErrUnknownSchema = errors.New("unknown payload schema")
+	// ErrDuplicateSchema is returned when registering a schema ID already registered.
+	ErrDuplicateSchema = errors.New("payload schema already registered")
+	// ErrContentTypeMismatch is returned when a package content type differs from the one of its schema.
+	ErrContentTypeMismatch = errors.New("content type doesn't match the payload schema")
+)
+
+// PayloadSchema describes how the payloads tagged with a schema ID are encoded.
+// ID: Schema ID sent in TransportPackage.SchemaID. Must be > 0.
+// ContentType: Media type of the payloads.
+// Codec: Name of the encoding, e.g. "json" or "logBatch".
+// Version: Version of the encoding.
+// Decode: Returns the package Data of a payload. Required.
+type PayloadSchema struct {
+	ID          uint32
+	ContentType string
+	Codec       string
+	Version     int
+	Decode      func(payload []byte) (interface{}, error)
+}
+
+// SchemaRegistry maps schema IDs to their payload schemas, so servers decode the payloads of mixed
+// client versions without guessing from the package type. Safe for concurrent use.
+type SchemaRegistry struct {
+	mu      sync.RWMutex
+	schemas map[uint32]*PayloadSchema
+}
+
+// NewSchemaRegistry returns a registry holding the built-in "SchemaID*" schemas.
+func NewSchemaRegistry() *SchemaRegistry {
+	r := &SchemaRegistry{schemas: make(map[uint32]*PayloadSchema)}
+	r.MustRegister(&PayloadSchema{
+		ID:          SchemaIDLogGroupJSON,
+		ContentType: JSONContentType,
+		Codec:       "json",
+		Version:     1,
+		Decode: func(payload []byte) (interface{}, error) {
+			g := &LogGroup{}
+			if err := json.Unmarshal(payload, g); err != nil {
+				return nil, err
+			}
+			return g, nil
+		},
+	})
+	r.MustRegister(&PayloadSchema{
+		ID:          SchemaIDLogBatch,
+		ContentType: LogBatchContentType,
+		Codec:       "logBatch",
+		Version:     LogBatchVersionCommonContext,
+		Decode: func(payload []byte) (interface{}, error) {
+			g, _, err := DecodeLogBatch(payload)
+			return g, err
+		},
+	})
+	r.MustRegister(&PayloadSchema{
+		ID:          SchemaIDLogBatchDeltas,
+		ContentType: LogBatchDeltasContentType,
+		Codec:       "logBatch",
+		Version:     LogBatchVersionTimestampDeltas,
+		Decode: func(payload []byte) (interface{}, error) {
+			g, _, err := DecodeLogBatch(payload)
+			return g, err
+		},
+	})
+	return r
+}
+
+// Register adds a schema. Schema IDs can't be redefined: a new encoding or version gets a new ID.
+func (r *SchemaRegistry) Register(s *PayloadSchema) error {
+	if s.ID == 0 || s.Decode == nil {
+		return fmt.Errorf("invalid payload schema %d: ID and Decode are required", s.ID)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.schemas[s.ID]; ok {
+		return fmt.Errorf("%w: %d", ErrDuplicateSchema, s.ID)
+	}
+	r.schemas[s.ID] = s
+	return nil
+}
+
+// MustRegister is like Register but panics if the registration fails.
+func (r *SchemaRegistry) MustRegister(s *PayloadSchema) {
+	if err := r.Register(s); err != nil {
+		panic(err)
+	}
+}
+
+// Lookup returns the schema registered with the ID, if any.
+func (r *SchemaRegistry) Lookup(id uint32) (*PayloadSchema, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	s, ok := r.schemas[id]
+	return s, ok
+}
+
+// Describe sets the package ContentType and SchemaID to the ones of the schema.
+func (r *SchemaRegistry) Describe(pkg *TransportPackage, id uint32) error {
+	s, ok := r.Lookup(id)
+	if !ok {
+		return fmt.Errorf("%w: %d", ErrUnknownSchema, id)
+	}
+	pkg.ContentType, pkg.SchemaID = s.ContentType, s.ID
+	return nil
+}
+
+// Decode sets the package Data to its Payload decoded with the schema of its SchemaID. Returns
+// ErrUnknownSchema if the package has no SchemaID or an unregistered one.
+func (r *SchemaRegistry) Decode(pkg *TransportPackage) error {
+	s, ok := r.Lookup(pkg.SchemaID)
+	if !ok {
+		return fmt.Errorf("%w: %d", ErrUnknownSchema, pkg.SchemaID)
+	}
+	if pkg.ContentType != "" && pkg.ContentType != s.ContentType {
+		return fmt.Errorf("%w: %q for schema %d (%q)", ErrContentTypeMismatch, pkg.ContentType, s.ID, s.ContentType)
+	}
+	data, err := s.Decode(pkg.Payload)
+	if err != nil {
+		return fmt.Errorf("schema %d package %d: %w", s.ID, pkg.ID, err)
+	}
+	pkg.Data = data
+	return nil
+}
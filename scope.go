@@ -0,0 +1,130 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ScopeSeparator separates the names of a scope and its ancestors in the scope ID.
+const ScopeSeparator = "/"
+
+var (
+	// ErrUnknownScope is returned when resolving a scope that wasn't defined on the connection.
+	ErrUnknownScope = errors.New("unknown scope")
+	// ErrScopeCycle is returned when a scope is its own ancestor.
+	ErrScopeCycle = errors.New("scope cycle")
+)
+
+// Scope holds the labels of a sub-logger, e.g. a module. Scopes are defined once per connection
+// with a "TransportPackageTypeScopeDefinition" package; logs then reference them by ID so the labels
+// aren't serialized with every log.
+// ID: Unique scope ID within the connection, the scope name path, e.g. "db/pool".
+// Name: Scope name.
+// Labels: Key-value pairs attached to every log of the scope. They override the parent ones.
+// ParentID: ID of the parent scope. Empty for root scopes.
+type Scope struct {
+	ID       string            `json:"id"`
+	Name     string            `json:"name"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	ParentID string            `json:"parentID,omitempty"`
+}
+
+// NewScope returns a root scope.
+func NewScope(name string, labels map[string]string) *Scope {
+	return &Scope{ID: name, Name: name, Labels: labels}
+}
+
+// Child returns a scope nested in s.
+func (s *Scope) Child(name string, labels map[string]string) *Scope {
+	return &Scope{ID: s.ID + ScopeSeparator + name, Name: name, Labels: labels, ParentID: s.ID}
+}
+
+// ScopeDefinitions holds the data of a "TransportPackageTypeScopeDefinition" package.
+// Scopes: Scopes defined or redefined. Parents may be defined in the same package or an earlier one.
+type ScopeDefinitions struct {
+	Scopes []*Scope `json:"scopes"`
+}
+
+// ScopeRegistry resolves the scopes defined on a connection. Safe for concurrent use.
+type ScopeRegistry struct {
+	mu     sync.RWMutex
+	scopes map[string]*Scope
+}
+
+// NewScopeRegistry returns an empty registry.
+func NewScopeRegistry() *ScopeRegistry {
+	return &ScopeRegistry{scopes: make(map[string]*Scope)}
+}
+
+// Define adds or replaces the scopes. Unknown parents are only reported when resolving.
+func (r *ScopeRegistry) Define(scopes ...*Scope) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range scopes {
+		r.scopes[s.ID] = s
+	}
+}
+
+// Labels returns the labels of the scope merged with its ancestors' ones, the nearest scope winning.
+func (r *ScopeRegistry) Labels(scopeID string) (map[string]string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var chain []*Scope
+	seen := make(map[string]bool)
+	for id := scopeID; id != ""; {
+		if seen[id] {
+			return nil, fmt.Errorf("%w: %s", ErrScopeCycle, scopeID)
+		}
+		seen[id] = true
+		s, ok := r.scopes[id]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownScope, id)
+		}
+		chain = append(chain, s)
+		id = s.ParentID
+	}
+
+	labels := make(map[string]string)
+	for i := len(chain) - 1; i >= 0; i-- {
+		for k, v := range chain[i].Labels {
+			labels[k] = v
+		}
+	}
+	return labels, nil
+}
+
+// MergeInto adds the labels of the log scope to the context without overriding existing keys.
+// Logs without a scope are left unchanged.
+func (r *ScopeRegistry) MergeInto(ld *LogData, context map[string]interface{}) (map[string]interface{}, error) {
+	if ld.ScopeID == "" {
+		return context, nil
+	}
+	labels, err := r.Labels(ld.ScopeID)
+	if err != nil {
+		return context, err
+	}
+	if context == nil {
+		context = make(map[string]interface{}, len(labels))
+	}
+	for k, v := range labels {
+		if _, ok := context[k]; !ok {
+			context[k] = v
+		}
+	}
+	return context, nil
+}
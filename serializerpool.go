@@ -0,0 +1,128 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"encoding/json"
+	"runtime"
+	"sync"
+)
+
+// SerializedPackage holds the outcome of serializing a package in a SerializerPool.
+// Sequence: Submission order of the package, starting at 0.
+// Package: Package, with its Payload set if serialized.
+// Err: Serialization error, if any.
+type SerializedPackage struct {
+	Sequence uint64
+	Package  *TransportPackage
+	Err      error
+}
+
+// SerializePackageData is the default serializer of a SerializerPool: the JSON of the package Data.
+func SerializePackageData(pkg *TransportPackage) ([]byte, error) {
+	return json.Marshal(pkg.Data)
+}
+
+// SerializerPool serializes the pending packages with a bounded number of concurrent workers and
+// hands them back in submission order, so marshaling isn't a single threaded bottleneck while the
+// send order is kept. At most twice the number of workers packages are in flight: Submit blocks
+// until the results are consumed. Submit and Close must be called from a single goroutine.
+type SerializerPool struct {
+	serialize func(*TransportPackage) ([]byte, error)
+	jobs      chan *SerializedPackage
+	done      chan *SerializedPackage
+	results   chan *SerializedPackage
+	slots     chan struct{}
+	next      uint64
+	workers   sync.WaitGroup
+}
+
+// NewSerializerPool returns a pool of the given number of workers, or GOMAXPROCS workers if zero.
+// A nil serialize uses SerializePackageData.
+func NewSerializerPool(workers int, serialize func(*TransportPackage) ([]byte, error)) *SerializerPool {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if serialize == nil {
+		serialize = SerializePackageData
+	}
+	p := &SerializerPool{
+		serialize: serialize,
+		jobs:      make(chan *SerializedPackage, workers),
+		done:      make(chan *SerializedPackage, workers),
+		results:   make(chan *SerializedPackage),
+		slots:     make(chan struct{}, 2*workers),
+	}
+	p.workers.Add(workers)
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+	go p.reorder()
+	return p
+}
+
+// NewSerializerPool returns a pool of SerializerWorkers workers.
+func (c *ClientConfig) NewSerializerPool(serialize func(*TransportPackage) ([]byte, error)) *SerializerPool {
+	return NewSerializerPool(c.SerializerWorkers, serialize)
+}
+
+// Submit queues the package for serialization, returning its sequence number. Blocks while the
+// pool holds its maximum of in flight packages.
+func (p *SerializerPool) Submit(pkg *TransportPackage) uint64 {
+	p.slots <- struct{}{}
+	seq := p.next
+	p.next++
+	p.jobs <- &SerializedPackage{Sequence: seq, Package: pkg}
+	return seq
+}
+
+// Results returns the channel of the serialized packages, in submission order. It is closed once
+// the pool is closed and every submitted package was handed back.
+func (p *SerializerPool) Results() <-chan *SerializedPackage {
+	return p.results
+}
+
+// Close stops accepting packages. The packages already submitted are still serialized and handed back.
+func (p *SerializerPool) Close() {
+	close(p.jobs)
+}
+
+func (p *SerializerPool) work() {
+	defer p.workers.Done()
+	for job := range p.jobs {
+		job.Package.Payload, job.Err = p.serialize(job.Package)
+		p.done <- job
+	}
+}
+
+// reorder hands the serialized packages back in sequence order, holding the ones finished early.
+func (p *SerializerPool) reorder() {
+	go func() {
+		p.workers.Wait()
+		close(p.done)
+	}()
+	pending := make(map[uint64]*SerializedPackage)
+	var next uint64
+	for job := range p.done {
+		pending[job.Sequence] = job
+		for r, ok := pending[next]; ok; r, ok = pending[next] {
+			delete(pending, next)
+			next++
+			p.results <- r
+			<-p.slots
+		}
+	}
+	close(p.results)
+}
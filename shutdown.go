@@ -0,0 +1,324 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"sync"
+	"time"
+)
+
+// DrainClass represents a class of logs drained together during shutdown.
+type DrainClass string
+
+const (
+	// DrainClassAudit represents logs of type "LogTypeAudit".
+	DrainClassAudit = DrainClass("audit")
+	// DrainClassHiPri represents logs at or above the high priority logging level.
+	DrainClassHiPri = DrainClass("hipri")
+	// DrainClassError represents logs of 'error' level.
+	DrainClassError = DrainClass("error")
+	// DrainClassWarn represents logs of 'warn' level.
+	DrainClassWarn = DrainClass("warn")
+	// DrainClassInfo represents logs of 'info' level.
+	DrainClassInfo = DrainClass("info")
+	// DrainClassDebug represents logs of 'debug' level.
+	DrainClassDebug = DrainClass("debug")
+)
+
+// DefaultDrainOrder is the drain order used when the client config doesn't define one.
+var DefaultDrainOrder = []DrainClass{
+	DrainClassAudit,
+	DrainClassHiPri,
+	DrainClassError,
+	DrainClassWarn,
+	DrainClassInfo,
+	DrainClassDebug,
+}
+
+// ClassifyForDrain returns the drain class of the log.
+func ClassifyForDrain(ld *LogData, hipriLevel byte) DrainClass {
+	switch {
+	case ld.Type == LogTypeAudit:
+		return DrainClassAudit
+	case ld.Level <= hipriLevel:
+		return DrainClassHiPri
+	case ld.Level == LevelError:
+		return DrainClassError
+	case ld.Level == LevelWarn:
+		return DrainClassWarn
+	case ld.Level == LevelInfo:
+		return DrainClassInfo
+	default:
+		return DrainClassDebug
+	}
+}
+
+// DrainPartition holds the logs of one drain class.
+// Class: Drain class of the logs.
+// Logs: Logs pending to be sent, in their original order.
+type DrainPartition struct {
+	Class DrainClass
+	Logs  []*LogData
+}
+
+// DrainClassReport holds the outcome of draining one class.
+// Class: Drain class.
+// Drained: Number of logs sent before the deadline.
+// Dropped: Number of logs not sent, either because the deadline was hit or because sending failed.
+// DroppedByLevel: Dropped logs per level.
+type DrainClassReport struct {
+	Class          DrainClass
+	Drained        int
+	Dropped        int
+	DroppedByLevel map[byte]int
+}
+
+func (r *DrainClassReport) drop(ld *LogData) {
+	if r.DroppedByLevel == nil {
+		r.DroppedByLevel = make(map[byte]int)
+	}
+	r.Dropped++
+	r.DroppedByLevel[ld.Level]++
+}
+
+// DrainReport holds the outcome of a shutdown drain, one entry per class in drain order.
+type DrainReport struct {
+	Classes []*DrainClassReport
+}
+
+// Dropped returns the total number of logs dropped across all classes.
+func (r *DrainReport) Dropped() int {
+	dropped := 0
+	for _, c := range r.Classes {
+		dropped += c.Dropped
+	}
+	return dropped
+}
+
+// PartitionForDrain splits the pending logs by drain class, ordered by the given drain order.
+// Classes missing from the order are drained last, in "DefaultDrainOrder" order.
+func PartitionForDrain(logs []*LogData, order []DrainClass, hipriLevel byte) []*DrainPartition {
+	if len(order) == 0 {
+		order = DefaultDrainOrder
+	}
+	partitions := make([]*DrainPartition, 0, len(DefaultDrainOrder))
+	byClass := make(map[DrainClass]*DrainPartition, len(DefaultDrainOrder))
+	add := func(c DrainClass) {
+		if _, ok := byClass[c]; !ok {
+			p := &DrainPartition{Class: c}
+			byClass[c] = p
+			partitions = append(partitions, p)
+		}
+	}
+	for _, c := range order {
+		add(c)
+	}
+	for _, c := range DefaultDrainOrder {
+		add(c)
+	}
+	for _, ld := range logs {
+		p := byClass[ClassifyForDrain(ld, hipriLevel)]
+		p.Logs = append(p.Logs, ld)
+	}
+	return partitions
+}
+
+// DrainPartitions sends the partitions in order until the deadline, reporting what was drained
+// and dropped per class. A zero deadline means no deadline.
+func DrainPartitions(partitions []*DrainPartition, deadline time.Time, send func(*LogData) error) *DrainReport {
+	return DrainPartitionsWithClock(partitions, deadline, nil, send)
+}
+
+// DrainPartitionsWithClock is DrainPartitions with the deadline checked on the clock. Nil uses SystemClock.
+func DrainPartitionsWithClock(partitions []*DrainPartition, deadline time.Time, clock Clock, send func(*LogData) error) *DrainReport {
+	clock = clockOrSystem(clock)
+	report := &DrainReport{Classes: make([]*DrainClassReport, 0, len(partitions))}
+	for _, p := range partitions {
+		cr := &DrainClassReport{Class: p.Class}
+		for i, ld := range p.Logs {
+			if !deadline.IsZero() && !clock.Now().Before(deadline) {
+				for _, dropped := range p.Logs[i:] {
+					cr.drop(dropped)
+				}
+				break
+			}
+			if err := send(ld); err != nil {
+				cr.drop(ld)
+			} else {
+				cr.Drained++
+			}
+		}
+		report.Classes = append(report.Classes, cr)
+	}
+	return report
+}
+
+const (
+	// ShutdownChannelNormal holds the report name of the normal channel.
+	ShutdownChannelNormal = "normal"
+	// ShutdownChannelHiPri holds the report name of the high priority channel.
+	ShutdownChannelHiPri = "hipri"
+	// ShutdownChannelOverflow holds the report name of the overflow channel.
+	ShutdownChannelOverflow = "overflow"
+)
+
+// ShutdownChannelReport holds the drain outcome of one client channel.
+// Channel: Channel name. One of "ShutdownChannel*".
+// Drained: Number of logs sent during shutdown.
+// Dropped: Number of logs dropped during shutdown.
+type ShutdownChannelReport struct {
+	Channel string
+	Drained int
+	Dropped int
+}
+
+// ShutdownPhase holds the time spent in one shutdown phase.
+// Name: Phase name, e.g. "drain" or "close-connections".
+// Duration: Time spent in the phase.
+type ShutdownPhase struct {
+	Name     string
+	Duration time.Duration
+}
+
+// ShutdownReport holds the outcome of a client shutdown.
+// StartedAt: Time the shutdown started, the first ShutdownReporter call.
+// Duration: Total shutdown duration.
+// Channels: Drain outcome per channel.
+// DroppedByLevel: Dropped logs per level across every channel.
+// Phases: Time spent per phase, in execution order.
+// Errors: Errors hit during the shutdown.
+type ShutdownReport struct {
+	StartedAt      time.Time
+	Duration       time.Duration
+	Channels       []*ShutdownChannelReport
+	DroppedByLevel map[byte]int
+	Phases         []*ShutdownPhase
+	Errors         []string
+}
+
+// Dropped returns the total number of logs dropped during the shutdown.
+func (r *ShutdownReport) Dropped() int {
+	dropped := 0
+	for _, n := range r.DroppedByLevel {
+		dropped += n
+	}
+	return dropped
+}
+
+// ZeroLoss returns true if no log was dropped and no error happened during the shutdown; false otherwise.
+func (r *ShutdownReport) ZeroLoss() bool {
+	return r.Dropped() == 0 && len(r.Errors) == 0
+}
+
+// ShutdownReporter builds a ShutdownReport along the shutdown path. Safe for concurrent use,
+// as channels are usually drained in parallel.
+// Clock: Times the shutdown and its phases. Nil uses SystemClock. Set it before the first call.
+type ShutdownReporter struct {
+	Clock      Clock
+	mu         sync.Mutex
+	report     *ShutdownReport
+	phaseStart time.Time
+	started    bool
+	channels   map[string]*ShutdownChannelReport
+}
+
+// NewShutdownReporter starts a shutdown report. The shutdown starts at the first reporter call.
+func NewShutdownReporter() *ShutdownReporter {
+	return &ShutdownReporter{
+		report:   &ShutdownReport{DroppedByLevel: make(map[byte]int)},
+		channels: make(map[string]*ShutdownChannelReport),
+	}
+}
+
+// now returns the time on the reporter clock, starting the report at the first call. Must be called with mu held.
+func (r *ShutdownReporter) now() time.Time {
+	now := clockOrSystem(r.Clock).Now()
+	if !r.started {
+		r.report.StartedAt, r.started = now, true
+	}
+	return now
+}
+
+// BeginPhase ends the current phase, if any, and starts a new one.
+func (r *ShutdownReporter) BeginPhase(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now()
+	r.endPhase(now)
+	r.report.Phases = append(r.report.Phases, &ShutdownPhase{Name: name})
+	r.phaseStart = now
+}
+
+func (r *ShutdownReporter) endPhase(now time.Time) {
+	if n := len(r.report.Phases); n > 0 && r.report.Phases[n-1].Duration == 0 {
+		r.report.Phases[n-1].Duration = now.Sub(r.phaseStart)
+	}
+}
+
+// RecordDrain adds the outcome of draining the given channel.
+func (r *ShutdownReporter) RecordDrain(channel string, drain *DrainReport) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.now()
+	cr := r.channel(channel)
+	for _, c := range drain.Classes {
+		cr.Drained += c.Drained
+		cr.Dropped += c.Dropped
+		for level, n := range c.DroppedByLevel {
+			r.report.DroppedByLevel[level] += n
+		}
+	}
+}
+
+// RecordDropped adds n logs of the given level dropped from the channel outside of a drain, e.g.
+// logs still in the channel when the connection was closed.
+func (r *ShutdownReporter) RecordDropped(channel string, level byte, n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.now()
+	r.channel(channel).Dropped += n
+	r.report.DroppedByLevel[level] += n
+}
+
+// RecordError adds an error hit during the shutdown.
+func (r *ShutdownReporter) RecordError(err error) {
+	if err == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.now()
+	r.report.Errors = append(r.report.Errors, err.Error())
+}
+
+func (r *ShutdownReporter) channel(name string) *ShutdownChannelReport {
+	cr, ok := r.channels[name]
+	if !ok {
+		cr = &ShutdownChannelReport{Channel: name}
+		r.channels[name] = cr
+		r.report.Channels = append(r.report.Channels, cr)
+	}
+	return cr
+}
+
+// Finish ends the current phase and returns the report.
+func (r *ShutdownReporter) Finish() *ShutdownReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now()
+	r.endPhase(now)
+	r.report.Duration = now.Sub(r.report.StartedAt)
+	return r.report
+}
@@ -0,0 +1,126 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"sync"
+	"time"
+)
+
+// DeliverySLOConfig holds the log delivery service level objective.
+// Target: Ratio of logs that must be delivered, in (0, 1), e.g. 0.999.
+// Window: Rolling window the objective is evaluated over.
+type DeliverySLOConfig struct {
+	Target float64       `json:"target"`
+	Window time.Duration `json:"window"`
+}
+
+// Validate checks the delivery SLO config, returning every invalid field.
+func (c *DeliverySLOConfig) Validate() []*ValidationError {
+	v := &validator{}
+	if c.Target <= 0 || c.Target >= 1 {
+		v.add("target", c.Target, "must be in (0, 1)")
+	}
+	if c.Window <= 0 {
+		v.add("window", c.Window, ConstraintPositive)
+	}
+	return v.errs
+}
+
+// SLOState holds the delivery SLO evaluation over the last window.
+// Target: Objective success ratio.
+// Window: Time actually covered by the evaluation, at most the configured window.
+// Delivered: Number of logs delivered within the window.
+// Failed: Number of logs not delivered within the window.
+// SuccessRatio: Delivered over delivered plus failed. One if no log was sent.
+// BurnRate: Speed the error budget is consumed at. One means the budget runs out exactly at the end of the window.
+// BudgetRemaining: Share of the window error budget left. Negative once the objective is missed.
+type SLOState struct {
+	Target          float64
+	Window          time.Duration
+	Delivered       uint64
+	Failed          uint64
+	SuccessRatio    float64
+	BurnRate        float64
+	BudgetRemaining float64
+}
+
+type sloSample struct {
+	at        time.Time
+	delivered uint64
+	failed    uint64
+}
+
+// SLOTracker evaluates the delivery SLO from periodic PipelineStats snapshots. Safe for concurrent use.
+type SLOTracker struct {
+	cfg     DeliverySLOConfig
+	mu      sync.Mutex
+	samples []sloSample
+	// last holds the raw counters of the last snapshot, offset the counts observed before the last resets.
+	last   sloSample
+	offset sloSample
+}
+
+// NewSLOTracker returns a tracker of the given objective.
+func NewSLOTracker(cfg *DeliverySLOConfig) *SLOTracker {
+	return &SLOTracker{cfg: *cfg}
+}
+
+// Observe records the pipeline counters at the given time. Samples older than the window are
+// discarded, except the newest of them, kept as the window baseline. Counters lower than in the
+// previous snapshot are taken as reset, e.g. by a restart, and counted on top of the previous values.
+func (t *SLOTracker) Observe(now time.Time, snap PipelineStatsSnapshot) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if snap.LogsDelivered < t.last.delivered || snap.LogsFailed < t.last.failed {
+		t.offset.delivered += t.last.delivered
+		t.offset.failed += t.last.failed
+	}
+	t.last = sloSample{delivered: snap.LogsDelivered, failed: snap.LogsFailed}
+	t.samples = append(t.samples, sloSample{
+		at:        now,
+		delivered: t.offset.delivered + snap.LogsDelivered,
+		failed:    t.offset.failed + snap.LogsFailed,
+	})
+	start := now.Add(-t.cfg.Window)
+	i := 0
+	for i+1 < len(t.samples) && !t.samples[i+1].at.After(start) {
+		i++
+	}
+	t.samples = t.samples[i:]
+}
+
+// State returns the SLO evaluation over the observed window.
+func (t *SLOTracker) State() *SLOState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state := &SLOState{Target: t.cfg.Target, SuccessRatio: 1, BudgetRemaining: 1}
+	if len(t.samples) < 2 {
+		return state
+	}
+	first, last := t.samples[0], t.samples[len(t.samples)-1]
+	state.Window = last.at.Sub(first.at)
+	state.Delivered = last.delivered - first.delivered
+	state.Failed = last.failed - first.failed
+	total := state.Delivered + state.Failed
+	if total == 0 {
+		return state
+	}
+	errorRatio := float64(state.Failed) / float64(total)
+	state.SuccessRatio = 1 - errorRatio
+	state.BurnRate = errorRatio / (1 - t.cfg.Target)
+	state.BudgetRemaining = 1 - state.BurnRate
+	return state
+}
@@ -0,0 +1,183 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+)
+
+const (
+	// SlogErrorKey holds the attribute key carrying the log error in slog records.
+	SlogErrorKey = "error"
+	// SlogLevelKey holds the context key keeping slog levels between the standard ones, e.g. slog.LevelInfo+2.
+	SlogLevelKey = "slog.level"
+)
+
+// LevelFromSlog returns the level of a slog level, rounding down to the closest standard level.
+func LevelFromSlog(l slog.Level) byte {
+	switch {
+	case l >= slog.LevelError:
+		return LevelError
+	case l >= slog.LevelWarn:
+		return LevelWarn
+	case l >= slog.LevelInfo:
+		return LevelInfo
+	default:
+		return LevelDebug
+	}
+}
+
+// SlogLevel returns the slog level of a level.
+func SlogLevel(level byte) slog.Level {
+	switch level {
+	case LevelError:
+		return slog.LevelError
+	case LevelWarn:
+		return slog.LevelWarn
+	case LevelInfo:
+		return slog.LevelInfo
+	default:
+		return slog.LevelDebug
+	}
+}
+
+// LogDataFromSlogRecord converts a slog record into a log. LogValuer attributes are resolved,
+// groups become nested maps, the SlogErrorKey error attribute becomes the log Error and the record
+// PC becomes the log Origin.
+func LogDataFromSlogRecord(r slog.Record) *LogData {
+	ld := &LogData{
+		Timestamp: r.Time,
+		Level:     LevelFromSlog(r.Level),
+		Type:      LogTypeLog,
+		Message:   r.Message,
+		Origin:    OriginFromPC(r.PC),
+	}
+	if r.Level != SlogLevel(ld.Level) {
+		ld.ContextMap = append(ld.ContextMap, SlogLevelKey, int64(r.Level))
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		a.Value = a.Value.Resolve()
+		if a.Key == SlogErrorKey && ld.Error == nil {
+			if err, ok := a.Value.Any().(error); ok {
+				ld.Error = err
+				return true
+			}
+		}
+		if a.Equal(slog.Attr{}) {
+			return true
+		}
+		if a.Key == "" && a.Value.Kind() == slog.KindGroup {
+			// Inline groups, as slog handlers do.
+			for _, ga := range a.Value.Group() {
+				ld.ContextMap = append(ld.ContextMap, ga.Key, slogValueToAny(ga.Value))
+			}
+			return true
+		}
+		ld.ContextMap = append(ld.ContextMap, a.Key, slogValueToAny(a.Value))
+		return true
+	})
+	return ld
+}
+
+// SlogRecordFromLogData converts a log into a slog record, so it can be re-emitted through any slog
+// handler. Nested maps become groups, the Error becomes the SlogErrorKey attribute and the Origin,
+// which has no PC once received, becomes the slog.SourceKey attribute.
+func SlogRecordFromLogData(ld *LogData) slog.Record {
+	context := ld.Context()
+	level := SlogLevel(ld.Level)
+	if l, ok := context[SlogLevelKey]; ok {
+		if n, ok := toInt64(l); ok && LevelFromSlog(slog.Level(n)) == ld.Level {
+			level = slog.Level(n)
+		}
+	}
+	r := slog.NewRecord(ld.Timestamp, level, ld.RenderMessage(), 0)
+
+	seen := make(map[string]bool, len(context))
+	for i := 0; i < len(ld.ContextMap); i += 2 {
+		key := fmt.Sprint(ld.ContextMap[i])
+		if seen[key] || key == SlogLevelKey {
+			continue
+		}
+		seen[key] = true
+		r.AddAttrs(slog.Attr{Key: key, Value: anyToSlogValue(context[key])})
+	}
+	if ld.Error != nil {
+		r.AddAttrs(slog.Any(SlogErrorKey, ld.Error))
+	}
+	if ld.CorrelationData != nil && ld.CorrelationData.CorrelationID != "" && !seen[CorrelationIDField] {
+		r.AddAttrs(slog.String(CorrelationIDField, ld.CorrelationData.CorrelationID))
+	}
+	if ld.Origin != nil {
+		fn := ld.Origin.Function
+		if ld.Origin.Package != "" {
+			fn = ld.Origin.Package + "." + fn
+		}
+		r.AddAttrs(slog.Any(slog.SourceKey, &slog.Source{Function: fn, File: ld.Origin.File, Line: ld.Origin.Line}))
+	}
+	return r
+}
+
+// slogValueToAny returns the Go value of a resolved slog value, groups as maps.
+func slogValueToAny(v slog.Value) interface{} {
+	v = v.Resolve()
+	if v.Kind() != slog.KindGroup {
+		return v.Any()
+	}
+	m := make(map[string]interface{}, len(v.Group()))
+	for _, a := range v.Group() {
+		a.Value = a.Value.Resolve()
+		if a.Key == "" && a.Value.Kind() == slog.KindGroup {
+			for k, gv := range slogValueToAny(a.Value).(map[string]interface{}) {
+				m[k] = gv
+			}
+			continue
+		}
+		m[a.Key] = slogValueToAny(a.Value)
+	}
+	return m
+}
+
+// anyToSlogValue returns the slog value of a context value, maps as groups sorted by key.
+func anyToSlogValue(v interface{}) slog.Value {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return slog.AnyValue(v)
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	attrs := make([]slog.Attr, len(keys))
+	for i, k := range keys {
+		attrs[i] = slog.Attr{Key: k, Value: anyToSlogValue(m[k])}
+	}
+	return slog.GroupValue(attrs...)
+}
+
+func toInt64(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return n, true
+	case int:
+		return int64(n), true
+	case float64:
+		return int64(n), float64(int64(n)) == n
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	// ResourceTypeGlobal represents the Cloud Logging "global" monitored resource.
+	ResourceTypeGlobal = "global"
+	// ResourceTypeGCEInstance represents the Cloud Logging "gce_instance" monitored resource.
+	ResourceTypeGCEInstance = "gce_instance"
+	// ResourceTypeK8sPod represents the Cloud Logging "k8s_pod" monitored resource.
+	ResourceTypeK8sPod = "k8s_pod"
+	// ResourceTypeGenericNode represents the Cloud Logging "generic_node" monitored resource.
+	ResourceTypeGenericNode = "generic_node"
+)
+
+// MonitoredResource mirrors the Cloud Logging MonitoredResource message.
+// Type: Resource type. One of "ResourceType*".
+// Labels: Resource labels, as defined by the resource type.
+type MonitoredResource struct {
+	Type   string            `json:"type"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// LogEntry mirrors the Cloud Logging (Stackdriver) LogEntry message fields set by the server.
+// LogName: Full log name, "projects/[PROJECT_ID]/logs/[LOG_ID]".
+// Resource: Monitored resource that produced the log.
+// Timestamp: Log timestamp.
+// Severity: Severity name, e.g. "ERROR".
+// InsertID: Unique entry ID, used by Cloud Logging to drop duplicates of retransmitted entries.
+// Trace: Trace resource name, "projects/[PROJECT_ID]/traces/[TRACE_ID]", linking correlated logs.
+// Labels: Entry labels.
+// JSONPayload: Structured entry payload.
+type LogEntry struct {
+	LogName     string                 `json:"logName"`
+	Resource    *MonitoredResource     `json:"resource"`
+	Timestamp   time.Time              `json:"timestamp"`
+	Severity    string                 `json:"severity"`
+	InsertID    string                 `json:"insertId"`
+	Trace       string                 `json:"trace,omitempty"`
+	Labels      map[string]string      `json:"labels,omitempty"`
+	JSONPayload map[string]interface{} `json:"jsonPayload"`
+}
+
+// LogEntrySource holds what the server knows about a log when writing it to Cloud Logging.
+// Data: Logged data.
+// Timestamp: Log timestamp.
+// Level: Log level. One of "Level*".
+// LogID: ID of the log within the project, e.g. the client app name.
+// ConnectionID: ID of the connection the log was received on.
+// PackageID: ID of the package the log was received in.
+// Index: Position of the log in its package.
+// Identity: Identity of the client, used to describe the monitored resource. Nil maps to "ResourceTypeGlobal".
+type LogEntrySource struct {
+	Data         *LoggedData
+	Timestamp    time.Time
+	Level        byte
+	LogID        string
+	ConnectionID string
+	PackageID    uint64
+	Index        int
+	Identity     *ClientIdentity
+}
+
+// ToLogEntry maps the log to a Cloud Logging entry of the config project, with the config severity mapping.
+func (c *ServerLoggingConfig) ToLogEntry(src *LogEntrySource) *LogEntry {
+	d := src.Data
+	e := &LogEntry{
+		LogName:   fmt.Sprintf("projects/%s/logs/%s", c.ProjectID, url.PathEscape(src.LogID)),
+		Resource:  MonitoredResourceFor(c.ProjectID, src.Identity),
+		Timestamp: src.Timestamp,
+		Severity:  c.Severity(src.Level).Name,
+		InsertID:  fmt.Sprintf("%s-%d-%d", src.ConnectionID, src.PackageID, src.Index),
+		JSONPayload: map[string]interface{}{
+			"message": d.Message,
+			"type":    d.Type.String(),
+		},
+	}
+	if d.Weight != 0 {
+		e.JSONPayload["weight"] = d.Weight
+	}
+	if d.Error != nil {
+		e.JSONPayload["error"] = d.Error.Error()
+	}
+	if d.MessageTemplate != "" {
+		e.JSONPayload["messageTemplate"] = d.MessageTemplate
+		e.JSONPayload["params"] = d.Params
+	}
+	if len(d.Context) > 0 {
+		e.JSONPayload["context"] = d.Context
+	}
+	if id, ok := d.Context[CorrelationIDField].(string); ok && id != "" {
+		e.Trace = fmt.Sprintf("projects/%s/traces/%s", c.ProjectID, id)
+	}
+	if src.Identity != nil && src.Identity.Version != "" {
+		e.Labels = map[string]string{IdentityVersionField: src.Identity.Version}
+	}
+	return e
+}
+
+// CloudLoggingBackend writes the logs as Cloud Logging entries, one JSON object per line, for the
+// Cloud Logging agent to ingest, e.g. from the stdout of a container. Safe for concurrent use.
+type CloudLoggingBackend struct {
+	config *ServerLoggingConfig
+	mu     sync.Mutex
+	w      io.Writer
+}
+
+// NewCloudLoggingBackend returns a backend writing the entries of the config to w. It's the
+// "OutputCloudLogging" backend, writing to os.Stdout.
+func NewCloudLoggingBackend(cfg *ServerLoggingConfig, w io.Writer) *CloudLoggingBackend {
+	return &CloudLoggingBackend{config: cfg, w: w}
+}
+
+// Write writes the entries of the logs at once.
+func (b *CloudLoggingBackend) Write(ctx context.Context, logs []*LogEntrySource) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, src := range logs {
+		if err := enc.Encode(b.config.ToLogEntry(src)); err != nil {
+			return err
+		}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, err := b.w.Write(buf.Bytes())
+	return err
+}
+
+// Close does nothing, every write being unbuffered.
+func (b *CloudLoggingBackend) Close() error {
+	return nil
+}
+
+// MonitoredResourceFor returns the monitored resource best describing the client: its GCE instance,
+// its Kubernetes pod or its host, falling back to "ResourceTypeGlobal". A resource type is only used
+// when the identity has every label Cloud Logging requires for it.
+func MonitoredResourceFor(projectID string, ci *ClientIdentity) *MonitoredResource {
+	labels := map[string]string{"project_id": projectID}
+	if ci == nil {
+		return &MonitoredResource{Type: ResourceTypeGlobal, Labels: labels}
+	}
+	location := ci.Zone
+	if location == "" {
+		location = ci.Region
+	}
+	switch {
+	case ci.PodID != "" && ci.ClusterName != "" && ci.Namespace != "" && location != "":
+		labels["location"] = location
+		labels["cluster_name"] = ci.ClusterName
+		labels["namespace_name"] = ci.Namespace
+		labels["pod_name"] = ci.PodID
+		return &MonitoredResource{Type: ResourceTypeK8sPod, Labels: labels}
+	case ci.InstanceID != "" && ci.Zone != "":
+		labels["instance_id"] = ci.InstanceID
+		labels["zone"] = ci.Zone
+		return &MonitoredResource{Type: ResourceTypeGCEInstance, Labels: labels}
+	case ci.Hostname != "":
+		labels["location"] = location
+		labels["node_id"] = ci.Hostname
+		return &MonitoredResource{Type: ResourceTypeGenericNode, Labels: labels}
+	default:
+		return &MonitoredResource{Type: ResourceTypeGlobal, Labels: labels}
+	}
+}
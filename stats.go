@@ -0,0 +1,72 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// PipelineStats holds the logging pipeline counters. Safe for concurrent use.
+// ContextsTruncated: Number of log contexts truncated to fit MaxContextBytes/MaxContextKeys.
+// ContextKeysDropped: Number of context keys dropped by truncation.
+// MessagesTruncated: Number of log messages truncated to fit MaxMessageBytes.
+// LogsDelivered: Number of logs acknowledged by the server.
+// LogsFailed: Number of logs dropped or rejected instead of being delivered.
+// LevelRates: Sliding rates of the logs emitted at each level, indexed by "Level*". See ObserveLog.
+// Clock: Times the snapshots. Nil uses SystemClock.
+type PipelineStats struct {
+	ContextsTruncated  atomic.Uint64
+	ContextKeysDropped atomic.Uint64
+	MessagesTruncated  atomic.Uint64
+	LogsDelivered      atomic.Uint64
+	LogsFailed         atomic.Uint64
+	LevelRates         [LevelDebug + 1]SlidingRate
+	Clock              Clock
+}
+
+// PipelineStatsSnapshot holds a point in time copy of the pipeline counters.
+type PipelineStatsSnapshot struct {
+	ContextsTruncated  uint64
+	ContextKeysDropped uint64
+	MessagesTruncated  uint64
+	LogsDelivered      uint64
+	LogsFailed         uint64
+	LevelRates         map[byte]Rates
+}
+
+// Snapshot returns a copy of the current counter values and rates.
+func (s *PipelineStats) Snapshot() PipelineStatsSnapshot {
+	now := clockOrSystem(s.Clock).Now()
+	rates := make(map[byte]Rates, len(s.LevelRates))
+	for level := range s.LevelRates {
+		rates[byte(level)] = s.LevelRates[level].Rates(now)
+	}
+	return PipelineStatsSnapshot{
+		ContextsTruncated:  s.ContextsTruncated.Load(),
+		ContextKeysDropped: s.ContextKeysDropped.Load(),
+		MessagesTruncated:  s.MessagesTruncated.Load(),
+		LogsDelivered:      s.LogsDelivered.Load(),
+		LogsFailed:         s.LogsFailed.Load(),
+		LevelRates:         rates,
+	}
+}
+
+// ObserveLog records a log emitted at the given level in the level rates. Unknown levels are ignored.
+func (s *PipelineStats) ObserveLog(level byte, now time.Time) {
+	if int(level) < len(s.LevelRates) {
+		s.LevelRates[level].Add(now, 1)
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TemplatePlaceholder holds the placeholder replaced by the next param when rendering a message template.
+const TemplatePlaceholder = "{}"
+
+// RenderTemplate replaces each placeholder in the template with the next param, formatted with
+// fmt.Sprint. Placeholders without param are kept; params without placeholder are appended.
+func RenderTemplate(template string, params []interface{}) string {
+	var sb strings.Builder
+	i := 0
+	for {
+		idx := strings.Index(template, TemplatePlaceholder)
+		if idx < 0 || i >= len(params) {
+			break
+		}
+		sb.WriteString(template[:idx])
+		sb.WriteString(fmt.Sprint(params[i]))
+		template = template[idx+len(TemplatePlaceholder):]
+		i++
+	}
+	sb.WriteString(template)
+	if i < len(params) {
+		sb.WriteString(" ")
+		sb.WriteString(fmt.Sprint(params[i:]))
+	}
+	return sb.String()
+}
+
+// RenderMessage returns the log message, rendering MessageTemplate with Params if Message is empty.
+func (ld *LogData) RenderMessage() string {
+	if ld.Message != "" || ld.MessageTemplate == "" {
+		return ld.Message
+	}
+	return RenderTemplate(ld.MessageTemplate, ld.Params)
+}
@@ -0,0 +1,259 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+const (
+	// TransformEngineTemplate renders the payload with a Go text/template.
+	TransformEngineTemplate = "template"
+	// TransformEngineFieldMap builds the payload from JSONPath field mappings.
+	TransformEngineFieldMap = "fieldMap"
+)
+
+// ErrInvalidJSONPath is returned when a field mapping source isn't a supported JSONPath.
+var ErrInvalidJSONPath = errors.New("invalid JSONPath")
+
+// TransformTemplate holds the transformation of the logged data into the payload written to a
+// backend, so small backend specific formatting differences don't need code per destination. Both
+// engines see the logged data as its JSON document: Type, Weight, Message, Error, Context,
+// MessageTemplate, Params, RetentionHint and MessageKey.
+// Engine: Transformation engine. One of "TransformEngine*".
+// Template: Go text/template rendering the payload, which must be a JSON object. Used by "TransformEngineTemplate".
+// The "json" function serializes its argument.
+// Fields: Payload fields, dot separated for nested fields, mapped to the JSONPath of their value,
+// e.g. "labels.user": "$.Context.user.id". Fields whose path matches nothing are left out. Used by "TransformEngineFieldMap".
+type TransformTemplate struct {
+	Engine   string
+	Template string
+	Fields   map[string]string
+}
+
+// Validate checks the transform template, returning every invalid field.
+func (t *TransformTemplate) Validate() []*ValidationError {
+	v := &validator{}
+	v.oneOf("Engine", t.Engine, TransformEngineTemplate, TransformEngineFieldMap)
+	switch t.Engine {
+	case TransformEngineTemplate:
+		if t.Template == "" {
+			v.add("Template", t.Template, ConstraintRequired)
+		} else if _, err := parseTransformTemplate(t.Template); err != nil {
+			v.add("Template", t.Template, "must be a valid template")
+		}
+	case TransformEngineFieldMap:
+		if len(t.Fields) == 0 {
+			v.add("Fields", t.Fields, ConstraintRequired)
+		}
+		for field, path := range t.Fields {
+			if field == "" {
+				v.add("Fields", field, "keys must not be empty")
+			}
+			if _, err := parseJSONPath(path); err != nil {
+				v.add("Fields."+field, path, "must be a valid JSONPath")
+			}
+		}
+	}
+	return v.errs
+}
+
+// Transformer applies a compiled transform template. Safe for concurrent use.
+type Transformer struct {
+	tmpl   *template.Template
+	fields []transformField
+}
+
+type transformField struct {
+	target []string
+	path   []jsonPathSegment
+}
+
+// Compile parses the transform template.
+func (t *TransformTemplate) Compile() (*Transformer, error) {
+	switch t.Engine {
+	case TransformEngineTemplate:
+		tmpl, err := parseTransformTemplate(t.Template)
+		if err != nil {
+			return nil, err
+		}
+		return &Transformer{tmpl: tmpl}, nil
+	case TransformEngineFieldMap:
+		names := make([]string, 0, len(t.Fields))
+		for name := range t.Fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		tr := &Transformer{fields: make([]transformField, len(names))}
+		for i, name := range names {
+			path, err := parseJSONPath(t.Fields[name])
+			if err != nil {
+				return nil, fmt.Errorf("field %q: %w", name, err)
+			}
+			tr.fields[i] = transformField{target: strings.Split(name, "."), path: path}
+		}
+		return tr, nil
+	default:
+		return nil, fmt.Errorf("unknown transform engine %q", t.Engine)
+	}
+}
+
+// Apply returns the payload of the logged data.
+func (t *Transformer) Apply(ld *LoggedData) (map[string]interface{}, error) {
+	doc, err := loggedDataDocument(ld)
+	if err != nil {
+		return nil, err
+	}
+	if t.tmpl != nil {
+		var buf bytes.Buffer
+		if err := t.tmpl.Execute(&buf, doc); err != nil {
+			return nil, err
+		}
+		payload := make(map[string]interface{})
+		if err := json.Unmarshal(buf.Bytes(), &payload); err != nil {
+			return nil, fmt.Errorf("template output is not a JSON object: %w", err)
+		}
+		return payload, nil
+	}
+	payload := make(map[string]interface{})
+	for _, f := range t.fields {
+		value, ok := evalJSONPath(doc, f.path)
+		if !ok {
+			continue
+		}
+		m := payload
+		for _, k := range f.target[:len(f.target)-1] {
+			next, ok := m[k].(map[string]interface{})
+			if !ok {
+				next = make(map[string]interface{})
+				m[k] = next
+			}
+			m = next
+		}
+		m[f.target[len(f.target)-1]] = value
+	}
+	return payload, nil
+}
+
+func parseTransformTemplate(text string) (*template.Template, error) {
+	return template.New("transform").Funcs(template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+	}).Parse(text)
+}
+
+// loggedDataDocument returns the logged data as a generic JSON document, its error as a string.
+func loggedDataDocument(ld *LoggedData) (map[string]interface{}, error) {
+	type document LoggedData
+	d := struct {
+		*document
+		Error string `json:"Error,omitempty"`
+	}{document: (*document)(ld)}
+	if ld.Error != nil {
+		d.Error = ld.Error.Error()
+	}
+	raw, err := json.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+	doc := make(map[string]interface{})
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// jsonPathSegment holds a JSONPath member name, or an array index if key is empty.
+type jsonPathSegment struct {
+	key   string
+	index int
+}
+
+// parseJSONPath parses the JSONPath subset made of the "$" root followed by ".name", "['name']"
+// and "[index]" segments.
+func parseJSONPath(path string) ([]jsonPathSegment, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("%w %q: must start with $", ErrInvalidJSONPath, path)
+	}
+	var segments []jsonPathSegment
+	rest := path[1:]
+	for rest != "" {
+		switch {
+		case rest[0] == '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			name := rest[1 : end+1]
+			if name == "" {
+				return nil, fmt.Errorf("%w %q: empty member name", ErrInvalidJSONPath, path)
+			}
+			segments = append(segments, jsonPathSegment{key: name})
+			rest = rest[end+1:]
+		case strings.HasPrefix(rest, "['"):
+			end := strings.Index(rest, "']")
+			if end < 2 {
+				return nil, fmt.Errorf("%w %q: unterminated member name", ErrInvalidJSONPath, path)
+			}
+			segments = append(segments, jsonPathSegment{key: rest[2:end]})
+			rest = rest[end+2:]
+		case rest[0] == '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("%w %q: unterminated index", ErrInvalidJSONPath, path)
+			}
+			i, err := strconv.Atoi(rest[1:end])
+			if err != nil || i < 0 {
+				return nil, fmt.Errorf("%w %q: invalid index %q", ErrInvalidJSONPath, path, rest[1:end])
+			}
+			segments = append(segments, jsonPathSegment{index: i})
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("%w %q: unexpected %q", ErrInvalidJSONPath, path, rest[:1])
+		}
+	}
+	return segments, nil
+}
+
+func evalJSONPath(doc interface{}, path []jsonPathSegment) (interface{}, bool) {
+	v := doc
+	for _, s := range path {
+		if s.key != "" {
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			if v, ok = m[s.key]; !ok {
+				return nil, false
+			}
+			continue
+		}
+		a, ok := v.([]interface{})
+		if !ok || s.index >= len(a) {
+			return nil, false
+		}
+		v = a[s.index]
+	}
+	return v, true
+}
@@ -0,0 +1,189 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"sync"
+)
+
+// TransportStream is the name of the framed stream transport, the default transport.
+const TransportStream = "stream"
+
+var (
+	// ErrTransportNotOpen is returned when sending or receiving over a transport that isn't open.
+	ErrTransportNotOpen = errors.New("transport not open")
+	// ErrTransportAlreadyOpen is returned when opening a transport twice.
+	ErrTransportAlreadyOpen = errors.New("transport already open")
+)
+
+// Transport carries transport packages between a client and the server. Batching and queueing
+// are built on top of this interface so new protocols can be added without changing them.
+// Send and Recv may be called concurrently with each other, but not with themselves.
+type Transport interface {
+	// Open connects to the endpoint.
+	Open(ctx context.Context, endpoint string) error
+	// Send writes the package. The package Payload must hold the serialized Data.
+	Send(pkg *TransportPackage) error
+	// Recv blocks until a package is received. Returns io.EOF when the peer closed the stream.
+	Recv() (*TransportPackage, error)
+	// Close releases the connection. Pending Recv calls return an error.
+	Close() error
+}
+
+// TransportFactory returns a new, unopened transport.
+type TransportFactory func() Transport
+
+var transports = struct {
+	sync.RWMutex
+	factories map[string]TransportFactory
+}{factories: make(map[string]TransportFactory)}
+
+func init() {
+	RegisterTransport(TransportStream, func() Transport { return NewStreamTransport(NetStreamDialer("tcp")) })
+}
+
+// RegisterTransport makes a transport available under the given name, replacing any previous registration.
+func RegisterTransport(name string, factory TransportFactory) {
+	transports.Lock()
+	defer transports.Unlock()
+	transports.factories[name] = factory
+}
+
+// NewTransport returns a new transport of the given type. An empty name returns a "TransportStream" transport.
+func NewTransport(name string) (Transport, error) {
+	if name == "" {
+		name = TransportStream
+	}
+	transports.RLock()
+	factory, ok := transports.factories[name]
+	transports.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown transport %q", name)
+	}
+	return factory(), nil
+}
+
+// RegisteredTransports returns the names of the registered transports, sorted.
+func RegisteredTransports() []string {
+	transports.RLock()
+	defer transports.RUnlock()
+	names := make([]string, 0, len(transports.factories))
+	for name := range transports.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// StreamDialer opens the byte stream a StreamTransport frames packages over.
+type StreamDialer func(ctx context.Context, endpoint string) (io.ReadWriteCloser, error)
+
+// NetStreamDialer returns a dialer opening network connections of the given type, e.g. "tcp".
+func NetStreamDialer(network string) StreamDialer {
+	return func(ctx context.Context, endpoint string) (io.ReadWriteCloser, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, network, endpoint)
+	}
+}
+
+// StreamTransport frames packages over a byte stream with WriteTransportPackage/ReadTransportPackage.
+type StreamTransport struct {
+	dial StreamDialer
+
+	mu     sync.Mutex
+	caps   Capabilities
+	conn   io.ReadWriteCloser
+	writer *bufio.Writer
+	reader *bufio.Reader
+}
+
+// NewStreamTransport returns a stream transport opening its stream with dial.
+func NewStreamTransport(dial StreamDialer) *StreamTransport {
+	return &StreamTransport{dial: dial}
+}
+
+// NewStreamTransportFromConn returns an open stream transport over an already established stream.
+func NewStreamTransportFromConn(conn io.ReadWriteCloser) *StreamTransport {
+	return &StreamTransport{conn: conn, writer: bufio.NewWriter(conn), reader: bufio.NewReader(conn)}
+}
+
+// Open implements the Transport interface.
+func (t *StreamTransport) Open(ctx context.Context, endpoint string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.conn != nil {
+		return ErrTransportAlreadyOpen
+	}
+	conn, err := t.dial(ctx, endpoint)
+	if err != nil {
+		return err
+	}
+	t.conn = conn
+	t.writer = bufio.NewWriter(conn)
+	t.reader = bufio.NewReader(conn)
+	return nil
+}
+
+// Send implements the Transport interface.
+func (t *StreamTransport) Send(pkg *TransportPackage) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.conn == nil {
+		return ErrTransportNotOpen
+	}
+	if err := WriteFrame(t.writer, pkg, t.caps); err != nil {
+		return err
+	}
+	return t.writer.Flush()
+}
+
+// Recv implements the Transport interface.
+func (t *StreamTransport) Recv() (*TransportPackage, error) {
+	t.mu.Lock()
+	reader, caps := t.reader, t.caps
+	t.mu.Unlock()
+	if reader == nil {
+		return nil, ErrTransportNotOpen
+	}
+	return ReadFrame(reader, caps)
+}
+
+// SetCapabilities sets the capabilities negotiated with the peer, which select the frame layout of
+// the following packages. Call it once the open connection exchange is done.
+func (t *StreamTransport) SetCapabilities(caps Capabilities) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.caps = caps
+}
+
+// Close implements the Transport interface.
+func (t *StreamTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.conn == nil {
+		return nil
+	}
+	err := t.conn.Close()
+	t.conn = nil
+	t.writer = nil
+	return err
+}
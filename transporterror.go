@@ -0,0 +1,154 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// TransportOpConnect represents a failure opening a connection.
+	TransportOpConnect = "connect"
+	// TransportOpSend represents a failure sending a package.
+	TransportOpSend = "send"
+	// TransportOpReceive represents a failure receiving a package.
+	TransportOpReceive = "receive"
+	// TransportOpHealthCheck represents a failed health check.
+	TransportOpHealthCheck = "healthcheck"
+)
+
+// DefaultRecentErrorsSize is the number of errors kept by a RecentErrors buffer created with size zero.
+const DefaultRecentErrorsSize = 16
+
+// TransportError holds a failure of a client connection.
+// Time: Time the failure happened.
+// Op: Failed operation. One of "TransportOp*".
+// Endpoint: Server endpoint the connection was talking to.
+// ConnectionID: Server provided unique connection ID, if the connection was open.
+// PackageID: ID of the package being sent or received, if any.
+// Message: Error message.
+type TransportError struct {
+	Time         time.Time
+	Op           string
+	Endpoint     string
+	ConnectionID string
+	PackageID    uint64
+	Message      string
+	Err          error `json:"-"`
+}
+
+// NewTransportError returns a transport error wrapping err.
+func NewTransportError(op, endpoint, connectionID string, packageID uint64, err error) *TransportError {
+	return &TransportError{
+		Time:         time.Now(),
+		Op:           op,
+		Endpoint:     endpoint,
+		ConnectionID: connectionID,
+		PackageID:    packageID,
+		Message:      err.Error(),
+		Err:          err,
+	}
+}
+
+// Error implements the error interface.
+func (e *TransportError) Error() string {
+	return fmt.Sprintf("%s %s: %s", e.Op, e.Endpoint, e.Message)
+}
+
+// Unwrap returns the wrapped error, if any.
+func (e *TransportError) Unwrap() error {
+	return e.Err
+}
+
+// RecentErrors holds the last N transport errors of a connection. Safe for concurrent use.
+type RecentErrors struct {
+	mu    sync.Mutex
+	buf   []*TransportError
+	next  int
+	full  bool
+	total uint64
+}
+
+// NewRecentErrors returns a buffer keeping the last size errors.
+func NewRecentErrors(size int) *RecentErrors {
+	if size <= 0 {
+		size = DefaultRecentErrorsSize
+	}
+	return &RecentErrors{buf: make([]*TransportError, size)}
+}
+
+// Add records the error, evicting the oldest one if the buffer is full.
+func (r *RecentErrors) Add(err *TransportError) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.buf[r.next] = err
+	r.next = (r.next + 1) % len(r.buf)
+	if r.next == 0 {
+		r.full = true
+	}
+	r.total++
+}
+
+// Snapshot returns the buffered errors, oldest first.
+func (r *RecentErrors) Snapshot() []*TransportError {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.full {
+		return append([]*TransportError(nil), r.buf[:r.next]...)
+	}
+	out := make([]*TransportError, 0, len(r.buf))
+	out = append(out, r.buf[r.next:]...)
+	return append(out, r.buf[:r.next]...)
+}
+
+// Total returns the number of errors recorded since the buffer was created, including evicted ones.
+func (r *RecentErrors) Total() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.total
+}
+
+// ClientConnectionState holds the client side state of a connection to the server.
+// ConnectionID: Server provided unique connecton ID.
+// Endpoint: Server endpoint.
+// IsHiPri: true if the connection is high priority; false otherwise.
+// IsBackup: true if the connection is a backup connection; false otherwise.
+// RecentErrors: Last failures of the connection.
+type ClientConnectionState struct {
+	ConnectionID string
+	Endpoint     string
+	IsHiPri      bool
+	IsBackup     bool
+	RecentErrors *RecentErrors
+}
+
+// NewClientConnectionState returns the state of a new connection keeping the last recentErrors failures.
+func NewClientConnectionState(endpoint string, isHiPri, isBackup bool, recentErrors int) *ClientConnectionState {
+	return &ClientConnectionState{
+		Endpoint:     endpoint,
+		IsHiPri:      isHiPri,
+		IsBackup:     isBackup,
+		RecentErrors: NewRecentErrors(recentErrors),
+	}
+}
+
+// RecordError records a failure of the connection.
+func (s *ClientConnectionState) RecordError(op string, packageID uint64, err error) *TransportError {
+	te := NewTransportError(op, s.Endpoint, s.ConnectionID, packageID, err)
+	s.RecentErrors.Add(te)
+	return te
+}
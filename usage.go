@@ -0,0 +1,108 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// UsageTierCritical represents apps whose logs must not be dropped, e.g. payment services.
+	UsageTierCritical = "critical"
+	// UsageTierStandard represents most apps.
+	UsageTierStandard = "standard"
+	// UsageTierBestEffort represents apps whose logs can be dropped under load, e.g. batch jobs.
+	UsageTierBestEffort = "bestEffort"
+)
+
+const (
+	// DefaultConnectionBufferSize is the number of messages buffered per connection without a usage profile.
+	DefaultConnectionBufferSize = 1000
+	// MaxConnectionBufferSize caps the buffer sized from a usage profile, whatever the client claims.
+	MaxConnectionBufferSize = 100000
+	// connectionBufferHeadroom is the factor applied to the peak rate when sizing connection buffers.
+	connectionBufferHeadroom = 2
+)
+
+// UsageProfile holds the expected usage of a client, sent opt-in in the open requests so the server
+// can pre-size the connection buffers and select a suitable ServerLoggingConfig instead of using
+// one-size defaults. Every field is optional.
+// PeakLogsPerSecond: Expected peak number of logs per second of the client.
+// TypicalMessageBytes: Typical serialized size of a log.
+// Tier: App tier. One of "UsageTier*".
+type UsageProfile struct {
+	PeakLogsPerSecond   float64 `json:"peakLogsPerSecond"`
+	TypicalMessageBytes int     `json:"typicalMessageBytes"`
+	Tier                string  `json:"tier"`
+}
+
+// Validate checks the usage profile, returning every invalid field.
+func (p *UsageProfile) Validate() []*ValidationError {
+	v := &validator{}
+	if p.PeakLogsPerSecond < 0 || math.IsNaN(p.PeakLogsPerSecond) || math.IsInf(p.PeakLogsPerSecond, 0) {
+		v.add("peakLogsPerSecond", p.PeakLogsPerSecond, ConstraintNonNegative)
+	}
+	v.nonNegative("typicalMessageBytes", int64(p.TypicalMessageBytes))
+	if p.Tier != "" {
+		v.oneOf("tier", p.Tier, UsageTierCritical, UsageTierStandard, UsageTierBestEffort)
+	}
+	return v.errs
+}
+
+// ConnectionBufferSize returns the number of messages to buffer for a connection drained every
+// drainInterval: twice the peak logs of an interval, in [1, MaxConnectionBufferSize]. Returns
+// DefaultConnectionBufferSize if the profile is nil or has no peak rate.
+func (p *UsageProfile) ConnectionBufferSize(drainInterval time.Duration) int {
+	if p == nil || !(p.PeakLogsPerSecond > 0) || drainInterval <= 0 {
+		return DefaultConnectionBufferSize
+	}
+	size := math.Ceil(p.PeakLogsPerSecond * drainInterval.Seconds() * connectionBufferHeadroom)
+	if size > MaxConnectionBufferSize {
+		return MaxConnectionBufferSize
+	}
+	return int(math.Max(size, 1))
+}
+
+// ConnectionBufferBytes returns the expected memory of the connection buffer sized by
+// ConnectionBufferSize, or zero if the typical message size is unknown.
+func (p *UsageProfile) ConnectionBufferBytes(drainInterval time.Duration) int64 {
+	if p == nil || p.TypicalMessageBytes <= 0 {
+		return 0
+	}
+	return int64(p.ConnectionBufferSize(drainInterval)) * int64(p.TypicalMessageBytes)
+}
+
+// SelectConfig returns the config of the default group serving the profile tier, or the default
+// config if the profile is nil, has no tier or no config serves it. Returns nil if there's neither.
+func (c *ServerLoggingConfigs) SelectConfig(profile *UsageProfile) *ServerLoggingConfig {
+	var fallback *ServerLoggingConfig
+	for _, cfg := range c.Configs {
+		if cfg == nil || cfg.Group != c.DefaultConfigGroupName {
+			continue
+		}
+		if profile != nil && profile.Tier != "" {
+			for _, tier := range cfg.Tiers {
+				if tier == profile.Tier {
+					return cfg
+				}
+			}
+		}
+		if cfg.Name == c.DefaultConfigName && fallback == nil {
+			fallback = cfg
+		}
+	}
+	return fallback
+}
@@ -0,0 +1,385 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// ConstraintRequired represents a field that must be set.
+	ConstraintRequired = "required"
+	// ConstraintNonNegative represents a field that must be zero or greater.
+	ConstraintNonNegative = "must be >= 0"
+	// ConstraintPositive represents a field that must be greater than zero.
+	ConstraintPositive = "must be > 0"
+	// ConstraintLevel represents a field that must be one of "Level*".
+	ConstraintLevel = "must be a valid level (0-3)"
+	// ConstraintDuration represents a field that must be a valid duration string, e.g. "5s".
+	ConstraintDuration = "must be a valid duration"
+)
+
+// ValidationErrorsMessage holds the message of the API error responses returned for invalid configs.
+const ValidationErrorsMessage = "invalid configuration"
+
+// ValidationError describes a config field rejected by a Validate method.
+// Field: Path of the field, dot separated, with indexes in brackets, e.g. "configs[1].bulkhead.maxQueued".
+// Value: Rejected value.
+// Constraint: Constraint the value violates, e.g. "ConstraintRequired".
+type ValidationError struct {
+	Field      string
+	Value      interface{}
+	Constraint string
+}
+
+// Error implements the error interface.
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s (got %v)", e.Field, e.Constraint, e.Value)
+}
+
+// ValidationErrors holds all the errors found validating a config.
+type ValidationErrors []*ValidationError
+
+// Error implements the error interface.
+func (errs ValidationErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, e := range errs {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Err returns errs as an error, or nil if errs is empty.
+func (errs ValidationErrors) Err() error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// ErrorResponse holds the body of API error responses.
+// Message: Human readable error description.
+// Errors: Config fields rejected by validation, if any.
+type ErrorResponse struct {
+	Message string
+	Errors  []*ValidationError `json:",omitempty"`
+}
+
+// NewValidationErrorResponse returns the API error response reporting the given validation errors.
+func NewValidationErrorResponse(errs []*ValidationError) *ErrorResponse {
+	return &ErrorResponse{Message: ValidationErrorsMessage, Errors: errs}
+}
+
+// validator accumulates the validation errors of a config.
+type validator struct {
+	errs []*ValidationError
+}
+
+func (v *validator) add(field string, value interface{}, constraint string) {
+	v.errs = append(v.errs, &ValidationError{Field: field, Value: value, Constraint: constraint})
+}
+
+// nest adds the errors of a nested config, prefixing their field paths with parent.
+func (v *validator) nest(parent string, errs []*ValidationError) {
+	for _, e := range errs {
+		v.errs = append(v.errs, &ValidationError{Field: parent + "." + e.Field, Value: e.Value, Constraint: e.Constraint})
+	}
+}
+
+func (v *validator) nonNegative(field string, value int64) {
+	if value < 0 {
+		v.add(field, value, ConstraintNonNegative)
+	}
+}
+
+func (v *validator) level(field string, value byte) {
+	if value > LevelDebug {
+		v.add(field, value, ConstraintLevel)
+	}
+}
+
+func (v *validator) oneOf(field string, value string, allowed ...string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	v.add(field, value, fmt.Sprintf("must be one of %q", allowed))
+}
+
+// uniqueNames checks the names of a list field are set, unique and, unless known is nil, in known.
+func (v *validator) uniqueNames(field string, names []string, known map[string]bool) {
+	seen := make(map[string]bool, len(names))
+	for i, name := range names {
+		f := fmt.Sprintf("%s[%d]", field, i)
+		switch {
+		case name == "":
+			v.add(f, name, ConstraintRequired)
+		case seen[name]:
+			v.add(f, name, "must be unique")
+		case known != nil && !known[name]:
+			v.add(f, name, "must be a known name")
+		}
+		seen[name] = true
+	}
+}
+
+// Validate checks the client config, returning every invalid field. Field paths use the JSON names.
+func (c *ClientConfig) Validate() []*ValidationError {
+	v := &validator{}
+	if c.Enabled {
+		if c.Endpoint == "" {
+			v.add("endpoint", c.Endpoint, ConstraintRequired)
+		} else if _, err := ParseEndpoint(c.Endpoint); err != nil {
+			v.add("endpoint", c.Endpoint, err.Error())
+		}
+		if c.NumberOfConnections < 1 {
+			v.add("numberOfConnections", c.NumberOfConnections, ConstraintPositive)
+		}
+	}
+	v.level("level", c.Level)
+	v.level("overflowChannelLoggingLevel", c.OverflowChannelLoggingLevel)
+	v.level("hipriLoggingLevel", c.HipriLoggingLevel)
+	v.nonNegative("numberOfHiPriConnections", int64(c.NumberOfHiPriConnections))
+	v.nonNegative("numberOfBackupConnections", int64(c.NumberOfBackupConnections))
+	v.nonNegative("numberOfHiPriBackupConnections", int64(c.NumberOfHiPriBackupConnections))
+	v.nonNegative("connectionResetInterval", int64(c.ConnectionResetInterval))
+	v.nonNegative("channelSize", int64(c.ChannelSize))
+	v.nonNegative("overflowChannelSize", int64(c.OverflowChannelSize))
+	v.nonNegative("hipriChannelSize", int64(c.HipriChannelSize))
+	v.nonNegative("channelMaxBytes", c.ChannelMaxBytes)
+	if c.ChannelOverflow != "" {
+		v.oneOf("channelOverflow", c.ChannelOverflow, QueueOverflowReject, QueueOverflowDropOldest, QueueOverflowDropLeastSevere)
+	}
+	v.nonNegative("targetMessageBatchSize", int64(c.TargetMessageBatchSize))
+	v.nonNegative("sendBatchLogsInterval", int64(c.SendBatchLogsInterval))
+	v.nonNegative("healthCheckInterval", int64(c.HealthCheckInterval))
+	v.nonNegative("healthCheckFailureThreshold", int64(c.HealthCheckFailureThreshold))
+	v.nonNegative("healthCheckPayloadSize", int64(c.HealthCheckPayloadSize))
+	v.nonNegative("requestTrackingTimout", int64(c.RequestTrackingTimout))
+	v.nonNegative("connectionShutdownTimout", int64(c.ConnectionShutdownTimout))
+	v.nonNegative("maxContextBytes", int64(c.MaxContextBytes))
+	v.nonNegative("maxContextKeys", int64(c.MaxContextKeys))
+	v.nonNegative("maxMessageBytes", int64(c.MaxMessageBytes))
+	v.nonNegative("serializerWorkers", int64(c.SerializerWorkers))
+	if c.MessageTruncation != "" {
+		v.oneOf("messageTruncation", c.MessageTruncation, MessageTruncationHead, MessageTruncationTail)
+	}
+	validateLevelOverrides(v, c.LevelOverrides)
+	for i, class := range c.DrainOrder {
+		v.oneOf(fmt.Sprintf("drainOrder[%d]", i), string(class), drainClassNames()...)
+	}
+	if c.OverflowEncryption != nil {
+		v.nest("overflowEncryption", c.OverflowEncryption.Validate())
+	}
+	if c.IDGenerator != nil {
+		v.nest("idGenerator", c.IDGenerator.Validate())
+	}
+	if c.RecoveryPolicy != nil {
+		v.nest("recoveryPolicy", c.RecoveryPolicy.Validate())
+	}
+	if c.ChannelScheduler != nil {
+		v.nest("channelScheduler", c.ChannelScheduler.Validate())
+	}
+	if c.HTTPFallback != nil {
+		v.nest("httpFallback", c.HTTPFallback.Validate())
+	}
+	if c.Sampling != nil {
+		v.nest("sampling", c.Sampling.Validate())
+	}
+	if c.Capture != nil {
+		v.nest("capture", c.Capture.Validate())
+	}
+	if c.QUIC != nil {
+		v.nest("quic", c.QUIC.Validate())
+	}
+	if c.AdaptiveBatching != nil {
+		v.nest("adaptiveBatching", c.AdaptiveBatching.Validate())
+	}
+	if c.DeliverySLO != nil {
+		v.nest("deliverySLO", c.DeliverySLO.Validate())
+	}
+	if c.GroupLifetime != nil {
+		v.nest("groupLifetime", c.GroupLifetime.Validate())
+	}
+	if c.CircuitBreaker != nil {
+		v.nest("circuitBreaker", c.CircuitBreaker.Validate())
+	}
+	if c.FieldEncryption != nil {
+		v.nest("fieldEncryption", c.FieldEncryption.Validate())
+	}
+	if c.FlushAlignment != nil {
+		v.nest("flushAlignment", c.FlushAlignment.Validate())
+	}
+	if c.MemoryBudget != nil {
+		v.nest("memoryBudget", c.MemoryBudget.Validate())
+	}
+	if c.BackupActivation != nil {
+		v.nest("backupActivation", c.BackupActivation.Validate())
+	}
+	if c.FaultInjection != nil {
+		v.nest("faultInjection", c.FaultInjection.Validate())
+	}
+	if c.Retention != nil {
+		v.nest("retention", c.Retention.Validate())
+	}
+	if c.Warmup != nil {
+		v.nest("warmup", c.Warmup.Validate())
+	}
+	if c.Preemption != nil {
+		v.nest("preemption", c.Preemption.Validate())
+	}
+	if c.Outbox != nil {
+		v.nest("outbox", c.Outbox.Validate())
+	}
+	if c.Console != nil {
+		v.nest("console", c.Console.Validate())
+	}
+	if c.ConnectionStateCache != nil {
+		v.nest("connectionStateCache", c.ConnectionStateCache.Validate())
+	}
+	if c.EndpointSelection != nil {
+		v.nest("endpointSelection", c.EndpointSelection.Validate())
+	}
+	if c.UsageProfile != nil {
+		v.nest("usageProfile", c.UsageProfile.Validate())
+	}
+	if c.AccessLog != nil {
+		v.nest("accessLog", c.AccessLog.Validate())
+	}
+	if c.Hedging != nil {
+		v.nest("hedging", c.Hedging.Validate())
+	}
+	v.uniqueNames("processors", c.Processors, nil)
+	return v.errs
+}
+
+// Validate checks the server configs, returning every invalid field.
+func (c *ServerConfigs) Validate() []*ValidationError {
+	v := &validator{}
+	if c.ServicePort < 1 || c.ServicePort > 65535 {
+		v.add("ServicePort", c.ServicePort, "must be in [1, 65535]")
+	}
+	v.nonNegative("ShutdownTimeout", int64(c.ShutdownTimeout))
+	v.nonNegative("ReadTimeout", int64(c.ReadTimeout))
+	v.nonNegative("WriteTimeout", int64(c.WriteTimeout))
+	v.nonNegative("ConnectionTombstoneRetention", int64(c.ConnectionTombstoneRetention))
+	if c.Logging != nil {
+		v.nest("Logging", c.Logging.Validate())
+	}
+	if c.IDGenerator != nil {
+		v.nest("IDGenerator", c.IDGenerator.Validate())
+	}
+	if c.OpenIdempotency != nil {
+		v.nest("OpenIdempotency", c.OpenIdempotency.Validate())
+	}
+	if c.UpstreamForwarding != nil {
+		v.nest("UpstreamForwarding", c.UpstreamForwarding.Validate())
+	}
+	v.uniqueNames("Middleware", c.Middleware, nil)
+	return v.errs
+}
+
+// Validate checks the server logging configs, returning every invalid field.
+func (c *ServerLoggingConfigs) Validate() []*ValidationError {
+	v := &validator{}
+	if c.DeliveryMethod > DeliveryMethodRoundRobin {
+		v.add("DeliveryMethod", c.DeliveryMethod, "must be one of \"DeliveryMethod*\"")
+	}
+	names := make(map[string]bool, len(c.Configs))
+	for i, cfg := range c.Configs {
+		field := fmt.Sprintf("Configs[%d]", i)
+		if cfg == nil {
+			v.add(field, nil, ConstraintRequired)
+			continue
+		}
+		key := cfg.Group + "/" + cfg.Name
+		if names[key] {
+			v.add(field+".Name", cfg.Name, "must be unique within its group")
+		}
+		names[key] = true
+		v.nest(field, cfg.Validate())
+	}
+	if c.UnknownLogTypes != "" {
+		v.oneOf("UnknownLogTypes", c.UnknownLogTypes, UnknownLogTypesReject, UnknownLogTypesPassThrough)
+	}
+	if c.DedupWindow != nil {
+		v.nest("DedupWindow", c.DedupWindow.Validate())
+	}
+	if c.CorrelationDedup != nil {
+		v.nest("CorrelationDedup", c.CorrelationDedup.Validate())
+	}
+	return v.errs
+}
+
+// Validate checks the server logging config, returning every invalid field.
+func (c *ServerLoggingConfig) Validate() []*ValidationError {
+	v := &validator{}
+	if c.Name == "" {
+		v.add("Name", c.Name, ConstraintRequired)
+	}
+	if c.AuthMode != "" {
+		v.oneOf("AuthMode", c.AuthMode, AuthModeCredentialsFile, AuthModeApplicationDefault)
+	}
+	if c.Output != "" {
+		v.oneOf("Output", c.Output, knownOutputs()...)
+	}
+	if c.EffectiveOutput() == OutputCloudLogging && c.EffectiveAuthMode() == AuthModeCredentialsFile && c.CredentialsFilePath == "" {
+		v.add("CredentialsFilePath", c.CredentialsFilePath, ConstraintRequired)
+	}
+	v.level("Level", c.Level)
+	v.nonNegative("NumberOfWorkers", int64(c.NumberOfWorkers))
+	v.nonNegative("MessagesChannelSize", int64(c.MessagesChannelSize))
+	v.nonNegative("ShutdownTimeout", int64(c.ShutdownTimeout))
+	for level := range c.LevelMapping {
+		v.level(fmt.Sprintf("LevelMapping[%d]", level), level)
+	}
+	if c.Bulkhead != nil {
+		v.nest("Bulkhead", c.Bulkhead.Validate())
+	}
+	if c.Partitioning != nil {
+		v.nest("Partitioning", c.Partitioning.Validate())
+	}
+	if c.Transform != nil {
+		v.nest("Transform", c.Transform.Validate())
+	}
+	if c.AuditEncryption != nil {
+		v.nest("AuditEncryption", c.AuditEncryption.Validate())
+	}
+	if c.Kafka != nil {
+		v.nest("Kafka", c.Kafka.Validate())
+	} else if c.EffectiveOutput() == OutputKafka {
+		v.add("Kafka", c.Kafka, ConstraintRequired)
+	}
+	if c.KafkaMapping != nil {
+		v.nest("KafkaMapping", c.KafkaMapping.Validate())
+	}
+	if c.Delivery != nil {
+		v.nest("Delivery", c.Delivery.Validate())
+	}
+	for i, tier := range c.Tiers {
+		v.oneOf(fmt.Sprintf("Tiers[%d]", i), tier, UsageTierCritical, UsageTierStandard, UsageTierBestEffort)
+	}
+	return v.errs
+}
+
+func drainClassNames() []string {
+	names := make([]string, len(DefaultDrainOrder))
+	for i, class := range DefaultDrainOrder {
+		names[i] = string(class)
+	}
+	return names
+}
@@ -0,0 +1,128 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+// ViewLevel represents how much of the connection responses a caller may see.
+type ViewLevel string
+
+const (
+	// ViewLevelOperator sees the full responses.
+	ViewLevelOperator = ViewLevel("operator")
+	// ViewLevelReadOnly sees the responses without credential paths and common labels.
+	ViewLevelReadOnly = ViewLevel("readonly")
+	// ViewLevelPublic sees the connection identity and status only, without client configs, errors or stats.
+	ViewLevelPublic = ViewLevel("public")
+)
+
+var viewLevelRanks = map[ViewLevel]int{ViewLevelPublic: 0, ViewLevelReadOnly: 1, ViewLevelOperator: 2}
+
+// redactedConfigFields holds the JSON names of the client config fields hidden from "ViewLevelReadOnly" callers.
+var redactedConfigFields = map[string]bool{
+	"CredentialsFilePath": true,
+	"commonLabels":        true,
+	"overflowEncryption":  true,
+	"fieldEncryption":     true,
+	"accessLog":           true,
+}
+
+// Valid returns true if the level is one of "ViewLevel*"; false otherwise.
+func (l ViewLevel) Valid() bool {
+	_, ok := viewLevelRanks[l]
+	return ok
+}
+
+// Cap returns the level, lowered to max if it is higher, e.g. to cap the level a caller requests
+// to the one its role grants. Unknown levels are treated as "ViewLevelPublic".
+func (l ViewLevel) Cap(max ViewLevel) ViewLevel {
+	if !l.Valid() {
+		l = ViewLevelPublic
+	}
+	if !max.Valid() {
+		max = ViewLevelPublic
+	}
+	if viewLevelRanks[l] > viewLevelRanks[max] {
+		return max
+	}
+	return l
+}
+
+// Redacted returns a copy of the config without credential paths, encryption and IP hash key
+// references and common labels. The original config is not modified.
+func (c *ClientConfig) Redacted() *ClientConfig {
+	r := *c
+	r.CredentialsFilePath = ""
+	r.CommonLabels = nil
+	if c.AccessLog != nil {
+		a := *c.AccessLog
+		a.IPHashKeyReference = ""
+		r.AccessLog = &a
+	}
+	if c.OverflowEncryption != nil {
+		e := *c.OverflowEncryption
+		e.KeyReference = ""
+		r.OverflowEncryption = &e
+	}
+	if c.FieldEncryption != nil {
+		e := *c.FieldEncryption
+		e.KeyReference = ""
+		r.FieldEncryption = &e
+	}
+	return &r
+}
+
+// View returns the response as seen at the given level, with its ETag recomputed for the shaped
+// content. The original response is returned as is to "ViewLevelOperator" callers and is never modified.
+func (r *GetConnectionResponse) View(level ViewLevel) *GetConnectionResponse {
+	level = level.Cap(ViewLevelOperator)
+	if level == ViewLevelOperator {
+		return r
+	}
+	v := *r
+	if level == ViewLevelPublic {
+		v.StreamingEndpoint = ""
+		v.ClientConfigs = nil
+		v.RecentErrors = nil
+		v.ConfigReport = nil
+	} else {
+		if r.ClientConfigs != nil {
+			v.ClientConfigs = r.ClientConfigs.Redacted()
+		}
+		if r.ConfigReport != nil {
+			report := *r.ConfigReport
+			report.Differences = nil
+			for _, d := range r.ConfigReport.Differences {
+				if !redactedConfigFields[d.Field] {
+					report.Differences = append(report.Differences, d)
+				}
+			}
+			v.ConfigReport = &report
+		}
+	}
+	if r.ETag != "" {
+		v.ETag, _ = ComputeETag(&v)
+	}
+	return &v
+}
+
+// View returns the response as seen at the given level. "ViewLevelPublic" callers don't see the
+// connection stats. The original response is never modified.
+func (r *ListConnectionResponse) View(level ViewLevel) *ListConnectionResponse {
+	if level.Cap(ViewLevelOperator) != ViewLevelPublic {
+		return r
+	}
+	v := *r
+	v.Stats = nil
+	return &v
+}
@@ -0,0 +1,186 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"crypto/tls"
+	"sync"
+	"time"
+)
+
+const (
+	// ReadinessCold represents a client that hasn't started establishing connections.
+	ReadinessCold = byte(0)
+	// ReadinessWarming represents a client establishing its warm-up connections. Logs are buffered.
+	ReadinessWarming = byte(1)
+	// ReadinessReady represents a client with every warm-up connection established.
+	ReadinessReady = byte(2)
+	// ReadinessDegraded represents a client whose warm-up timed out with connections missing. Logs are
+	// sent over the established connections, if any.
+	ReadinessDegraded = byte(3)
+)
+
+// DefaultWarmupSessionCacheSize is the TLS session cache size used when the warm-up config doesn't set one.
+const DefaultWarmupSessionCacheSize = 64
+
+// WarmupConfig holds the configuration of the client connection warm-up, establishing connections
+// before the client reports ready so the first logs after app start aren't lost to connection latency.
+// Connections: Number of connections established before the client is ready. Defaults to "NumberOfConnections".
+// HiPriConnections: Number of high priority connections established before the client is ready. Defaults to "NumberOfHiPriConnections".
+// Timeout: Time after which the client stops waiting and becomes degraded. Zero waits for every connection.
+// SessionCacheSize: Number of TLS sessions kept so reconnections resume their session. Defaults to "DefaultWarmupSessionCacheSize".
+type WarmupConfig struct {
+	Connections      int           `json:"connections"`
+	HiPriConnections int           `json:"hipriConnections"`
+	Timeout          time.Duration `json:"timeout"`
+	SessionCacheSize int           `json:"sessionCacheSize"`
+}
+
+// Validate checks the warm-up config, returning every invalid field.
+func (c *WarmupConfig) Validate() []*ValidationError {
+	v := &validator{}
+	v.nonNegative("connections", int64(c.Connections))
+	v.nonNegative("hipriConnections", int64(c.HiPriConnections))
+	v.nonNegative("timeout", int64(c.Timeout))
+	v.nonNegative("sessionCacheSize", int64(c.SessionCacheSize))
+	return v.errs
+}
+
+// TLSConfig returns a copy of the TLS config sharing a session cache across every connection, so
+// connections opened after the first one resume its session instead of a full handshake.
+func (c *WarmupConfig) TLSConfig(base *tls.Config) *tls.Config {
+	var cfg *tls.Config
+	if base != nil {
+		cfg = base.Clone()
+	} else {
+		cfg = &tls.Config{}
+	}
+	if cfg.ClientSessionCache == nil {
+		size := c.SessionCacheSize
+		if size <= 0 {
+			size = DefaultWarmupSessionCacheSize
+		}
+		cfg.ClientSessionCache = tls.NewLRUClientSessionCache(size)
+	}
+	return cfg
+}
+
+// NewWarmup returns the warm-up readiness of the client, resolving the connection counts the
+// warm-up config leaves to the client config. Returns nil if the client has no warm-up config.
+func (c *ClientConfig) NewWarmup() *Warmup {
+	if c.Warmup == nil {
+		return nil
+	}
+	cfg := *c.Warmup
+	if cfg.Connections == 0 {
+		cfg.Connections = c.NumberOfConnections
+	}
+	if cfg.HiPriConnections == 0 {
+		cfg.HiPriConnections = c.NumberOfHiPriConnections
+	}
+	return NewWarmup(&cfg)
+}
+
+// WarmupState holds the readiness of the client.
+// State: One of "Readiness*".
+// Connections: Number of established connections.
+// HiPriConnections: Number of established high priority connections.
+// StartedAt: Time the warm-up started.
+// ReadyAt: Time the client became ready or degraded. Zero while cold or warming.
+type WarmupState struct {
+	State            byte
+	Connections      int
+	HiPriConnections int
+	StartedAt        time.Time
+	ReadyAt          time.Time
+}
+
+// Warmup tracks the connections established during the client warm-up. Safe for concurrent use.
+type Warmup struct {
+	cfg   WarmupConfig
+	mu    sync.Mutex
+	state WarmupState
+	ready chan struct{}
+}
+
+// NewWarmup returns a cold warm-up.
+func NewWarmup(cfg *WarmupConfig) *Warmup {
+	return &Warmup{cfg: *cfg, ready: make(chan struct{})}
+}
+
+// Start marks the warm-up as started. The client is ready at once if it needs no connection.
+func (w *Warmup) Start(now time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.state.State != ReadinessCold {
+		return
+	}
+	w.state.State = ReadinessWarming
+	w.state.StartedAt = now
+	w.update(now)
+}
+
+// ConnectionEstablished records a connection of the given priority as established.
+func (w *Warmup) ConnectionEstablished(hipri bool, now time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if hipri {
+		w.state.HiPriConnections++
+	} else {
+		w.state.Connections++
+	}
+	w.update(now)
+}
+
+// ConnectionLost records an established connection of the given priority as lost. A ready client
+// stays ready: reconnections are handled by the connection reset logic, not the warm-up.
+func (w *Warmup) ConnectionLost(hipri bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if hipri && w.state.HiPriConnections > 0 {
+		w.state.HiPriConnections--
+	} else if !hipri && w.state.Connections > 0 {
+		w.state.Connections--
+	}
+}
+
+// State returns the readiness of the client, degrading a warm-up that outlived its timeout.
+func (w *Warmup) State(now time.Time) WarmupState {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.update(now)
+	return w.state
+}
+
+// Ready returns a channel closed once the client is ready or degraded.
+func (w *Warmup) Ready() <-chan struct{} {
+	return w.ready
+}
+
+func (w *Warmup) update(now time.Time) {
+	if w.state.State != ReadinessWarming {
+		return
+	}
+	switch {
+	case w.state.Connections >= w.cfg.Connections && w.state.HiPriConnections >= w.cfg.HiPriConnections:
+		w.state.State = ReadinessReady
+	case w.cfg.Timeout > 0 && now.Sub(w.state.StartedAt) >= w.cfg.Timeout:
+		w.state.State = ReadinessDegraded
+	default:
+		return
+	}
+	w.state.ReadyAt = now
+	close(w.ready)
+}
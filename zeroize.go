@@ -0,0 +1,61 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY Type, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+// zeroizeBytes overwrites b with zeros.
+func zeroizeBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// Zeroize overwrites the payload bytes so no residual log data stays in memory once the buffer is
+// returned to a pool. The payload is left with its length, ready to be reused.
+func (p *TransportPackage) Zeroize() {
+	zeroizeBytes(p.Payload)
+	if c, ok := p.Data.(*Chunk); ok {
+		zeroizeBytes(c.Data)
+	}
+	p.Data = nil
+}
+
+// Zeroize overwrites the entry payload and nonce bytes before the entry buffers are reused.
+func (e *OverflowEntry) Zeroize() {
+	zeroizeBytes(e.Payload)
+	zeroizeBytes(e.Nonce)
+}
+
+// IsSensitive returns true if the package carries high priority or audit logs; false otherwise.
+func (p *TransportPackage) IsSensitive() bool {
+	if p.Type == TransportPackageTypeHiPriLog {
+		return true
+	}
+	switch d := p.Data.(type) {
+	case *LogData:
+		return d.Type == LogTypeAudit
+	case *LogGroup:
+		for _, ld := range d.Logs {
+			if ld != nil && ld.Type == LogTypeAudit {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ShouldZeroize returns true if the package buffers must be zeroized before reuse under the given config.
+func (c *ClientConfig) ShouldZeroize(p *TransportPackage) bool {
+	return c.ZeroizeSensitiveBuffers && p.IsSensitive()
+}